@@ -20,4 +20,15 @@ const (
 	MigrateEntryKey  string = "consul.hashicorp.com/migrate-entry"
 	MigrateEntryTrue string = "true"
 	SourceValue      string = "kubernetes"
+
+	// MetaReservedPrefix is the prefix of the config entry Meta keys that
+	// are reserved for the controller, e.g. DatacenterKey.
+	MetaReservedPrefix string = "consul.hashicorp.com/"
+)
+
+// Limits Consul places on the Meta of config entries.
+const (
+	MetaMaxKeyPairs    = 64
+	MetaKeyMaxLength   = 128
+	MetaValueMaxLength = 512
 )
@@ -51,6 +51,9 @@ type ConfigEntryResource interface {
 	// MatchesConsul returns true if the resource has the same fields as the Consul
 	// config entry.
 	MatchesConsul(candidate api.ConfigEntry) bool
+	// ConsulMeta returns the metadata set on the resource that is written
+	// to the Meta of the Consul config entry alongside the controller's keys.
+	ConsulMeta() map[string]string
 	// GetObjectKind should be implemented by the generated code.
 	GetObjectKind() schema.ObjectKind
 	// DeepCopyObject should be implemented by the generated code.
@@ -5,13 +5,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strings"
 
 	"github.com/go-logr/logr"
+	"github.com/hashicorp/consul-k8s/namespaces"
+	capi "github.com/hashicorp/consul/api"
 	"gomodules.xyz/jsonpatch/v2"
 	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
+// consulNameRegex matches the config entry names that Consul accepts.
+var consulNameRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._-]*[a-zA-Z0-9])?$`)
+
 // ConfigEntryLister is implemented by CRD-specific webhooks.
 type ConfigEntryLister interface {
 	// List returns all resources of this type across all namespaces in a
@@ -19,6 +27,111 @@ type ConfigEntryLister interface {
 	List(ctx context.Context) ([]ConfigEntryResource, error)
 }
 
+// ConsulValidation configures the validation of config entries against the
+// config entries that already exist in Consul. The validation is skipped if
+// Client is nil.
+type ConsulValidation struct {
+	// Client is used to look up the config entries in Consul.
+	Client *capi.Client
+	// DatacenterName is the name of the Consul datacenter the controller
+	// manages config entries in. Config entries with this datacenter in
+	// their metadata are managed by the controller and don't conflict.
+	DatacenterName string
+}
+
+// Validate denies the creation of cfgEntry if a config entry of the same
+// kind and name already exists in consulNamespace in Consul and isn't
+// managed by the controller, e.g. because it was created with the Consul
+// CLI or by the controller of another datacenter. The controller would
+// refuse to sync such a resource so it is denied up front unless it has the
+// migrate-entry annotation. It returns false and the response to deny the
+// request with if the request is denied.
+func (v ConsulValidation) Validate(cfgEntry ConfigEntryResource, consulNamespace string) (admission.Response, bool) {
+	if v.Client == nil {
+		return admission.Response{}, true
+	}
+	if cfgEntry.GetObjectMeta().Annotations[MigrateEntryKey] == MigrateEntryTrue {
+		return admission.Response{}, true
+	}
+	entry, _, err := v.Client.ConfigEntries().Get(cfgEntry.ConsulKind(), cfgEntry.ConsulName(), &capi.QueryOptions{
+		Namespace: consulNamespace,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "404") {
+			return admission.Response{}, true
+		}
+		return RecordDenied(cfgEntry.KubeKind(), DenialError, http.StatusInternalServerError,
+			fmt.Errorf("reading config entry from Consul: %w", err)), false
+	}
+	sourceDatacenter := entry.GetMeta()[DatacenterKey]
+	if sourceDatacenter == v.DatacenterName {
+		return admission.Response{}, true
+	}
+	owner := "it was created outside of Kubernetes"
+	if sourceDatacenter != "" {
+		owner = fmt.Sprintf("it is managed in datacenter %q", sourceDatacenter)
+	}
+	return RecordDenied(cfgEntry.KubeKind(), DenialConsulConflict, http.StatusBadRequest,
+		fmt.Errorf("%s config entry with name %q already exists in Consul and %s – set the %q annotation to %q to migrate it",
+			cfgEntry.ConsulKind(), cfgEntry.ConsulName(), owner, MigrateEntryKey, MigrateEntryTrue)), false
+}
+
+// ValidateConsulName denies cfgEntry if the name of its config entry isn't
+// a valid Consul name. Consul would reject the config entry so it is denied
+// up front rather than failing to sync later. The wildcard name is allowed
+// since some config entries, e.g. service-intentions, support it. It returns
+// false and the response to deny the request with if the request is denied.
+func ValidateConsulName(cfgEntry ConfigEntryResource) (admission.Response, bool) {
+	name := cfgEntry.ConsulName()
+	if name == WildcardNamespace || consulNameRegex.MatchString(name) {
+		return admission.Response{}, true
+	}
+	return RecordDenied(cfgEntry.KubeKind(), DenialValidation, http.StatusBadRequest,
+		fmt.Errorf("%s config entry name %q is invalid – names must start and end with an alphanumeric character and may only contain alphanumeric characters, '-', '_' and '.'",
+			cfgEntry.ConsulKind(), name)), false
+}
+
+// ValidateMeta denies cfgEntry if its Meta uses the keys reserved for the
+// controller or exceeds the limits Consul places on the Meta of config
+// entries. Consul would reject the config entry, or the controller would
+// overwrite the keys, so it is denied up front. It returns false and the
+// response to deny the request with if the request is denied.
+func ValidateMeta(cfgEntry ConfigEntryResource) (admission.Response, bool) {
+	var allErrs field.ErrorList
+	path := field.NewPath("spec").Child("meta")
+	userMeta := cfgEntry.ConsulMeta()
+	// The controller writes its own keys to the Meta too.
+	maxKeyPairs := MetaMaxKeyPairs - len(reservedMetaKeys)
+	if len(userMeta) > maxKeyPairs {
+		allErrs = append(allErrs, field.TooMany(path, len(userMeta), maxKeyPairs))
+	}
+	for k, v := range userMeta {
+		if strings.HasPrefix(k, MetaReservedPrefix) || reservedMetaKeys[k] {
+			allErrs = append(allErrs, field.Invalid(path.Key(k), k,
+				fmt.Sprintf("key is reserved for the controller, keys may not start with %q", MetaReservedPrefix)))
+		}
+		if len(k) > MetaKeyMaxLength {
+			allErrs = append(allErrs, field.Invalid(path.Key(k), k,
+				fmt.Sprintf("key must be no more than %d characters", MetaKeyMaxLength)))
+		}
+		if len(v) > MetaValueMaxLength {
+			allErrs = append(allErrs, field.TooLong(path.Key(k), v, MetaValueMaxLength))
+		}
+	}
+	if len(allErrs) == 0 {
+		return admission.Response{}, true
+	}
+	return RecordDenied(cfgEntry.KubeKind(), DenialValidation, http.StatusBadRequest,
+		fmt.Errorf("%s config entry meta is invalid: %s", cfgEntry.ConsulKind(), allErrs.ToAggregate())), false
+}
+
+// reservedMetaKeys are the Meta keys the controller writes to all config
+// entries.
+var reservedMetaKeys = map[string]bool{
+	SourceKey:     true,
+	DatacenterKey: true,
+}
+
 // ValidateConfigEntry validates cfgEntry. It is a generic method that
 // can be used by all CRD-specific validators.
 // Callers should pass themselves as validator and kind should be the custom
@@ -29,42 +142,70 @@ func ValidateConfigEntry(
 	logger logr.Logger,
 	configEntryLister ConfigEntryLister,
 	cfgEntry ConfigEntryResource,
+	consulValidation ConsulValidation,
 	enableConsulNamespaces bool,
 	nsMirroring bool,
 	consulDestinationNamespace string,
 	nsMirroringPrefix string) admission.Response {
 
+	kind := cfgEntry.KubeKind()
+	if resp, ok := ValidateConsulName(cfgEntry); !ok {
+		return resp
+	}
+	if resp, ok := ValidateMeta(cfgEntry); !ok {
+		return resp
+	}
 	defaultingPatches, err := DefaultingPatches(cfgEntry, enableConsulNamespaces, nsMirroring, consulDestinationNamespace, nsMirroringPrefix)
 	if err != nil {
-		return admission.Errored(http.StatusInternalServerError, err)
+		return RecordDenied(kind, DenialError, http.StatusInternalServerError, err)
 	}
 	// On create we need to validate that there isn't already a resource with
-	// the same name in a different namespace if we're need to mapping all Kube
-	// resources to a single Consul namespace. The only case where we're not
-	// mapping all kube resources to a single Consul namespace is when we
-	// are running Consul enterprise with namespace mirroring.
+	// the same name mapped to the same Consul namespace. Unless we're running
+	// Consul enterprise with namespace mirroring, all Kube resources are mapped
+	// to a single Consul namespace so their names must be unique across Kube
+	// namespaces. With mirroring, resources in different Kube namespaces are
+	// mapped to different Consul namespaces and may share a name.
 	singleConsulDestNS := !(enableConsulNamespaces && nsMirroring)
-	if req.Operation == v1beta1.Create && singleConsulDestNS {
+	if req.Operation == v1beta1.Create {
 		logger.Info("validate create", "name", cfgEntry.KubernetesName())
 
 		list, err := configEntryLister.List(ctx)
 		if err != nil {
-			return admission.Errored(http.StatusInternalServerError, err)
+			return RecordDenied(kind, DenialError, http.StatusInternalServerError, err)
 		}
+		consulNS := consulNamespace(cfgEntry, enableConsulNamespaces, nsMirroring, consulDestinationNamespace, nsMirroringPrefix)
 		for _, item := range list {
-			if item.KubernetesName() == cfgEntry.KubernetesName() {
-				return admission.Errored(http.StatusBadRequest,
+			if item.KubernetesName() != cfgEntry.KubernetesName() ||
+				consulNamespace(item, enableConsulNamespaces, nsMirroring, consulDestinationNamespace, nsMirroringPrefix) != consulNS {
+				continue
+			}
+			if singleConsulDestNS {
+				return RecordDenied(kind, DenialNameConflict, http.StatusBadRequest,
 					fmt.Errorf("%s resource with name %q is already defined – all %s resources must have unique names across namespaces",
 						cfgEntry.KubeKind(),
 						cfgEntry.KubernetesName(),
 						cfgEntry.KubeKind()))
 			}
+			return RecordDenied(kind, DenialNameConflict, http.StatusBadRequest,
+				fmt.Errorf("%s resource with name %q is already defined – all %s resources mapped to Consul namespace %q must have unique names",
+					cfgEntry.KubeKind(),
+					cfgEntry.KubernetesName(),
+					cfgEntry.KubeKind(),
+					consulNS))
+		}
+		if resp, ok := consulValidation.Validate(cfgEntry, consulNS); !ok {
+			return resp
 		}
 	}
 	if err := cfgEntry.Validate(enableConsulNamespaces); err != nil {
-		return admission.Errored(http.StatusBadRequest, err)
+		return RecordDenied(kind, DenialValidation, http.StatusBadRequest, err)
 	}
-	return admission.Patched(fmt.Sprintf("valid %s request", cfgEntry.KubeKind()), defaultingPatches...)
+	resp := admission.Patched(fmt.Sprintf("valid %s request", cfgEntry.KubeKind()), defaultingPatches...)
+	if warnings := DeprecationWarnings(cfgEntry); len(warnings) > 0 {
+		logger.Info("deprecated fields set", "name", cfgEntry.KubernetesName(), "warnings", warnings)
+		resp = WithWarnings(resp, warnings)
+	}
+	return RecordAllowed(kind, resp)
 }
 
 // DefaultingPatches returns the patches needed to set fields to their
@@ -86,3 +227,20 @@ func DefaultingPatches(cfgEntry ConfigEntryResource, enableConsulNamespaces bool
 	}
 	return defaultingPatches, nil
 }
+
+// consulNamespace returns the Consul namespace that cfgEntry is written to.
+// It mirrors how the controller determines the namespace.
+func consulNamespace(cfgEntry ConfigEntryResource, enableConsulNamespaces bool, nsMirroring bool, consulDestinationNamespace string, nsMirroringPrefix string) string {
+	// Some config entries, e.g. ServiceIntentions, have the namespace set on
+	// them by the defaulting.
+	if ns := cfgEntry.ToConsul("").GetNamespace(); ns != "" {
+		return ns
+	}
+	if !cfgEntry.ConsulGlobalResource() && cfgEntry.ConsulMirroringNS() != WildcardNamespace {
+		return namespaces.ConsulNamespace(cfgEntry.ConsulMirroringNS(), enableConsulNamespaces, consulDestinationNamespace, nsMirroring, nsMirroringPrefix)
+	}
+	if enableConsulNamespaces {
+		return cfgEntry.ConsulMirroringNS()
+	}
+	return ""
+}
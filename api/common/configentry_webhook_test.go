@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
 
 	logrtest "github.com/go-logr/logr/testing"
 	capi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/testutil"
 	"github.com/stretchr/testify/require"
 	"gomodules.xyz/jsonpatch/v2"
 	"k8s.io/api/admission/v1beta1"
@@ -40,6 +43,16 @@ func TestValidateConfigEntry(t *testing.T) {
 			},
 			expAllow: true,
 		},
+		"invalid Consul name": {
+			existingResources: nil,
+			newResource: &mockConfigEntry{
+				MockName:      "foo/bar",
+				MockNamespace: otherNS,
+				Valid:         true,
+			},
+			expAllow:      false,
+			expErrMessage: "mock-kind config entry name \"foo/bar\" is invalid – names must start and end with an alphanumeric character and may only contain alphanumeric characters, '-', '_' and '.'",
+		},
 		"no duplicates, invalid": {
 			existingResources: nil,
 			newResource: &mockConfigEntry{
@@ -50,6 +63,38 @@ func TestValidateConfigEntry(t *testing.T) {
 			expAllow:      false,
 			expErrMessage: "invalid",
 		},
+		"valid meta": {
+			existingResources: nil,
+			newResource: &mockConfigEntry{
+				MockName:      "foo",
+				MockNamespace: otherNS,
+				MockMeta:      map[string]string{"team": "payments", "example.com/owner": "alice"},
+				Valid:         true,
+			},
+			expAllow: true,
+		},
+		"reserved meta key": {
+			existingResources: nil,
+			newResource: &mockConfigEntry{
+				MockName:      "foo",
+				MockNamespace: otherNS,
+				MockMeta:      map[string]string{"consul.hashicorp.com/managed-by": "me"},
+				Valid:         true,
+			},
+			expAllow:      false,
+			expErrMessage: "mock-kind config entry meta is invalid: spec.meta[consul.hashicorp.com/managed-by]: Invalid value: \"consul.hashicorp.com/managed-by\": key is reserved for the controller, keys may not start with \"consul.hashicorp.com/\"",
+		},
+		"meta value too long": {
+			existingResources: nil,
+			newResource: &mockConfigEntry{
+				MockName:      "foo",
+				MockNamespace: otherNS,
+				MockMeta:      map[string]string{"team": strings.Repeat("a", MetaValueMaxLength+1)},
+				Valid:         true,
+			},
+			expAllow:      false,
+			expErrMessage: "mock-kind config entry meta is invalid: spec.meta[team]: Too long: must have at most 512 bytes",
+		},
 		"duplicate name": {
 			existingResources: []ConfigEntryResource{&mockConfigEntry{
 				MockName:      "foo",
@@ -91,6 +136,53 @@ func TestValidateConfigEntry(t *testing.T) {
 			nsMirroring:      true,
 			expAllow:         true,
 		},
+		"duplicate name, namespaces enabled, mirroring enabled, same Consul namespace": {
+			existingResources: []ConfigEntryResource{&mockConfigEntry{
+				MockName:      "foo",
+				MockNamespace: "bar",
+			}},
+			newResource: &mockConfigEntry{
+				MockName:      "foo",
+				MockNamespace: otherNS,
+				Valid:         true,
+			},
+			enableNamespaces: true,
+			nsMirroring:      true,
+			expAllow:         false,
+			// The mock defaults its namespace to "bar".
+			expErrMessage: "mockkind resource with name \"foo\" is already defined – all mockkind resources mapped to Consul namespace \"bar\" must have unique names",
+		},
+		"duplicate name, namespaces enabled, mirroring enabled with prefix": {
+			existingResources: []ConfigEntryResource{&mockConfigEntry{
+				MockName:      "foo",
+				MockNamespace: "bar",
+			}},
+			newResource: &mockConfigEntry{
+				MockName:      "foo",
+				MockNamespace: otherNS,
+				Valid:         true,
+			},
+			enableNamespaces:  true,
+			nsMirroring:       true,
+			nsMirroringPrefix: "k8s-",
+			expAllow:          false,
+			expErrMessage:     "mockkind resource with name \"foo\" is already defined – all mockkind resources mapped to Consul namespace \"k8s-bar\" must have unique names",
+		},
+		"duplicate name, namespaces enabled, destination namespace": {
+			existingResources: []ConfigEntryResource{&mockConfigEntry{
+				MockName:      "foo",
+				MockNamespace: "default",
+			}},
+			newResource: &mockConfigEntry{
+				MockName:      "foo",
+				MockNamespace: otherNS,
+				Valid:         true,
+			},
+			enableNamespaces:    true,
+			consulDestinationNS: "dest",
+			expAllow:            false,
+			expErrMessage:       "mockkind resource with name \"foo\" is already defined – all mockkind resources must have unique names across namespaces",
+		},
 	}
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
@@ -114,6 +206,7 @@ func TestValidateConfigEntry(t *testing.T) {
 				logrtest.TestLogger{T: t},
 				lister,
 				c.newResource,
+				ConsulValidation{},
 				c.enableNamespaces,
 				c.nsMirroring,
 				c.consulDestinationNS,
@@ -126,6 +219,213 @@ func TestValidateConfigEntry(t *testing.T) {
 	}
 }
 
+func init() {
+	RegisterDeprecatedField("mockkind", DeprecatedField{
+		Path:        "spec.deprecated",
+		Replacement: "spec.replacement",
+		IsSet: func(cfgEntry ConfigEntryResource) bool {
+			return cfgEntry.(*mockConfigEntry).MockDeprecated
+		},
+	})
+}
+
+// Test that setting a deprecated field results in a warning but doesn't deny
+// the request.
+func TestValidateConfigEntry_DeprecationWarnings(t *testing.T) {
+	cases := map[string]struct {
+		deprecated  bool
+		expWarnings map[string]string
+	}{
+		"deprecated field not set": {
+			deprecated:  false,
+			expWarnings: nil,
+		},
+		"deprecated field set": {
+			deprecated: true,
+			expWarnings: map[string]string{
+				DeprecationWarningsAnnotation: "spec.deprecated is deprecated, use spec.replacement instead",
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			resource := &mockConfigEntry{
+				MockName:       "foo",
+				MockNamespace:  "default",
+				MockDeprecated: c.deprecated,
+				Valid:          true,
+			}
+			marshalledRequestObject, err := json.Marshal(resource)
+			require.NoError(t, err)
+
+			response := ValidateConfigEntry(context.Background(), admission.Request{
+				AdmissionRequest: v1beta1.AdmissionRequest{
+					Name:      resource.KubernetesName(),
+					Namespace: "default",
+					Operation: v1beta1.Update,
+					Object: runtime.RawExtension{
+						Raw: marshalledRequestObject,
+					},
+				},
+			},
+				logrtest.TestLogger{T: t},
+				&mockConfigEntryLister{},
+				resource,
+				ConsulValidation{},
+				false,
+				false,
+				"",
+				"")
+			require.True(t, response.Allowed)
+			require.Equal(t, c.expWarnings, response.AuditAnnotations)
+		})
+	}
+}
+
+// Test that with Consul validation enabled, resources whose config entries
+// already exist in Consul but aren't managed by this datacenter are denied.
+func TestValidateConfigEntry_ConsulValidation(t *testing.T) {
+	consul, err := testutil.NewTestServerConfigT(t, nil)
+	require.NoError(t, err)
+	defer consul.Stop()
+	consul.WaitForLeader(t)
+	consulClient, err := capi.NewClient(&capi.Config{Address: consul.HTTPAddr})
+	require.NoError(t, err)
+
+	for name, meta := range map[string]map[string]string{
+		"created-in-consul": nil,
+		"other-dc":          {SourceKey: SourceValue, DatacenterKey: "dc2"},
+		"this-dc":           {SourceKey: SourceValue, DatacenterKey: "dc1"},
+	} {
+		_, _, err := consulClient.ConfigEntries().Set(&capi.ServiceConfigEntry{
+			Kind: capi.ServiceDefaults,
+			Name: name,
+			Meta: meta,
+		}, nil)
+		require.NoError(t, err)
+	}
+
+	cases := map[string]struct {
+		name          string
+		annotations   map[string]string
+		disabled      bool
+		expAllow      bool
+		expErrMessage string
+	}{
+		"not in Consul": {
+			name:     "foo",
+			expAllow: true,
+		},
+		"created in Consul": {
+			name:          "created-in-consul",
+			expAllow:      false,
+			expErrMessage: `service-defaults config entry with name "created-in-consul" already exists in Consul and it was created outside of Kubernetes – set the "consul.hashicorp.com/migrate-entry" annotation to "true" to migrate it`,
+		},
+		"created in Consul, migrating": {
+			name:        "created-in-consul",
+			annotations: map[string]string{MigrateEntryKey: MigrateEntryTrue},
+			expAllow:    true,
+		},
+		"created in Consul, validation disabled": {
+			name:     "created-in-consul",
+			disabled: true,
+			expAllow: true,
+		},
+		"managed in another datacenter": {
+			name:          "other-dc",
+			expAllow:      false,
+			expErrMessage: `service-defaults config entry with name "other-dc" already exists in Consul and it is managed in datacenter "dc2" – set the "consul.hashicorp.com/migrate-entry" annotation to "true" to migrate it`,
+		},
+		"managed in this datacenter": {
+			name:     "this-dc",
+			expAllow: true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			newResource := &mockConfigEntry{
+				MockName:        c.name,
+				MockNamespace:   "default",
+				MockConsulKind:  capi.ServiceDefaults,
+				MockAnnotations: c.annotations,
+				Valid:           true,
+			}
+			marshalledRequestObject, err := json.Marshal(newResource)
+			require.NoError(t, err)
+			consulValidation := ConsulValidation{
+				Client:         consulClient,
+				DatacenterName: "dc1",
+			}
+			if c.disabled {
+				consulValidation = ConsulValidation{}
+			}
+
+			response := ValidateConfigEntry(context.Background(), admission.Request{
+				AdmissionRequest: v1beta1.AdmissionRequest{
+					Name:      newResource.KubernetesName(),
+					Namespace: "default",
+					Operation: v1beta1.Create,
+					Object: runtime.RawExtension{
+						Raw: marshalledRequestObject,
+					},
+				},
+			},
+				logrtest.TestLogger{T: t},
+				&mockConfigEntryLister{},
+				newResource,
+				consulValidation,
+				false,
+				false,
+				"",
+				"")
+			require.Equal(t, c.expAllow, response.Allowed)
+			if c.expErrMessage != "" {
+				require.Equal(t, c.expErrMessage, response.AdmissionResponse.Result.Message)
+			}
+		})
+	}
+}
+
+func TestValidateConsulName(t *testing.T) {
+	cases := map[string]bool{
+		"foo":         true,
+		"foo-bar":     true,
+		"foo_bar":     true,
+		"foo.bar":     true,
+		"Foo1":        true,
+		"1":           true,
+		"*":           true,
+		"":            false,
+		"-foo":        false,
+		"foo-":        false,
+		"foo/bar":     false,
+		"foo bar":     false,
+		"foo:bar":     false,
+		"foo*":        false,
+		".foo":        false,
+		"foo%20bar":   false,
+		"foo\nbar":    false,
+		"ns/foo-bar":  false,
+		"foo..bar":    true,
+		"foo.bar-baz": true,
+	}
+	for name, expAllow := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfgEntry := &mockConfigEntry{
+				MockName: name,
+				Valid:    true,
+			}
+			resp, ok := ValidateConsulName(cfgEntry)
+			require.Equal(t, expAllow, ok)
+			if !expAllow {
+				require.False(t, resp.Allowed)
+				require.Equal(t, fmt.Sprintf("mock-kind config entry name %q is invalid – names must start and end with an alphanumeric character and may only contain alphanumeric characters, '-', '_' and '.'", name),
+					resp.AdmissionResponse.Result.Message)
+			}
+		})
+	}
+}
+
 func TestDefaultingPatches(t *testing.T) {
 	cfgEntry := &mockConfigEntry{
 		MockName: "test",
@@ -154,9 +454,13 @@ func (in *mockConfigEntryLister) List(_ context.Context) ([]ConfigEntryResource,
 }
 
 type mockConfigEntry struct {
-	MockName      string
-	MockNamespace string
-	Valid         bool
+	MockName        string
+	MockNamespace   string
+	MockConsulKind  string
+	MockAnnotations map[string]string
+	MockDeprecated  bool
+	MockMeta        map[string]string
+	Valid           bool
 }
 
 func (in *mockConfigEntry) KubernetesName() string {
@@ -168,7 +472,7 @@ func (in *mockConfigEntry) ConsulMirroringNS() string {
 }
 
 func (in *mockConfigEntry) GetObjectMeta() metav1.ObjectMeta {
-	return metav1.ObjectMeta{}
+	return metav1.ObjectMeta{Annotations: in.MockAnnotations}
 }
 
 func (in *mockConfigEntry) GetObjectKind() schema.ObjectKind {
@@ -192,6 +496,9 @@ func (in *mockConfigEntry) Finalizers() []string {
 }
 
 func (in *mockConfigEntry) ConsulKind() string {
+	if in.MockConsulKind != "" {
+		return in.MockConsulKind
+	}
 	return "mock-kind"
 }
 
@@ -231,3 +538,7 @@ func (in *mockConfigEntry) DefaultNamespaceFields(consulNamespacesEnabled bool,
 func (in *mockConfigEntry) MatchesConsul(_ capi.ConfigEntry) bool {
 	return false
 }
+
+func (in *mockConfigEntry) ConsulMeta() map[string]string {
+	return in.MockMeta
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// DeprecationWarningsAnnotation is the key of the audit annotation of
+// allowed admission responses that lists the deprecated fields set on the
+// resource. The admission.v1beta1 API used by the webhooks doesn't support
+// warnings so they're surfaced as an audit annotation instead, i.e. they
+// aren't shown by kubectl and only appear in the audit logs of the API
+// server, and only if its audit policy logs the requests of the resource at
+// the Metadata level or above.
+const DeprecationWarningsAnnotation = "deprecation-warnings"
+
+// DeprecatedField is a deprecated field of a config entry resource. Setting
+// it doesn't deny the request but results in a warning.
+type DeprecatedField struct {
+	// Path is the path of the field, e.g. "spec.expose.checks".
+	Path string
+	// Replacement, if set, is the path of the field to use instead.
+	Replacement string
+	// IsSet returns true if the field is set on cfgEntry.
+	IsSet func(cfgEntry ConfigEntryResource) bool
+}
+
+// deprecatedFields are the registered deprecated fields keyed by the Kube
+// kind of their resources.
+var deprecatedFields = make(map[string][]DeprecatedField)
+
+// RegisterDeprecatedField registers field as a deprecated field of the
+// resources of Kube kind kind, e.g. "servicedefaults". It should be called
+// from an init function. Since the warnings only appear in the audit logs,
+// the doc comment of the field, i.e. its description in the CRD, should say
+// it's deprecated too.
+func RegisterDeprecatedField(kind string, field DeprecatedField) {
+	deprecatedFields[kind] = append(deprecatedFields[kind], field)
+}
+
+// DeprecationWarnings returns a warning for each deprecated field set on
+// cfgEntry, sorted by the fields' paths.
+func DeprecationWarnings(cfgEntry ConfigEntryResource) []string {
+	var warnings []string
+	for _, field := range deprecatedFields[cfgEntry.KubeKind()] {
+		if !field.IsSet(cfgEntry) {
+			continue
+		}
+		warning := fmt.Sprintf("%s is deprecated", field.Path)
+		if field.Replacement != "" {
+			warning += fmt.Sprintf(", use %s instead", field.Replacement)
+		}
+		warnings = append(warnings, warning)
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// WithWarnings adds warnings, e.g. the DeprecationWarnings of the resource,
+// to the allowed response resp and returns it.
+func WithWarnings(resp admission.Response, warnings []string) admission.Response {
+	if len(warnings) == 0 {
+		return resp
+	}
+	if resp.AuditAnnotations == nil {
+		resp.AuditAnnotations = make(map[string]string)
+	}
+	resp.AuditAnnotations[DeprecationWarningsAnnotation] = strings.Join(warnings, "; ")
+	return resp
+}
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Reasons for which the webhooks deny config entry resources.
+const (
+	// DenialNameConflict is the reason for denying a resource with the same
+	// name as an existing resource.
+	DenialNameConflict = "name-conflict"
+	// DenialConsulConflict is the reason for denying a resource whose config
+	// entry already exists in Consul but isn't managed by the controller.
+	DenialConsulConflict = "consul-conflict"
+	// DenialValidation is the reason for denying an invalid resource.
+	DenialValidation = "semantic-validation"
+	// DenialError is the reason for denying a resource because of an error
+	// while handling the request.
+	DenialError = "error"
+)
+
+var (
+	// admissionsTotal counts the admission requests handled by the webhooks.
+	admissionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "consul_k8s_webhook_admissions_total",
+		Help: "Number of config entry admission requests handled, labeled by kind and whether they were allowed.",
+	}, []string{"kind", "allowed"})
+	// denialsTotal counts the admission requests denied by the webhooks.
+	denialsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "consul_k8s_webhook_denials_total",
+		Help: "Number of config entry admission requests denied, labeled by kind and reason.",
+	}, []string{"kind", "reason"})
+)
+
+func init() {
+	// The controller-runtime registry is served on the controller manager's
+	// metrics endpoint.
+	metrics.Registry.MustRegister(admissionsTotal, denialsTotal)
+}
+
+// RecordAllowed records that a request for a resource of kind was allowed
+// and returns resp.
+func RecordAllowed(kind string, resp admission.Response) admission.Response {
+	admissionsTotal.WithLabelValues(kind, strconv.FormatBool(true)).Inc()
+	return resp
+}
+
+// RecordDenied records that a request for a resource of kind was denied for
+// reason and returns a response denying it with code and err.
+func RecordDenied(kind, reason string, code int32, err error) admission.Response {
+	admissionsTotal.WithLabelValues(kind, strconv.FormatBool(false)).Inc()
+	denialsTotal.WithLabelValues(kind, reason).Inc()
+	return admission.Errored(code, err)
+}
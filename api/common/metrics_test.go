@@ -0,0 +1,95 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	logrtest "github.com/go-logr/logr/testing"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Test that the admission metrics are recorded with the reason a request
+// was denied.
+func TestValidateConfigEntry_Metrics(t *testing.T) {
+	cases := map[string]struct {
+		existingResources []ConfigEntryResource
+		valid             bool
+		expAllowed        bool
+		expReason         string
+	}{
+		"allowed": {
+			valid:      true,
+			expAllowed: true,
+		},
+		"name conflict": {
+			existingResources: []ConfigEntryResource{&mockConfigEntry{
+				MockName:      "foo",
+				MockNamespace: "default",
+			}},
+			valid:      true,
+			expAllowed: false,
+			expReason:  DenialNameConflict,
+		},
+		"invalid": {
+			valid:      false,
+			expAllowed: false,
+			expReason:  DenialValidation,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			newResource := &mockConfigEntry{
+				MockName:      "foo",
+				MockNamespace: "other",
+				Valid:         c.valid,
+			}
+			marshalledRequestObject, err := json.Marshal(newResource)
+			require.NoError(t, err)
+
+			allowedLabel := "false"
+			if c.expAllowed {
+				allowedLabel = "true"
+			}
+			admissions := admissionsTotal.WithLabelValues("mockkind", allowedLabel)
+			admissionsBefore := testutil.ToFloat64(admissions)
+			denialsBefore := map[string]float64{}
+			for _, reason := range []string{DenialNameConflict, DenialConsulConflict, DenialValidation, DenialError} {
+				denialsBefore[reason] = testutil.ToFloat64(denialsTotal.WithLabelValues("mockkind", reason))
+			}
+
+			response := ValidateConfigEntry(context.Background(), admission.Request{
+				AdmissionRequest: v1beta1.AdmissionRequest{
+					Name:      newResource.KubernetesName(),
+					Namespace: "other",
+					Operation: v1beta1.Create,
+					Object: runtime.RawExtension{
+						Raw: marshalledRequestObject,
+					},
+				},
+			},
+				logrtest.TestLogger{T: t},
+				&mockConfigEntryLister{Resources: c.existingResources},
+				newResource,
+				ConsulValidation{},
+				false,
+				false,
+				"",
+				"")
+			require.Equal(t, c.expAllowed, response.Allowed)
+
+			require.Equal(t, admissionsBefore+1, testutil.ToFloat64(admissions))
+			for reason, before := range denialsBefore {
+				exp := before
+				if reason == c.expReason {
+					exp++
+				}
+				require.Equal(t, exp, testutil.ToFloat64(denialsTotal.WithLabelValues("mockkind", reason)), reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/consul-k8s/api/v1beta1"
+)
+
+// The config entry types implement conversion.Convertible so that they're
+// converted to and from the v1beta1 hub by the conversion webhook. The
+// conversions of the fields that are shared by several types are here.
+
+// unsupportedHubErr is returned when asked to convert to or from a hub of
+// the wrong type.
+func unsupportedHubErr(hub interface{}) error {
+	return fmt.Errorf("unsupported hub type %T", hub)
+}
+
+func (s Status) toHub() v1beta1.Status {
+	var conditions v1beta1.Conditions
+	if s.Conditions != nil {
+		conditions = make(v1beta1.Conditions, len(s.Conditions))
+		for i, c := range s.Conditions {
+			conditions[i] = v1beta1.Condition{
+				Type:               v1beta1.ConditionType(c.Type),
+				Status:             c.Status,
+				LastTransitionTime: c.LastTransitionTime,
+				Reason:             c.Reason,
+				Message:            c.Message,
+			}
+		}
+	}
+	return v1beta1.Status{Conditions: conditions}
+}
+
+func statusFromHub(hub v1beta1.Status) Status {
+	var conditions Conditions
+	if hub.Conditions != nil {
+		conditions = make(Conditions, len(hub.Conditions))
+		for i, c := range hub.Conditions {
+			conditions[i] = Condition{
+				Type:               ConditionType(c.Type),
+				Status:             c.Status,
+				LastTransitionTime: c.LastTransitionTime,
+				Reason:             c.Reason,
+				Message:            c.Message,
+			}
+		}
+	}
+	return Status{Conditions: conditions}
+}
+
+func copyStrings(in []string) []string {
+	if in == nil {
+		return nil
+	}
+	return append([]string{}, in...)
+}
+
+func (m MeshGatewayConfig) toHub() v1beta1.MeshGatewayConfig {
+	return v1beta1.MeshGatewayConfig{Mode: m.Mode}
+}
+
+func meshGatewayFromHub(hub v1beta1.MeshGatewayConfig) MeshGatewayConfig {
+	return MeshGatewayConfig{Mode: hub.Mode}
+}
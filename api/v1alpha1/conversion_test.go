@@ -0,0 +1,165 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/api/v1beta1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+)
+
+// Test that the config entries with a hub version are convertible.
+func TestConversion_IsConvertible(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, AddToScheme(scheme))
+	require.NoError(t, v1beta1.AddToScheme(scheme))
+
+	for _, obj := range []runtime.Object{&ServiceDefaults{}, &ServiceResolver{}} {
+		ok, err := conversion.IsConvertible(scheme, obj)
+		require.NoError(t, err)
+		require.True(t, ok, "%T is not convertible", obj)
+	}
+}
+
+func TestServiceDefaults_ConvertRoundTrip(t *testing.T) {
+	cases := map[string]*ServiceDefaults{
+		"empty": {
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "foo",
+			},
+		},
+		"every field set": {
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "foo",
+				Namespace:   "bar",
+				Annotations: map[string]string{"key": "value"},
+				Finalizers:  []string{"finalizer"},
+			},
+			Spec: ServiceDefaultsSpec{
+				Protocol: "http",
+				MeshGateway: MeshGatewayConfig{
+					Mode: "local",
+				},
+				Expose: ExposeConfig{
+					Checks: true,
+					Paths: []ExposePath{
+						{
+							ListenerPort:  21500,
+							Path:          "/metrics",
+							LocalPathPort: 9090,
+							Protocol:      "http2",
+						},
+					},
+				},
+				ExternalSNI: "sni",
+			},
+			Status: testConversionStatus(),
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var hub v1beta1.ServiceDefaults
+			require.NoError(t, c.ConvertTo(&hub))
+			require.Equal(t, c.Spec.Expose.Paths == nil, hub.Spec.Expose.Paths == nil)
+
+			var actual ServiceDefaults
+			require.NoError(t, actual.ConvertFrom(&hub))
+			require.Equal(t, c, &actual)
+		})
+	}
+}
+
+func TestServiceResolver_ConvertRoundTrip(t *testing.T) {
+	cases := map[string]*ServiceResolver{
+		"empty": {
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "foo",
+			},
+		},
+		"every field set": {
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "bar",
+				Labels:    map[string]string{"key": "value"},
+			},
+			Spec: ServiceResolverSpec{
+				DefaultSubset: "v1",
+				Subsets: map[string]ServiceResolverSubset{
+					"v1": {
+						Filter:      "Service.Meta.version == v1",
+						OnlyPassing: true,
+					},
+				},
+				Redirect: &ServiceResolverRedirect{
+					Service:       "redirect",
+					ServiceSubset: "v2",
+					Namespace:     "ns",
+					Datacenter:    "dc2",
+				},
+				Failover: map[string]ServiceResolverFailover{
+					"*": {
+						Service:       "failover",
+						ServiceSubset: "v1",
+						Namespace:     "ns",
+						Datacenters:   []string{"dc2", "dc3"},
+					},
+				},
+				ConnectTimeout: 5 * time.Second,
+				LoadBalancer: &LoadBalancer{
+					Policy: "ring_hash",
+					RingHashConfig: &RingHashConfig{
+						MinimumRingSize: 1024,
+						MaximumRingSize: 8192,
+					},
+					LeastRequestConfig: &LeastRequestConfig{
+						ChoiceCount: 2,
+					},
+					HashPolicies: []HashPolicy{
+						{
+							Field:      "cookie",
+							FieldValue: "session",
+							CookieConfig: &CookieConfig{
+								TTL:  time.Minute,
+								Path: "/",
+							},
+							Terminal: true,
+						},
+						{
+							SourceIP: true,
+						},
+					},
+				},
+			},
+			Status: testConversionStatus(),
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var hub v1beta1.ServiceResolver
+			require.NoError(t, c.ConvertTo(&hub))
+			require.Equal(t, c.Spec.ConnectTimeout, hub.Spec.ConnectTimeout)
+
+			var actual ServiceResolver
+			require.NoError(t, actual.ConvertFrom(&hub))
+			require.Equal(t, c, &actual)
+		})
+	}
+}
+
+func testConversionStatus() Status {
+	return Status{
+		Conditions: Conditions{
+			{
+				Type:               ConditionSynced,
+				Status:             corev1.ConditionFalse,
+				LastTransitionTime: metav1.NewTime(time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)),
+				Reason:             "ConsulAgentError",
+				Message:            "error",
+			},
+		},
+	}
+}
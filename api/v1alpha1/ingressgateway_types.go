@@ -54,6 +54,9 @@ type IngressGatewaySpec struct {
 	// Listeners declares what ports the ingress gateway should listen on, and
 	// what services to associated to those ports.
 	Listeners []IngressListener `json:"listeners,omitempty"`
+	// Meta is arbitrary metadata written to the Meta of the config entry in
+	// Consul. Keys starting with "consul.hashicorp.com/" are reserved.
+	Meta map[string]string `json:"meta,omitempty"`
 }
 
 type GatewayTLSConfig struct {
@@ -86,8 +89,9 @@ type IngressService struct {
 	// Name declares the service to which traffic should be forwarded.
 	//
 	// This can either be a specific service, or the wildcard specifier,
-	// "*". If the wildcard specifier is provided, the listener must be of "http"
-	// protocol and means that the listener will forward traffic to all services.
+	// "*". If the wildcard specifier is provided, the listener must be of an
+	// HTTP-based protocol, i.e. "http", "http2" or "grpc", and means that the
+	// listener will forward traffic to all services.
 	//
 	// A name can be specified on multiple listeners, and will be exposed on both
 	// of the listeners.
@@ -195,7 +199,7 @@ func (in *IngressGateway) ToConsul(datacenter string) capi.ConfigEntry {
 		Name:      in.ConsulName(),
 		TLS:       in.Spec.TLS.toConsul(),
 		Listeners: listeners,
-		Meta:      meta(datacenter),
+		Meta:      meta(datacenter, in.Spec.Meta),
 	}
 }
 
@@ -204,15 +208,31 @@ func (in *IngressGateway) MatchesConsul(candidate capi.ConfigEntry) bool {
 	if !ok {
 		return false
 	}
-	// No datacenter is passed to ToConsul as we ignore the Meta field when checking for equality.
+	// The controller's keys in the Meta field differ between datacenters so
+	// only the metadata set on the resource is compared. No datacenter is
+	// passed to ToConsul as the Meta field is ignored below.
+	if !userMetaMatches(in.Spec.Meta, configEntry.Meta) {
+		return false
+	}
 	return cmp.Equal(in.ToConsul(""), configEntry, cmpopts.IgnoreFields(capi.IngressGatewayConfigEntry{}, "Namespace", "Meta", "ModifyIndex", "CreateIndex"), cmpopts.IgnoreUnexported(), cmpopts.EquateEmpty())
 }
 
+// ConsulMeta returns the metadata written to the Meta of the config entry.
+func (in *IngressGateway) ConsulMeta() map[string]string {
+	return in.Spec.Meta
+}
+
 func (in *IngressGateway) Validate(namespacesEnabled bool) error {
 	var errs field.ErrorList
 	path := field.NewPath("spec")
 
+	// Each listener must listen on its own port.
+	ports := make(map[int]bool)
 	for i, v := range in.Spec.Listeners {
+		if ports[v.Port] {
+			errs = append(errs, field.Duplicate(path.Child("listeners").Index(i).Child("port"), v.Port))
+		}
+		ports[v.Port] = true
 		errs = append(errs, v.validate(path.Child("listeners").Index(i))...)
 	}
 
@@ -287,11 +307,13 @@ func (in IngressListener) validate(path *field.Path) field.ErrorList {
 			fmt.Sprintf("if protocol is \"tcp\", only a single service is allowed, found %d", len(in.Services))))
 	}
 
+	// The wildcard service is only supported by the HTTP-based protocols.
+	httpProtocols := []string{"http", "http2", "grpc"}
 	for i, svc := range in.Services {
-		if svc.Name == wildcardServiceName && in.Protocol != "http" {
+		if svc.Name == wildcardServiceName && !sliceContains(httpProtocols, in.Protocol) {
 			errs = append(errs, field.Invalid(path.Child("services").Index(i).Child("name"),
 				svc.Name,
-				fmt.Sprintf("if name is %q, protocol must be \"http\" but was %q", wildcardServiceName, in.Protocol)))
+				fmt.Sprintf("if name is %q, protocol %s but was %q", wildcardServiceName, notInSliceMessage(httpProtocols), in.Protocol)))
 		}
 
 		if svc.Name == wildcardServiceName && len(svc.Hosts) > 0 {
@@ -323,7 +323,54 @@ func TestIngressGateway_Validate(t *testing.T) {
 			},
 			namespacesEnabled: false,
 			expectedErrMsgs: []string{
-				`spec.listeners[0].services[0].name: Invalid value: "*": if name is "*", protocol must be "http" but was "tcp"`,
+				`spec.listeners[0].services[0].name: Invalid value: "*": if name is "*", protocol must be one of "http", "http2", "grpc" but was "tcp"`,
+			},
+		},
+		"protocol == grpc when service.name==*": {
+			input: &IngressGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: IngressGatewaySpec{
+					Listeners: []IngressListener{
+						{
+							Protocol: "grpc",
+							Services: []IngressService{
+								{
+									Name: "*",
+								},
+							},
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+		},
+		"duplicate listener ports": {
+			input: &IngressGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: IngressGatewaySpec{
+					Listeners: []IngressListener{
+						{
+							Port:     8080,
+							Protocol: "http",
+						},
+						{
+							Port:     8081,
+							Protocol: "http",
+						},
+						{
+							Port:     8080,
+							Protocol: "tcp",
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				`spec.listeners[2].port: Duplicate value: 8080`,
 			},
 		},
 		"len(hosts) > 0 when service.name==*": {
@@ -440,7 +487,7 @@ func TestIngressGateway_Validate(t *testing.T) {
 			namespacesEnabled: false,
 			expectedErrMsgs: []string{
 				`spec.listeners[0].protocol: Invalid value: "invalid": must be one of "tcp", "http", "http2", "grpc"`,
-				`spec.listeners[0].services[0].name: Invalid value: "*": if name is "*", protocol must be "http" but was "invalid"`,
+				`spec.listeners[0].services[0].name: Invalid value: "*": if name is "*", protocol must be one of "http", "http2", "grpc" but was "invalid"`,
 			},
 		},
 	}
@@ -0,0 +1,149 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	logrtest "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestValidateIngressGateway(t *testing.T) {
+	otherNS := "other"
+
+	cases := map[string]struct {
+		existingResources []runtime.Object
+		newResource       *IngressGateway
+		expAllow          bool
+		expErrMessage     string
+	}{
+		"no duplicates, valid": {
+			existingResources: nil,
+			newResource: &IngressGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: IngressGatewaySpec{
+					Listeners: []IngressListener{
+						{
+							Port:     8080,
+							Protocol: "http",
+							Services: []IngressService{{Name: "*"}},
+						},
+						{
+							Port:     8081,
+							Protocol: "tcp",
+							Services: []IngressService{{Name: "db"}},
+						},
+					},
+				},
+			},
+			expAllow: true,
+		},
+		"duplicate listener ports": {
+			existingResources: nil,
+			newResource: &IngressGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: IngressGatewaySpec{
+					Listeners: []IngressListener{
+						{
+							Port:     8080,
+							Protocol: "http",
+						},
+						{
+							Port:     8080,
+							Protocol: "grpc",
+						},
+					},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: `ingressgateway.consul.hashicorp.com "foo" is invalid: spec.listeners[1].port: Duplicate value: 8080`,
+		},
+		"wildcard service with tcp protocol": {
+			existingResources: nil,
+			newResource: &IngressGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: IngressGatewaySpec{
+					Listeners: []IngressListener{
+						{
+							Port:     8080,
+							Protocol: "tcp",
+							Services: []IngressService{{Name: "*"}},
+						},
+					},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: `ingressgateway.consul.hashicorp.com "foo" is invalid: spec.listeners[0].services[0].name: Invalid value: "*": if name is "*", protocol must be one of "http", "http2", "grpc" but was "tcp"`,
+		},
+		"ingress gateway exists in another namespace": {
+			existingResources: []runtime.Object{&IngressGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+			}},
+			newResource: &IngressGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: otherNS,
+				},
+				Spec: IngressGatewaySpec{
+					Listeners: []IngressListener{
+						{
+							Port:     8080,
+							Protocol: "http",
+						},
+					},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: "ingressgateway resource with name \"foo\" is already defined – all ingressgateway resources must have unique names across namespaces",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			marshalledRequestObject, err := json.Marshal(c.newResource)
+			require.NoError(t, err)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(GroupVersion, &IngressGateway{}, &IngressGatewayList{})
+			client := fake.NewFakeClientWithScheme(s, c.existingResources...)
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(t, err)
+
+			validator := &IngressGatewayWebhook{
+				Client:       client,
+				ConsulClient: nil,
+				Logger:       logrtest.TestLogger{T: t},
+				decoder:      decoder,
+			}
+			response := validator.Handle(ctx, admission.Request{
+				AdmissionRequest: v1beta1.AdmissionRequest{
+					Name:      c.newResource.KubernetesName(),
+					Namespace: otherNS,
+					Operation: v1beta1.Create,
+					Object: runtime.RawExtension{
+						Raw: marshalledRequestObject,
+					},
+				},
+			})
+
+			require.Equal(t, c.expAllow, response.Allowed)
+			if c.expErrMessage != "" {
+				require.Equal(t, c.expErrMessage, response.AdmissionResponse.Result.Message)
+			}
+		})
+	}
+}
@@ -58,6 +58,9 @@ type ProxyDefaultsSpec struct {
 	MeshGateway MeshGatewayConfig `json:"meshGateway,omitempty"`
 	// Expose controls the default expose path configuration for Envoy.
 	Expose ExposeConfig `json:"expose,omitempty"`
+	// Meta is arbitrary metadata written to the Meta of the config entry in
+	// Consul. Keys starting with "consul.hashicorp.com/" are reserved.
+	Meta map[string]string `json:"meta,omitempty"`
 }
 
 func (in *ProxyDefaults) GetObjectMeta() metav1.ObjectMeta {
@@ -143,7 +146,7 @@ func (in *ProxyDefaults) ToConsul(datacenter string) capi.ConfigEntry {
 		MeshGateway: in.Spec.MeshGateway.toConsul(),
 		Expose:      in.Spec.Expose.toConsul(),
 		Config:      consulConfig,
-		Meta:        meta(datacenter),
+		Meta:        meta(datacenter, in.Spec.Meta),
 	}
 }
 
@@ -152,10 +155,20 @@ func (in *ProxyDefaults) MatchesConsul(candidate api.ConfigEntry) bool {
 	if !ok {
 		return false
 	}
-	// No datacenter is passed to ToConsul as we ignore the Meta field when checking for equality.
+	// The controller's keys in the Meta field differ between datacenters so
+	// only the metadata set on the resource is compared. No datacenter is
+	// passed to ToConsul as the Meta field is ignored below.
+	if !userMetaMatches(in.Spec.Meta, configEntry.Meta) {
+		return false
+	}
 	return cmp.Equal(in.ToConsul(""), configEntry, cmpopts.IgnoreFields(capi.ProxyConfigEntry{}, "Namespace", "Meta", "ModifyIndex", "CreateIndex"), cmpopts.IgnoreUnexported(), cmpopts.EquateEmpty())
 }
 
+// ConsulMeta returns the metadata written to the Meta of the config entry.
+func (in *ProxyDefaults) ConsulMeta() map[string]string {
+	return in.Spec.Meta
+}
+
 func (in *ProxyDefaults) Validate(namespacesEnabled bool) error {
 	var allErrs field.ErrorList
 	path := field.NewPath("spec")
@@ -22,6 +22,9 @@ type ProxyDefaultsWebhook struct {
 	decoder                *admission.Decoder
 	EnableConsulNamespaces bool
 	EnableNSMirroring      bool
+	// ConsulValidation configures denying the creation of resources that
+	// conflict with config entries that already exist in Consul.
+	ConsulValidation common.ConsulValidation
 }
 
 // NOTE: The path value in the below line is the path to the webhook.
@@ -38,33 +41,46 @@ func (v *ProxyDefaultsWebhook) Handle(ctx context.Context, req admission.Request
 	var proxyDefaultsList ProxyDefaultsList
 	err := v.decoder.Decode(req, &proxyDefaults)
 	if err != nil {
-		return admission.Errored(http.StatusBadRequest, err)
+		return common.RecordDenied(common.ProxyDefaults, common.DenialError, http.StatusBadRequest, err)
+	}
+
+	if resp, ok := common.ValidateConsulName(&proxyDefaults); !ok {
+		return resp
 	}
 
 	if req.Operation == v1beta1.Create {
 		v.Logger.Info("validate create", "name", proxyDefaults.KubernetesName())
 
 		if proxyDefaults.KubernetesName() != common.Global {
-			return admission.Errored(http.StatusBadRequest,
+			return common.RecordDenied(proxyDefaults.KubeKind(), common.DenialValidation, http.StatusBadRequest,
 				fmt.Errorf(`%s resource name must be "%s"`,
 					proxyDefaults.KubeKind(), common.Global))
 		}
 
 		if err := v.Client.List(ctx, &proxyDefaultsList); err != nil {
-			return admission.Errored(http.StatusInternalServerError, err)
+			return common.RecordDenied(proxyDefaults.KubeKind(), common.DenialError, http.StatusInternalServerError, err)
 		}
 
 		if len(proxyDefaultsList.Items) > 0 {
-			return admission.Errored(http.StatusBadRequest,
+			return common.RecordDenied(proxyDefaults.KubeKind(), common.DenialNameConflict, http.StatusBadRequest,
 				fmt.Errorf("%s resource already defined - only one global entry is supported",
 					proxyDefaults.KubeKind()))
 		}
+
+		// Proxy defaults are always written to the default Consul namespace.
+		consulNamespace := ""
+		if v.EnableConsulNamespaces {
+			consulNamespace = common.DefaultConsulNamespace
+		}
+		if resp, ok := v.ConsulValidation.Validate(&proxyDefaults, consulNamespace); !ok {
+			return resp
+		}
 	}
 
 	if err := proxyDefaults.Validate(v.EnableConsulNamespaces); err != nil {
-		return admission.Errored(http.StatusBadRequest, err)
+		return common.RecordDenied(proxyDefaults.KubeKind(), common.DenialValidation, http.StatusBadRequest, err)
 	}
-	return admission.Allowed(fmt.Sprintf("valid %s request", proxyDefaults.KubeKind()))
+	return common.RecordAllowed(proxyDefaults.KubeKind(), admission.Allowed(fmt.Sprintf("valid %s request", proxyDefaults.KubeKind())))
 }
 
 func (v *ProxyDefaultsWebhook) InjectDecoder(d *admission.Decoder) error {
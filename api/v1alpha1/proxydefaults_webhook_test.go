@@ -48,6 +48,21 @@ func TestValidateProxyDefault(t *testing.T) {
 			// This error message is because the value "1" is valid JSON but is an invalid map
 			expErrMessage: "proxydefaults.consul.hashicorp.com \"global\" is invalid: spec.config: Invalid value: json.RawMessage{0x31}: must be valid map value: json: cannot unmarshal number into Go value of type map[string]interface {}",
 		},
+		"invalid mesh gateway mode": {
+			existingResources: nil,
+			newResource: &ProxyDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: common.Global,
+				},
+				Spec: ProxyDefaultsSpec{
+					MeshGateway: MeshGatewayConfig{
+						Mode: "foo",
+					},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: `proxydefaults.consul.hashicorp.com "global" is invalid: spec.meshGateway.mode: Invalid value: "foo": must be one of "remote", "local", "none", ""`,
+		},
 		"proxy default exists": {
 			existingResources: []runtime.Object{&ProxyDefaults{
 				ObjectMeta: metav1.ObjectMeta{
@@ -113,3 +128,49 @@ func TestValidateProxyDefault(t *testing.T) {
 		})
 	}
 }
+
+// Test that only a proxy defaults resource named "global" is allowed since
+// Consul only supports a single proxy-defaults config entry with that name.
+func TestValidateProxyDefault_NameMustBeGlobal(t *testing.T) {
+	cases := map[string]bool{
+		common.Global: true,
+		"Global":      false,
+		"global-2":    false,
+		"default":     false,
+	}
+	for name, expAllow := range cases {
+		t.Run(name, func(t *testing.T) {
+			marshalledRequestObject, err := json.Marshal(&ProxyDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: name,
+				},
+			})
+			require.NoError(t, err)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(GroupVersion, &ProxyDefaults{}, &ProxyDefaultsList{})
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(t, err)
+
+			validator := &ProxyDefaultsWebhook{
+				Client:  fake.NewFakeClientWithScheme(s),
+				Logger:  logrtest.TestLogger{T: t},
+				decoder: decoder,
+			}
+			response := validator.Handle(context.Background(), admission.Request{
+				AdmissionRequest: v1beta1.AdmissionRequest{
+					Name:      name,
+					Namespace: "default",
+					Operation: v1beta1.Create,
+					Object: runtime.RawExtension{
+						Raw: marshalledRequestObject,
+					},
+				},
+			})
+
+			require.Equal(t, expAllow, response.Allowed)
+			if !expAllow {
+				require.Equal(t, `proxydefaults resource name must be "global"`, response.AdmissionResponse.Result.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package v1alpha1
+
+import (
+	"github.com/hashicorp/consul-k8s/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// ConvertTo converts this ServiceDefaults to the hub version.
+func (in *ServiceDefaults) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1beta1.ServiceDefaults)
+	if !ok {
+		return unsupportedHubErr(dstRaw)
+	}
+	dst.ObjectMeta = in.ObjectMeta
+	dst.Spec = v1beta1.ServiceDefaultsSpec{
+		Protocol:    in.Spec.Protocol,
+		MeshGateway: in.Spec.MeshGateway.toHub(),
+		Expose:      in.Spec.Expose.toHub(),
+		ExternalSNI: in.Spec.ExternalSNI,
+		Meta:        in.Spec.Meta,
+	}
+	dst.Status = in.Status.toHub()
+	return nil
+}
+
+// ConvertFrom converts the hub version to this ServiceDefaults.
+func (in *ServiceDefaults) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1beta1.ServiceDefaults)
+	if !ok {
+		return unsupportedHubErr(srcRaw)
+	}
+	in.ObjectMeta = src.ObjectMeta
+	in.Spec = ServiceDefaultsSpec{
+		Protocol:    src.Spec.Protocol,
+		MeshGateway: meshGatewayFromHub(src.Spec.MeshGateway),
+		Expose:      exposeFromHub(src.Spec.Expose),
+		ExternalSNI: src.Spec.ExternalSNI,
+		Meta:        src.Spec.Meta,
+	}
+	in.Status = statusFromHub(src.Status)
+	return nil
+}
+
+func (in ExposeConfig) toHub() v1beta1.ExposeConfig {
+	var paths []v1beta1.ExposePath
+	if in.Paths != nil {
+		paths = make([]v1beta1.ExposePath, len(in.Paths))
+		for i, p := range in.Paths {
+			paths[i] = v1beta1.ExposePath{
+				ListenerPort:  p.ListenerPort,
+				Path:          p.Path,
+				LocalPathPort: p.LocalPathPort,
+				Protocol:      p.Protocol,
+			}
+		}
+	}
+	return v1beta1.ExposeConfig{
+		Checks: in.Checks,
+		Paths:  paths,
+	}
+}
+
+func exposeFromHub(hub v1beta1.ExposeConfig) ExposeConfig {
+	var paths []ExposePath
+	if hub.Paths != nil {
+		paths = make([]ExposePath, len(hub.Paths))
+		for i, p := range hub.Paths {
+			paths[i] = ExposePath{
+				ListenerPort:  p.ListenerPort,
+				Path:          p.Path,
+				LocalPathPort: p.LocalPathPort,
+				Protocol:      p.Protocol,
+			}
+		}
+	}
+	return ExposeConfig{
+		Checks: hub.Checks,
+		Paths:  paths,
+	}
+}
@@ -21,8 +21,12 @@ func init() {
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:storageversion
 
-// ServiceDefaults is the Schema for the servicedefaults API
+// ServiceDefaults is the Schema for the servicedefaults API. It is served as
+// v1alpha1, the stored version, and v1beta1, which are converted by the
+// /convert webhook of the controller command that is only served with
+// -enable-webhooks.
 // +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status",description="The sync status of the resource with Consul"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="The age of the resource"
 type ServiceDefaults struct {
@@ -54,6 +58,9 @@ type ServiceDefaultsSpec struct {
 	// ExternalSNI is an optional setting that allows for the TLS SNI value
 	// to be changed to a non-connect value when federating with an external system.
 	ExternalSNI string `json:"externalSNI,omitempty"`
+	// Meta is arbitrary metadata written to the Meta of the config entry in
+	// Consul. Keys starting with "consul.hashicorp.com/" are reserved.
+	Meta map[string]string `json:"meta,omitempty"`
 }
 
 // ExposeConfig describes HTTP paths to expose through Envoy outside of Connect.
@@ -161,7 +168,7 @@ func (in *ServiceDefaults) ToConsul(datacenter string) capi.ConfigEntry {
 		MeshGateway: in.Spec.MeshGateway.toConsul(),
 		Expose:      in.Spec.Expose.toConsul(),
 		ExternalSNI: in.Spec.ExternalSNI,
-		Meta:        meta(datacenter),
+		Meta:        meta(datacenter, in.Spec.Meta),
 	}
 }
 
@@ -196,10 +203,20 @@ func (in *ServiceDefaults) MatchesConsul(candidate capi.ConfigEntry) bool {
 	if !ok {
 		return false
 	}
-	// No datacenter is passed to ToConsul as we ignore the Meta field when checking for equality.
+	// The controller's keys in the Meta field differ between datacenters so
+	// only the metadata set on the resource is compared. No datacenter is
+	// passed to ToConsul as the Meta field is ignored below.
+	if !userMetaMatches(in.Spec.Meta, configEntry.Meta) {
+		return false
+	}
 	return cmp.Equal(in.ToConsul(""), configEntry, cmpopts.IgnoreFields(capi.ServiceConfigEntry{}, "Namespace", "Meta", "ModifyIndex", "CreateIndex"), cmpopts.IgnoreUnexported(), cmpopts.EquateEmpty())
 }
 
+// ConsulMeta returns the metadata written to the Meta of the config entry.
+func (in *ServiceDefaults) ConsulMeta() map[string]string {
+	return in.Spec.Meta
+}
+
 func (in *ServiceDefaults) ConsulGlobalResource() bool {
 	return false
 }
@@ -224,6 +241,7 @@ func (e ExposeConfig) toConsul() capi.ExposeConfig {
 func (e ExposeConfig) validate(path *field.Path) []*field.Error {
 	var errs field.ErrorList
 	protocols := []string{"http", "http2"}
+	listenerPorts := make(map[int]bool)
 	for i, pathCfg := range e.Paths {
 		indexPath := path.Child("paths").Index(i)
 		if invalidPathPrefix(pathCfg.Path) {
@@ -238,6 +256,15 @@ func (e ExposeConfig) validate(path *field.Path) []*field.Error {
 				pathCfg.Protocol,
 				notInSliceMessage(protocols)))
 		}
+		// Each path is exposed on its own listener so the ports can't be shared.
+		if pathCfg.ListenerPort != 0 {
+			if listenerPorts[pathCfg.ListenerPort] {
+				errs = append(errs, field.Duplicate(
+					indexPath.Child("listenerPort"),
+					pathCfg.ListenerPort))
+			}
+			listenerPorts[pathCfg.ListenerPort] = true
+		}
 	}
 	return errs
 }
@@ -184,6 +184,65 @@ func TestServiceDefaults_MatchesConsul(t *testing.T) {
 			},
 			true,
 		},
+		"different protocol does not match": {
+			&ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-test-service",
+				},
+				Spec: ServiceDefaultsSpec{
+					Protocol: "http",
+				},
+			},
+			&capi.ServiceConfigEntry{
+				Kind:        capi.ServiceDefaults,
+				Name:        "my-test-service",
+				Protocol:    "tcp",
+				Namespace:   "namespace",
+				CreateIndex: 1,
+				ModifyIndex: 2,
+			},
+			false,
+		},
+		"same meta matches": {
+			&ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-test-service",
+				},
+				Spec: ServiceDefaultsSpec{
+					Meta: map[string]string{"team": "payments"},
+				},
+			},
+			&capi.ServiceConfigEntry{
+				Kind: capi.ServiceDefaults,
+				Name: "my-test-service",
+				Meta: map[string]string{
+					"team":               "payments",
+					common.SourceKey:     common.SourceValue,
+					common.DatacenterKey: "datacenter",
+				},
+			},
+			true,
+		},
+		"different meta does not match": {
+			&ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-test-service",
+				},
+				Spec: ServiceDefaultsSpec{
+					Meta: map[string]string{"team": "payments"},
+				},
+			},
+			&capi.ServiceConfigEntry{
+				Kind: capi.ServiceDefaults,
+				Name: "my-test-service",
+				Meta: map[string]string{
+					"team":               "billing",
+					common.SourceKey:     common.SourceValue,
+					common.DatacenterKey: "datacenter",
+				},
+			},
+			false,
+		},
 		"mismatched types does not match": {
 			&ServiceDefaults{
 				ObjectMeta: metav1.ObjectMeta{
@@ -287,6 +346,54 @@ func TestServiceDefaults_Validate(t *testing.T) {
 			},
 			`servicedefaults.consul.hashicorp.com "my-service" is invalid: spec.expose.paths[0].path: Invalid value: "invalid-path": must begin with a '/'`,
 		},
+		"expose.paths[].listenerPort distinct": {
+			&ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-service",
+				},
+				Spec: ServiceDefaultsSpec{
+					Expose: ExposeConfig{
+						Paths: []ExposePath{
+							{
+								ListenerPort: 21500,
+								Protocol:     "http",
+								Path:         "/health",
+							},
+							{
+								ListenerPort: 21501,
+								Protocol:     "http2",
+								Path:         "/metrics",
+							},
+						},
+					},
+				},
+			},
+			"",
+		},
+		"expose.paths[].listenerPort duplicate": {
+			&ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-service",
+				},
+				Spec: ServiceDefaultsSpec{
+					Expose: ExposeConfig{
+						Paths: []ExposePath{
+							{
+								ListenerPort: 21500,
+								Protocol:     "http",
+								Path:         "/health",
+							},
+							{
+								ListenerPort: 21500,
+								Protocol:     "http",
+								Path:         "/metrics",
+							},
+						},
+					},
+				},
+			},
+			`servicedefaults.consul.hashicorp.com "my-service" is invalid: spec.expose.paths[1].listenerPort: Duplicate value: 21500`,
+		},
 		"multi-error": {
 			&ServiceDefaults{
 				ObjectMeta: metav1.ObjectMeta{
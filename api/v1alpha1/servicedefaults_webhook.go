@@ -2,11 +2,15 @@ package v1alpha1
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/hashicorp/consul-k8s/api/common"
 	capi "github.com/hashicorp/consul/api"
+	"gomodules.xyz/jsonpatch/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
@@ -38,6 +42,10 @@ type ServiceDefaultsWebhook struct {
 	// `k8s-staging` Consul namespace.
 	NSMirroringPrefix string
 
+	// ConsulValidation configures denying the creation of resources that
+	// conflict with config entries that already exist in Consul.
+	ConsulValidation common.ConsulValidation
+
 	decoder *admission.Decoder
 	client.Client
 }
@@ -54,18 +62,134 @@ func (v *ServiceDefaultsWebhook) Handle(ctx context.Context, req admission.Reque
 	var svcDefaults ServiceDefaults
 	err := v.decoder.Decode(req, &svcDefaults)
 	if err != nil {
-		return admission.Errored(http.StatusBadRequest, err)
+		return common.RecordDenied(common.ServiceDefaults, common.DenialError, http.StatusBadRequest, err)
+	}
+
+	// If the protocol isn't set, it's inherited from the proxy defaults so
+	// we write the resolved protocol into the resource to reflect it.
+	var protocolPatches []jsonpatch.Operation
+	if svcDefaults.Spec.Protocol == "" {
+		protocol, err := v.proxyDefaultsProtocol(ctx)
+		if err != nil {
+			return common.RecordDenied(common.ServiceDefaults, common.DenialError, http.StatusInternalServerError, err)
+		}
+		if protocol != "" {
+			svcDefaults.Spec.Protocol = protocol
+			protocolPatches = append(protocolPatches, jsonpatch.Operation{
+				Operation: "add",
+				Path:      "/spec/protocol",
+				Value:     protocol,
+			})
+		}
 	}
 
-	return common.ValidateConfigEntry(ctx,
+	// Routing and splitting need an L7 protocol so service defaults that
+	// would leave an existing router or splitter unusable are denied.
+	if err := v.validateL7Features(ctx, &svcDefaults); err != nil {
+		return common.RecordDenied(common.ServiceDefaults, common.DenialValidation, http.StatusBadRequest, err)
+	}
+
+	resp := common.ValidateConfigEntry(ctx,
 		req,
 		v.Logger,
 		v,
 		&svcDefaults,
+		v.ConsulValidation,
 		v.EnableConsulNamespaces,
 		v.EnableNSMirroring,
 		v.ConsulDestinationNamespace,
 		v.NSMirroringPrefix)
+	if resp.Allowed {
+		resp.Patches = append(resp.Patches, protocolPatches...)
+	}
+	return resp
+}
+
+// proxyDefaultsProtocol returns the protocol set in the config of the
+// proxy defaults resource. It returns an empty string if there are no proxy
+// defaults or they don't set a protocol.
+func (v *ServiceDefaultsWebhook) proxyDefaultsProtocol(ctx context.Context) (string, error) {
+	var proxyDefaultsList ProxyDefaultsList
+	if err := v.Client.List(ctx, &proxyDefaultsList); err != nil {
+		return "", err
+	}
+	for _, item := range proxyDefaultsList.Items {
+		if item.KubernetesName() != common.Global || item.Spec.Config == nil {
+			continue
+		}
+		var config struct {
+			Protocol string `json:"protocol"`
+		}
+		// Invalid config is denied by the proxy defaults webhook so it's
+		// treated the same as config without a protocol.
+		if err := json.Unmarshal(item.Spec.Config, &config); err != nil {
+			return "", nil
+		}
+		return config.Protocol, nil
+	}
+	return "", nil
+}
+
+// validateL7Features returns an error if the protocol of svcDefaults, once
+// resolved from the proxy defaults, isn't an L7 protocol while a service
+// router or service splitter, which Consul only supports for L7 protocols,
+// exists for the service.
+func (v *ServiceDefaultsWebhook) validateL7Features(ctx context.Context, svcDefaults *ServiceDefaults) error {
+	if isL7Protocol(svcDefaults.Spec.Protocol) {
+		return nil
+	}
+	protocol := svcDefaults.Spec.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+
+	var routers ServiceRouterList
+	if err := v.Client.List(ctx, &routers); err != nil {
+		return err
+	}
+	for _, item := range routers.Items {
+		if v.sameService(svcDefaults, &item) {
+			return fmt.Errorf("protocol %q is not supported by the service router %s/%s – it requires one of %s",
+				protocol, item.Namespace, item.Name, strings.Join(l7Protocols, ", "))
+		}
+	}
+	var splitters ServiceSplitterList
+	if err := v.Client.List(ctx, &splitters); err != nil {
+		return err
+	}
+	for _, item := range splitters.Items {
+		if v.sameService(svcDefaults, &item) {
+			return fmt.Errorf("protocol %q is not supported by the service splitter %s/%s – it requires one of %s",
+				protocol, item.Namespace, item.Name, strings.Join(l7Protocols, ", "))
+		}
+	}
+	return nil
+}
+
+// sameService returns true if entry configures the same Consul service as
+// svcDefaults. Resources in different Kubernetes namespaces only configure
+// different services if they are mirrored into different Consul namespaces.
+func (v *ServiceDefaultsWebhook) sameService(svcDefaults *ServiceDefaults, entry common.ConfigEntryResource) bool {
+	if entry.ConsulName() != svcDefaults.ConsulName() {
+		return false
+	}
+	if v.EnableConsulNamespaces && v.EnableNSMirroring {
+		return entry.ConsulMirroringNS() == svcDefaults.ConsulMirroringNS()
+	}
+	return true
+}
+
+// l7Protocols are the protocols that support L7 features such as routing
+// and splitting.
+var l7Protocols = []string{"http", "http2", "grpc"}
+
+func isL7Protocol(protocol string) bool {
+	for _, p := range l7Protocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
 }
 
 func (v *ServiceDefaultsWebhook) List(ctx context.Context) ([]common.ConfigEntryResource, error) {
@@ -0,0 +1,367 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	logrtest "github.com/go-logr/logr/testing"
+	"github.com/hashicorp/consul-k8s/api/common"
+	"github.com/stretchr/testify/require"
+	"gomodules.xyz/jsonpatch/v2"
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Test that the protocol of service defaults without a protocol is defaulted
+// to the protocol of the proxy defaults.
+func TestHandle_ServiceDefaults_ProtocolPatches(t *testing.T) {
+	cases := map[string]struct {
+		existingResources []runtime.Object
+		newResource       *ServiceDefaults
+		expPatches        []jsonpatch.Operation
+	}{
+		"no proxy defaults": {
+			newResource: &ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+			},
+			expPatches: []jsonpatch.Operation{},
+		},
+		"proxy defaults without protocol": {
+			existingResources: []runtime.Object{&ProxyDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: common.Global,
+				},
+				Spec: ProxyDefaultsSpec{
+					Config: json.RawMessage(`{"local_connect_timeout_ms": 5000}`),
+				},
+			}},
+			newResource: &ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+			},
+			expPatches: []jsonpatch.Operation{},
+		},
+		"protocol inherited from proxy defaults": {
+			existingResources: []runtime.Object{&ProxyDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: common.Global,
+				},
+				Spec: ProxyDefaultsSpec{
+					Config: json.RawMessage(`{"protocol": "http"}`),
+				},
+			}},
+			newResource: &ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+			},
+			expPatches: []jsonpatch.Operation{
+				{
+					Operation: "add",
+					Path:      "/spec/protocol",
+					Value:     "http",
+				},
+			},
+		},
+		"protocol explicitly set": {
+			existingResources: []runtime.Object{&ProxyDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: common.Global,
+				},
+				Spec: ProxyDefaultsSpec{
+					Config: json.RawMessage(`{"protocol": "http"}`),
+				},
+			}},
+			newResource: &ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceDefaultsSpec{
+					Protocol: "grpc",
+				},
+			},
+			expPatches: []jsonpatch.Operation{},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			marshalledRequestObject, err := json.Marshal(c.newResource)
+			require.NoError(t, err)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(GroupVersion, &ServiceDefaults{}, &ServiceDefaultsList{}, &ProxyDefaults{}, &ProxyDefaultsList{},
+				&ServiceRouter{}, &ServiceRouterList{}, &ServiceSplitter{}, &ServiceSplitterList{})
+			client := fake.NewFakeClientWithScheme(s, c.existingResources...)
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(t, err)
+
+			validator := &ServiceDefaultsWebhook{
+				Client:       client,
+				ConsulClient: nil,
+				Logger:       logrtest.TestLogger{T: t},
+				decoder:      decoder,
+			}
+			response := validator.Handle(ctx, admission.Request{
+				AdmissionRequest: v1beta1.AdmissionRequest{
+					Name:      c.newResource.KubernetesName(),
+					Namespace: "default",
+					Operation: v1beta1.Create,
+					Object: runtime.RawExtension{
+						Raw: marshalledRequestObject,
+					},
+				},
+			})
+
+			require.True(t, response.Allowed, response.AdmissionResponse.Result.Message)
+			require.ElementsMatch(t, c.expPatches, response.Patches)
+		})
+	}
+}
+
+// Test that service defaults whose protocol doesn't support the routers and
+// splitters of the service are denied.
+func TestHandle_ServiceDefaults_L7Features(t *testing.T) {
+	router := &ServiceRouter{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+	}
+	splitter := &ServiceSplitter{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+	}
+	httpProxyDefaults := &ProxyDefaults{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: common.Global,
+		},
+		Spec: ProxyDefaultsSpec{
+			Config: json.RawMessage(`{"protocol": "http"}`),
+		},
+	}
+	cases := map[string]struct {
+		existingResources []runtime.Object
+		protocol          string
+		mirroring         bool
+		expAllow          bool
+		expErrMessage     string
+	}{
+		"tcp with mesh gateway and without router or splitter": {
+			protocol: "tcp",
+			expAllow: true,
+		},
+		"http with router and splitter": {
+			existingResources: []runtime.Object{router, splitter},
+			protocol:          "http",
+			expAllow:          true,
+		},
+		"grpc with router": {
+			existingResources: []runtime.Object{router},
+			protocol:          "grpc",
+			expAllow:          true,
+		},
+		"tcp with router": {
+			existingResources: []runtime.Object{router},
+			protocol:          "tcp",
+			expAllow:          false,
+			expErrMessage:     `protocol "tcp" is not supported by the service router default/foo – it requires one of http, http2, grpc`,
+		},
+		"tcp with splitter": {
+			existingResources: []runtime.Object{splitter},
+			protocol:          "tcp",
+			expAllow:          false,
+			expErrMessage:     `protocol "tcp" is not supported by the service splitter default/foo – it requires one of http, http2, grpc`,
+		},
+		"default protocol with router": {
+			existingResources: []runtime.Object{router},
+			expAllow:          false,
+			expErrMessage:     `protocol "tcp" is not supported by the service router default/foo – it requires one of http, http2, grpc`,
+		},
+		"protocol inherited from proxy defaults with router": {
+			existingResources: []runtime.Object{router, httpProxyDefaults},
+			expAllow:          true,
+		},
+		"tcp with router of another service": {
+			existingResources: []runtime.Object{&ServiceRouter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "bar",
+					Namespace: "default",
+				},
+			}},
+			protocol: "tcp",
+			expAllow: true,
+		},
+		"tcp with router in another namespace": {
+			existingResources: []runtime.Object{&ServiceRouter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "other",
+				},
+			}},
+			protocol:      "tcp",
+			expAllow:      false,
+			expErrMessage: `protocol "tcp" is not supported by the service router other/foo – it requires one of http, http2, grpc`,
+		},
+		"tcp with router in another mirrored namespace": {
+			existingResources: []runtime.Object{&ServiceRouter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "other",
+				},
+			}},
+			protocol:  "tcp",
+			mirroring: true,
+			expAllow:  true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			svcDefaults := &ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+				Spec: ServiceDefaultsSpec{
+					Protocol: c.protocol,
+					MeshGateway: MeshGatewayConfig{
+						Mode: "remote",
+					},
+				},
+			}
+			marshalledRequestObject, err := json.Marshal(svcDefaults)
+			require.NoError(t, err)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(GroupVersion, &ServiceDefaults{}, &ServiceDefaultsList{}, &ProxyDefaults{}, &ProxyDefaultsList{},
+				&ServiceRouter{}, &ServiceRouterList{}, &ServiceSplitter{}, &ServiceSplitterList{})
+			client := fake.NewFakeClientWithScheme(s, c.existingResources...)
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(t, err)
+
+			validator := &ServiceDefaultsWebhook{
+				Client:                 client,
+				ConsulClient:           nil,
+				Logger:                 logrtest.TestLogger{T: t},
+				EnableConsulNamespaces: c.mirroring,
+				EnableNSMirroring:      c.mirroring,
+				decoder:                decoder,
+			}
+			response := validator.Handle(ctx, admission.Request{
+				AdmissionRequest: v1beta1.AdmissionRequest{
+					Name:      svcDefaults.KubernetesName(),
+					Namespace: svcDefaults.Namespace,
+					Operation: v1beta1.Create,
+					Object: runtime.RawExtension{
+						Raw: marshalledRequestObject,
+					},
+				},
+			})
+
+			require.Equal(t, c.expAllow, response.Allowed, response.AdmissionResponse.Result.Message)
+			if c.expErrMessage != "" {
+				require.Equal(t, c.expErrMessage, response.AdmissionResponse.Result.Message)
+			}
+		})
+	}
+}
+
+// Test that the mutating webhook patches service defaults with an empty
+// namespace to the defaulted resource whatever the Consul namespace config:
+// service defaults have no namespace fields so only their protocol is
+// defaulted.
+func TestHandle_ServiceDefaults_EmptyNamespacePatches(t *testing.T) {
+	httpProxyDefaults := &ProxyDefaults{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: common.Global,
+		},
+		Spec: ProxyDefaultsSpec{
+			Config: json.RawMessage(`{"protocol": "http"}`),
+		},
+	}
+	protocolPatch := jsonpatch.Operation{
+		Operation: "add",
+		Path:      "/spec/protocol",
+		Value:     "http",
+	}
+	cases := map[string]struct {
+		existingResources      []runtime.Object
+		enableConsulNamespaces bool
+		destinationNamespace   string
+		mirroring              bool
+		prefix                 string
+		expPatches             []jsonpatch.Operation
+	}{
+		"namespaces disabled": {
+			existingResources: []runtime.Object{httpProxyDefaults},
+			expPatches:        []jsonpatch.Operation{protocolPatch},
+		},
+		"destination namespace": {
+			existingResources:      []runtime.Object{httpProxyDefaults},
+			enableConsulNamespaces: true,
+			destinationNamespace:   "dest",
+			expPatches:             []jsonpatch.Operation{protocolPatch},
+		},
+		"mirroring with prefix": {
+			existingResources:      []runtime.Object{httpProxyDefaults},
+			enableConsulNamespaces: true,
+			mirroring:              true,
+			prefix:                 "k8s-",
+			expPatches:             []jsonpatch.Operation{protocolPatch},
+		},
+		"mirroring without proxy defaults": {
+			enableConsulNamespaces: true,
+			mirroring:              true,
+			expPatches:             []jsonpatch.Operation{},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			svcDefaults := &ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+			}
+			marshalledRequestObject, err := json.Marshal(svcDefaults)
+			require.NoError(t, err)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(GroupVersion, &ServiceDefaults{}, &ServiceDefaultsList{}, &ProxyDefaults{}, &ProxyDefaultsList{},
+				&ServiceRouter{}, &ServiceRouterList{}, &ServiceSplitter{}, &ServiceSplitterList{})
+			client := fake.NewFakeClientWithScheme(s, c.existingResources...)
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(t, err)
+
+			validator := &ServiceDefaultsWebhook{
+				Client:                     client,
+				Logger:                     logrtest.TestLogger{T: t},
+				EnableConsulNamespaces:     c.enableConsulNamespaces,
+				ConsulDestinationNamespace: c.destinationNamespace,
+				EnableNSMirroring:          c.mirroring,
+				NSMirroringPrefix:          c.prefix,
+				decoder:                    decoder,
+			}
+			response := validator.Handle(ctx, admission.Request{
+				AdmissionRequest: v1beta1.AdmissionRequest{
+					Name:      svcDefaults.KubernetesName(),
+					Namespace: "default",
+					Operation: v1beta1.Create,
+					Object: runtime.RawExtension{
+						Raw: marshalledRequestObject,
+					},
+				},
+			})
+
+			require.True(t, response.Allowed, response.AdmissionResponse.Result.Message)
+			require.ElementsMatch(t, c.expPatches, response.Patches)
+		})
+	}
+}
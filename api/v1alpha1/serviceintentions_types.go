@@ -53,6 +53,9 @@ type ServiceIntentionsSpec struct {
 	// The order of this list does not matter, but out of convenience Consul will always store this
 	// reverse sorted by intention precedence, as that is the order that they will be evaluated at enforcement time.
 	Sources SourceIntentions `json:"sources,omitempty"`
+	// Meta is arbitrary metadata written to the Meta of the config entry in
+	// Consul. Keys starting with "consul.hashicorp.com/" are reserved.
+	Meta map[string]string `json:"meta,omitempty"`
 }
 
 type Destination struct {
@@ -210,7 +213,7 @@ func (in *ServiceIntentions) ToConsul(datacenter string) api.ConfigEntry {
 		Name:      in.Spec.Destination.Name,
 		Namespace: in.Spec.Destination.Namespace,
 		Sources:   in.Spec.Sources.toConsul(),
-		Meta:      meta(datacenter),
+		Meta:      meta(datacenter, in.Spec.Meta),
 	}
 }
 
@@ -224,7 +227,12 @@ func (in *ServiceIntentions) MatchesConsul(candidate api.ConfigEntry) bool {
 		return false
 	}
 
-	// No datacenter is passed to ToConsul as we ignore the Meta field when checking for equality.
+	// The controller's keys in the Meta field differ between datacenters so
+	// only the metadata set on the resource is compared. No datacenter is
+	// passed to ToConsul as the Meta field is ignored below.
+	if !userMetaMatches(in.Spec.Meta, configEntry.Meta) {
+		return false
+	}
 	return cmp.Equal(
 		in.ToConsul(""),
 		configEntry,
@@ -242,6 +250,11 @@ func (in *ServiceIntentions) MatchesConsul(candidate api.ConfigEntry) bool {
 	)
 }
 
+// ConsulMeta returns the metadata written to the Meta of the config entry.
+func (in *ServiceIntentions) ConsulMeta() map[string]string {
+	return in.Spec.Meta
+}
+
 func (in *ServiceIntentions) Validate(namespacesEnabled bool) error {
 	var errs field.ErrorList
 	path := field.NewPath("spec")
@@ -25,6 +25,9 @@ type ServiceIntentionsWebhook struct {
 	EnableNSMirroring          bool
 	ConsulDestinationNamespace string
 	NSMirroringPrefix          string
+	// ConsulValidation configures denying the creation of resources that
+	// conflict with config entries that already exist in Consul.
+	ConsulValidation common.ConsulValidation
 }
 
 // NOTE: The path value in the below line is the path to the webhook.
@@ -41,12 +44,15 @@ func (v *ServiceIntentionsWebhook) Handle(ctx context.Context, req admission.Req
 	var svcIntentionsList ServiceIntentionsList
 	err := v.decoder.Decode(req, &svcIntentions)
 	if err != nil {
-		return admission.Errored(http.StatusBadRequest, err)
+		return common.RecordDenied(common.ServiceIntentions, common.DenialError, http.StatusBadRequest, err)
 	}
 
+	if resp, ok := common.ValidateConsulName(&svcIntentions); !ok {
+		return resp
+	}
 	defaultingPatches, err := common.DefaultingPatches(&svcIntentions, v.EnableConsulNamespaces, v.EnableNSMirroring, v.ConsulDestinationNamespace, v.NSMirroringPrefix)
 	if err != nil {
-		return admission.Errored(http.StatusInternalServerError, err)
+		return common.RecordDenied(svcIntentions.KubeKind(), common.DenialError, http.StatusInternalServerError, err)
 	}
 
 	singleConsulDestNS := !(v.EnableConsulNamespaces && v.EnableNSMirroring)
@@ -54,7 +60,7 @@ func (v *ServiceIntentionsWebhook) Handle(ctx context.Context, req admission.Req
 		v.Logger.Info("validate create", "name", svcIntentions.KubernetesName())
 
 		if err := v.Client.List(ctx, &svcIntentionsList); err != nil {
-			return admission.Errored(http.StatusInternalServerError, err)
+			return common.RecordDenied(svcIntentions.KubeKind(), common.DenialError, http.StatusInternalServerError, err)
 		}
 
 		for _, item := range svcIntentionsList.Items {
@@ -62,41 +68,47 @@ func (v *ServiceIntentionsWebhook) Handle(ctx context.Context, req admission.Req
 				// If all config entries will be registered in the same Consul namespace, then spec.name
 				// must be unique for all entries so two custom resources don't configure the same Consul resource.
 				if item.Spec.Destination.Name == svcIntentions.Spec.Destination.Name {
-					return admission.Errored(http.StatusBadRequest,
+					return common.RecordDenied(svcIntentions.KubeKind(), common.DenialNameConflict, http.StatusBadRequest,
 						fmt.Errorf("an existing ServiceIntentions resource has `spec.destination.name: %s`", svcIntentions.Spec.Destination.Name))
 				}
 				// If namespace mirroring is enabled, each config entry will be registered in the Consul namespace
 				// set in spec.namespace. Thus we must check that there isn't already a config entry that sets the same spec.name and spec.namespace.
 			} else if item.Spec.Destination.Name == svcIntentions.Spec.Destination.Name && item.Spec.Destination.Namespace == svcIntentions.Spec.Destination.Namespace {
-				return admission.Errored(http.StatusBadRequest,
+				return common.RecordDenied(svcIntentions.KubeKind(), common.DenialNameConflict, http.StatusBadRequest,
 					fmt.Errorf("an existing ServiceIntentions resource has `spec.destination.name: %s` and `spec.destination.namespace: %s`", svcIntentions.Spec.Destination.Name, svcIntentions.Spec.Destination.Namespace))
 			}
 		}
+
+		// The destination namespace was defaulted above so the Consul
+		// namespace is set on the config entry.
+		if resp, ok := v.ConsulValidation.Validate(&svcIntentions, svcIntentions.ToConsul("").GetNamespace()); !ok {
+			return resp
+		}
 	} else if req.Operation == v1beta1.Update {
 		v.Logger.Info("validate update", "name", svcIntentions.KubernetesName())
 		var prevIntention, newIntention ServiceIntentions
 		if err := v.decoder.DecodeRaw(*req.OldObject.DeepCopy(), &prevIntention); err != nil {
-			return admission.Errored(http.StatusInternalServerError, err)
+			return common.RecordDenied(svcIntentions.KubeKind(), common.DenialError, http.StatusInternalServerError, err)
 		}
 		if err := v.decoder.DecodeRaw(*req.Object.DeepCopy(), &newIntention); err != nil {
-			return admission.Errored(http.StatusInternalServerError, err)
+			return common.RecordDenied(svcIntentions.KubeKind(), common.DenialError, http.StatusInternalServerError, err)
 		}
 
 		// validate that name and namespace of a resource cannot be updated so ensure no dangling intentions in Consul
 		if prevIntention.Spec.Destination.Name != newIntention.Spec.Destination.Name || prevIntention.Spec.Destination.Namespace != newIntention.Spec.Destination.Namespace {
-			return admission.Errored(http.StatusBadRequest, errors.New("spec.destination.name and spec.destination.namespace are immutable fields for ServiceIntentions"))
+			return common.RecordDenied(svcIntentions.KubeKind(), common.DenialValidation, http.StatusBadRequest, errors.New("spec.destination.name and spec.destination.namespace are immutable fields for ServiceIntentions"))
 		}
 	}
 
 	// ServiceIntentions are invalid if destination namespaces or source namespaces are set when Consul Namespaces are not enabled.
 	if err := svcIntentions.Validate(v.EnableConsulNamespaces); err != nil {
-		return admission.Errored(http.StatusBadRequest, err)
+		return common.RecordDenied(svcIntentions.KubeKind(), common.DenialValidation, http.StatusBadRequest, err)
 	}
 
 	// We always return an admission.Patched() response, even if there are no patches, since
 	// admission.Patched() with no patches is equal to admission.Allowed() under
 	// the hood.
-	return admission.Patched(fmt.Sprintf("valid %s request", svcIntentions.KubeKind()), defaultingPatches...)
+	return common.RecordAllowed(svcIntentions.KubeKind(), admission.Patched(fmt.Sprintf("valid %s request", svcIntentions.KubeKind()), defaultingPatches...))
 }
 
 func (v *ServiceIntentionsWebhook) InjectDecoder(d *admission.Decoder) error {
@@ -73,6 +73,36 @@ func TestHandle_ServiceIntentions_Create(t *testing.T) {
 			mirror:        false,
 			expErrMessage: "serviceintentions.consul.hashicorp.com \"foo-intention\" is invalid: spec.sources[0].action: Invalid value: \"fail\": must be one of \"allow\", \"deny\"",
 		},
+		"action and permissions": {
+			existingResources: nil,
+			newResource: &ServiceIntentions{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo-intention",
+				},
+				Spec: ServiceIntentionsSpec{
+					Destination: Destination{
+						Name: "foo",
+					},
+					Sources: SourceIntentions{
+						{
+							Name:   "bar",
+							Action: "allow",
+							Permissions: IntentionPermissions{
+								{
+									Action: "deny",
+									HTTP: &IntentionHTTPPermission{
+										PathPrefix: "/admin",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expAllow:      false,
+			mirror:        false,
+			expErrMessage: `serviceintentions.consul.hashicorp.com "foo-intention" is invalid: spec.sources[0]: Invalid value: "{\"name\":\"bar\",\"action\":\"allow\",\"permissions\":[{\"action\":\"deny\",\"http\":{\"pathPrefix\":\"/admin\"}}]}": action and permissions are mutually exclusive and only one of them can be specified`,
+		},
 		"intention managing service exists": {
 			existingResources: []runtime.Object{&ServiceIntentions{
 				ObjectMeta: metav1.ObjectMeta{
@@ -0,0 +1,204 @@
+package v1alpha1
+
+import (
+	"github.com/hashicorp/consul-k8s/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// ConvertTo converts this ServiceResolver to the hub version.
+func (in *ServiceResolver) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1beta1.ServiceResolver)
+	if !ok {
+		return unsupportedHubErr(dstRaw)
+	}
+	dst.ObjectMeta = in.ObjectMeta
+	dst.Spec = v1beta1.ServiceResolverSpec{
+		DefaultSubset:  in.Spec.DefaultSubset,
+		Subsets:        in.Spec.Subsets.toHub(),
+		Redirect:       in.Spec.Redirect.toHub(),
+		Failover:       in.Spec.Failover.toHub(),
+		ConnectTimeout: in.Spec.ConnectTimeout,
+		LoadBalancer:   in.Spec.LoadBalancer.toHub(),
+		Meta:           in.Spec.Meta,
+	}
+	dst.Status = in.Status.toHub()
+	return nil
+}
+
+// ConvertFrom converts the hub version to this ServiceResolver.
+func (in *ServiceResolver) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1beta1.ServiceResolver)
+	if !ok {
+		return unsupportedHubErr(srcRaw)
+	}
+	in.ObjectMeta = src.ObjectMeta
+	in.Spec = ServiceResolverSpec{
+		DefaultSubset:  src.Spec.DefaultSubset,
+		Subsets:        subsetsFromHub(src.Spec.Subsets),
+		Redirect:       redirectFromHub(src.Spec.Redirect),
+		Failover:       failoverFromHub(src.Spec.Failover),
+		ConnectTimeout: src.Spec.ConnectTimeout,
+		LoadBalancer:   loadBalancerFromHub(src.Spec.LoadBalancer),
+		Meta:           src.Spec.Meta,
+	}
+	in.Status = statusFromHub(src.Status)
+	return nil
+}
+
+func (in ServiceResolverSubsetMap) toHub() v1beta1.ServiceResolverSubsetMap {
+	if in == nil {
+		return nil
+	}
+	m := make(v1beta1.ServiceResolverSubsetMap, len(in))
+	for k, v := range in {
+		m[k] = v1beta1.ServiceResolverSubset{
+			Filter:      v.Filter,
+			OnlyPassing: v.OnlyPassing,
+		}
+	}
+	return m
+}
+
+func subsetsFromHub(hub v1beta1.ServiceResolverSubsetMap) ServiceResolverSubsetMap {
+	if hub == nil {
+		return nil
+	}
+	m := make(ServiceResolverSubsetMap, len(hub))
+	for k, v := range hub {
+		m[k] = ServiceResolverSubset{
+			Filter:      v.Filter,
+			OnlyPassing: v.OnlyPassing,
+		}
+	}
+	return m
+}
+
+func (in *ServiceResolverRedirect) toHub() *v1beta1.ServiceResolverRedirect {
+	if in == nil {
+		return nil
+	}
+	return &v1beta1.ServiceResolverRedirect{
+		Service:       in.Service,
+		ServiceSubset: in.ServiceSubset,
+		Namespace:     in.Namespace,
+		Datacenter:    in.Datacenter,
+	}
+}
+
+func redirectFromHub(hub *v1beta1.ServiceResolverRedirect) *ServiceResolverRedirect {
+	if hub == nil {
+		return nil
+	}
+	return &ServiceResolverRedirect{
+		Service:       hub.Service,
+		ServiceSubset: hub.ServiceSubset,
+		Namespace:     hub.Namespace,
+		Datacenter:    hub.Datacenter,
+	}
+}
+
+func (in ServiceResolverFailoverMap) toHub() v1beta1.ServiceResolverFailoverMap {
+	if in == nil {
+		return nil
+	}
+	m := make(v1beta1.ServiceResolverFailoverMap, len(in))
+	for k, v := range in {
+		m[k] = v1beta1.ServiceResolverFailover{
+			Service:       v.Service,
+			ServiceSubset: v.ServiceSubset,
+			Namespace:     v.Namespace,
+			Datacenters:   copyStrings(v.Datacenters),
+		}
+	}
+	return m
+}
+
+func failoverFromHub(hub v1beta1.ServiceResolverFailoverMap) ServiceResolverFailoverMap {
+	if hub == nil {
+		return nil
+	}
+	m := make(ServiceResolverFailoverMap, len(hub))
+	for k, v := range hub {
+		m[k] = ServiceResolverFailover{
+			Service:       v.Service,
+			ServiceSubset: v.ServiceSubset,
+			Namespace:     v.Namespace,
+			Datacenters:   copyStrings(v.Datacenters),
+		}
+	}
+	return m
+}
+
+func (in *LoadBalancer) toHub() *v1beta1.LoadBalancer {
+	if in == nil {
+		return nil
+	}
+	lb := &v1beta1.LoadBalancer{Policy: in.Policy}
+	if in.RingHashConfig != nil {
+		lb.RingHashConfig = &v1beta1.RingHashConfig{
+			MinimumRingSize: in.RingHashConfig.MinimumRingSize,
+			MaximumRingSize: in.RingHashConfig.MaximumRingSize,
+		}
+	}
+	if in.LeastRequestConfig != nil {
+		lb.LeastRequestConfig = &v1beta1.LeastRequestConfig{
+			ChoiceCount: in.LeastRequestConfig.ChoiceCount,
+		}
+	}
+	if in.HashPolicies != nil {
+		lb.HashPolicies = make([]v1beta1.HashPolicy, len(in.HashPolicies))
+		for i, p := range in.HashPolicies {
+			lb.HashPolicies[i] = v1beta1.HashPolicy{
+				Field:      p.Field,
+				FieldValue: p.FieldValue,
+				SourceIP:   p.SourceIP,
+				Terminal:   p.Terminal,
+			}
+			if p.CookieConfig != nil {
+				lb.HashPolicies[i].CookieConfig = &v1beta1.CookieConfig{
+					Session: p.CookieConfig.Session,
+					TTL:     p.CookieConfig.TTL,
+					Path:    p.CookieConfig.Path,
+				}
+			}
+		}
+	}
+	return lb
+}
+
+func loadBalancerFromHub(hub *v1beta1.LoadBalancer) *LoadBalancer {
+	if hub == nil {
+		return nil
+	}
+	lb := &LoadBalancer{Policy: hub.Policy}
+	if hub.RingHashConfig != nil {
+		lb.RingHashConfig = &RingHashConfig{
+			MinimumRingSize: hub.RingHashConfig.MinimumRingSize,
+			MaximumRingSize: hub.RingHashConfig.MaximumRingSize,
+		}
+	}
+	if hub.LeastRequestConfig != nil {
+		lb.LeastRequestConfig = &LeastRequestConfig{
+			ChoiceCount: hub.LeastRequestConfig.ChoiceCount,
+		}
+	}
+	if hub.HashPolicies != nil {
+		lb.HashPolicies = make([]HashPolicy, len(hub.HashPolicies))
+		for i, p := range hub.HashPolicies {
+			lb.HashPolicies[i] = HashPolicy{
+				Field:      p.Field,
+				FieldValue: p.FieldValue,
+				SourceIP:   p.SourceIP,
+				Terminal:   p.Terminal,
+			}
+			if p.CookieConfig != nil {
+				lb.HashPolicies[i].CookieConfig = &CookieConfig{
+					Session: p.CookieConfig.Session,
+					TTL:     p.CookieConfig.TTL,
+					Path:    p.CookieConfig.Path,
+				}
+			}
+		}
+	}
+	return lb
+}
@@ -2,6 +2,7 @@ package v1alpha1
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
@@ -22,8 +23,12 @@ func init() {
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:storageversion
 
-// ServiceResolver is the Schema for the serviceresolvers API
+// ServiceResolver is the Schema for the serviceresolvers API. It is served as
+// v1alpha1, the stored version, and v1beta1, which are converted by the
+// /convert webhook of the controller command that is only served with
+// -enable-webhooks.
 // +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status",description="The sync status of the resource with Consul"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="The age of the resource"
 type ServiceResolver struct {
@@ -71,6 +76,9 @@ type ServiceResolverSpec struct {
 	// LoadBalancer determines the load balancing policy and configuration for services
 	// issuing requests to this upstream service.
 	LoadBalancer *LoadBalancer `json:"loadBalancer,omitempty"`
+	// Meta is arbitrary metadata written to the Meta of the config entry in
+	// Consul. Keys starting with "consul.hashicorp.com/" are reserved.
+	Meta map[string]string `json:"meta,omitempty"`
 }
 
 type ServiceResolverRedirect struct {
@@ -122,12 +130,13 @@ type ServiceResolverFailover struct {
 
 type LoadBalancer struct {
 	// Policy is the load balancing policy used to select a host.
+	// Must be one of "random", "round_robin", "least_request", "ring_hash" or "maglev".
 	Policy string `json:"policy,omitempty"`
 
-	// RingHashConfig contains configuration for the "ringHash" policy type.
+	// RingHashConfig contains configuration for the "ring_hash" policy type.
 	RingHashConfig *RingHashConfig `json:"ringHashConfig,omitempty"`
 
-	// LeastRequestConfig contains configuration for the "leastRequest" policy type.
+	// LeastRequestConfig contains configuration for the "least_request" policy type.
 	LeastRequestConfig *LeastRequestConfig `json:"leastRequestConfig,omitempty"`
 
 	// HashPolicies is a list of hash policies to use for hashing load balancing algorithms.
@@ -267,7 +276,7 @@ func (in *ServiceResolver) ToConsul(datacenter string) capi.ConfigEntry {
 		Failover:       in.Spec.Failover.toConsul(),
 		ConnectTimeout: in.Spec.ConnectTimeout,
 		LoadBalancer:   in.Spec.LoadBalancer.toConsul(),
-		Meta:           meta(datacenter),
+		Meta:           meta(datacenter, in.Spec.Meta),
 	}
 }
 
@@ -276,10 +285,20 @@ func (in *ServiceResolver) MatchesConsul(candidate capi.ConfigEntry) bool {
 	if !ok {
 		return false
 	}
-	// No datacenter is passed to ToConsul as we ignore the Meta field when checking for equality.
+	// The controller's keys in the Meta field differ between datacenters so
+	// only the metadata set on the resource is compared. No datacenter is
+	// passed to ToConsul as the Meta field is ignored below.
+	if !userMetaMatches(in.Spec.Meta, configEntry.Meta) {
+		return false
+	}
 	return cmp.Equal(in.ToConsul(""), configEntry, cmpopts.IgnoreFields(capi.ServiceResolverConfigEntry{}, "Namespace", "Meta", "ModifyIndex", "CreateIndex"), cmpopts.IgnoreUnexported(), cmpopts.EquateEmpty())
 }
 
+// ConsulMeta returns the metadata written to the Meta of the config entry.
+func (in *ServiceResolver) ConsulMeta() map[string]string {
+	return in.Spec.Meta
+}
+
 func (in *ServiceResolver) ConsulGlobalResource() bool {
 	return false
 }
@@ -294,6 +313,13 @@ func (in *ServiceResolver) Validate(namespacesEnabled bool) error {
 		}
 	}
 
+	if in.Spec.ConnectTimeout < 0 {
+		errs = append(errs, field.Invalid(path.Child("connectTimeout"), in.Spec.ConnectTimeout.String(),
+			"must be a non-negative duration"))
+	}
+
+	errs = append(errs, in.validateSubsetReferences()...)
+
 	errs = append(errs, in.Spec.LoadBalancer.validate(path.Child("loadBalancer"))...)
 
 	errs = append(errs, in.validateNamespaces(namespacesEnabled)...)
@@ -424,6 +450,9 @@ func (in *CookieConfig) validate(path *field.Path) *field.Error {
 		return nil
 	}
 
+	if in.TTL < 0 {
+		return field.Invalid(path.Child("ttl"), in.TTL.String(), "must be a non-negative duration")
+	}
 	if in.Session && in.TTL > 0 {
 		asJSON, _ := json.Marshal(in)
 		return field.Invalid(path, string(asJSON), "cannot set both session and ttl")
@@ -450,6 +479,39 @@ func (in *ServiceResolver) validateNamespaces(namespacesEnabled bool) field.Erro
 	return errs
 }
 
+// validateSubsetReferences validates that the subsets referenced by
+// defaultSubset, failover and redirect are defined in subsets. Subsets of
+// other services can't be checked so references to them are skipped.
+func (in *ServiceResolver) validateSubsetReferences() field.ErrorList {
+	var errs field.ErrorList
+	path := field.NewPath("spec")
+	const notDefined = "subset is not defined in spec.subsets"
+
+	if in.Spec.DefaultSubset != "" && !in.hasSubset(in.Spec.DefaultSubset) {
+		errs = append(errs, field.Invalid(path.Child("defaultSubset"), in.Spec.DefaultSubset, notDefined))
+	}
+	if r := in.Spec.Redirect; r != nil && r.ServiceSubset != "" && in.isLocalService(r.Service) && !in.hasSubset(r.ServiceSubset) {
+		errs = append(errs, field.Invalid(path.Child("redirect").Child("serviceSubset"), r.ServiceSubset, notDefined))
+	}
+	for k, v := range in.Spec.Failover {
+		if v.ServiceSubset != "" && in.isLocalService(v.Service) && !in.hasSubset(v.ServiceSubset) {
+			errs = append(errs, field.Invalid(path.Child("failover").Key(k).Child("serviceSubset"), v.ServiceSubset, notDefined))
+		}
+	}
+	return errs
+}
+
+func (in *ServiceResolver) hasSubset(name string) bool {
+	_, ok := in.Spec.Subsets[name]
+	return ok
+}
+
+// isLocalService returns true if service refers to the service this
+// resolver is for.
+func (in *ServiceResolver) isLocalService(service string) bool {
+	return service == "" || service == in.ConsulName()
+}
+
 func (in *ServiceResolverFailover) validate(path *field.Path) *field.Error {
 	if in.Service == "" && in.ServiceSubset == "" && in.Namespace == "" && len(in.Datacenters) == 0 {
 		// NOTE: We're passing "{}" here as our value because we know that the
@@ -465,6 +527,21 @@ func (in *LoadBalancer) validate(path *field.Path) field.ErrorList {
 		return nil
 	}
 	var errs field.ErrorList
+	validPolicies := []string{"", "random", "round_robin", "least_request", "ring_hash", "maglev"}
+	if !sliceContains(validPolicies, in.Policy) {
+		errs = append(errs, field.Invalid(path.Child("policy"), in.Policy,
+			notInSliceMessage(validPolicies[1:])))
+	}
+	if in.RingHashConfig != nil && in.Policy != "ring_hash" {
+		asJSON, _ := json.Marshal(in.RingHashConfig)
+		errs = append(errs, field.Invalid(path.Child("ringHashConfig"), string(asJSON),
+			fmt.Sprintf(`can only be set for the "ring_hash" policy, got %q`, in.Policy)))
+	}
+	if in.LeastRequestConfig != nil && in.Policy != "least_request" {
+		asJSON, _ := json.Marshal(in.LeastRequestConfig)
+		errs = append(errs, field.Invalid(path.Child("leastRequestConfig"), string(asJSON),
+			fmt.Sprintf(`can only be set for the "least_request" policy, got %q`, in.Policy)))
+	}
 	for i, p := range in.HashPolicies {
 		errs = append(errs, p.validate(path.Child("hashPolicies").Index(i))...)
 	}
@@ -161,6 +161,25 @@ func TestServiceResolver_MatchesConsul(t *testing.T) {
 			},
 			Matches: true,
 		},
+		"different default subset does not match": {
+			Ours: ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "name",
+				},
+				Spec: ServiceResolverSpec{
+					DefaultSubset: "v1",
+				},
+			},
+			Theirs: &capi.ServiceResolverConfigEntry{
+				Name:          "name",
+				Kind:          capi.ServiceResolver,
+				DefaultSubset: "v2",
+				Namespace:     "foobar",
+				CreateIndex:   1,
+				ModifyIndex:   2,
+			},
+			Matches: false,
+		},
 		"different types does not match": {
 			Ours: ServiceResolver{
 				ObjectMeta: metav1.ObjectMeta{
@@ -489,6 +508,59 @@ func TestServiceResolver_Validate(t *testing.T) {
 			namespacesEnabled: false,
 			expectedErrMsgs:   nil,
 		},
+		"subset references: valid": {
+			input: &ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceResolverSpec{
+					DefaultSubset: "v1",
+					Subsets: map[string]ServiceResolverSubset{
+						"v1": {Filter: "Service.Meta.version == v1"},
+						"v2": {Filter: "Service.Meta.version == v2"},
+					},
+					Failover: map[string]ServiceResolverFailover{
+						"v1": {
+							ServiceSubset: "v2",
+						},
+						"v2": {
+							Service:       "bar",
+							ServiceSubset: "undefined-in-foo",
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs:   nil,
+		},
+		"subset references: undefined subsets": {
+			input: &ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceResolverSpec{
+					DefaultSubset: "v3",
+					Subsets: map[string]ServiceResolverSubset{
+						"v1": {Filter: "Service.Meta.version == v1"},
+					},
+					Redirect: &ServiceResolverRedirect{
+						Service:       "foo",
+						ServiceSubset: "v4",
+					},
+					Failover: map[string]ServiceResolverFailover{
+						"v1": {
+							ServiceSubset: "v5",
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				`spec.defaultSubset: Invalid value: "v3": subset is not defined in spec.subsets`,
+				`spec.redirect.serviceSubset: Invalid value: "v4": subset is not defined in spec.subsets`,
+				`spec.failover[v1].serviceSubset: Invalid value: "v5": subset is not defined in spec.subsets`,
+			},
+		},
 		"failover service, servicesubset, namespace, datacenters empty": {
 			input: &ServiceResolver{
 				ObjectMeta: metav1.ObjectMeta{
@@ -517,6 +589,68 @@ func TestServiceResolver_Validate(t *testing.T) {
 				"spec.failover[failB]: Invalid value: \"{}\": service, serviceSubset, namespace and datacenters cannot all be empty at once",
 			},
 		},
+		"loadBalancer ring_hash config valid": {
+			input: &ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceResolverSpec{
+					LoadBalancer: &LoadBalancer{
+						Policy: "ring_hash",
+						RingHashConfig: &RingHashConfig{
+							MinimumRingSize: 1024,
+							MaximumRingSize: 8192,
+						},
+						HashPolicies: []HashPolicy{
+							{
+								Field:      "header",
+								FieldValue: "x-user-id",
+							},
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs:   nil,
+		},
+		"loadBalancer policy invalid": {
+			input: &ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceResolverSpec{
+					LoadBalancer: &LoadBalancer{
+						Policy: "ringHash",
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				`serviceresolver.consul.hashicorp.com "foo" is invalid: spec.loadBalancer.policy: Invalid value: "ringHash": must be one of "random", "round_robin", "least_request", "ring_hash", "maglev"`,
+			},
+		},
+		"loadBalancer config mismatched with policy": {
+			input: &ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceResolverSpec{
+					LoadBalancer: &LoadBalancer{
+						Policy: "least_request",
+						RingHashConfig: &RingHashConfig{
+							MinimumRingSize: 1024,
+						},
+						LeastRequestConfig: &LeastRequestConfig{
+							ChoiceCount: 2,
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				`spec.loadBalancer.ringHashConfig: Invalid value: "{\"minimumRingSize\":1024}": can only be set for the "ring_hash" policy, got "least_request"`,
+			},
+		},
 		"hashPolicy.field invalid": {
 			input: &ServiceResolver{
 				ObjectMeta: metav1.ObjectMeta{
@@ -582,6 +716,55 @@ func TestServiceResolver_Validate(t *testing.T) {
 				`serviceresolver.consul.hashicorp.com "foo" is invalid: spec.loadBalancer.hashPolicies[0].cookieConfig: Invalid value: "{\"session\":true,\"ttl\":100}": cannot set both session and ttl`,
 			},
 		},
+		"connectTimeout valid": {
+			input: &ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceResolverSpec{
+					ConnectTimeout: 5 * time.Second,
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs:   nil,
+		},
+		"connectTimeout negative": {
+			input: &ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceResolverSpec{
+					ConnectTimeout: -5 * time.Second,
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				`serviceresolver.consul.hashicorp.com "foo" is invalid: spec.connectTimeout: Invalid value: "-5s": must be a non-negative duration`,
+			},
+		},
+		"cookieConfig ttl negative": {
+			input: &ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceResolverSpec{
+					LoadBalancer: &LoadBalancer{
+						HashPolicies: []HashPolicy{
+							{
+								Field: "cookie",
+								CookieConfig: &CookieConfig{
+									TTL: -time.Minute,
+								},
+							},
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				`serviceresolver.consul.hashicorp.com "foo" is invalid: spec.loadBalancer.hashPolicies[0].cookieConfig.ttl: Invalid value: "-1m0s": must be a non-negative duration`,
+			},
+		},
 		"namespaces disabled: redirect namespace specified": {
 			input: &ServiceResolver{
 				ObjectMeta: metav1.ObjectMeta{
@@ -38,6 +38,10 @@ type ServiceResolverWebhook struct {
 	// `k8s-staging` Consul namespace.
 	NSMirroringPrefix string
 
+	// ConsulValidation configures denying the creation of resources that
+	// conflict with config entries that already exist in Consul.
+	ConsulValidation common.ConsulValidation
+
 	decoder *admission.Decoder
 	client.Client
 }
@@ -54,7 +58,7 @@ func (v *ServiceResolverWebhook) Handle(ctx context.Context, req admission.Reque
 	var svcResolver ServiceResolver
 	err := v.decoder.Decode(req, &svcResolver)
 	if err != nil {
-		return admission.Errored(http.StatusBadRequest, err)
+		return common.RecordDenied(common.ServiceResolver, common.DenialError, http.StatusBadRequest, err)
 	}
 
 	return common.ValidateConfigEntry(ctx,
@@ -62,6 +66,7 @@ func (v *ServiceResolverWebhook) Handle(ctx context.Context, req admission.Reque
 		v.Logger,
 		v,
 		&svcResolver,
+		v.ConsulValidation,
 		v.EnableConsulNamespaces,
 		v.EnableNSMirroring,
 		v.ConsulDestinationNamespace,
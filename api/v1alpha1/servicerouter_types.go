@@ -53,6 +53,9 @@ type ServiceRouterSpec struct {
 	// evaluation. Traffic that fails to match any of the provided routes will
 	// be routed to the default service.
 	Routes []ServiceRoute `json:"routes,omitempty"`
+	// Meta is arbitrary metadata written to the Meta of the config entry in
+	// Consul. Keys starting with "consul.hashicorp.com/" are reserved.
+	Meta map[string]string `json:"meta,omitempty"`
 }
 
 type ServiceRoute struct {
@@ -226,7 +229,7 @@ func (in *ServiceRouter) ToConsul(datacenter string) capi.ConfigEntry {
 		Kind:   in.ConsulKind(),
 		Name:   in.ConsulName(),
 		Routes: routes,
-		Meta:   meta(datacenter),
+		Meta:   meta(datacenter, in.Spec.Meta),
 	}
 }
 
@@ -235,10 +238,20 @@ func (in *ServiceRouter) MatchesConsul(candidate capi.ConfigEntry) bool {
 	if !ok {
 		return false
 	}
-	// No datacenter is passed to ToConsul as we ignore the Meta field when checking for equality.
+	// The controller's keys in the Meta field differ between datacenters so
+	// only the metadata set on the resource is compared. No datacenter is
+	// passed to ToConsul as the Meta field is ignored below.
+	if !userMetaMatches(in.Spec.Meta, configEntry.Meta) {
+		return false
+	}
 	return cmp.Equal(in.ToConsul(""), configEntry, cmpopts.IgnoreFields(capi.ServiceRouterConfigEntry{}, "Namespace", "Meta", "ModifyIndex", "CreateIndex"), cmpopts.IgnoreUnexported(), cmpopts.EquateEmpty())
 }
 
+// ConsulMeta returns the metadata written to the Meta of the config entry.
+func (in *ServiceRouter) ConsulMeta() map[string]string {
+	return in.Spec.Meta
+}
+
 func (in *ServiceRouter) Validate(namespacesEnabled bool) error {
 	var errs field.ErrorList
 	path := field.NewPath("spec")
@@ -352,7 +365,24 @@ func (in ServiceRoute) validate(path *field.Path) field.ErrorList {
 		}
 	}
 	errs = append(errs, in.Match.validate(path.Child("match"))...)
+	errs = append(errs, in.Destination.validate(path.Child("destination"))...)
+
+	return errs
+}
 
+func (in *ServiceRouteDestination) validate(path *field.Path) field.ErrorList {
+	if in == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	if in.RequestTimeout < 0 {
+		errs = append(errs, field.Invalid(path.Child("requestTimeout"), in.RequestTimeout.String(), "must not be negative"))
+	}
+	for i, code := range in.RetryOnStatusCodes {
+		if code < 100 || code > 599 {
+			errs = append(errs, field.Invalid(path.Child("retryOnStatusCodes").Index(i), int(code), "must be a valid HTTP status code between 100 and 599"))
+		}
+	}
 	return errs
 }
 
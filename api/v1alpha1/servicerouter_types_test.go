@@ -538,6 +538,30 @@ func TestServiceRouter_Validate(t *testing.T) {
 				`servicerouter.consul.hashicorp.com "foo" is invalid: spec.routes[0]: Invalid value: "{\"match\":{\"http\":{}},\"destination\":{\"prefixRewrite\":\"prefixRewrite\"}}": destination.prefixRewrite requires that either match.http.pathPrefix or match.http.pathExact be configured on this route`,
 			},
 		},
+		"destination requestTimeout and retryOnStatusCodes": {
+			input: &ServiceRouter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceRouterSpec{
+					Routes: []ServiceRoute{
+						{
+							Destination: &ServiceRouteDestination{
+								Service:            "destA",
+								RequestTimeout:     -1 * time.Second,
+								RetryOnStatusCodes: []uint32{503, 99, 600},
+							},
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				`spec.routes[0].destination.requestTimeout: Invalid value: "-1s": must not be negative`,
+				`spec.routes[0].destination.retryOnStatusCodes[1]: Invalid value: 99: must be a valid HTTP status code between 100 and 599`,
+				`spec.routes[0].destination.retryOnStatusCodes[2]: Invalid value: 600: must be a valid HTTP status code between 100 and 599`,
+			},
+		},
 		"namespaces disabled: single destination namespace specified": {
 			input: &ServiceRouter{
 				ObjectMeta: metav1.ObjectMeta{
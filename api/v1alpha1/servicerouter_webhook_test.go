@@ -0,0 +1,210 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	logrtest "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/require"
+	"gomodules.xyz/jsonpatch/v2"
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestValidateServiceRouter(t *testing.T) {
+	otherNS := "other"
+
+	cases := map[string]struct {
+		existingResources []runtime.Object
+		newResource       *ServiceRouter
+		expAllow          bool
+		expErrMessage     string
+	}{
+		"no duplicates, valid": {
+			existingResources: nil,
+			newResource: &ServiceRouter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceRouterSpec{
+					Routes: []ServiceRoute{
+						{
+							Match: &ServiceRouteMatch{
+								HTTP: &ServiceRouteHTTPMatch{
+									PathPrefix: "/admin",
+								},
+							},
+							Destination: &ServiceRouteDestination{
+								Service: "admin",
+							},
+						},
+					},
+				},
+			},
+			expAllow: true,
+		},
+		"invalid match": {
+			existingResources: nil,
+			newResource: &ServiceRouter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceRouterSpec{
+					Routes: []ServiceRoute{
+						{
+							Match: &ServiceRouteMatch{
+								HTTP: &ServiceRouteHTTPMatch{
+									PathExact:  "/exact",
+									PathPrefix: "/prefix",
+								},
+							},
+						},
+					},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: `servicerouter.consul.hashicorp.com "foo" is invalid: spec.routes[0].match.http: Invalid value: "{\"pathExact\":\"/exact\",\"pathPrefix\":\"/prefix\"}": at most only one of pathExact, pathPrefix, or pathRegex may be configured`,
+		},
+		"service router exists in another namespace": {
+			existingResources: []runtime.Object{&ServiceRouter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+			}},
+			newResource: &ServiceRouter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: otherNS,
+				},
+			},
+			expAllow:      false,
+			expErrMessage: "servicerouter resource with name \"foo\" is already defined – all servicerouter resources must have unique names across namespaces",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			marshalledRequestObject, err := json.Marshal(c.newResource)
+			require.NoError(t, err)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(GroupVersion, &ServiceRouter{}, &ServiceRouterList{})
+			client := fake.NewFakeClientWithScheme(s, c.existingResources...)
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(t, err)
+
+			validator := &ServiceRouterWebhook{
+				Client:       client,
+				ConsulClient: nil,
+				Logger:       logrtest.TestLogger{T: t},
+				decoder:      decoder,
+			}
+			response := validator.Handle(ctx, admission.Request{
+				AdmissionRequest: v1beta1.AdmissionRequest{
+					Name:      c.newResource.KubernetesName(),
+					Namespace: otherNS,
+					Operation: v1beta1.Create,
+					Object: runtime.RawExtension{
+						Raw: marshalledRequestObject,
+					},
+				},
+			})
+
+			require.Equal(t, c.expAllow, response.Allowed)
+			if c.expErrMessage != "" {
+				require.Equal(t, c.expErrMessage, response.AdmissionResponse.Result.Message)
+			}
+		})
+	}
+}
+
+func TestHandle_ServiceRouter_Patches(t *testing.T) {
+	otherNS := "other"
+
+	cases := map[string]struct {
+		newResource *ServiceRouter
+		expPatches  []jsonpatch.Operation
+	}{
+		"destination.namespace set": {
+			newResource: &ServiceRouter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "bar",
+				},
+				Spec: ServiceRouterSpec{
+					Routes: []ServiceRoute{
+						{
+							Destination: &ServiceRouteDestination{
+								Service:   "baz",
+								Namespace: "baz",
+							},
+						},
+					},
+				},
+			},
+			expPatches: []jsonpatch.Operation{},
+		},
+		"destination.namespace empty": {
+			newResource: &ServiceRouter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "bar",
+				},
+				Spec: ServiceRouterSpec{
+					Routes: []ServiceRoute{
+						{
+							Destination: &ServiceRouteDestination{
+								Service: "baz",
+							},
+						},
+					},
+				},
+			},
+			expPatches: []jsonpatch.Operation{
+				{
+					Operation: "add",
+					Path:      "/spec/routes/0/destination/namespace",
+					Value:     "bar",
+				},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			marshalledRequestObject, err := json.Marshal(c.newResource)
+			require.NoError(t, err)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(GroupVersion, &ServiceRouter{}, &ServiceRouterList{})
+			client := fake.NewFakeClientWithScheme(s)
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(t, err)
+
+			validator := &ServiceRouterWebhook{
+				Client:                 client,
+				ConsulClient:           nil,
+				Logger:                 logrtest.TestLogger{T: t},
+				decoder:                decoder,
+				EnableConsulNamespaces: true,
+				EnableNSMirroring:      true,
+			}
+			response := validator.Handle(ctx, admission.Request{
+				AdmissionRequest: v1beta1.AdmissionRequest{
+					Name:      c.newResource.KubernetesName(),
+					Namespace: otherNS,
+					Operation: v1beta1.Create,
+					Object: runtime.RawExtension{
+						Raw: marshalledRequestObject,
+					},
+				},
+			})
+
+			require.Equal(t, true, response.Allowed, response.AdmissionResponse.Result.Message)
+			require.ElementsMatch(t, c.expPatches, response.Patches)
+		})
+	}
+}
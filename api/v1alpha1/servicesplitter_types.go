@@ -3,6 +3,7 @@ package v1alpha1
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -49,6 +50,9 @@ type ServiceSplitterSpec struct {
 	// Splits defines how much traffic to send to which set of service instances during a traffic split.
 	// The sum of weights across all splits must add up to 100.
 	Splits ServiceSplits `json:"splits,omitempty"`
+	// Meta is arbitrary metadata written to the Meta of the config entry in
+	// Consul. Keys starting with "consul.hashicorp.com/" are reserved.
+	Meta map[string]string `json:"meta,omitempty"`
 }
 
 type ServiceSplit struct {
@@ -136,7 +140,7 @@ func (in *ServiceSplitter) ToConsul(datacenter string) capi.ConfigEntry {
 		Kind:   in.ConsulKind(),
 		Name:   in.ConsulName(),
 		Splits: in.Spec.Splits.toConsul(),
-		Meta:   meta(datacenter),
+		Meta:   meta(datacenter, in.Spec.Meta),
 	}
 }
 
@@ -153,10 +157,20 @@ func (in *ServiceSplitter) MatchesConsul(candidate capi.ConfigEntry) bool {
 	if !ok {
 		return false
 	}
-	// No datacenter is passed to ToConsul as we ignore the Meta field when checking for equality.
+	// The controller's keys in the Meta field differ between datacenters so
+	// only the metadata set on the resource is compared. No datacenter is
+	// passed to ToConsul as the Meta field is ignored below.
+	if !userMetaMatches(in.Spec.Meta, configEntry.Meta) {
+		return false
+	}
 	return cmp.Equal(in.ToConsul(""), configEntry, cmpopts.IgnoreFields(capi.ServiceSplitterConfigEntry{}, "Namespace", "Meta", "ModifyIndex", "CreateIndex"), cmpopts.IgnoreUnexported(), cmpopts.EquateEmpty())
 }
 
+// ConsulMeta returns the metadata written to the Meta of the config entry.
+func (in *ServiceSplitter) ConsulMeta() map[string]string {
+	return in.Spec.Meta
+}
+
 func (in *ServiceSplitter) Validate(namespacesEnabled bool) error {
 	errs := in.Spec.Splits.validate(field.NewPath("spec").Child("splits"))
 
@@ -222,7 +236,10 @@ func (in ServiceSplits) validate(path *field.Path) field.ErrorList {
 		sumOfWeights += split.Weight
 	}
 
-	if sumOfWeights != 100 {
+	// Compare the sum scaled to the smallest representable weight, like Consul
+	// does, so that float rounding errors, e.g. in 33.33 + 33.33 + 33.34,
+	// aren't rejected.
+	if scaleWeight(sumOfWeights) != scaleWeight(100) {
 		asJSON, _ := json.Marshal(in)
 		errs = append(errs, field.Invalid(path, string(asJSON),
 			fmt.Sprintf("the sum of weights across all splits must add up to 100 percent, but adds up to %f", sumOfWeights)))
@@ -231,6 +248,12 @@ func (in ServiceSplits) validate(path *field.Path) field.ErrorList {
 	return errs
 }
 
+// scaleWeight converts a weight into an integer number of the smallest
+// representable weights (.01%).
+func scaleWeight(v float32) int {
+	return int(math.Round(float64(v) * 100))
+}
+
 func (in ServiceSplit) validate(path *field.Path) *field.Error {
 	// Validate that the weight value is between 0.01 and 100 but allow a weight to be 0.
 	if in.Weight != 0 && (in.Weight > 100 || in.Weight < 0.01) {
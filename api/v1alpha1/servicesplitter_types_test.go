@@ -325,6 +325,49 @@ func TestServiceSplitter_Validate(t *testing.T) {
 			namespacesEnabled: false,
 			expectedErrMsgs:   []string{},
 		},
+		"weights summing to 100 with rounding errors: valid": {
+			input: &ServiceSplitter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceSplitterSpec{
+					Splits: []ServiceSplit{
+						{
+							Weight: 33.33,
+						},
+						{
+							Weight: 33.33,
+						},
+						{
+							Weight: 33.34,
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs:   nil,
+		},
+		"negative weight": {
+			input: &ServiceSplitter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceSplitterSpec{
+					Splits: []ServiceSplit{
+						{
+							Weight: 110,
+						},
+						{
+							Weight: -10,
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				"spec.splits[1].weight: Invalid value: -10: weight must be a percentage between 0.01 and 100",
+			},
+		},
 		"sum of weights must be 100": {
 			input: &ServiceSplitter{
 				ObjectMeta: metav1.ObjectMeta{
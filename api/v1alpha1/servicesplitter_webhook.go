@@ -38,6 +38,10 @@ type ServiceSplitterWebhook struct {
 	// `k8s-staging` Consul namespace.
 	NSMirroringPrefix string
 
+	// ConsulValidation configures denying the creation of resources that
+	// conflict with config entries that already exist in Consul.
+	ConsulValidation common.ConsulValidation
+
 	decoder *admission.Decoder
 	client.Client
 }
@@ -55,7 +59,7 @@ func (v *ServiceSplitterWebhook) Handle(ctx context.Context, req admission.Reque
 	var serviceSplitter ServiceSplitter
 	err := v.decoder.Decode(req, &serviceSplitter)
 	if err != nil {
-		return admission.Errored(http.StatusBadRequest, err)
+		return common.RecordDenied(common.ServiceSplitter, common.DenialError, http.StatusBadRequest, err)
 	}
 
 	return common.ValidateConfigEntry(ctx,
@@ -63,6 +67,7 @@ func (v *ServiceSplitterWebhook) Handle(ctx context.Context, req admission.Reque
 		v.Logger,
 		v,
 		&serviceSplitter,
+		v.ConsulValidation,
 		v.EnableConsulNamespaces,
 		v.EnableNSMirroring,
 		v.ConsulDestinationNamespace,
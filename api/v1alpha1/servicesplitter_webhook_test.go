@@ -0,0 +1,127 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	logrtest "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestValidateServiceSplitter(t *testing.T) {
+	otherNS := "other"
+
+	cases := map[string]struct {
+		existingResources []runtime.Object
+		newResource       *ServiceSplitter
+		expAllow          bool
+		expErrMessage     string
+	}{
+		"no duplicates, valid": {
+			existingResources: nil,
+			newResource: &ServiceSplitter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceSplitterSpec{
+					Splits: []ServiceSplit{
+						{
+							Weight:        90,
+							ServiceSubset: "v1",
+						},
+						{
+							Weight:        10,
+							ServiceSubset: "v2",
+						},
+					},
+				},
+			},
+			expAllow: true,
+		},
+		"weights don't sum to 100": {
+			existingResources: nil,
+			newResource: &ServiceSplitter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceSplitterSpec{
+					Splits: []ServiceSplit{
+						{
+							Weight:        90,
+							ServiceSubset: "v1",
+						},
+						{
+							Weight:        20,
+							ServiceSubset: "v2",
+						},
+					},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: `servicesplitter.consul.hashicorp.com "foo" is invalid: spec.splits: Invalid value: "[{\"weight\":90,\"serviceSubset\":\"v1\"},{\"weight\":20,\"serviceSubset\":\"v2\"}]": the sum of weights across all splits must add up to 100 percent, but adds up to 110.000000`,
+		},
+		"service splitter exists in another namespace": {
+			existingResources: []runtime.Object{&ServiceSplitter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+			}},
+			newResource: &ServiceSplitter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: otherNS,
+				},
+				Spec: ServiceSplitterSpec{
+					Splits: []ServiceSplit{
+						{
+							Weight: 100,
+						},
+					},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: "servicesplitter resource with name \"foo\" is already defined – all servicesplitter resources must have unique names across namespaces",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			marshalledRequestObject, err := json.Marshal(c.newResource)
+			require.NoError(t, err)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(GroupVersion, &ServiceSplitter{}, &ServiceSplitterList{})
+			client := fake.NewFakeClientWithScheme(s, c.existingResources...)
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(t, err)
+
+			validator := &ServiceSplitterWebhook{
+				Client:       client,
+				ConsulClient: nil,
+				Logger:       logrtest.TestLogger{T: t},
+				decoder:      decoder,
+			}
+			response := validator.Handle(ctx, admission.Request{
+				AdmissionRequest: v1beta1.AdmissionRequest{
+					Name:      c.newResource.KubernetesName(),
+					Namespace: otherNS,
+					Operation: v1beta1.Create,
+					Object: runtime.RawExtension{
+						Raw: marshalledRequestObject,
+					},
+				},
+			})
+
+			require.Equal(t, c.expAllow, response.Allowed)
+			if c.expErrMessage != "" {
+				require.Equal(t, c.expErrMessage, response.AdmissionResponse.Result.Message)
+			}
+		})
+	}
+}
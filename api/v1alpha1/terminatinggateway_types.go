@@ -49,6 +49,9 @@ type TerminatingGatewayList struct {
 type TerminatingGatewaySpec struct {
 	// Services is a list of service names represented by the terminating gateway.
 	Services []LinkedService `json:"services,omitempty"`
+	// Meta is arbitrary metadata written to the Meta of the config entry in
+	// Consul. Keys starting with "consul.hashicorp.com/" are reserved.
+	Meta map[string]string `json:"meta,omitempty"`
 }
 
 // A LinkedService is a service represented by a terminating gateway
@@ -60,7 +63,8 @@ type LinkedService struct {
 	Name string `json:"name,omitempty"`
 
 	// CAFile is the optional path to a CA certificate to use for TLS connections
-	// from the gateway to the linked service.
+	// from the gateway to the linked service. It must be set if CertFile and
+	// KeyFile are set.
 	CAFile string `json:"caFile,omitempty"`
 
 	// CertFile is the optional path to a client certificate to use for TLS connections
@@ -158,7 +162,7 @@ func (in *TerminatingGateway) ToConsul(datacenter string) capi.ConfigEntry {
 		Kind:     in.ConsulKind(),
 		Name:     in.ConsulName(),
 		Services: svcs,
-		Meta:     meta(datacenter),
+		Meta:     meta(datacenter, in.Spec.Meta),
 	}
 }
 
@@ -167,10 +171,20 @@ func (in *TerminatingGateway) MatchesConsul(candidate capi.ConfigEntry) bool {
 	if !ok {
 		return false
 	}
-	// No datacenter is passed to ToConsul as we ignore the Meta field when checking for equality.
+	// The controller's keys in the Meta field differ between datacenters so
+	// only the metadata set on the resource is compared. No datacenter is
+	// passed to ToConsul as the Meta field is ignored below.
+	if !userMetaMatches(in.Spec.Meta, configEntry.Meta) {
+		return false
+	}
 	return cmp.Equal(in.ToConsul(""), configEntry, cmpopts.IgnoreFields(capi.TerminatingGatewayConfigEntry{}, "Namespace", "Meta", "ModifyIndex", "CreateIndex"), cmpopts.IgnoreUnexported(), cmpopts.EquateEmpty())
 }
 
+// ConsulMeta returns the metadata written to the Meta of the config entry.
+func (in *TerminatingGateway) ConsulMeta() map[string]string {
+	return in.Spec.Meta
+}
+
 func (in *TerminatingGateway) Validate(namespacesEnabled bool) error {
 	var errs field.ErrorList
 	path := field.NewPath("spec")
@@ -225,6 +239,14 @@ func (in LinkedService) validate(path *field.Path) field.ErrorList {
 			string(asJSON),
 			"if certFile or keyFile is set, the other must also be set"))
 	}
+	// Consul needs the CA to verify the linked service when the gateway
+	// presents a client certificate.
+	if (in.CertFile != "" || in.KeyFile != "") && in.CAFile == "" {
+		asJSON, _ := json.Marshal(in)
+		errs = append(errs, field.Invalid(path,
+			string(asJSON),
+			"if certFile or keyFile is set, caFile must also be set"))
+	}
 	return errs
 }
 
@@ -227,6 +227,44 @@ func TestTerminatingGateway_Validate(t *testing.T) {
 				`spec.services[0]: Invalid value: "{\"name\":\"foo\",\"keyFile\":\"keyFile\"}": if certFile or keyFile is set, the other must also be set`,
 			},
 		},
+		"certFile and keyFile set and caFile not set": {
+			input: &TerminatingGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: TerminatingGatewaySpec{
+					Services: []LinkedService{
+						{
+							Name:     "foo",
+							CertFile: "certFile",
+							KeyFile:  "keyFile",
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				`spec.services[0]: Invalid value: "{\"name\":\"foo\",\"certFile\":\"certFile\",\"keyFile\":\"keyFile\"}": if certFile or keyFile is set, caFile must also be set`,
+			},
+		},
+		"caFile set without certFile and keyFile": {
+			input: &TerminatingGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: TerminatingGatewaySpec{
+					Services: []LinkedService{
+						{
+							Name:   "foo",
+							CAFile: "caFile",
+							SNI:    "sni",
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs:   []string{},
+		},
 		"service.namespace set when namespaces disabled": {
 			input: &TerminatingGateway{
 				ObjectMeta: metav1.ObjectMeta{
@@ -0,0 +1,142 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	logrtest "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestValidateTerminatingGateway(t *testing.T) {
+	otherNS := "other"
+
+	cases := map[string]struct {
+		existingResources []runtime.Object
+		newResource       *TerminatingGateway
+		expAllow          bool
+		expErrMessage     string
+	}{
+		"no duplicates, valid": {
+			existingResources: nil,
+			newResource: &TerminatingGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: TerminatingGatewaySpec{
+					Services: []LinkedService{
+						{
+							Name:     "db",
+							CAFile:   "caFile",
+							CertFile: "certFile",
+							KeyFile:  "keyFile",
+							SNI:      "db.example.com",
+						},
+					},
+				},
+			},
+			expAllow: true,
+		},
+		"certFile without keyFile": {
+			existingResources: nil,
+			newResource: &TerminatingGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: TerminatingGatewaySpec{
+					Services: []LinkedService{
+						{
+							Name:     "db",
+							CAFile:   "caFile",
+							CertFile: "certFile",
+						},
+					},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: `terminatinggateway.consul.hashicorp.com "foo" is invalid: spec.services[0]: Invalid value: "{\"name\":\"db\",\"caFile\":\"caFile\",\"certFile\":\"certFile\"}": if certFile or keyFile is set, the other must also be set`,
+		},
+		"certFile and keyFile without caFile": {
+			existingResources: nil,
+			newResource: &TerminatingGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: TerminatingGatewaySpec{
+					Services: []LinkedService{
+						{
+							Name:     "db",
+							CertFile: "certFile",
+							KeyFile:  "keyFile",
+						},
+					},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: `terminatinggateway.consul.hashicorp.com "foo" is invalid: spec.services[0]: Invalid value: "{\"name\":\"db\",\"certFile\":\"certFile\",\"keyFile\":\"keyFile\"}": if certFile or keyFile is set, caFile must also be set`,
+		},
+		"terminating gateway exists in another namespace": {
+			existingResources: []runtime.Object{&TerminatingGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+			}},
+			newResource: &TerminatingGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: otherNS,
+				},
+				Spec: TerminatingGatewaySpec{
+					Services: []LinkedService{
+						{
+							Name: "db",
+						},
+					},
+				},
+			},
+			expAllow:      false,
+			expErrMessage: "terminatinggateway resource with name \"foo\" is already defined – all terminatinggateway resources must have unique names across namespaces",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			marshalledRequestObject, err := json.Marshal(c.newResource)
+			require.NoError(t, err)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(GroupVersion, &TerminatingGateway{}, &TerminatingGatewayList{})
+			client := fake.NewFakeClientWithScheme(s, c.existingResources...)
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(t, err)
+
+			validator := &TerminatingGatewayWebhook{
+				Client:       client,
+				ConsulClient: nil,
+				Logger:       logrtest.TestLogger{T: t},
+				decoder:      decoder,
+			}
+			response := validator.Handle(ctx, admission.Request{
+				AdmissionRequest: v1beta1.AdmissionRequest{
+					Name:      c.newResource.KubernetesName(),
+					Namespace: otherNS,
+					Operation: v1beta1.Create,
+					Object: runtime.RawExtension{
+						Raw: marshalledRequestObject,
+					},
+				},
+			})
+
+			require.Equal(t, c.expAllow, response.Allowed)
+			if c.expErrMessage != "" {
+				require.Equal(t, c.expErrMessage, response.AdmissionResponse.Result.Message)
+			}
+		})
+	}
+}
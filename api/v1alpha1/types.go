@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/hashicorp/consul-k8s/api/common"
 	capi "github.com/hashicorp/consul/api"
 	"k8s.io/apimachinery/pkg/util/validation/field"
@@ -78,9 +80,26 @@ func invalidPathPrefix(path string) bool {
 	return path != "" && !strings.HasPrefix(path, "/")
 }
 
-func meta(datacenter string) map[string]string {
-	return map[string]string{
-		common.SourceKey:     common.SourceValue,
-		common.DatacenterKey: datacenter,
+// meta returns the Meta of a config entry: the metadata set on the resource
+// along with the keys the controller uses to identify the entries it manages.
+func meta(datacenter string, userMeta map[string]string) map[string]string {
+	m := make(map[string]string, len(userMeta)+2)
+	for k, v := range userMeta {
+		m[k] = v
 	}
+	m[common.SourceKey] = common.SourceValue
+	m[common.DatacenterKey] = datacenter
+	return m
+}
+
+// userMetaMatches returns true if the keys of consulMeta, other than the
+// ones written by the controller, are userMeta.
+func userMetaMatches(userMeta, consulMeta map[string]string) bool {
+	other := make(map[string]string, len(consulMeta))
+	for k, v := range consulMeta {
+		if k != common.SourceKey && k != common.DatacenterKey {
+			other[k] = v
+		}
+	}
+	return cmp.Equal(userMeta, other, cmpopts.EquateEmpty())
 }
@@ -216,6 +216,13 @@ func (in *IngressGatewaySpec) DeepCopyInto(out *IngressGatewaySpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Meta != nil {
+		in, out := &in.Meta, &out.Meta
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressGatewaySpec.
@@ -520,6 +527,13 @@ func (in *ProxyDefaultsSpec) DeepCopyInto(out *ProxyDefaultsSpec) {
 	}
 	out.MeshGateway = in.MeshGateway
 	in.Expose.DeepCopyInto(&out.Expose)
+	if in.Meta != nil {
+		in, out := &in.Meta, &out.Meta
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyDefaultsSpec.
@@ -611,6 +625,13 @@ func (in *ServiceDefaultsSpec) DeepCopyInto(out *ServiceDefaultsSpec) {
 	*out = *in
 	out.MeshGateway = in.MeshGateway
 	in.Expose.DeepCopyInto(&out.Expose)
+	if in.Meta != nil {
+		in, out := &in.Meta, &out.Meta
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceDefaultsSpec.
@@ -697,6 +718,13 @@ func (in *ServiceIntentionsSpec) DeepCopyInto(out *ServiceIntentionsSpec) {
 			}
 		}
 	}
+	if in.Meta != nil {
+		in, out := &in.Meta, &out.Meta
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceIntentionsSpec.
@@ -851,6 +879,13 @@ func (in *ServiceResolverSpec) DeepCopyInto(out *ServiceResolverSpec) {
 		*out = new(LoadBalancer)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Meta != nil {
+		in, out := &in.Meta, &out.Meta
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceResolverSpec.
@@ -1093,6 +1128,13 @@ func (in *ServiceRouterSpec) DeepCopyInto(out *ServiceRouterSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Meta != nil {
+		in, out := &in.Meta, &out.Meta
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceRouterSpec.
@@ -1206,6 +1248,13 @@ func (in *ServiceSplitterSpec) DeepCopyInto(out *ServiceSplitterSpec) {
 		*out = make(ServiceSplits, len(*in))
 		copy(*out, *in)
 	}
+	if in.Meta != nil {
+		in, out := &in.Meta, &out.Meta
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceSplitterSpec.
@@ -1358,6 +1407,13 @@ func (in *TerminatingGatewaySpec) DeepCopyInto(out *TerminatingGatewaySpec) {
 		*out = make([]LinkedService, len(*in))
 		copy(*out, *in)
 	}
+	if in.Meta != nil {
+		in, out := &in.Meta, &out.Meta
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TerminatingGatewaySpec.
@@ -0,0 +1,24 @@
+// Package v1beta1 contains API Schema definitions for the consul.hashicorp.com v1beta1 API group.
+// It is the hub that older versions of the config entries, e.g. v1alpha1, are
+// converted to and from. It isn't served yet so its CRD versions aren't
+// generated.
+// +kubebuilder:object:generate=true
+// +kubebuilder:skipversion
+// +groupName=consul.hashicorp.com
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	// GroupVersion is group version used to register these objects
+	GroupVersion = schema.GroupVersion{Group: "consul.hashicorp.com", Version: "v1beta1"}
+
+	// SchemeBuilder is used to add go types to the GroupVersionKind scheme
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	// AddToScheme adds the types in this group-version to the given scheme.
+	AddToScheme = SchemeBuilder.AddToScheme
+)
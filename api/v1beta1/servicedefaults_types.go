@@ -0,0 +1,82 @@
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	SchemeBuilder.Register(&ServiceDefaults{}, &ServiceDefaultsList{})
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// ServiceDefaults is the Schema for the servicedefaults API. It is served as
+// v1alpha1, the stored version, and v1beta1, which are converted by the
+// /convert webhook of the controller command that is only served with
+// -enable-webhooks.
+// +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status",description="The sync status of the resource with Consul"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="The age of the resource"
+type ServiceDefaults struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ServiceDefaultsSpec `json:"spec,omitempty"`
+	Status            `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ServiceDefaultsList contains a list of ServiceDefaults
+type ServiceDefaultsList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ServiceDefaults `json:"items"`
+}
+
+// ServiceDefaultsSpec defines the desired state of ServiceDefaults
+type ServiceDefaultsSpec struct {
+	// Protocol sets the protocol of the service. This is used by Connect proxies for
+	// things like observability features and to unlock usage of the
+	// service-splitter and service-router config entries for a service.
+	Protocol string `json:"protocol,omitempty"`
+	// MeshGateway controls the default mesh gateway configuration for this service.
+	MeshGateway MeshGatewayConfig `json:"meshGateway,omitempty"`
+	// Expose controls the default expose path configuration for Envoy.
+	Expose ExposeConfig `json:"expose,omitempty"`
+	// ExternalSNI is an optional setting that allows for the TLS SNI value
+	// to be changed to a non-connect value when federating with an external system.
+	ExternalSNI string `json:"externalSNI,omitempty"`
+	// Meta is arbitrary metadata written to the Meta of the config entry in
+	// Consul. Keys starting with "consul.hashicorp.com/" are reserved.
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+// ExposeConfig describes HTTP paths to expose through Envoy outside of Connect.
+// Users can expose individual paths and/or all HTTP/GRPC paths for checks.
+type ExposeConfig struct {
+	// Checks defines whether paths associated with Consul checks will be exposed.
+	// This flag triggers exposing all HTTP and GRPC check paths registered for the service.
+	Checks bool `json:"checks,omitempty"`
+
+	// Paths is the list of paths exposed through the proxy.
+	Paths []ExposePath `json:"paths,omitempty"`
+}
+
+type ExposePath struct {
+	// ListenerPort defines the port of the proxy's listener for exposed paths.
+	ListenerPort int `json:"listenerPort,omitempty"`
+
+	// Path is the path to expose through the proxy, ie. "/metrics".
+	Path string `json:"path,omitempty"`
+
+	// LocalPathPort is the port that the service is listening on for the given path.
+	LocalPathPort int `json:"localPathPort,omitempty"`
+
+	// Protocol describes the upstream's service protocol.
+	// Valid values are "http" and "http2", defaults to "http".
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// Hub marks ServiceDefaults as the version the other versions are converted
+// to and from.
+func (*ServiceDefaults) Hub() {}
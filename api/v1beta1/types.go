@@ -0,0 +1,9 @@
+package v1beta1
+
+// MeshGatewayConfig controls how Mesh Gateways are used for upstream Connect
+// services
+type MeshGatewayConfig struct {
+	// Mode is the mode that should be used for the upstream connection.
+	// One of none, local, or remote.
+	Mode string `json:"mode,omitempty"`
+}
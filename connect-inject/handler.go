@@ -35,6 +35,42 @@ const (
 	// to the name of the first container.
 	annotationService = "consul.hashicorp.com/connect-service"
 
+	// annotationServiceName is the name of the Consul service that a pod
+	// which isn't part of the service mesh is registered as. The health
+	// checks controller manages the health checks of these pods too if they
+	// don't have annotationService.
+	annotationServiceName = "consul.hashicorp.com/service-name"
+
+	// annotationConsulAPIPort is the port of the HTTP(S) API of the Consul
+	// agent local to the pod. The health checks controller uses it instead of
+	// the port of the configured Consul address if set, e.g. when the agents
+	// run with host ports that vary across nodes.
+	annotationConsulAPIPort = "consul.hashicorp.com/consul-api-port"
+
+	// annotationHealthSync controls whether the health checks controller
+	// manages the pod's health check. This should be set to a truthy or falsy
+	// value, as parseable by strconv.ParseBool. If it's falsy, any health
+	// check that was registered for the pod is deregistered.
+	annotationHealthSync = "consul.hashicorp.com/health-sync"
+
+	// annotationHealthCheckNote is additional context, e.g. the git SHA or
+	// the name of the deployment, that the health checks controller adds to
+	// the notes of the pod's health check when it registers it.
+	annotationHealthCheckNote = "consul.hashicorp.com/health-check-note"
+
+	// annotationDeregisterCriticalAfter overrides the global
+	// DeregisterCriticalServiceAfter of the health checks controller for the
+	// pod's health check. It must parse as a Go duration.
+	annotationDeregisterCriticalAfter = "consul.hashicorp.com/deregister-critical-after"
+
+	// annotationEnvoyReadyPort is the port at which the pod exposes the
+	// /ready endpoint of its Envoy sidecar at the pod's IP, e.g. through a
+	// listener added with the envoy-extra-args annotation. The health checks
+	// controller probes it before marking the pod's health check passing if
+	// the probe is enabled. The admin API of the sidecar only listens on
+	// localhost so it can't be probed without this.
+	annotationEnvoyReadyPort = "consul.hashicorp.com/envoy-ready-port"
+
 	// annotationPort is the name or value of the port to proxy incoming
 	// connections to.
 	annotationPort = "consul.hashicorp.com/connect-service-port"
@@ -0,0 +1,171 @@
+package connectinject
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// consulAgent is the subset of the Consul agent API used by the
+// HealthCheckResource to manage the health checks of a pod's service
+// instance. It exists so that the resource can be tested without a Consul
+// agent.
+type consulAgent interface {
+	// Checks returns the checks registered with the agent that match filter.
+	Checks(ctx context.Context, filter string) (map[string]*api.AgentCheck, error)
+	// CheckRegister registers check with the agent.
+	CheckRegister(ctx context.Context, check *api.AgentCheckRegistration) error
+	// CheckDeregister deregisters the check with ID checkID.
+	CheckDeregister(ctx context.Context, checkID string) error
+	// UpdateTTL sets the status and output of the TTL check with ID checkID.
+	UpdateTTL(ctx context.Context, checkID, output, status string) error
+}
+
+// apiAgent implements consulAgent with an *api.Client.
+//
+// The methods of client.Agent() don't accept a context so the same requests
+// are made through client.Raw() instead.
+type apiAgent struct {
+	client *api.Client
+}
+
+// checkUpdate is the body of a request to update the status of a TTL check.
+type checkUpdate struct {
+	Status string
+	Output string
+}
+
+func (a *apiAgent) Checks(ctx context.Context, filter string) (map[string]*api.AgentCheck, error) {
+	var checks map[string]*api.AgentCheck
+	_, err := a.client.Raw().Query("/v1/agent/checks", &checks,
+		(&api.QueryOptions{Filter: filter}).WithContext(ctx))
+	return checks, err
+}
+
+func (a *apiAgent) CheckRegister(ctx context.Context, check *api.AgentCheckRegistration) error {
+	_, err := a.client.Raw().Write("/v1/agent/check/register", check, nil,
+		(&api.WriteOptions{}).WithContext(ctx))
+	return err
+}
+
+func (a *apiAgent) CheckDeregister(ctx context.Context, checkID string) error {
+	_, err := a.client.Raw().Write("/v1/agent/check/deregister/"+checkID, nil, nil,
+		(&api.WriteOptions{}).WithContext(ctx))
+	return err
+}
+
+func (a *apiAgent) UpdateTTL(ctx context.Context, checkID, output, status string) error {
+	_, err := a.client.Raw().Write(fmt.Sprintf("/v1/agent/check/update/%s", checkID),
+		&checkUpdate{Status: status, Output: output}, nil, (&api.WriteOptions{}).WithContext(ctx))
+	return err
+}
+
+// rateLimitError is returned when the Consul agent rejected a request with
+// 429 Too Many Requests.
+type rateLimitError struct {
+	// retryAfter is the delay requested by the agent's Retry-After header.
+	// It is 0 if the header wasn't set.
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	if e.retryAfter > 0 {
+		return fmt.Sprintf("Consul agent rate limited the request, retry after %s", e.retryAfter)
+	}
+	return "Consul agent rate limited the request"
+}
+
+// rateLimitTransport returns a rateLimitError for the 429 responses of the
+// Consul agent. The Consul API client turns them into plain errors and
+// discards their headers, so this is the only place the Retry-After header
+// can be read.
+type rateLimitTransport struct {
+	base http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+	resp.Body.Close()
+	return nil, &rateLimitError{retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date. It returns 0 if the value is invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// isRateLimitErr returns whether err was caused by the Consul agent rate
+// limiting the request and, if it was, the delay the agent asked for or 0 if
+// it didn't ask for one.
+func isRateLimitErr(err error) (bool, time.Duration) {
+	if err == nil {
+		return false, 0
+	}
+	var rlErr *rateLimitError
+	if errors.As(err, &rlErr) {
+		return true, rlErr.retryAfter
+	}
+	// Clients that don't use rateLimitTransport return the error generated
+	// by the Consul API client.
+	return strings.Contains(err.Error(), "Unexpected response code: 429"), 0
+}
+
+// isFilterUnsupportedErr returns true if err was returned by a Consul agent
+// that doesn't support the filter query parameter, e.g. an agent older than
+// Consul 1.4.
+func isFilterUnsupportedErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "Unexpected response code: 400") && strings.Contains(strings.ToLower(msg), "filter")
+}
+
+// filteredChecks returns the checks registered with the agent that match
+// filter. If the agent doesn't support filtering, all its checks are listed
+// and those that match are returned instead. The result of this detection is
+// kept so that the agents aren't probed with a filter on every call.
+func (h *HealthCheckResource) filteredChecks(ctx context.Context, agent consulAgent, filter string, match func(id string, check *api.AgentCheck) bool) (map[string]*api.AgentCheck, error) {
+	if atomic.LoadInt32(&h.filterUnsupported) == 0 {
+		checks, err := agent.Checks(ctx, filter)
+		if !isFilterUnsupportedErr(err) {
+			return checks, err
+		}
+		h.Log.Info("Consul agent doesn't support filtering health checks, filtering them locally", "err", err)
+		atomic.StoreInt32(&h.filterUnsupported, 1)
+	}
+	checks, err := agent.Checks(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	matching := make(map[string]*api.AgentCheck)
+	for id, check := range checks {
+		if match(id, check) {
+			matching[id] = check
+		}
+	}
+	return matching, nil
+}
@@ -0,0 +1,1439 @@
+package connectinject
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/helper/controller"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// Test that the resource registers and updates health checks as expected
+// without a Consul agent.
+func TestUpsert_FakeAgent(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		Ready          bool
+		ServiceMissing bool
+		ExistingStatus string
+		ExistingOutput string
+		ExpStatus      string
+		ExpOutput      string
+		ExpUpdates     int
+		// ExpRegistrations is the number of attempts to register the check.
+		ExpRegistrations int
+	}{
+		"ready pod registers a passing check": {
+			Ready:            true,
+			ExpStatus:        api.HealthPassing,
+			ExpOutput:        kubernetesSuccessReasonMsg,
+			ExpUpdates:       1,
+			ExpRegistrations: 1,
+		},
+		"unready pod registers a critical check": {
+			Ready:            false,
+			ExpStatus:        api.HealthCritical,
+			ExpOutput:        testFailureMessage,
+			ExpUpdates:       1,
+			ExpRegistrations: 1,
+		},
+		"pod becoming unready fails the check": {
+			Ready:          false,
+			ExistingStatus: api.HealthPassing,
+			ExpStatus:      api.HealthCritical,
+			ExpOutput:      testFailureMessage,
+			ExpUpdates:     1,
+		},
+		"pod becoming ready passes the check": {
+			Ready:          true,
+			ExistingStatus: api.HealthCritical,
+			ExpStatus:      api.HealthPassing,
+			ExpOutput:      kubernetesSuccessReasonMsg,
+			ExpUpdates:     1,
+		},
+		"unchanged status is not updated": {
+			Ready:          true,
+			ExistingStatus: api.HealthPassing,
+			ExistingOutput: kubernetesSuccessReasonMsg,
+			ExpStatus:      api.HealthPassing,
+			ExpOutput:      kubernetesSuccessReasonMsg,
+			ExpUpdates:     0,
+		},
+		"changed output is updated": {
+			Ready:          false,
+			ExistingStatus: api.HealthCritical,
+			ExistingOutput: "containers with unready status: [app]",
+			ExpStatus:      api.HealthCritical,
+			ExpOutput:      testFailureMessage,
+			ExpUpdates:     1,
+		},
+		// Registration isn't retried if the service isn't registered. The
+		// check is registered on the next reconcile instead.
+		"service not registered": {
+			Ready:            true,
+			ServiceMissing:   true,
+			ExpStatus:        "",
+			ExpUpdates:       0,
+			ExpRegistrations: 1,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			pod := testFakeAgentPod(testPodName, c.Ready)
+			agent := newFakeConsulAgent()
+			if !c.ServiceMissing {
+				agent.services[testServiceNameReg] = true
+			}
+			if c.ExistingStatus != "" {
+				agent.checks[testHealthCheckID] = &api.AgentCheck{
+					CheckID:   testHealthCheckID,
+					ServiceID: testServiceNameReg,
+					Status:    c.ExistingStatus,
+					Output:    c.ExistingOutput,
+				}
+			}
+			resource := HealthCheckResource{
+				Log:                 hclog.Default().Named("healthCheckResource"),
+				KubernetesClientset: fake.NewSimpleClientset(pod),
+				Ctx:                 context.Background(),
+				agent:               agent,
+			}
+
+			require.NoError(resource.Upsert("", pod))
+
+			check := agent.checks[testHealthCheckID]
+			if c.ExpStatus == "" {
+				require.Nil(check)
+			} else {
+				require.NotNil(check)
+				require.Equal(c.ExpStatus, check.Status)
+				require.Equal(c.ExpOutput, check.Output)
+			}
+			require.Equal(c.ExpUpdates, agent.updates)
+			require.Equal(c.ExpRegistrations, agent.registrations)
+		})
+	}
+}
+
+// Test that the health check only passes if all the configured pod
+// conditions are True.
+func TestUpsert_FakeAgentReadyConditions(t *testing.T) {
+	t.Parallel()
+	const gate = corev1.PodConditionType("example.com/mesh-ready")
+	cases := map[string]struct {
+		GateStatus corev1.ConditionStatus
+		ExpStatus  string
+		ExpOutput  string
+		ExpErr     string
+	}{
+		"gate true": {
+			GateStatus: corev1.ConditionTrue,
+			ExpStatus:  api.HealthPassing,
+			ExpOutput:  kubernetesSuccessReasonMsg,
+		},
+		"gate false while ready": {
+			GateStatus: corev1.ConditionFalse,
+			ExpStatus:  api.HealthCritical,
+			ExpOutput:  "mesh not ready",
+		},
+		"gate not set": {
+			ExpErr: "no example.com/mesh-ready status for pod: " + testPodName,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			pod := testFakeAgentPod(testPodName, true)
+			if c.GateStatus != "" {
+				pod.Status.Conditions = append(pod.Status.Conditions, corev1.PodCondition{
+					Type:    gate,
+					Status:  c.GateStatus,
+					Message: "mesh not ready",
+				})
+			}
+			agent := newFakeConsulAgent()
+			agent.services[testServiceNameReg] = true
+			resource := HealthCheckResource{
+				Log:                 hclog.Default().Named("healthCheckResource"),
+				KubernetesClientset: fake.NewSimpleClientset(pod),
+				Ctx:                 context.Background(),
+				ReadyConditions:     []corev1.PodConditionType{corev1.PodReady, gate},
+				agent:               agent,
+			}
+
+			err := resource.Upsert("", pod)
+			if c.ExpErr != "" {
+				require.Error(err)
+				require.Contains(err.Error(), c.ExpErr)
+				return
+			}
+			require.NoError(err)
+			check := agent.checks[testHealthCheckID]
+			require.NotNil(check)
+			require.Equal(c.ExpStatus, check.Status)
+			require.Equal(c.ExpOutput, check.Output)
+		})
+	}
+}
+
+// Test that the health check reflects the readiness of the configured
+// container and falls back to the pod conditions without it.
+func TestUpsert_FakeAgentReadinessContainer(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		ReadinessContainer string
+		PodReady           bool
+		ContainerReady     bool
+		ExpStatus          string
+		ExpOutput          string
+	}{
+		"pod source uses the pod condition": {
+			PodReady:       true,
+			ContainerReady: false,
+			ExpStatus:      api.HealthPassing,
+			ExpOutput:      kubernetesSuccessReasonMsg,
+		},
+		"container not ready while pod ready": {
+			ReadinessContainer: "app",
+			PodReady:           true,
+			ContainerReady:     false,
+			ExpStatus:          api.HealthCritical,
+			ExpOutput:          "container app is not ready",
+		},
+		"container ready while pod not ready": {
+			ReadinessContainer: "app",
+			PodReady:           false,
+			ContainerReady:     true,
+			ExpStatus:          api.HealthPassing,
+			ExpOutput:          kubernetesSuccessReasonMsg,
+		},
+		"missing container falls back to the pod condition": {
+			ReadinessContainer: "missing",
+			PodReady:           false,
+			ContainerReady:     true,
+			ExpStatus:          api.HealthCritical,
+			ExpOutput:          testFailureMessage,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			pod := testFakeAgentPod(testPodName, c.PodReady)
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+				{Name: "app", Ready: c.ContainerReady},
+				{Name: "envoy-sidecar", Ready: true},
+			}
+			agent := newFakeConsulAgent()
+			agent.services[testServiceNameReg] = true
+			resource := HealthCheckResource{
+				Log:                 hclog.Default().Named("healthCheckResource"),
+				KubernetesClientset: fake.NewSimpleClientset(pod),
+				Ctx:                 context.Background(),
+				ReadinessContainer:  c.ReadinessContainer,
+				agent:               agent,
+			}
+
+			require.NoError(resource.Upsert("", pod))
+			check := agent.checks[testHealthCheckID]
+			require.NotNil(check)
+			require.Equal(c.ExpStatus, check.Status)
+			require.Equal(c.ExpOutput, check.Output)
+		})
+	}
+}
+
+// Test that the configured thresholds are set on the registered check.
+func TestUpsert_FakeAgentThresholds(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		SuccessBeforePassing      int
+		FailuresBeforeCritical    int
+		ExpSuccessBeforePassing   int
+		ExpFailuresBeforeCritical int
+	}{
+		"defaults": {
+			ExpSuccessBeforePassing:   1,
+			ExpFailuresBeforeCritical: 1,
+		},
+		"configured": {
+			SuccessBeforePassing:      2,
+			FailuresBeforeCritical:    3,
+			ExpSuccessBeforePassing:   2,
+			ExpFailuresBeforeCritical: 3,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			pod := testFakeAgentPod(testPodName, true)
+			agent := newFakeConsulAgent()
+			agent.services[testServiceNameReg] = true
+			resource := HealthCheckResource{
+				Log:                    hclog.Default().Named("healthCheckResource"),
+				KubernetesClientset:    fake.NewSimpleClientset(pod),
+				Ctx:                    context.Background(),
+				SuccessBeforePassing:   c.SuccessBeforePassing,
+				FailuresBeforeCritical: c.FailuresBeforeCritical,
+				agent:                  agent,
+			}
+
+			require.NoError(resource.Upsert("", pod))
+			require.NotNil(agent.lastRegistration)
+			require.Equal(c.ExpSuccessBeforePassing, agent.lastRegistration.SuccessBeforePassing)
+			require.Equal(c.ExpFailuresBeforeCritical, agent.lastRegistration.FailuresBeforeCritical)
+		})
+	}
+}
+
+// Test that a pod event is retried while the Consul agent can't be reached
+// and that other errors aren't retried.
+func TestUpsert_FakeAgentConnectionRetries(t *testing.T) {
+	t.Parallel()
+	connErr := &url.Error{Op: "Get", URL: "http://127.0.0.1:8500/v1/agent/checks", Err: errors.New("connection refused")}
+	cases := map[string]struct {
+		Err       error
+		ErrCalls  int
+		Retries   int
+		ExpErr    string
+		ExpStatus string
+	}{
+		"agent reachable on retry": {
+			Err:       connErr,
+			ErrCalls:  1,
+			Retries:   2,
+			ExpStatus: api.HealthPassing,
+		},
+		"agent unreachable after retries": {
+			Err:      connErr,
+			ErrCalls: 3,
+			Retries:  2,
+			ExpErr:   "connection refused",
+		},
+		"retries disabled": {
+			Err:      connErr,
+			ErrCalls: 1,
+			Retries:  0,
+			ExpErr:   "connection refused",
+		},
+		"agent errors are not retried": {
+			Err:      errors.New("Unexpected response code: 403 (Permission denied)"),
+			ErrCalls: 1,
+			Retries:  2,
+			ExpErr:   "Permission denied",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			pod := testFakeAgentPod(testPodName, true)
+			agent := newFakeConsulAgent()
+			agent.services[testServiceNameReg] = true
+			agent.err = c.Err
+			agent.errCalls = c.ErrCalls
+			consulURL, err := url.Parse("http://127.0.0.1:8500")
+			require.NoError(err)
+			resource := HealthCheckResource{
+				Log:                  hclog.Default().Named("healthCheckResource"),
+				KubernetesClientset:  fake.NewSimpleClientset(pod),
+				ConsulUrl:            consulURL,
+				Ctx:                  context.Background(),
+				ConnectionRetries:    c.Retries,
+				ConnectionRetryDelay: time.Millisecond,
+				agent:                agent,
+			}
+
+			err = resource.Upsert("", pod)
+			if c.ExpErr != "" {
+				require.Error(err)
+				require.Contains(err.Error(), c.ExpErr)
+				require.Nil(agent.checks[testHealthCheckID])
+				return
+			}
+			require.NoError(err)
+			require.NotNil(agent.checks[testHealthCheckID])
+			require.Equal(c.ExpStatus, agent.checks[testHealthCheckID].Status)
+		})
+	}
+}
+
+// Test that the pods of a node whose Consul agent keeps failing aren't
+// processed until the cooldown of the agent's breaker has elapsed.
+func TestUpsert_FakeAgentBreaker(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	connErr := &url.Error{Op: "Get", URL: "http://127.0.0.1:8500/v1/agent/checks", Err: errors.New("connection refused")}
+	pod := testFakeAgentPod(testPodName, true)
+	pod.Status.HostIP = "10.0.0.1"
+	agent := newFakeConsulAgent()
+	agent.services[testServiceNameReg] = true
+	agent.err = connErr
+	consulURL, err := url.Parse("http://127.0.0.1:8500")
+	require.NoError(err)
+	fakeClock := clock.NewFakeClock(time.Now())
+	resource := HealthCheckResource{
+		Log:                   hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset:   fake.NewSimpleClientset(pod),
+		ConsulUrl:             consulURL,
+		Ctx:                   context.Background(),
+		AgentFailureThreshold: 3,
+		AgentFailureCooldown:  time.Minute,
+		Clock:                 fakeClock,
+		agent:                 agent,
+	}
+
+	// The breaker opens after the threshold is reached.
+	for i := 0; i < 3; i++ {
+		err := resource.Upsert("", pod)
+		require.Error(err)
+		require.Contains(err.Error(), "connection refused")
+	}
+	require.Equal(3, agent.calls)
+	require.Equal(float64(1), promtestutil.ToFloat64(resource.getMetrics().agentBreakerTransitions.WithLabelValues("open")))
+
+	// No calls are made to the agent during the cooldown and the pod is
+	// requeued once it ends.
+	for i := 0; i < 5; i++ {
+		err := resource.Upsert("", pod)
+		var requeueErr *controller.RequeueAfterError
+		require.True(errors.As(err, &requeueErr), "unexpected error: %v", err)
+		require.Equal(time.Minute, requeueErr.Delay)
+	}
+	require.Equal(3, agent.calls)
+
+	// The pods of other nodes are still processed.
+	otherPod := testFakeAgentPod("other-pod", true)
+	otherPod.Status.HostIP = "10.0.0.2"
+	require.Error(resource.Upsert("", otherPod))
+	require.Equal(4, agent.calls)
+
+	// Once the cooldown has elapsed, the pod is processed again and the
+	// breaker closes when the agent recovers.
+	fakeClock.Step(time.Minute)
+	agent.Lock()
+	agent.err = nil
+	agent.Unlock()
+	require.NoError(resource.Upsert("", pod))
+	require.NotNil(agent.checks[testHealthCheckID])
+	require.Equal(float64(1), promtestutil.ToFloat64(resource.getMetrics().agentBreakerTransitions.WithLabelValues("closed")))
+}
+
+// Test that the events of pods without a host IP are requeued without
+// calling their Consul agent and that reconciling skips them.
+func TestUpsert_FakeAgentMissingHostIP(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, true)
+	pod.Status.HostIP = ""
+	agent := newFakeConsulAgent()
+	agent.services[testServiceNameReg] = true
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		Ctx:                 context.Background(),
+		agent:               agent,
+	}
+
+	err := resource.Upsert("", pod)
+	var requeueErr *controller.RequeueAfterError
+	require.True(errors.As(err, &requeueErr), "unexpected error: %v", err)
+	require.Equal(hostIPRequeueDelay, requeueErr.Delay)
+	require.NoError(resource.Reconcile())
+	require.Equal(0, agent.calls)
+
+	// The pod is processed once it has a host IP.
+	pod.Status.HostIP = "127.0.0.1"
+	require.NoError(resource.Upsert("", pod))
+	require.NotNil(agent.checks[testHealthCheckID])
+}
+
+// Test that no health checks are registered if ManageStatusOnly is set and
+// that the status of a check is managed once it has been registered.
+func TestUpsert_FakeAgentManageStatusOnly(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, false)
+	agent := newFakeConsulAgent()
+	agent.services[testServiceNameReg] = true
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		Ctx:                 context.Background(),
+		ManageStatusOnly:    true,
+		agent:               agent,
+	}
+
+	err := resource.Upsert("", pod)
+	var requeueErr *controller.RequeueAfterError
+	require.True(errors.As(err, &requeueErr), "unexpected error: %v", err)
+	require.Equal(checkMissingRequeueDelay, requeueErr.Delay)
+	require.NoError(resource.Reconcile())
+	require.Equal(0, agent.registrations)
+	require.Empty(agent.checks)
+
+	// The delay doubles on each retry until the retries are exhausted, after
+	// which the pod is left alone.
+	for _, delay := range []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second} {
+		err = resource.Upsert("", pod)
+		require.True(errors.As(err, &requeueErr), "unexpected error: %v", err)
+		require.Equal(delay, requeueErr.Delay)
+	}
+	require.NoError(resource.Upsert("", pod))
+	// The next change of the pod starts over.
+	err = resource.Upsert("", pod)
+	require.True(errors.As(err, &requeueErr), "unexpected error: %v", err)
+	require.Equal(checkMissingRequeueDelay, requeueErr.Delay)
+
+	// The check is managed once the sidecar registered it.
+	agent.checks[testHealthCheckID] = &api.AgentCheck{
+		CheckID:   testHealthCheckID,
+		ServiceID: testServiceNameReg,
+		Status:    api.HealthPassing,
+	}
+	require.NoError(resource.Upsert("", pod))
+	require.NoError(resource.Reconcile())
+	require.Equal(0, agent.registrations)
+	require.Equal(api.HealthCritical, agent.checks[testHealthCheckID].Status)
+	require.Equal(testFailureMessage, agent.checks[testHealthCheckID].Output)
+}
+
+// Test that the health checks are filtered locally if the Consul agent
+// doesn't support filtering and that the agent is only probed once.
+func TestUpsert_FakeAgentFilterUnsupported(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, false)
+	agent := newFakeConsulAgent()
+	agent.services[testServiceNameReg] = true
+	agent.filterErr = errors.New("Unexpected response code: 400 (Bad request: unknown query parameter \"filter\")")
+	agent.checks[testHealthCheckID] = &api.AgentCheck{
+		CheckID:   testHealthCheckID,
+		ServiceID: testServiceNameReg,
+		Status:    api.HealthPassing,
+	}
+	agent.checks["service:other"] = &api.AgentCheck{CheckID: "service:other", Status: api.HealthPassing}
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		Ctx:                 context.Background(),
+		agent:               agent,
+	}
+
+	require.NoError(resource.Upsert("", pod))
+	require.NoError(resource.Reconcile())
+	// The existing check was found so it was updated rather than registered.
+	require.Equal(0, agent.registrations)
+	require.Equal(api.HealthCritical, agent.checks[testHealthCheckID].Status)
+	require.Equal(api.HealthPassing, agent.checks["service:other"].Status)
+	require.Equal(1, agent.filteredCalls)
+}
+
+// Test that pods whose Consul agent rate limits the requests are requeued
+// with the rate limit backoff instead of being retried right away.
+func TestUpsert_FakeAgentRateLimited(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		Err      error
+		ExpDelay time.Duration
+	}{
+		"without Retry-After": {
+			Err:      &url.Error{Op: "Get", URL: "http://127.0.0.1:8500/v1/agent/checks", Err: &rateLimitError{}},
+			ExpDelay: time.Minute,
+		},
+		"with Retry-After": {
+			Err:      &url.Error{Op: "Get", URL: "http://127.0.0.1:8500/v1/agent/checks", Err: &rateLimitError{retryAfter: 5 * time.Minute}},
+			ExpDelay: 5 * time.Minute,
+		},
+		"error of the Consul API client": {
+			Err:      errors.New("Unexpected response code: 429 (rate limit exceeded)"),
+			ExpDelay: time.Minute,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			pod := testFakeAgentPod(testPodName, true)
+			agent := newFakeConsulAgent()
+			agent.services[testServiceNameReg] = true
+			agent.err = c.Err
+			resource := HealthCheckResource{
+				Log:                   hclog.Default().Named("healthCheckResource"),
+				KubernetesClientset:   fake.NewSimpleClientset(pod),
+				Ctx:                   context.Background(),
+				ConnectionRetries:     2,
+				ConnectionRetryDelay:  time.Millisecond,
+				AgentFailureThreshold: 1,
+				RateLimitBackoff:      time.Minute,
+				agent:                 agent,
+			}
+
+			err := resource.Upsert("", pod)
+			var requeueErr *controller.RequeueAfterError
+			require.True(errors.As(err, &requeueErr), "unexpected error: %v", err)
+			require.Equal(c.ExpDelay, requeueErr.Delay)
+			// Rate limited requests are neither retried right away nor
+			// counted as failures of the agent.
+			require.Equal(1, agent.calls)
+			allowed, _ := resource.agentAllowed(pod)
+			require.True(allowed)
+			require.Equal(float64(1), promtestutil.ToFloat64(resource.getMetrics().rateLimited))
+		})
+	}
+}
+
+// Test that the Retry-After header of the 429 responses of the Consul agent
+// is available to the resource.
+func TestGetOrCreateClient_RateLimited(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	resource := HealthCheckResource{
+		Log: hclog.Default().Named("healthCheckResource"),
+	}
+	client, err := resource.getOrCreateClient(server.URL, "")
+	require.NoError(err)
+
+	_, err = (&apiAgent{client: client}).Checks(context.Background(), "")
+	rateLimited, retryAfter := isRateLimitErr(err)
+	require.True(rateLimited, "unexpected error: %v", err)
+	require.Equal(7*time.Second, retryAfter)
+	require.False(isConnectionErr(err))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              0,
+		"30":                            30 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Wed, 03 Feb 2021 04:06:06 GMT": time.Minute,
+		"Wed, 03 Feb 2021 04:04:06 GMT": 0,
+	}
+	for value, exp := range cases {
+		t.Run(value, func(t *testing.T) {
+			require.Equal(t, exp, parseRetryAfter(value, now))
+		})
+	}
+}
+
+// Test that reconciling a pod whose service was re-registered under a new ID
+// replaces the health check of the old service with one bound to the new
+// service.
+func TestReconcile_FakeAgentServiceIDChanged(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, true)
+	agent := newFakeConsulAgent()
+	agent.services[testServiceNameReg] = true
+	client := fake.NewSimpleClientset(pod)
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: client,
+		Ctx:                 context.Background(),
+		agent:               agent,
+	}
+	require.NoError(resource.Upsert("", pod))
+	require.NotNil(agent.checks[testHealthCheckID])
+
+	// The pod's connect-service annotation changes and its service is
+	// re-registered under the new ID.
+	pod.Annotations[annotationService] = "renamed"
+	_, err := client.CoreV1().Pods(pod.Namespace).Update(context.Background(), pod, metav1.UpdateOptions{})
+	require.NoError(err)
+	newServiceID := testPodName + "-renamed"
+	newHealthCheckID := "default/" + newServiceID + "/kubernetes-health-check"
+	agent.services[newServiceID] = true
+
+	require.NoError(resource.Reconcile())
+	require.Nil(agent.checks[testHealthCheckID])
+	check := agent.checks[newHealthCheckID]
+	require.NotNil(check)
+	require.Equal(newServiceID, check.ServiceID)
+	require.Equal(api.HealthPassing, check.Status)
+	reports := resource.Reports()
+	require.Len(reports, 1)
+	require.Equal(newHealthCheckID, reports[0].HealthCheckID)
+}
+
+// Test that reconciling a pod whose status hasn't changed doesn't write to
+// Consul.
+func TestUpsert_FakeAgentUnchangedStatusNotWritten(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, true)
+	agent := newFakeConsulAgent()
+	agent.services[testServiceNameReg] = true
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		Ctx:                 context.Background(),
+		agent:               agent,
+	}
+
+	require.NoError(resource.Upsert("", pod))
+	require.Equal(1, agent.registrations)
+	require.Equal(1, agent.updates)
+
+	// Relisting the pod doesn't update the check.
+	for i := 0; i < 3; i++ {
+		require.NoError(resource.Upsert("", pod))
+	}
+	require.Equal(1, agent.registrations)
+	require.Equal(1, agent.updates)
+	require.Equal(float64(1), promtestutil.ToFloat64(resource.getMetrics().statusUpdates.WithLabelValues(api.HealthPassing)))
+}
+
+// Test that the value of the health check note annotation is added to the
+// notes, after the metadata, but not to the output of the health check.
+func TestUpsert_FakeAgentHealthCheckNote(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		Annotations map[string]string
+		ExpNotes    string
+		ExpOutput   string
+	}{
+		"without annotation": {
+			ExpNotes:  "k8s-ns=default;k8s-node=node-1;managed-by=consul-k8s-healthcheck;check-config=" + testCheckConfig,
+			ExpOutput: testFailureMessage,
+		},
+		"with annotation": {
+			Annotations: map[string]string{annotationHealthCheckNote: "deployment=web sha=abc123"},
+			ExpNotes:    "k8s-ns=default;k8s-node=node-1;managed-by=consul-k8s-healthcheck;check-config=" + testCheckConfig + "\ndeployment=web sha=abc123",
+			ExpOutput:   testFailureMessage,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			pod := testFakeAgentPod(testPodName, false)
+			pod.Spec.NodeName = "node-1"
+			for k, v := range c.Annotations {
+				pod.Annotations[k] = v
+			}
+			agent := newFakeConsulAgent()
+			agent.services[testServiceNameReg] = true
+			resource := HealthCheckResource{
+				Log:                 hclog.Default().Named("healthCheckResource"),
+				KubernetesClientset: fake.NewSimpleClientset(pod),
+				Ctx:                 context.Background(),
+				agent:               agent,
+			}
+
+			require.NoError(resource.Upsert("", pod))
+
+			require.NotNil(agent.lastRegistration)
+			require.Equal(c.ExpNotes, agent.lastRegistration.Notes)
+			check := agent.checks[testHealthCheckID]
+			require.NotNil(check)
+			require.Equal(c.ExpNotes, check.Notes)
+			require.Equal(c.ExpOutput, check.Output)
+		})
+	}
+}
+
+// Test that the notes set at registration stay the same while the output of
+// the health check follows the message of the pod condition.
+func TestUpsert_FakeAgentNotesStableOutputLive(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, false)
+	pod.Spec.NodeName = "node-1"
+	pod.Annotations[annotationHealthCheckNote] = "sha=abc123"
+	agent := newFakeConsulAgent()
+	agent.services[testServiceNameReg] = true
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		Ctx:                 context.Background(),
+		agent:               agent,
+	}
+	expNotes := "k8s-ns=default;k8s-node=node-1;managed-by=consul-k8s-healthcheck;check-config=" + testCheckConfig + "\nsha=abc123"
+
+	require.NoError(resource.Upsert("", pod))
+	check := agent.checks[testHealthCheckID]
+	require.NotNil(check)
+	require.Equal(expNotes, check.Notes)
+	require.Equal(api.HealthCritical, check.Status)
+	require.Equal(testFailureMessage, check.Output)
+
+	// The message changes while the pod stays unready.
+	pod.Status.Conditions[0].Message = "containers with unready status: [app]"
+	require.NoError(resource.Upsert("", pod))
+	require.Equal(expNotes, check.Notes)
+	require.Equal(api.HealthCritical, check.Status)
+	require.Equal("containers with unready status: [app]", check.Output)
+
+	// The pod becomes ready.
+	pod.Status.Conditions[0] = corev1.PodCondition{Type: corev1.PodReady, Status: corev1.ConditionTrue}
+	require.NoError(resource.Upsert("", pod))
+	require.Equal(expNotes, check.Notes)
+	require.Equal(api.HealthPassing, check.Status)
+	require.Equal(kubernetesSuccessReasonMsg, check.Output)
+
+	// The check is only registered once and relisting the pod doesn't
+	// update it.
+	require.NoError(resource.Upsert("", pod))
+	require.Equal(1, agent.registrations)
+	require.Equal(3, agent.updates)
+}
+
+// Test that a long pod condition message is truncated before it's written
+// as the output of the health check.
+func TestUpsert_FakeAgentTruncatesReason(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, false)
+	pod.Status.Conditions[0].Message = strings.Repeat("a", 2048)
+	agent := newFakeConsulAgent()
+	agent.services[testServiceNameReg] = true
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		Ctx:                 context.Background(),
+		agent:               agent,
+	}
+
+	require.NoError(resource.Upsert("", pod))
+
+	check := agent.checks[testHealthCheckID]
+	require.NotNil(check)
+	require.Equal(api.HealthCritical, check.Status)
+	require.Len(check.Output, DefaultHealthCheckMaxReasonLength)
+	require.Equal(strings.Repeat("a", DefaultHealthCheckMaxReasonLength-3)+"...", check.Output)
+}
+
+// Test that Reconcile registers the health checks of all pods and Delete
+// deregisters them without a Consul agent.
+func TestReconcileDelete_FakeAgent(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	readyPod := testFakeAgentPod("ready-pod", true)
+	unreadyPod := testFakeAgentPod("unready-pod", false)
+	agent := newFakeConsulAgent()
+	agent.services["ready-pod-"+testServiceNameAnnotation] = true
+	agent.services["unready-pod-"+testServiceNameAnnotation] = true
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(readyPod, unreadyPod),
+		Ctx:                 context.Background(),
+		agent:               agent,
+	}
+
+	require.NoError(resource.Reconcile())
+	require.Len(agent.checks, 2)
+	require.Equal(api.HealthPassing, agent.checks[resource.getConsulHealthCheckID(readyPod)].Status)
+	require.Equal(api.HealthCritical, agent.checks[resource.getConsulHealthCheckID(unreadyPod)].Status)
+
+	require.NoError(resource.Delete("", readyPod))
+	require.Len(agent.checks, 1)
+	require.Nil(agent.checks[resource.getConsulHealthCheckID(readyPod)])
+}
+
+// Test that Reconcile processes every pod and returns the errors of all the
+// pods that failed.
+func TestReconcile_FakeAgentErrors(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod1 := testFakeAgentPod("pod-1", true)
+	pod2 := testFakeAgentPod("pod-2", true)
+	agent := newFakeConsulAgent()
+	agent.services["pod-1-"+testServiceNameAnnotation] = true
+	agent.services["pod-2-"+testServiceNameAnnotation] = true
+	agent.err = errors.New("Unexpected response code: 500 (agent unavailable)")
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod1, pod2),
+		Ctx:                 context.Background(),
+		agent:               agent,
+	}
+
+	err := resource.Reconcile()
+	require.Error(err)
+	merr, ok := err.(*multierror.Error)
+	require.True(ok, "expected a *multierror.Error, got %T", err)
+	require.Len(merr.Errors, 2)
+	require.Contains(err.Error(), "pod default/pod-1")
+	require.Contains(err.Error(), "pod default/pod-2")
+
+	// Once the agent recovers, Reconcile succeeds.
+	agent.err = nil
+	require.NoError(resource.Reconcile())
+	require.Len(agent.checks, 2)
+}
+
+// Test that pods that opt out of health check syncing are skipped and that
+// their previously registered health checks are deregistered.
+func TestUpsert_HealthSyncAnnotation(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		Annotation    string
+		ExistingCheck bool
+		ExpCheck      bool
+	}{
+		"opted out without a check": {
+			Annotation:    "false",
+			ExistingCheck: false,
+			ExpCheck:      false,
+		},
+		"opted out with a check": {
+			Annotation:    "false",
+			ExistingCheck: true,
+			ExpCheck:      false,
+		},
+		"opted in": {
+			Annotation:    "true",
+			ExistingCheck: false,
+			ExpCheck:      true,
+		},
+		"invalid annotation is ignored": {
+			Annotation:    "maybe",
+			ExistingCheck: false,
+			ExpCheck:      true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			pod := testFakeAgentPod(testPodName, true)
+			pod.Annotations[annotationHealthSync] = c.Annotation
+			agent := newFakeConsulAgent()
+			agent.services[testServiceNameReg] = true
+			if c.ExistingCheck {
+				agent.checks[testHealthCheckID] = &api.AgentCheck{
+					CheckID:   testHealthCheckID,
+					ServiceID: testServiceNameReg,
+					Notes:     testCheckNotesMetadata,
+					Status:    api.HealthPassing,
+				}
+			}
+			resource := HealthCheckResource{
+				Log:                 hclog.Default().Named("healthCheckResource"),
+				KubernetesClientset: fake.NewSimpleClientset(pod),
+				Ctx:                 context.Background(),
+				agent:               agent,
+			}
+
+			require.NoError(resource.Upsert("", pod))
+			require.NoError(resource.Reconcile())
+
+			if c.ExpCheck {
+				require.NotNil(agent.checks[testHealthCheckID])
+			} else {
+				require.Nil(agent.checks[testHealthCheckID])
+			}
+		})
+	}
+}
+
+// Test that the health check is registered with the generated ID as its
+// CheckID and a human readable name, and that it's looked up by its CheckID
+// rather than its name.
+func TestUpsert_FakeAgentCheckIDAndName(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, true)
+	agent := newFakeConsulAgent()
+	agent.services[testServiceNameReg] = true
+	// A check of another pod with the same name isn't the pod's check.
+	agent.checks["default/other-pod-test-service/kubernetes-health-check"] = &api.AgentCheck{
+		CheckID: "default/other-pod-test-service/kubernetes-health-check",
+		Name:    "Kubernetes Readiness: test-service",
+		Status:  api.HealthCritical,
+	}
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		Ctx:                 context.Background(),
+		agent:               agent,
+	}
+
+	require.NoError(resource.Upsert("", pod))
+	require.Equal(1, agent.registrations)
+	require.Equal(testHealthCheckID, agent.lastRegistration.ID)
+	require.Equal("Kubernetes Readiness: test-service", agent.lastRegistration.Name)
+
+	// A check registered under the pod's CheckID is found even if its name
+	// differs, e.g. because it was registered by an older version, and is
+	// registered again under the new name.
+	agent.checks[testHealthCheckID].Name = "Kubernetes Health Check"
+	updates := agent.updates
+	pod = testFakeAgentPod(testPodName, false)
+	require.NoError(resource.Upsert("", pod))
+	require.Equal(2, agent.registrations)
+	require.Equal(updates+1, agent.updates)
+	require.Equal("Kubernetes Readiness: test-service", agent.checks[testHealthCheckID].Name)
+	require.Equal(api.HealthCritical, agent.checks[testHealthCheckID].Status)
+	require.Equal(api.HealthCritical, agent.checks["default/other-pod-test-service/kubernetes-health-check"].Status)
+}
+
+// Test that the deregister-critical-after annotation overrides the global
+// DeregisterCriticalServiceAfter and that invalid values fall back to it.
+func TestUpsert_FakeAgentDeregisterCriticalAfter(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		Default     string
+		Annotations map[string]string
+		Exp         string
+	}{
+		"no annotation uses the default": {
+			Default: "30m",
+			Exp:     "30m",
+		},
+		"no annotation and no default": {
+			Exp: "",
+		},
+		"annotation overrides the default": {
+			Default:     "30m",
+			Annotations: map[string]string{annotationDeregisterCriticalAfter: "5m"},
+			Exp:         "5m",
+		},
+		"annotation without a default": {
+			Annotations: map[string]string{annotationDeregisterCriticalAfter: "1h30m"},
+			Exp:         "1h30m",
+		},
+		"invalid annotation falls back to the default": {
+			Default:     "30m",
+			Annotations: map[string]string{annotationDeregisterCriticalAfter: "soon"},
+			Exp:         "30m",
+		},
+		"negative annotation falls back to the default": {
+			Default:     "30m",
+			Annotations: map[string]string{annotationDeregisterCriticalAfter: "-5m"},
+			Exp:         "30m",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			pod := testFakeAgentPod(testPodName, true)
+			for k, v := range c.Annotations {
+				pod.Annotations[k] = v
+			}
+			agent := newFakeConsulAgent()
+			agent.services[testServiceNameReg] = true
+			resource := HealthCheckResource{
+				Log:                            hclog.Default().Named("healthCheckResource"),
+				KubernetesClientset:            fake.NewSimpleClientset(pod),
+				Ctx:                            context.Background(),
+				DeregisterCriticalServiceAfter: c.Default,
+				agent:                          agent,
+			}
+
+			require.NoError(resource.Upsert("", pod))
+			require.NotNil(agent.lastRegistration)
+			require.Equal(c.Exp, agent.lastRegistration.DeregisterCriticalServiceAfter)
+		})
+	}
+}
+
+// Test that an existing check registered with other parameters, e.g. before
+// the configured TTL changed, is registered again with the new ones while an
+// unchanged check isn't.
+func TestUpsert_FakeAgentReregistersChangedCheck(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, true)
+	agent := newFakeConsulAgent()
+	agent.services[testServiceNameReg] = true
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		Ctx:                 context.Background(),
+		TTL:                 "1h",
+		agent:               agent,
+	}
+
+	require.NoError(resource.Upsert("", pod))
+	require.Equal(1, agent.registrations)
+	require.Equal("1h", agent.lastRegistration.TTL)
+
+	// Relisting the pod with the same configuration doesn't register it again.
+	require.NoError(resource.Upsert("", pod))
+	require.Equal(1, agent.registrations)
+
+	// A new version is rolled out with another TTL.
+	resource.TTL = "2h"
+	updates := agent.updates
+	require.NoError(resource.Upsert("", pod))
+	require.Equal(2, agent.registrations)
+	require.Equal("2h", agent.lastRegistration.TTL)
+	require.Equal(updates+1, agent.updates)
+	check := agent.checks[testHealthCheckID]
+	require.Equal(api.HealthPassing, check.Status)
+	require.Equal(kubernetesSuccessReasonMsg, check.Output)
+	meta, _, ok := decodeCheckNotes(check.Notes)
+	require.True(ok)
+	require.Equal(checkConfigFingerprint("2h", 1, 1, ""), meta.Config)
+
+	// Checks that aren't managed by the controller are never re-registered.
+	check.Notes = "created manually"
+	resource.TTL = "3h"
+	require.NoError(resource.Upsert("", pod))
+	require.Equal(2, agent.registrations)
+
+	// Neither are checks when only their status is managed.
+	resource.ManageStatusOnly = true
+	check.Notes = testCheckNotesMetadata
+	require.NoError(resource.Upsert("", pod))
+	require.Equal(2, agent.registrations)
+}
+
+// Test that the sweep deregisters the health checks of pods that no longer
+// exist and leaves the other checks alone, including checks with a matching
+// ID that don't carry the managed-by marker.
+func TestSweepOrphanedChecks_FakeAgent(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, true)
+	agent := newFakeConsulAgent()
+	addCheck := func(id string) {
+		agent.checks[id] = &api.AgentCheck{CheckID: id, Name: name, Notes: testCheckNotesMetadata,
+			Status: api.HealthPassing}
+	}
+	// The check of the existing pod.
+	addCheck("prefix/default/" + testServiceNameReg + "/kubernetes-health-check")
+	// The check of a deleted pod.
+	addCheck("prefix/default/deleted-pod-" + testServiceNameAnnotation + "/kubernetes-health-check")
+	// The check of a deleted pod in a namespace that isn't watched.
+	addCheck("prefix/other/deleted-pod-" + testServiceNameAnnotation + "/kubernetes-health-check")
+	// The check of a deleted pod registered by another cluster.
+	addCheck("other-prefix/default/deleted-pod-" + testServiceNameAnnotation + "/kubernetes-health-check")
+	// A check that isn't managed by the controller.
+	agent.checks["service:deleted-pod"] = &api.AgentCheck{CheckID: "service:deleted-pod", Name: "Other Check"}
+	// A check of a deleted pod registered by something else than the controller.
+	foreignID := "prefix/default/foreign-pod-" + testServiceNameAnnotation + "/kubernetes-health-check"
+	agent.checks[foreignID] = &api.AgentCheck{CheckID: foreignID, Name: name, Status: api.HealthPassing}
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		Ctx:                 context.Background(),
+		HealthCheckIDPrefix: "prefix",
+		Namespaces:          []string{"default"},
+		agent:               agent,
+	}
+
+	require.NoError(resource.SweepOrphanedChecks())
+	require.Len(agent.checks, 5)
+	require.NotNil(agent.checks[resource.getConsulHealthCheckID(pod)])
+	require.NotNil(agent.checks[foreignID])
+	require.Nil(agent.checks["prefix/default/deleted-pod-"+testServiceNameAnnotation+"/kubernetes-health-check"])
+}
+
+// Test that removing the health check label from a running pod deregisters
+// its health check, using the pod last known to the informer, while the
+// checks of the pods that keep the label stay registered.
+func TestRun_FakeAgentLabelRemoved(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	podA, podB := testFakeAgentPod("pod-a", true), testFakeAgentPod("pod-b", true)
+	client := fake.NewSimpleClientset(podA, podB)
+	// The fake client drops the events that happen before a watch is
+	// started so the label is only removed once the pods are watched.
+	podWatchStarted := make(chan struct{})
+	var podWatchOnce sync.Once
+	client.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w, err := client.Tracker().Watch(corev1.SchemeGroupVersion.WithResource("pods"), action.GetNamespace())
+		podWatchOnce.Do(func() { close(podWatchStarted) })
+		return true, w, err
+	})
+	agent := newFakeConsulAgent()
+	agent.services[podA.Name+"-"+testServiceNameAnnotation] = true
+	agent.services[podB.Name+"-"+testServiceNameAnnotation] = true
+	resource := &HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: client,
+		Ctx:                 context.Background(),
+		agent:               agent,
+	}
+	checkIDA, checkIDB := resource.getConsulHealthCheckID(podA), resource.getConsulHealthCheckID(podB)
+	hasCheck := func(id string) func() bool {
+		return func() bool {
+			agent.Lock()
+			defer agent.Unlock()
+			_, ok := agent.checks[id]
+			return ok
+		}
+	}
+
+	ctrl := &controller.Controller{
+		Log:      hclog.Default().Named("healthCheckController"),
+		Resource: resource,
+	}
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ctrl.Run(stopCh)
+	}()
+	defer func() {
+		close(stopCh)
+		<-doneCh
+	}()
+	require.Eventually(hasCheck(checkIDA), 5*time.Second, 10*time.Millisecond)
+	require.Eventually(hasCheck(checkIDB), 5*time.Second, 10*time.Millisecond)
+	<-podWatchStarted
+
+	podA = podA.DeepCopy()
+	delete(podA.Labels, labelInject)
+	podA.ResourceVersion = "2"
+	_, err := client.CoreV1().Pods(podA.Namespace).Update(context.Background(), podA, metav1.UpdateOptions{})
+	require.NoError(err)
+	require.Eventually(func() bool { return !hasCheck(checkIDA)() }, 5*time.Second, 10*time.Millisecond,
+		fmt.Sprintf("health check %q not deregistered", checkIDA))
+	require.True(hasCheck(checkIDB)())
+}
+
+// Test that Run sweeps the orphaned health checks every OrphanSweepPeriod
+// of its clock and not before.
+func TestRun_FakeAgentSweepWithFakeClock(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, true)
+	agent := newFakeConsulAgent()
+	agent.services[testServiceNameReg] = true
+	orphanID := "default/deleted-pod-" + testServiceNameAnnotation + "/kubernetes-health-check"
+	agent.checks[orphanID] = &api.AgentCheck{CheckID: orphanID, Name: name, Notes: testCheckNotesMetadata,
+		Status: api.HealthPassing}
+	fakeClock := clock.NewFakeClock(time.Now())
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		Ctx:                 context.Background(),
+		ReconcilePeriod:     time.Hour,
+		OrphanSweepPeriod:   10 * time.Minute,
+		Clock:               fakeClock,
+		agent:               agent,
+	}
+	orphanExists := func() bool {
+		agent.Lock()
+		defer agent.Unlock()
+		return agent.checks[orphanID] != nil
+	}
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		resource.Run(stopCh)
+	}()
+	defer func() {
+		close(stopCh)
+		<-doneCh
+	}()
+
+	// The sweep ticker is created once the initial reconcile is done.
+	retry.Run(t, func(r *retry.R) {
+		if !fakeClock.HasWaiters() {
+			r.Error("timers not created")
+		}
+	})
+	fakeClock.Step(9 * time.Minute)
+	require.True(orphanExists())
+
+	fakeClock.Step(time.Minute)
+	retry.Run(t, func(r *retry.R) {
+		if orphanExists() {
+			r.Error("orphaned health check not swept")
+		}
+	})
+	agent.Lock()
+	defer agent.Unlock()
+	require.NotNil(agent.checks[testHealthCheckID])
+}
+
+// testFakeAgentPod returns an injected pod of the test service.
+func testFakeAgentPod(name string, ready bool) *corev1.Pod {
+	condition := corev1.PodCondition{
+		Type:   corev1.PodReady,
+		Status: corev1.ConditionTrue,
+	}
+	if !ready {
+		condition.Status = corev1.ConditionFalse
+		condition.Message = testFailureMessage
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{labelInject: "true"},
+			Annotations: map[string]string{
+				annotationStatus:  injected,
+				annotationService: testServiceNameAnnotation,
+			},
+		},
+		Spec: testPodSpec,
+		Status: corev1.PodStatus{
+			HostIP:                "127.0.0.1",
+			Phase:                 corev1.PodRunning,
+			InitContainerStatuses: completedInjectInitContainer,
+			Conditions:            []corev1.PodCondition{condition},
+		},
+	}
+}
+
+// fakeConsulAgent implements consulAgent in memory. It only supports the
+// "CheckID == `<id>`" and "CheckID matches `<regexp>`" filters used by the
+// HealthCheckResource.
+type fakeConsulAgent struct {
+	sync.Mutex
+
+	// services is the set of registered service IDs.
+	services map[string]bool
+	// checks are the registered checks keyed by their ID.
+	checks map[string]*api.AgentCheck
+	// calls is the number of calls made to the agent.
+	calls int
+	// updates is the number of calls to UpdateTTL.
+	updates int
+	// registrations is the number of calls to CheckRegister.
+	registrations int
+	// lastRegistration is the check passed to the last call to
+	// CheckRegister.
+	lastRegistration *api.AgentCheckRegistration
+	// err, if set, is returned by every call.
+	err error
+	// errCalls, if greater than 0, is the number of calls that return err
+	// before the calls succeed again.
+	errCalls int
+	// filterErr, if set, is returned by the calls to Checks with a filter,
+	// like an agent that doesn't support filtering.
+	filterErr error
+	// filteredCalls is the number of calls to Checks with a filter.
+	filteredCalls int
+}
+
+func newFakeConsulAgent() *fakeConsulAgent {
+	return &fakeConsulAgent{
+		services: make(map[string]bool),
+		checks:   make(map[string]*api.AgentCheck),
+	}
+}
+
+// callErr returns the error the current call should return. It must be
+// called with the lock held.
+func (a *fakeConsulAgent) callErr() error {
+	a.calls++
+	err := a.err
+	if err != nil && a.errCalls > 0 {
+		a.errCalls--
+		if a.errCalls == 0 {
+			a.err = nil
+		}
+	}
+	return err
+}
+
+func (a *fakeConsulAgent) Checks(_ context.Context, filter string) (map[string]*api.AgentCheck, error) {
+	a.Lock()
+	defer a.Unlock()
+	if err := a.callErr(); err != nil {
+		return nil, err
+	}
+	if filter != "" {
+		a.filteredCalls++
+		if a.filterErr != nil {
+			return nil, a.filterErr
+		}
+	}
+	const idPrefix, matchesPrefix, suffix = "CheckID == `", "CheckID matches `", "`"
+	checks := make(map[string]*api.AgentCheck)
+	switch {
+	case filter == "":
+		for id, check := range a.checks {
+			checks[id] = check
+		}
+	case strings.HasPrefix(filter, idPrefix) && strings.HasSuffix(filter, suffix):
+		checkID := strings.TrimSuffix(strings.TrimPrefix(filter, idPrefix), suffix)
+		if check, ok := a.checks[checkID]; ok {
+			checks[checkID] = check
+		}
+	case strings.HasPrefix(filter, matchesPrefix) && strings.HasSuffix(filter, suffix):
+		re, err := regexp.Compile(strings.TrimSuffix(strings.TrimPrefix(filter, matchesPrefix), suffix))
+		if err != nil {
+			return nil, err
+		}
+		for id, check := range a.checks {
+			if re.MatchString(id) {
+				checks[id] = check
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported filter %q", filter)
+	}
+	return checks, nil
+}
+
+func (a *fakeConsulAgent) CheckRegister(_ context.Context, check *api.AgentCheckRegistration) error {
+	a.Lock()
+	defer a.Unlock()
+	a.registrations++
+	a.lastRegistration = check
+	if err := a.callErr(); err != nil {
+		return err
+	}
+	if !a.services[check.ServiceID] {
+		return fmt.Errorf("Unexpected response code: 500 (ServiceID %q does not exist)", check.ServiceID)
+	}
+	a.checks[check.ID] = &api.AgentCheck{
+		CheckID:   check.ID,
+		Name:      check.Name,
+		Notes:     check.Notes,
+		ServiceID: check.ServiceID,
+		Status:    check.Status,
+	}
+	return nil
+}
+
+func (a *fakeConsulAgent) CheckDeregister(_ context.Context, checkID string) error {
+	a.Lock()
+	defer a.Unlock()
+	if err := a.callErr(); err != nil {
+		return err
+	}
+	if _, ok := a.checks[checkID]; !ok {
+		return fmt.Errorf("Unexpected response code: 404 (Unknown check ID %q)", checkID)
+	}
+	delete(a.checks, checkID)
+	return nil
+}
+
+func (a *fakeConsulAgent) UpdateTTL(_ context.Context, checkID, output, status string) error {
+	a.Lock()
+	defer a.Unlock()
+	if err := a.callErr(); err != nil {
+		return err
+	}
+	check, ok := a.checks[checkID]
+	if !ok {
+		return fmt.Errorf("Unexpected response code: 404 (Unknown check ID %q)", checkID)
+	}
+	check.Status = status
+	check.Output = output
+	a.updates++
+	return nil
+}
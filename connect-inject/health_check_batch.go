@@ -0,0 +1,110 @@
+package connectinject
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// statusBatcher delays the status updates of the health checks by up to
+// window and sends the updates that share a Consul client together, e.g.
+// during a rolling restart that changes the readiness of many pods on a
+// node. Batches are keyed by clientCacheKey, i.e. the address of the agent
+// and the Consul namespace, so the agent of a batch's first update is the
+// client of every update in it. The updates are sent one after the other
+// since the agent API doesn't support updating several checks at once.
+type statusBatcher struct {
+	window time.Duration
+	clock  clock.Clock
+
+	lock sync.Mutex
+	// batches are the batches waiting for their window to end, keyed by
+	// the clientCacheKey of their client.
+	batches map[string]*statusBatch
+}
+
+// statusBatch is the batch of the updates sent with a single client.
+type statusBatch struct {
+	agent   consulAgent
+	updates []*statusUpdate
+}
+
+// statusUpdate is an update of the status of a single health check.
+type statusUpdate struct {
+	// ctx is the context of the caller. The update is sent with it so that
+	// it is bounded like an update that isn't batched.
+	ctx     context.Context
+	checkID string
+	output  string
+	status  string
+	// done receives the error of the update once the batch was flushed.
+	done chan error
+}
+
+func newStatusBatcher(window time.Duration, clk clock.Clock) *statusBatcher {
+	return &statusBatcher{
+		window:  window,
+		clock:   clk,
+		batches: make(map[string]*statusBatch),
+	}
+}
+
+// updateTTL adds the update of the check with ID checkID to the batch of key,
+// starting a new batch sent with agent if there is none, and waits until the
+// batch was flushed or ctx is done. agent must be the client of key.
+func (b *statusBatcher) updateTTL(ctx context.Context, key string, agent consulAgent, checkID, output, status string) error {
+	update := &statusUpdate{
+		ctx:     ctx,
+		checkID: checkID,
+		output:  output,
+		status:  status,
+		done:    make(chan error, 1),
+	}
+	b.lock.Lock()
+	batch, ok := b.batches[key]
+	if !ok {
+		batch = &statusBatch{agent: agent}
+		b.batches[key] = batch
+		go b.flushAfterWindow(key, batch)
+	}
+	batch.updates = append(batch.updates, update)
+	b.lock.Unlock()
+
+	select {
+	case err := <-update.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flushAfterWindow sends the updates of batch once window has elapsed. The
+// updates added to key afterwards start a new batch. The updates whose
+// caller stopped waiting are dropped.
+func (b *statusBatcher) flushAfterWindow(key string, batch *statusBatch) {
+	<-b.clock.After(b.window)
+	b.lock.Lock()
+	delete(b.batches, key)
+	updates := batch.updates
+	b.lock.Unlock()
+
+	for _, update := range updates {
+		if err := update.ctx.Err(); err != nil {
+			update.done <- err
+			continue
+		}
+		update.done <- batch.agent.UpdateTTL(update.ctx, update.checkID, update.output, update.status)
+	}
+}
+
+// pending returns the number of updates waiting in the batch of key.
+func (b *statusBatcher) pending(key string) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if batch, ok := b.batches[key]; ok {
+		return len(batch.updates)
+	}
+	return 0
+}
@@ -0,0 +1,206 @@
+package connectinject
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testBatchAgent starts a fake Consul agent whose checks are all critical,
+// so that the ready pods update them, and whose Consul namespaces all exist.
+// It records the Consul namespace each check was updated in, keyed by check
+// ID.
+func testBatchAgent(t *testing.T) (*url.URL, func() map[string]string) {
+	var lock sync.Mutex
+	updates := make(map[string]string)
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/agent/checks":
+			id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Query().Get("filter"), "CheckID == `"), "`")
+			serviceID := strings.Split(id, "/")[1]
+			json.NewEncoder(w).Encode(map[string]*api.AgentCheck{
+				id: {CheckID: id, Name: name, ServiceID: serviceID, Status: api.HealthCritical, Notes: testCheckNotesMetadata},
+			})
+		case r.URL.Path == "/v1/agent/check/register":
+			// The checks of the pods in other Kubernetes namespaces than the
+			// one of testCheckNotesMetadata are registered again.
+		case strings.HasPrefix(r.URL.Path, "/v1/namespace/"):
+			json.NewEncoder(w).Encode(&api.Namespace{Name: strings.TrimPrefix(r.URL.Path, "/v1/namespace/")})
+		case strings.HasPrefix(r.URL.Path, "/v1/agent/check/update/"):
+			lock.Lock()
+			updates[strings.TrimPrefix(r.URL.Path, "/v1/agent/check/update/")] = r.URL.Query().Get("ns")
+			lock.Unlock()
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(agent.Close)
+	consulURL, err := url.Parse(agent.URL)
+	require.NoError(t, err)
+	return consulURL, func() map[string]string {
+		lock.Lock()
+		defer lock.Unlock()
+		result := make(map[string]string)
+		for id, ns := range updates {
+			result[id] = ns
+		}
+		return result
+	}
+}
+
+// Test that the status updates of the pods on the same agent within the
+// batch window are sent together, once the window ends, with one client.
+func TestUpsert_StatusBatchWindow(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	const numPods = 5
+	consulURL, updates := testBatchAgent(t)
+
+	fakeClock := clock.NewFakeClock(time.Now())
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(),
+		ConsulUrl:           consulURL,
+		Ctx:                 context.Background(),
+		StatusBatchWindow:   time.Second,
+		Clock:               fakeClock,
+	}
+
+	errCh := make(chan error, numPods)
+	for i := 0; i < numPods; i++ {
+		pod := testFakeAgentPod(fmt.Sprintf("pod-%d", i), true)
+		pod.Status.HostIP = consulURL.Hostname()
+		go func() {
+			errCh <- resource.Upsert("", pod)
+		}()
+	}
+
+	// No update is sent before the window ends.
+	key := clientCacheKey(consulURL.String(), "")
+	retry.Run(t, func(r *retry.R) {
+		if n := resource.getBatcher().pending(key); n != numPods {
+			r.Errorf("expected %d pending updates, got %d", numPods, n)
+		}
+	})
+	require.Empty(updates())
+
+	waitForWaiters(t, fakeClock)
+	fakeClock.Step(time.Second)
+	for i := 0; i < numPods; i++ {
+		require.NoError(<-errCh)
+	}
+	require.Len(updates(), numPods)
+	require.Equal(0, resource.getBatcher().pending(key))
+	resource.clientsLock.Lock()
+	require.Len(resource.clients, 1)
+	resource.clientsLock.Unlock()
+}
+
+// Test that the updates of the pods on the same host whose checks are in
+// different Consul namespaces are batched separately and each sent with the
+// client of its namespace.
+func TestUpsert_StatusBatchWindowNamespaces(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	consulURL, updates := testBatchAgent(t)
+
+	fakeClock := clock.NewFakeClock(time.Now())
+	resource := HealthCheckResource{
+		Log:                    hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset:    fake.NewSimpleClientset(),
+		ConsulUrl:              consulURL,
+		Ctx:                    context.Background(),
+		EnableConsulNamespaces: true,
+		EnableNSMirroring:      true,
+		StatusBatchWindow:      time.Second,
+		Clock:                  fakeClock,
+	}
+
+	namespaces := []string{"team-a", "team-b"}
+	errCh := make(chan error, len(namespaces))
+	ids := make(map[string]string)
+	for _, ns := range namespaces {
+		pod := testFakeAgentPod("pod", true)
+		pod.Namespace = ns
+		pod.Status.HostIP = consulURL.Hostname()
+		ids[resource.getConsulHealthCheckID(pod)] = ns
+		go func() {
+			errCh <- resource.Upsert("", pod)
+		}()
+	}
+	retry.Run(t, func(r *retry.R) {
+		for _, ns := range namespaces {
+			if n := resource.getBatcher().pending(clientCacheKey(consulURL.String(), ns)); n != 1 {
+				r.Errorf("expected 1 pending update in namespace %s, got %d", ns, n)
+			}
+		}
+	})
+
+	waitForWaiters(t, fakeClock)
+	fakeClock.Step(time.Second)
+	for range namespaces {
+		require.NoError(<-errCh)
+	}
+	require.Equal(ids, updates())
+	resource.clientsLock.Lock()
+	defer resource.clientsLock.Unlock()
+	require.Len(resource.clients, len(namespaces))
+	for _, ns := range namespaces {
+		client := resource.clients[clientCacheKey(consulURL.String(), ns)]
+		require.NotNil(client)
+		for _, other := range namespaces {
+			if other != ns {
+				require.NotSame(client, resource.clients[clientCacheKey(consulURL.String(), other)])
+			}
+		}
+	}
+}
+
+// Test that a caller stops waiting for its batch once its context is done
+// and that its update isn't sent.
+func TestStatusBatcher_ContextDone(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	agent := newFakeConsulAgent()
+	fakeClock := clock.NewFakeClock(time.Now())
+	batcher := newStatusBatcher(time.Minute, fakeClock)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := batcher.updateTTL(ctx, "host", agent, testHealthCheckID, "", api.HealthPassing)
+	require.Equal(context.Canceled, err)
+	waitForWaiters(t, fakeClock)
+	fakeClock.Step(time.Minute)
+	retry.Run(t, func(r *retry.R) {
+		if n := batcher.pending("host"); n != 0 {
+			r.Errorf("expected no pending updates, got %d", n)
+		}
+	})
+	agent.Lock()
+	defer agent.Unlock()
+	require.Equal(0, agent.updates)
+}
+
+// waitForWaiters waits until a batch is waiting for its window to end on
+// fakeClock.
+func waitForWaiters(t *testing.T, fakeClock *clock.FakeClock) {
+	retry.Run(t, func(r *retry.R) {
+		if !fakeClock.HasWaiters() {
+			r.Error("no batch waiting")
+		}
+	})
+}
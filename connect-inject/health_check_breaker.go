@@ -0,0 +1,116 @@
+package connectinject
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// agentBreaker is a circuit breaker per Consul agent host. Once the agent on
+// a host failed threshold consecutive times, the breaker of the host opens
+// and no calls are made to the agent until cooldown has elapsed. A single
+// trial call is then let through while the others keep waiting: the breaker
+// closes if it succeeds and opens again if it fails.
+type agentBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	// onChange, if set, is called with the lock held when the breaker of
+	// host opens or closes.
+	onChange func(host string, open bool)
+	clock    clock.Clock
+
+	lock  sync.Mutex
+	hosts map[string]*agentBreakerState
+}
+
+// agentBreakerState is the state of the breaker of a single host.
+type agentBreakerState struct {
+	// failures is the number of consecutive failures.
+	failures int
+	// openUntil is the time the cooldown of an open breaker ends. It is zero
+	// if the breaker is closed.
+	openUntil time.Time
+	// trial is set while the single call let through after the cooldown
+	// is in flight.
+	trial bool
+}
+
+// breakerTrialWait is the delay after which the calls that weren't let
+// through while the trial call of a breaker is in flight are retried.
+const breakerTrialWait = time.Second
+
+func newAgentBreaker(threshold int, cooldown time.Duration, clk clock.Clock, onChange func(host string, open bool)) *agentBreaker {
+	return &agentBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		onChange:  onChange,
+		clock:     clk,
+		hosts:     make(map[string]*agentBreakerState),
+	}
+}
+
+// allow returns whether a call may be made to the agent on host and, if it
+// may not, the remaining cooldown.
+func (b *agentBreaker) allow(host string) (bool, time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	state, ok := b.hosts[host]
+	if !ok || state.openUntil.IsZero() {
+		return true, 0
+	}
+	if remaining := state.openUntil.Sub(b.clock.Now()); remaining > 0 {
+		return false, remaining
+	}
+	if state.trial {
+		return false, breakerTrialWait
+	}
+	state.trial = true
+	return true, 0
+}
+
+// release records that a call to the agent on host ended without telling
+// whether the agent can be reached, e.g. because the agent returned an
+// error, so that another trial call can be let through.
+func (b *agentBreaker) release(host string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if state, ok := b.hosts[host]; ok {
+		state.trial = false
+	}
+}
+
+// success records a successful call to the agent on host.
+func (b *agentBreaker) success(host string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	state, ok := b.hosts[host]
+	if !ok {
+		return
+	}
+	delete(b.hosts, host)
+	if !state.openUntil.IsZero() && b.onChange != nil {
+		b.onChange(host, false)
+	}
+}
+
+// failure records a failed call to the agent on host.
+func (b *agentBreaker) failure(host string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	state, ok := b.hosts[host]
+	if !ok {
+		state = &agentBreakerState{}
+		b.hosts[host] = state
+	}
+	state.failures++
+	state.trial = false
+	if state.failures < b.threshold {
+		return
+	}
+	wasOpen := !state.openUntil.IsZero()
+	state.openUntil = b.clock.Now().Add(b.cooldown)
+	if !wasOpen && b.onChange != nil {
+		b.onChange(host, true)
+	}
+}
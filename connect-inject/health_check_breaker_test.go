@@ -0,0 +1,91 @@
+package connectinject
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestAgentBreaker(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	var transitions []string
+	fakeClock := clock.NewFakeClock(time.Now())
+	breaker := newAgentBreaker(2, time.Minute, fakeClock, func(host string, open bool) {
+		state := "closed"
+		if open {
+			state = "open"
+		}
+		transitions = append(transitions, host+" "+state)
+	})
+
+	// A failure below the threshold doesn't open the breaker and a success
+	// resets the count.
+	breaker.failure("a")
+	breaker.success("a")
+	breaker.failure("a")
+	allowed, _ := breaker.allow("a")
+	require.True(allowed)
+
+	// Reaching the threshold opens the breaker for the cooldown.
+	breaker.failure("a")
+	allowed, remaining := breaker.allow("a")
+	require.False(allowed)
+	require.Equal(time.Minute, remaining)
+	fakeClock.Step(20 * time.Second)
+	allowed, remaining = breaker.allow("a")
+	require.False(allowed)
+	require.Equal(40*time.Second, remaining)
+
+	// Other hosts aren't affected.
+	allowed, _ = breaker.allow("b")
+	require.True(allowed)
+
+	// Once the cooldown has elapsed, a single trial call is allowed and the
+	// breaker opens again right away if it fails.
+	fakeClock.Step(40 * time.Second)
+	allowed, _ = breaker.allow("a")
+	require.True(allowed)
+	allowed, remaining = breaker.allow("a")
+	require.False(allowed)
+	require.Equal(breakerTrialWait, remaining)
+	breaker.failure("a")
+	allowed, remaining = breaker.allow("a")
+	require.False(allowed)
+	require.Equal(time.Minute, remaining)
+
+	// A success after the cooldown closes the breaker.
+	fakeClock.Step(time.Minute)
+	breaker.success("a")
+	allowed, _ = breaker.allow("a")
+	require.True(allowed)
+
+	require.Equal([]string{"a open", "a closed"}, transitions)
+}
+
+// Test that another trial call is let through once the trial call of a
+// half-open breaker ended without telling whether the agent is reachable.
+func TestAgentBreaker_TrialReleased(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	fakeClock := clock.NewFakeClock(time.Now())
+	breaker := newAgentBreaker(1, time.Minute, fakeClock, nil)
+	breaker.failure("a")
+	fakeClock.Step(time.Minute)
+
+	allowed, _ := breaker.allow("a")
+	require.True(allowed)
+	allowed, _ = breaker.allow("a")
+	require.False(allowed)
+
+	breaker.release("a")
+	allowed, _ = breaker.allow("a")
+	require.True(allowed)
+	breaker.success("a")
+	allowed, _ = breaker.allow("a")
+	require.True(allowed)
+	allowed, _ = breaker.allow("a")
+	require.True(allowed)
+}
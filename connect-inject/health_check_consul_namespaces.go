@@ -0,0 +1,64 @@
+package connectinject
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/consul-k8s/consul"
+	"github.com/hashicorp/consul-k8s/namespaces"
+	"github.com/hashicorp/consul/api"
+)
+
+// ensureConsulNamespace creates the Consul namespace consulNS, that a health
+// check is about to be registered into, with AclConfig as its ACL config if
+// it doesn't exist yet, e.g. so that the namespaces of Consul Enterprise that
+// weren't created by the webhook have a default ACL policy. Namespaces are
+// only ensured once, so the namespaces of the pods processed later, e.g. of
+// a Kubernetes namespace created since startup, are created on demand. It
+// does nothing if EnableConsulNamespaces is false.
+func (h *HealthCheckResource) ensureConsulNamespace(consulNS string) error {
+	if !h.EnableConsulNamespaces || consulNS == "" {
+		return nil
+	}
+	h.ensuredNamespacesLock.Lock()
+	defer h.ensuredNamespacesLock.Unlock()
+	if h.ensuredNamespaces[consulNS] {
+		return nil
+	}
+	if h.DryRun {
+		h.Log.Info("dry run: would create Consul namespace if missing", "namespace", consulNS)
+		return nil
+	}
+	client, err := h.namespacesClient()
+	if err != nil {
+		return fmt.Errorf("unable to get Consul client: %w", err)
+	}
+	created, err := namespaces.EnsureExistsWithACLConfig(client, consulNS, h.AclConfig)
+	if err != nil {
+		return fmt.Errorf("creating Consul namespace %q: %w", consulNS, err)
+	}
+	if created {
+		h.Log.Info("created Consul namespace", "namespace", consulNS)
+	}
+	if h.ensuredNamespaces == nil {
+		h.ensuredNamespaces = make(map[string]bool)
+	}
+	h.ensuredNamespaces[consulNS] = true
+	return nil
+}
+
+// namespacesClient returns a client for the Consul agent at ConsulUrl to
+// manage namespaces with. It isn't cached with the clients of
+// getOrCreateClient since the agents those point at are the ones the orphan
+// sweep visits.
+func (h *HealthCheckResource) namespacesClient() (*api.Client, error) {
+	token, err := h.token("")
+	if err != nil {
+		return nil, err
+	}
+	config := api.DefaultConfig()
+	config.Address = fmt.Sprintf("%s://%s", h.ConsulUrl.Scheme, h.ConsulUrl.Host)
+	config.TLSConfig = h.TLSConfig
+	config.Token = token
+	config.TokenFile = ""
+	return consul.NewClient(config)
+}
@@ -0,0 +1,132 @@
+package connectinject
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Test that the missing Consul namespaces the health checks are registered
+// into are created with AclConfig when the first check is registered into
+// them, including the namespaces of pods processed later, that the existing
+// ones are left alone and that the Consul client isn't cached with the
+// clients of the agents.
+func TestUpsert_FakeAgentEnsuresConsulNamespaces(t *testing.T) {
+	t.Parallel()
+	aclConfig := api.NamespaceACLConfig{PolicyDefaults: []api.ACLLink{{Name: "cross-namespace-policy"}}}
+	cases := map[string]struct {
+		EnableConsulNamespaces bool
+		DestinationNamespace   string
+		EnableNSMirroring      bool
+		NSMirroringPrefix      string
+		ExpCreated             []string
+	}{
+		"namespaces disabled": {
+			DestinationNamespace: "dest",
+			ExpCreated:           nil,
+		},
+		"missing destination namespace": {
+			EnableConsulNamespaces: true,
+			DestinationNamespace:   "dest",
+			ExpCreated:             []string{"dest"},
+		},
+		"existing destination namespace": {
+			EnableConsulNamespaces: true,
+			DestinationNamespace:   "existing",
+			ExpCreated:             nil,
+		},
+		"mirrors the namespaces of the pods": {
+			EnableConsulNamespaces: true,
+			EnableNSMirroring:      true,
+			NSMirroringPrefix:      "k8s-",
+			ExpCreated:             []string{"k8s-default", "k8s-team-a"},
+		},
+	}
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require := require.New(t)
+			var lock sync.Mutex
+			var reads int
+			var created []*api.Namespace
+			consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lock.Lock()
+				defer lock.Unlock()
+				switch {
+				case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/namespace/"):
+					reads++
+					ns := strings.TrimPrefix(r.URL.Path, "/v1/namespace/")
+					if ns != "existing" {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					json.NewEncoder(w).Encode(&api.Namespace{Name: ns})
+				case r.Method == http.MethodPut && r.URL.Path == "/v1/namespace":
+					var ns api.Namespace
+					require.NoError(json.NewDecoder(r.Body).Decode(&ns))
+					created = append(created, &ns)
+					json.NewEncoder(w).Encode(&ns)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer consul.Close()
+			consulURL, err := url.Parse(consul.URL)
+			require.NoError(err)
+
+			podA := testFakeAgentPod("pod-a", true)
+			podB := testFakeAgentPod("pod-b", true)
+			// The namespace of pod-c is only processed after the others.
+			podC := testFakeAgentPod("pod-c", true)
+			podC.Namespace = "team-a"
+			agent := newFakeConsulAgent()
+			agent.services[testServiceNameReg] = true
+			resource := HealthCheckResource{
+				Log:                        hclog.Default().Named("healthCheckResource"),
+				KubernetesClientset:        fake.NewSimpleClientset(podA, podB, podC),
+				ConsulUrl:                  consulURL,
+				Ctx:                        context.Background(),
+				EnableConsulNamespaces:     c.EnableConsulNamespaces,
+				ConsulDestinationNamespace: c.DestinationNamespace,
+				EnableNSMirroring:          c.EnableNSMirroring,
+				NSMirroringPrefix:          c.NSMirroringPrefix,
+				AclConfig:                  aclConfig,
+				agent:                      agent,
+			}
+
+			require.NoError(resource.Upsert("", podA))
+			require.NoError(resource.Upsert("", podB))
+			require.NoError(resource.Upsert("", podC))
+			require.Equal(3, agent.registrations)
+			lock.Lock()
+			defer lock.Unlock()
+			var createdNames []string
+			for _, ns := range created {
+				createdNames = append(createdNames, ns.Name)
+				require.Equal(&aclConfig, ns.ACLs)
+			}
+			require.ElementsMatch(c.ExpCreated, createdNames)
+			// Each namespace is only read once.
+			expReads := 0
+			if c.EnableConsulNamespaces {
+				expReads = 1
+				if c.EnableNSMirroring {
+					expReads = 2
+				}
+			}
+			require.Equal(expReads, reads)
+			require.Empty(resource.clients)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package connectinject
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultEnvoyReadyTimeout is the time the Envoy ready probe waits for
+	// the sidecar to answer if EnvoyReadyTimeout is not set.
+	DefaultEnvoyReadyTimeout = time.Second
+
+	// envoyReadyPath is the path of the Envoy endpoint that returns 200 once
+	// the proxy is ready to serve, i.e. it received its initial
+	// configuration over xDS.
+	envoyReadyPath = "/ready"
+)
+
+// envoyReadyStatusAndReason probes the /ready endpoint of the pod's Envoy
+// sidecar at the port of its annotationEnvoyReadyPort annotation and returns
+// whether it is ready to serve along with the reason it isn't. The admin API
+// of the injected sidecars only listens on localhost so pods without the
+// annotation, which must expose the endpoint at their IP themselves, aren't
+// probed and are considered ready.
+func (h *HealthCheckResource) envoyReadyStatusAndReason(ctx context.Context, pod *corev1.Pod) (bool, string) {
+	raw, ok := pod.Annotations[annotationEnvoyReadyPort]
+	if !ok {
+		return true, ""
+	}
+	port, err := strconv.Atoi(raw)
+	if err != nil || port < 1 || port > 65535 {
+		return false, fmt.Sprintf("Envoy sidecar is not ready: invalid %s annotation %q", annotationEnvoyReadyPort, raw)
+	}
+	if pod.Status.PodIP == "" {
+		return false, "Envoy sidecar is not ready: pod has no IP"
+	}
+	readyURL := fmt.Sprintf("http://%s%s", net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(port)), envoyReadyPath)
+
+	ctx, cancel := context.WithTimeout(ctx, h.envoyReadyTimeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, readyURL, nil)
+	if err != nil {
+		return false, fmt.Sprintf("Envoy sidecar is not ready: %s", err)
+	}
+	resp, err := h.getEnvoyClient().Do(req)
+	if err != nil {
+		h.Log.Debug("probing Envoy sidecar", "name", pod.Name, "namespace", pod.Namespace, "url", readyURL, "err", err)
+		return false, fmt.Sprintf("Envoy sidecar is not ready: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Sprintf("Envoy sidecar is not ready: %s returned %d", envoyReadyPath, resp.StatusCode)
+	}
+	return true, ""
+}
+
+// getEnvoyClient returns the client the sidecars are probed with. It is
+// created on first use so that its connections aren't shared with other
+// users of http.DefaultClient.
+func (h *HealthCheckResource) getEnvoyClient() *http.Client {
+	h.envoyClientOnce.Do(func() {
+		h.envoyClient = &http.Client{
+			Timeout: h.envoyReadyTimeout(),
+			// A redirect is not a ready sidecar.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	})
+	return h.envoyClient
+}
+
+func (h *HealthCheckResource) envoyReadyTimeout() time.Duration {
+	if h.EnvoyReadyTimeout == 0 {
+		return DefaultEnvoyReadyTimeout
+	}
+	return h.EnvoyReadyTimeout
+}
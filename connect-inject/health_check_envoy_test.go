@@ -0,0 +1,151 @@
+package connectinject
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Test that the health check of a ready pod with the ready port annotation
+// only passes once the /ready endpoint of its Envoy sidecar returns 200 when
+// the probe is enabled.
+func TestUpsert_EnvoyReadyProbe(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		Probe      bool
+		PodReady   bool
+		Annotation bool
+		ReadyCode  int
+		ExpStatus  string
+		ExpOutput  string
+		ExpProbes  int32
+	}{
+		"probe disabled ignores the sidecar": {
+			Probe:      false,
+			PodReady:   true,
+			Annotation: true,
+			ReadyCode:  http.StatusServiceUnavailable,
+			ExpStatus:  api.HealthPassing,
+			ExpOutput:  kubernetesSuccessReasonMsg,
+		},
+		"sidecar ready": {
+			Probe:      true,
+			PodReady:   true,
+			Annotation: true,
+			ReadyCode:  http.StatusOK,
+			ExpStatus:  api.HealthPassing,
+			ExpOutput:  kubernetesSuccessReasonMsg,
+			ExpProbes:  1,
+		},
+		"sidecar not ready keeps the check critical": {
+			Probe:      true,
+			PodReady:   true,
+			Annotation: true,
+			ReadyCode:  http.StatusServiceUnavailable,
+			ExpStatus:  api.HealthCritical,
+			ExpOutput:  "Envoy sidecar is not ready: /ready returned 503",
+			ExpProbes:  1,
+		},
+		"pod without the annotation isn't probed": {
+			Probe:     true,
+			PodReady:  true,
+			ReadyCode: http.StatusServiceUnavailable,
+			ExpStatus: api.HealthPassing,
+			ExpOutput: kubernetesSuccessReasonMsg,
+		},
+		"pod not ready isn't probed": {
+			Probe:      true,
+			PodReady:   false,
+			Annotation: true,
+			ReadyCode:  http.StatusOK,
+			ExpStatus:  api.HealthCritical,
+			ExpOutput:  testFailureMessage,
+		},
+	}
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require := require.New(t)
+			var probes int32
+			sidecar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&probes, 1)
+				if r.URL.Path != envoyReadyPath {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(c.ReadyCode)
+			}))
+			defer sidecar.Close()
+			sidecarURL, err := url.Parse(sidecar.URL)
+			require.NoError(err)
+
+			pod := testFakeAgentPod(testPodName, c.PodReady)
+			pod.Status.PodIP = sidecarURL.Hostname()
+			if c.Annotation {
+				pod.Annotations[annotationEnvoyReadyPort] = sidecarURL.Port()
+			}
+			agent := newFakeConsulAgent()
+			agent.services[testServiceNameReg] = true
+			resource := HealthCheckResource{
+				Log:                 hclog.Default().Named("healthCheckResource"),
+				KubernetesClientset: fake.NewSimpleClientset(pod),
+				Ctx:                 context.Background(),
+				EnvoyReadyProbe:     c.Probe,
+				agent:               agent,
+			}
+
+			require.NoError(resource.Upsert("", pod))
+			check := agent.checks[testHealthCheckID]
+			require.NotNil(check)
+			require.Equal(c.ExpStatus, check.Status)
+			require.Equal(c.ExpOutput, check.Output)
+			require.Equal(c.ExpProbes, atomic.LoadInt32(&probes))
+		})
+	}
+}
+
+// Test that a sidecar that can't be reached or whose annotation is invalid
+// is not ready.
+func TestEnvoyReadyStatusAndReason_NotReachable(t *testing.T) {
+	t.Parallel()
+	sidecar := httptest.NewServer(http.NotFoundHandler())
+	sidecarURL, err := url.Parse(sidecar.URL)
+	require.NoError(t, err)
+	sidecar.Close()
+
+	cases := map[string]struct {
+		Port      string
+		ExpReason string
+	}{
+		"unreachable": {
+			Port:      sidecarURL.Port(),
+			ExpReason: "Envoy sidecar is not ready: Get",
+		},
+		"invalid port": {
+			Port:      "envoy",
+			ExpReason: `Envoy sidecar is not ready: invalid consul.hashicorp.com/envoy-ready-port annotation "envoy"`,
+		},
+	}
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			pod := testFakeAgentPod(testPodName, true)
+			pod.Status.PodIP = sidecarURL.Hostname()
+			pod.Annotations[annotationEnvoyReadyPort] = c.Port
+			resource := HealthCheckResource{Log: hclog.Default().Named("healthCheckResource")}
+
+			ready, reason := resource.envoyReadyStatusAndReason(context.Background(), pod)
+			require.False(t, ready)
+			require.Contains(t, reason, c.ExpReason)
+		})
+	}
+}
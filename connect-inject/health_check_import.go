@@ -0,0 +1,93 @@
+package connectinject
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ImportExistingChecks adopts the health checks that already exist in Consul
+// for the watched pods, e.g. TTL checks created manually before the
+// controller was deployed, and records them as managed. Since their IDs are
+// the IDs of the pods' health checks, reconciling the pods then updates them
+// to match the pods' readiness instead of registering duplicates. It returns
+// the number of adopted checks.
+func (h *HealthCheckResource) ImportExistingChecks() (int, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.Log.Debug("starting import of existing health checks")
+
+	// Group the pods by the agent their health checks are registered with
+	// so that the checks of each agent are only listed once.
+	agents := make(map[string]consulAgent)
+	agentPods := make(map[string]map[string]*corev1.Pod)
+	for _, ns := range h.namespaces() {
+		podList, err := h.KubernetesClientset.CoreV1().Pods(ns).List(h.Ctx,
+			metav1.ListOptions{LabelSelector: h.labelSelector(), FieldSelector: h.fieldSelector()})
+		if err != nil {
+			h.Log.Error("unable to get pods", "namespace", ns, "err", err)
+			return 0, err
+		}
+		for i := range podList.Items {
+			pod := &podList.Items[i]
+			if !h.shouldProcess(pod) || h.getConsulServiceName(pod) == "" || !h.healthSyncEnabled(pod) {
+				continue
+			}
+			key, err := h.agentKey(pod)
+			if err != nil {
+				h.Log.Error("unable to get Consul agent address", "name", pod.Name, "namespace", pod.Namespace, "err", err)
+				continue
+			}
+			if _, ok := agents[key]; !ok {
+				agent, err := h.getConsulAgent(pod)
+				if err != nil {
+					h.Log.Error("unable to get Consul client connection", "name", pod.Name, "namespace", pod.Namespace, "err", err)
+					continue
+				}
+				agents[key] = agent
+				agentPods[key] = make(map[string]*corev1.Pod)
+			}
+			agentPods[key][h.getConsulHealthCheckID(pod)] = pod
+		}
+	}
+
+	imported := 0
+	for key, agent := range agents {
+		checks, err := agent.Checks(h.Ctx, "")
+		if err != nil {
+			h.Log.Error("unable to get agent health checks", "err", err)
+			continue
+		}
+		for id, check := range checks {
+			pod, ok := agentPods[key][id]
+			if !ok {
+				continue
+			}
+			// Checks registered by the controller carry the namespace of
+			// their pod in their notes, checks created manually don't.
+			meta, _, managed := decodeCheckNotes(check.Notes)
+			if managed && meta.Namespace != pod.Namespace {
+				h.Log.Warn("not adopting health check registered for a pod in another namespace", "id", id,
+					"name", pod.Name, "namespace", pod.Namespace, "check-namespace", meta.Namespace)
+				continue
+			}
+			h.Log.Info("adopting existing health check", "id", id, "name", pod.Name, "namespace", pod.Namespace,
+				"status", check.Status, "managed", managed)
+			h.recordReport(pod, h.getConsulServiceID(pod), id, check.Status)
+			imported++
+		}
+	}
+	h.Log.Debug("finished import of existing health checks", "imported", imported)
+	return imported, nil
+}
+
+// agentKey identifies the agent the pod's health check is registered with.
+func (h *HealthCheckResource) agentKey(pod *corev1.Pod) (string, error) {
+	if h.agent != nil {
+		return "", nil
+	}
+	addr, err := h.getConsulAgentAddr(pod)
+	if err != nil {
+		return "", err
+	}
+	return clientCacheKey(addr, h.getConsulNamespace(pod)), nil
+}
@@ -0,0 +1,64 @@
+package connectinject
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Test that a health check that already exists for a pod is adopted and
+// updated instead of registered again.
+func TestImportExistingChecks(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, true)
+	otherPod := testFakeAgentPod("other-pod", true)
+	agent := newFakeConsulAgent()
+	agent.services[testServiceNameReg] = true
+	agent.checks[testHealthCheckID] = &api.AgentCheck{
+		CheckID:   testHealthCheckID,
+		Name:      "manually created check",
+		ServiceID: testServiceNameReg,
+		Status:    api.HealthCritical,
+	}
+	// Checks registered for a pod in another namespace aren't adopted.
+	otherNSCheckID := "default/other-pod-test-service/kubernetes-health-check"
+	agent.checks[otherNSCheckID] = &api.AgentCheck{
+		CheckID: otherNSCheckID,
+		Notes:   encodeCheckNotes(checkMetadata{Namespace: "other", ManagedBy: checkManagedBy}, ""),
+		Status:  api.HealthPassing,
+	}
+	// Checks that aren't the health check of a watched pod are ignored.
+	agent.checks["unrelated"] = &api.AgentCheck{
+		CheckID: "unrelated",
+		Status:  api.HealthPassing,
+	}
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod, otherPod),
+		Ctx:                 context.Background(),
+		agent:               agent,
+	}
+
+	imported, err := resource.ImportExistingChecks()
+	require.NoError(err)
+	require.Equal(1, imported)
+	require.Equal([]CheckReport{{
+		PodNamespace:    "default",
+		PodName:         testPodName,
+		ServiceID:       testServiceNameReg,
+		HealthCheckID:   testHealthCheckID,
+		LastKnownStatus: api.HealthCritical,
+	}}, resource.Reports())
+
+	// The adopted check is updated to match the pod's readiness.
+	require.NoError(resource.Upsert("", pod))
+	require.Equal(0, agent.registrations)
+	require.Equal(1, agent.updates)
+	require.Equal(api.HealthPassing, agent.checks[testHealthCheckID].Status)
+	require.Equal(kubernetesSuccessReasonMsg, agent.checks[testHealthCheckID].Output)
+}
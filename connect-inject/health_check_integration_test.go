@@ -0,0 +1,119 @@
+package connectinject
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the HealthCheckResource against a real Consul agent: the TTL check is
+// registered for the pod's connect service when the pod is first seen and its
+// status follows the readiness of the pod on subsequent updates.
+func TestUpsert_Integration(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		// Readiness is the readiness of the pod on each Upsert.
+		Readiness []bool
+		ExpStatus string
+		ExpOutput string
+	}{
+		"registers a passing check": {
+			Readiness: []bool{true},
+			ExpStatus: api.HealthPassing,
+			ExpOutput: testCheckNotesPassing,
+		},
+		"registers a critical check": {
+			Readiness: []bool{false},
+			ExpStatus: api.HealthCritical,
+			ExpOutput: testFailureMessage,
+		},
+		"critical check passes when the pod becomes ready": {
+			Readiness: []bool{false, true},
+			ExpStatus: api.HealthPassing,
+			ExpOutput: testCheckNotesPassing,
+		},
+		"passing check fails when the pod becomes unready": {
+			Readiness: []bool{true, false},
+			ExpStatus: api.HealthCritical,
+			ExpOutput: testFailureMessage,
+		},
+		"check flaps with the pod": {
+			Readiness: []bool{true, false, true},
+			ExpStatus: api.HealthPassing,
+			ExpOutput: testCheckNotesPassing,
+		},
+	}
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require := require.New(t)
+			pod := testFakeAgentPod(testPodName, c.Readiness[0])
+			server, client, resource := testServerAgentResourceAndController(t, pod)
+			defer server.Stop()
+			registerConnectService(t, client)
+
+			for i, ready := range c.Readiness {
+				pod = testFakeAgentPod(testPodName, ready)
+				require.NoError(resource.Upsert("", pod), "upsert %d", i)
+
+				check := getConsulAgentChecks(t, client, testHealthCheckID)
+				require.NotNil(check, "upsert %d", i)
+				require.Equal(ttl, check.Type)
+				require.Equal(testServiceNameReg, check.ServiceID)
+				require.True(isManagedCheck(check))
+			}
+
+			check := getConsulAgentChecks(t, client, testHealthCheckID)
+			require.Equal(c.ExpStatus, check.Status)
+			require.Equal(c.ExpOutput, check.Output)
+		})
+	}
+}
+
+// Test that deleting the pod removes the check from the real Consul agent
+// while the connect service itself stays registered.
+func TestDelete_Integration(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, true)
+	server, client, resource := testServerAgentResourceAndController(t, pod)
+	defer server.Stop()
+	registerConnectService(t, client)
+
+	require.NoError(resource.Upsert("", pod))
+	require.NotNil(getConsulAgentChecks(t, client, testHealthCheckID))
+
+	require.NoError(resource.Delete("", pod))
+	require.Nil(getConsulAgentChecks(t, client, testHealthCheckID))
+	services, err := client.Agent().Services()
+	require.NoError(err)
+	require.Contains(services, testServiceNameReg)
+}
+
+// registerConnectService registers the test service and its sidecar proxy
+// with the agent the way the connect-inject init container does.
+func registerConnectService(t *testing.T, client *api.Client) {
+	require := require.New(t)
+	err := client.Agent().ServiceRegister(&api.AgentServiceRegistration{
+		ID:      testServiceNameReg,
+		Name:    testServiceNameAnnotation,
+		Port:    80,
+		Address: "127.0.0.1",
+	})
+	require.NoError(err)
+	err = client.Agent().ServiceRegister(&api.AgentServiceRegistration{
+		Kind:    api.ServiceKindConnectProxy,
+		ID:      testServiceNameReg + "-sidecar-proxy",
+		Name:    testServiceNameAnnotation + "-sidecar-proxy",
+		Port:    20000,
+		Address: "127.0.0.1",
+		Proxy: &api.AgentServiceConnectProxyConfig{
+			DestinationServiceName: testServiceNameAnnotation,
+			DestinationServiceID:   testServiceNameReg,
+			LocalServicePort:       80,
+		},
+	})
+	require.NoError(err)
+}
@@ -0,0 +1,77 @@
+package connectinject
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+)
+
+// errorLogLimiter collapses repeated identical error logs, e.g. the errors
+// logged for every pod event while Consul is down. The first occurrence of
+// an error is logged and the identical ones within window after it are
+// suppressed. Their number is logged with the next occurrence after the
+// window.
+type errorLogLimiter struct {
+	window time.Duration
+	clock  clock.Clock
+
+	lock sync.Mutex
+	// errors are keyed by the message and error that were logged.
+	errors map[string]*errorLogState
+	// lastPrune is the last time the errors whose window ended were
+	// removed.
+	lastPrune time.Time
+}
+
+// errorLogState is the state of a single logged error.
+type errorLogState struct {
+	// loggedAt is the time the error was last logged.
+	loggedAt time.Time
+	// suppressed is the number of times it wasn't logged since.
+	suppressed int
+}
+
+func newErrorLogLimiter(window time.Duration, clk clock.Clock) *errorLogLimiter {
+	return &errorLogLimiter{
+		window: window,
+		clock:  clk,
+		errors: make(map[string]*errorLogState),
+	}
+}
+
+// allow returns whether the error identified by key should be logged and,
+// if it should, the number of identical errors that were suppressed since it
+// was last logged.
+func (l *errorLogLimiter) allow(key string) (bool, int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.clock.Now()
+	l.prune(now)
+	state, ok := l.errors[key]
+	if ok && now.Sub(state.loggedAt) < l.window {
+		state.suppressed++
+		return false, 0
+	}
+	suppressed := 0
+	if ok {
+		suppressed = state.suppressed
+	}
+	l.errors[key] = &errorLogState{loggedAt: now}
+	return true, suppressed
+}
+
+// prune removes the errors whose window ended at most once per window so
+// that the errors of pods that are gone don't accumulate. The suppressed
+// count of these errors is dropped.
+func (l *errorLogLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.window {
+		return
+	}
+	l.lastPrune = now
+	for key, state := range l.errors {
+		if now.Sub(state.loggedAt) >= 2*l.window {
+			delete(l.errors, key)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package connectinject
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestErrorLogLimiter(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	fakeClock := clock.NewFakeClock(time.Now())
+	limiter := newErrorLogLimiter(time.Minute, fakeClock)
+
+	// The first error is logged and the identical ones within the window
+	// are suppressed. Other errors aren't.
+	allowed, suppressed := limiter.allow("a")
+	require.True(allowed)
+	require.Equal(0, suppressed)
+	for i := 0; i < 3; i++ {
+		allowed, _ = limiter.allow("a")
+		require.False(allowed)
+	}
+	allowed, _ = limiter.allow("b")
+	require.True(allowed)
+
+	// Once the window ends the error is logged with the number of errors
+	// suppressed.
+	fakeClock.Step(time.Minute)
+	allowed, suppressed = limiter.allow("a")
+	require.True(allowed)
+	require.Equal(3, suppressed)
+	allowed, _ = limiter.allow("a")
+	require.False(allowed)
+
+	// Errors that weren't logged again are pruned.
+	fakeClock.Step(2 * time.Minute)
+	limiter.allow("c")
+	require.Len(limiter.errors, 1)
+}
+
+// Test that the errors of repeated failures of a pod are throttled.
+func TestUpsert_FakeAgentErrorLogThrottled(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, true)
+	agent := newFakeConsulAgent()
+	agent.services[testServiceNameReg] = true
+	agent.err = errors.New("Unexpected response code: 500 (internal error)")
+	var logs bytes.Buffer
+	fakeClock := clock.NewFakeClock(time.Now())
+	resource := HealthCheckResource{
+		Log:                 hclog.New(&hclog.LoggerOptions{Output: &logs}),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		Ctx:                 context.Background(),
+		ErrorLogWindow:      time.Minute,
+		Clock:               fakeClock,
+		agent:               agent,
+	}
+
+	for i := 0; i < 5; i++ {
+		require.Error(resource.Upsert("", pod))
+	}
+	require.Equal(5, agent.calls)
+	require.Equal(1, strings.Count(logs.String(), "unable to update pod"), logs.String())
+	require.NotContains(logs.String(), "similar-errors-suppressed")
+
+	// The next error after the window reports the suppressed ones.
+	fakeClock.Step(time.Minute)
+	require.Error(resource.Upsert("", pod))
+	require.Equal(2, strings.Count(logs.String(), "unable to update pod"), logs.String())
+	require.Contains(logs.String(), "similar-errors-suppressed=4")
+}
@@ -0,0 +1,123 @@
+package connectinject
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// checkManagedBy is the managed-by value in the metadata of the health
+	// checks registered by the HealthCheckResource.
+	checkManagedBy = "consul-k8s-healthcheck"
+
+	metadataKeyNamespace = "k8s-ns"
+	metadataKeyNode      = "k8s-node"
+	metadataKeyManagedBy = "managed-by"
+	metadataKeyConfig    = "check-config"
+)
+
+// checkMetadata is the metadata encoded in the Notes of the registered health
+// checks. Consul checks can't be tagged so the notes are used instead, which
+// lets operators filter the checks in the Consul UI and API, e.g. with
+// `Notes contains "k8s-ns=default"`.
+type checkMetadata struct {
+	// Namespace is the Kubernetes namespace of the pod.
+	Namespace string
+	// Node is the name of the Kubernetes node of the pod.
+	Node string
+	// ManagedBy identifies what registered the check.
+	ManagedBy string
+	// Config is the fingerprint of the parameters the check was registered
+	// with, e.g. its TTL, which the agent doesn't return with the check. It
+	// tells whether the check needs to be registered again after they
+	// changed. It's omitted from the notes if empty.
+	Config string
+}
+
+// podCheckMetadata returns the metadata of the pod's health check.
+func podCheckMetadata(pod *corev1.Pod) checkMetadata {
+	return checkMetadata{
+		Namespace: pod.Namespace,
+		Node:      pod.Spec.NodeName,
+		ManagedBy: checkManagedBy,
+	}
+}
+
+// checkConfigFingerprint returns the Config metadata of a TTL health check
+// registered with these parameters.
+func checkConfigFingerprint(ttl string, successBeforePassing, failuresBeforeCritical int, deregisterAfter string) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s/%d/%d/%s", ttl, successBeforePassing, failuresBeforeCritical, deregisterAfter)
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// encodeCheckNotes returns the notes of a health check with metadata meta,
+// e.g. "k8s-ns=default;k8s-node=node-1;managed-by=consul-k8s-healthcheck".
+// If note isn't empty it follows the metadata on a new line.
+func encodeCheckNotes(meta checkMetadata, note string) string {
+	notes := fmt.Sprintf("%s=%s;%s=%s;%s=%s",
+		metadataKeyNamespace, meta.Namespace,
+		metadataKeyNode, meta.Node,
+		metadataKeyManagedBy, meta.ManagedBy)
+	if meta.Config != "" {
+		notes += fmt.Sprintf(";%s=%s", metadataKeyConfig, meta.Config)
+	}
+	if note != "" {
+		notes += "\n" + note
+	}
+	return notes
+}
+
+// decodeCheckNotes parses notes encoded by encodeCheckNotes and returns the
+// metadata and the note. It returns false if notes don't start with the
+// metadata, e.g. for checks registered before the metadata was added or by
+// something else than the HealthCheckResource, in which case notes is
+// returned as the note.
+func decodeCheckNotes(notes string) (checkMetadata, string, bool) {
+	first, note := notes, ""
+	if i := strings.Index(notes, "\n"); i >= 0 {
+		first, note = notes[:i], notes[i+1:]
+	}
+	var meta checkMetadata
+	for _, field := range strings.Split(first, ";") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return checkMetadata{}, notes, false
+		}
+		switch parts[0] {
+		case metadataKeyNamespace:
+			meta.Namespace = parts[1]
+		case metadataKeyNode:
+			meta.Node = parts[1]
+		case metadataKeyManagedBy:
+			meta.ManagedBy = parts[1]
+		case metadataKeyConfig:
+			meta.Config = parts[1]
+		}
+	}
+	if meta.ManagedBy == "" {
+		return checkMetadata{}, notes, false
+	}
+	return meta, note, true
+}
+
+// isManagedCheck returns true if the check was registered by the
+// HealthCheckResource, i.e. its notes carry the managed-by marker. Checks
+// without it belong to something else and are never deregistered.
+func isManagedCheck(check *api.AgentCheck) bool {
+	meta, _, ok := decodeCheckNotes(check.Notes)
+	return ok && meta.ManagedBy == checkManagedBy
+}
+
+// checkMatchesRegistration returns true if the check, as returned by the
+// agent, was registered with the given name, service and notes, much like
+// MatchesConsul of the config entries. Since the notes carry the Config
+// fingerprint, a check registered with other parameters doesn't match.
+func checkMatchesRegistration(check *api.AgentCheck, name, serviceID, notes string) bool {
+	return check.Name == name && check.ServiceID == serviceID && check.Notes == notes
+}
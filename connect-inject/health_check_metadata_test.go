@@ -0,0 +1,79 @@
+package connectinject
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckNotes_RoundTrip(t *testing.T) {
+	t.Parallel()
+	meta := checkMetadata{Namespace: "default", Node: "node-1", ManagedBy: checkManagedBy}
+	cases := map[string]struct {
+		Note     string
+		ExpNotes string
+	}{
+		"without note": {
+			ExpNotes: "k8s-ns=default;k8s-node=node-1;managed-by=consul-k8s-healthcheck",
+		},
+		"with note": {
+			Note:     "deployment=web sha=abc123",
+			ExpNotes: "k8s-ns=default;k8s-node=node-1;managed-by=consul-k8s-healthcheck\ndeployment=web sha=abc123",
+		},
+		"with multiline note": {
+			Note:     "first\nsecond",
+			ExpNotes: "k8s-ns=default;k8s-node=node-1;managed-by=consul-k8s-healthcheck\nfirst\nsecond",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			notes := encodeCheckNotes(meta, c.Note)
+			require.Equal(c.ExpNotes, notes)
+
+			decoded, note, ok := decodeCheckNotes(notes)
+			require.True(ok)
+			require.Equal(meta, decoded)
+			require.Equal(c.Note, note)
+		})
+	}
+}
+
+func TestCheckNotes_Config(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	meta := checkMetadata{Namespace: "default", Node: "node-1", ManagedBy: checkManagedBy,
+		Config: checkConfigFingerprint("100000h", 1, 1, "")}
+	notes := encodeCheckNotes(meta, "sha=abc123")
+	require.Equal("k8s-ns=default;k8s-node=node-1;managed-by=consul-k8s-healthcheck;check-config="+meta.Config+"\nsha=abc123", notes)
+
+	decoded, note, ok := decodeCheckNotes(notes)
+	require.True(ok)
+	require.Equal(meta, decoded)
+	require.Equal("sha=abc123", note)
+
+	// The fingerprint changes with any of the parameters.
+	require.NotEqual(meta.Config, checkConfigFingerprint("1h", 1, 1, ""))
+	require.NotEqual(meta.Config, checkConfigFingerprint("100000h", 2, 1, ""))
+	require.NotEqual(meta.Config, checkConfigFingerprint("100000h", 1, 2, ""))
+	require.NotEqual(meta.Config, checkConfigFingerprint("100000h", 1, 1, "30m"))
+}
+
+func TestDecodeCheckNotes_WithoutMetadata(t *testing.T) {
+	t.Parallel()
+	cases := []string{
+		"",
+		"deployment=web sha=abc123",
+		"created manually",
+		"k8s-ns=default;k8s-node=node-1",
+	}
+	for _, notes := range cases {
+		t.Run(notes, func(t *testing.T) {
+			require := require.New(t)
+			meta, note, ok := decodeCheckNotes(notes)
+			require.False(ok)
+			require.Equal(checkMetadata{}, meta)
+			require.Equal(notes, note)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package connectinject
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// healthCheckMetrics are the Prometheus metrics reported by HealthCheckResource.
+type healthCheckMetrics struct {
+	// registered counts the health checks registered with Consul.
+	registered prometheus.Counter
+	// statusUpdates counts the health check status updates sent to Consul,
+	// labeled by the status that was set.
+	statusUpdates *prometheus.CounterVec
+	// registerErrors counts the failed attempts to register a health check.
+	registerErrors prometheus.Counter
+	// registerDuration observes the latency of the Consul API calls made to
+	// register a health check.
+	registerDuration prometheus.Histogram
+	// agentBreakerTransitions counts the times the breaker of a Consul agent
+	// opened or closed, labeled by the new state.
+	agentBreakerTransitions *prometheus.CounterVec
+	// rateLimited counts the pods requeued because their Consul agent
+	// rejected a request with 429 Too Many Requests.
+	rateLimited prometheus.Counter
+	// watchErrors counts the failures to list or watch the pods, labeled by
+	// the operation that failed.
+	watchErrors *prometheus.CounterVec
+}
+
+// newHealthCheckMetrics creates the health check metrics and registers them
+// with reg. If reg is nil the metrics are still recorded but not exported.
+func newHealthCheckMetrics(reg *prometheus.Registry) *healthCheckMetrics {
+	m := &healthCheckMetrics{
+		registered: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "consul_k8s_healthcheck_registered_total",
+			Help: "Number of health checks registered with Consul.",
+		}),
+		statusUpdates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "consul_k8s_healthcheck_status_updates_total",
+			Help: "Number of health check status updates sent to Consul.",
+		}, []string{"status"}),
+		registerErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "consul_k8s_healthcheck_register_errors_total",
+			Help: "Number of errors registering health checks with Consul.",
+		}),
+		registerDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "consul_k8s_healthcheck_register_duration_seconds",
+			Help:    "Latency of the Consul API calls made to register health checks.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		agentBreakerTransitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "consul_k8s_healthcheck_agent_breaker_transitions_total",
+			Help: "Number of times the processing of the pods of a failing Consul agent was paused or resumed.",
+		}, []string{"state"}),
+		rateLimited: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "consul_k8s_healthcheck_rate_limited_total",
+			Help: "Number of pods requeued because their Consul agent rate limited the requests.",
+		}),
+		watchErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "consul_k8s_healthcheck_watch_errors_total",
+			Help: "Number of failures to list or watch the pods in Kubernetes.",
+		}, []string{"operation"}),
+	}
+	if reg != nil {
+		reg.MustRegister(m.registered, m.statusUpdates, m.registerErrors, m.registerDuration, m.agentBreakerTransitions, m.rateLimited,
+			m.watchErrors)
+	}
+	return m
+}
@@ -0,0 +1,149 @@
+package connectinject
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"github.com/hashicorp/consul-k8s/helper/controller"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// RunInformers implements controller.DynamicInformer. If NamespaceSelector
+// is set, it watches the namespaces and adds a pod informer for each
+// namespace that matches the selector to set, and removes it once the
+// namespace no longer matches or is deleted. Removing an informer causes the
+// controller to process its pods as deleted, which deregisters their health
+// checks.
+func (h *HealthCheckResource) RunInformers(stopCh <-chan struct{}, set controller.InformerSet) {
+	if h.NamespaceSelector == nil {
+		atomic.StoreInt32(&h.nsInformersSynced, 1)
+		return
+	}
+
+	nsInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return h.KubernetesClientset.CoreV1().Namespaces().List(h.Ctx, options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return h.KubernetesClientset.CoreV1().Namespaces().Watch(h.Ctx, options)
+			},
+		},
+		&corev1.Namespace{},
+		0,
+		cache.Indexers{},
+	)
+	// The selector is matched here rather than by the API server so that
+	// namespaces that stop matching it are seen as updates.
+	nsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			h.syncNamespace(obj, set)
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			h.syncNamespace(newObj, set)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = d.Obj
+			}
+			if ns, ok := obj.(*corev1.Namespace); ok {
+				h.unwatchNamespace(ns.Name, set)
+			}
+		},
+	})
+	go nsInformer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, nsInformer.HasSynced) {
+		return
+	}
+	// The event handlers may not have been called for all the namespaces
+	// yet, so add the informers of the namespaces in the cache before
+	// reporting that we've synced.
+	for _, obj := range nsInformer.GetStore().List() {
+		h.syncNamespace(obj, set)
+	}
+	atomic.StoreInt32(&h.nsInformersSynced, 1)
+	<-stopCh
+}
+
+// InformersSynced implements controller.DynamicInformer.
+func (h *HealthCheckResource) InformersSynced() bool {
+	return atomic.LoadInt32(&h.nsInformersSynced) == 1
+}
+
+// syncNamespace watches the pods of the namespace obj if it matches
+// NamespaceSelector and stops watching them otherwise.
+func (h *HealthCheckResource) syncNamespace(obj interface{}, set controller.InformerSet) {
+	ns, ok := obj.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+	if h.NamespaceSelector.Matches(labels.Set(ns.Labels)) {
+		h.watchNamespace(ns.Name, set)
+	} else {
+		h.unwatchNamespace(ns.Name, set)
+	}
+}
+
+// watchNamespace adds an informer for the pods in namespace ns to set if
+// there isn't one already.
+func (h *HealthCheckResource) watchNamespace(ns string, set controller.InformerSet) {
+	h.nsInformersLock.Lock()
+	defer h.nsInformersLock.Unlock()
+	if _, ok := h.nsInformers[ns]; ok {
+		return
+	}
+	h.Log.Info("watching pods in namespace", "namespace", ns)
+	if h.nsInformers == nil {
+		h.nsInformers = make(map[string]cache.SharedIndexInformer)
+	}
+	informer := h.namespaceInformer(ns)
+	h.nsInformers[ns] = informer
+	set.Add(informer)
+}
+
+// unwatchNamespace removes the informer for the pods in namespace ns from
+// set if there is one.
+func (h *HealthCheckResource) unwatchNamespace(ns string, set controller.InformerSet) {
+	// Wait for a running Reconcile, which may still register the health
+	// checks of the namespace's pods, so that they're deregistered after it.
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.nsInformersLock.Lock()
+	defer h.nsInformersLock.Unlock()
+	informer, ok := h.nsInformers[ns]
+	if !ok {
+		return
+	}
+	h.Log.Info("no longer watching pods in namespace", "namespace", ns)
+	delete(h.nsInformers, ns)
+	set.Remove(informer)
+	h.forgetWatchError(ns)
+}
+
+// selectedNamespaces returns the namespaces that match NamespaceSelector,
+// sorted by name.
+func (h *HealthCheckResource) selectedNamespaces() []string {
+	h.nsInformersLock.Lock()
+	defer h.nsInformersLock.Unlock()
+	namespaces := make([]string, 0, len(h.nsInformers))
+	for ns := range h.nsInformers {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// namespaceAllowed returns true if the pods of the Kubernetes namespace ns
+// may be processed according to AllowK8sNamespacesSet and
+// DenyK8sNamespacesSet.
+func (h *HealthCheckResource) namespaceAllowed(ns string) bool {
+	if h.AllowK8sNamespacesSet != nil && h.AllowK8sNamespacesSet.Cardinality() > 0 {
+		return h.AllowK8sNamespacesSet.Contains(ns)
+	}
+	return h.DenyK8sNamespacesSet == nil || !h.DenyK8sNamespacesSet.Contains(ns)
+}
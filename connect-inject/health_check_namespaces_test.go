@@ -0,0 +1,193 @@
+package connectinject
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/deckarep/golang-set"
+	"github.com/hashicorp/consul-k8s/helper/controller"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// Test that the pods of namespaces are watched while the namespaces match
+// the selector and that their health checks are deregistered once they
+// don't.
+func TestRunInformers_NamespaceSelector(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	const selectedLabel = "consul.hashicorp.com/health-checks"
+
+	namespace := func(name string, selected bool) *corev1.Namespace {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if selected {
+			ns.Labels = map[string]string{selectedLabel: "enabled"}
+		}
+		return ns
+	}
+	podInNamespace := func(ns string) *corev1.Pod {
+		pod := testFakeAgentPod("pod-"+ns, true)
+		pod.Namespace = ns
+		return pod
+	}
+	podA, podB := podInNamespace("team-a"), podInNamespace("team-b")
+	client := fake.NewSimpleClientset(namespace("team-a", true), namespace("team-b", false), podA, podB)
+	// The fake client drops the events that happen before a watch is
+	// started so the namespaces are only updated once they're watched.
+	nsWatchStarted := make(chan struct{})
+	client.PrependWatchReactor("namespaces", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w, err := client.Tracker().Watch(corev1.SchemeGroupVersion.WithResource("namespaces"), action.GetNamespace())
+		close(nsWatchStarted)
+		return true, w, err
+	})
+
+	agent := newFakeConsulAgent()
+	agent.services[podA.Name+"-"+testServiceNameAnnotation] = true
+	agent.services[podB.Name+"-"+testServiceNameAnnotation] = true
+	selector, err := labels.Parse(selectedLabel + "=enabled")
+	require.NoError(err)
+	resource := &HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: client,
+		Ctx:                 context.Background(),
+		NamespaceSelector:   selector,
+		agent:               agent,
+	}
+	checkIDA, checkIDB := resource.getConsulHealthCheckID(podA), resource.getConsulHealthCheckID(podB)
+	hasCheck := func(id string) func() bool {
+		return func() bool {
+			agent.Lock()
+			defer agent.Unlock()
+			_, ok := agent.checks[id]
+			return ok
+		}
+	}
+
+	ctrl := &controller.Controller{
+		Log:      hclog.Default().Named("healthCheckController"),
+		Resource: resource,
+	}
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ctrl.Run(stopCh)
+	}()
+	defer func() {
+		close(stopCh)
+		<-doneCh
+	}()
+
+	// Only the pod in the selected namespace has a health check.
+	require.Eventually(hasCheck(checkIDA), 5*time.Second, 10*time.Millisecond)
+	require.Eventually(ctrl.HasSynced, 5*time.Second, 10*time.Millisecond)
+	require.False(hasCheck(checkIDB)())
+	require.Equal([]string{"team-a"}, resource.namespaces())
+	<-nsWatchStarted
+
+	// A namespace gaining the label is watched.
+	_, err = client.CoreV1().Namespaces().Update(context.Background(), namespace("team-b", true), metav1.UpdateOptions{})
+	require.NoError(err)
+	require.Eventually(hasCheck(checkIDB), 5*time.Second, 10*time.Millisecond)
+
+	// A namespace losing the label is no longer watched and the health
+	// checks of its pods are deregistered.
+	_, err = client.CoreV1().Namespaces().Update(context.Background(), namespace("team-a", false), metav1.UpdateOptions{})
+	require.NoError(err)
+	require.Eventually(func() bool { return !hasCheck(checkIDA)() }, 5*time.Second, 10*time.Millisecond,
+		fmt.Sprintf("health check %q not deregistered", checkIDA))
+	require.Equal([]string{"team-b"}, resource.namespaces())
+	require.True(hasCheck(checkIDB)())
+}
+
+// Test that the pods of denied namespaces are skipped by Reconcile and Upsert
+// and that the allowed namespaces take precedence over the denied ones.
+func TestNamespaceAllowDeny(t *testing.T) {
+	t.Parallel()
+	namespaces := []string{"kube-system", "default", "team-a"}
+	cases := map[string]struct {
+		Allow []string
+		Deny  []string
+		Exp   []string
+	}{
+		"no filtering": {
+			Exp: []string{"kube-system", "default", "team-a"},
+		},
+		"system namespaces denied": {
+			Deny: []string{"kube-system", "kube-public"},
+			Exp:  []string{"default", "team-a"},
+		},
+		"allowed namespace": {
+			Allow: []string{"team-a"},
+			Exp:   []string{"team-a"},
+		},
+		"allow takes precedence over deny": {
+			Allow: []string{"kube-system", "team-a"},
+			Deny:  []string{"kube-system", "kube-public", "team-a"},
+			Exp:   []string{"kube-system", "team-a"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			var pods []runtime.Object
+			agent := newFakeConsulAgent()
+			for _, ns := range namespaces {
+				pod := testFakeAgentPod("pod-"+ns, true)
+				pod.Namespace = ns
+				pods = append(pods, pod)
+				agent.services[pod.Name+"-"+testServiceNameAnnotation] = true
+			}
+			resource := HealthCheckResource{
+				Log:                   hclog.Default().Named("healthCheckResource"),
+				KubernetesClientset:   fake.NewSimpleClientset(pods...),
+				Ctx:                   context.Background(),
+				AllowK8sNamespacesSet: mapset.NewSet(),
+				DenyK8sNamespacesSet:  mapset.NewSet(),
+				agent:                 agent,
+			}
+			for _, ns := range c.Allow {
+				resource.AllowK8sNamespacesSet.Add(ns)
+			}
+			for _, ns := range c.Deny {
+				resource.DenyK8sNamespacesSet.Add(ns)
+			}
+			checkID := func(ns string) string {
+				return fmt.Sprintf("%s/pod-%s-%s/kubernetes-health-check", ns, ns, testServiceNameAnnotation)
+			}
+
+			// Informer driven events.
+			for _, pod := range pods {
+				require.NoError(resource.Upsert("", pod))
+			}
+			var registered []string
+			for _, ns := range namespaces {
+				if agent.checks[checkID(ns)] != nil {
+					registered = append(registered, ns)
+				}
+			}
+			require.Equal(c.Exp, registered)
+
+			// Reconcile.
+			agent.checks = make(map[string]*api.AgentCheck)
+			require.NoError(resource.Reconcile())
+			registered = nil
+			for _, ns := range namespaces {
+				if agent.checks[checkID(ns)] != nil {
+					registered = append(registered, ns)
+				}
+			}
+			require.Equal(c.Exp, registered)
+		})
+	}
+}
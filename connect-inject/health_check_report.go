@@ -0,0 +1,92 @@
+package connectinject
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CheckReport describes a health check managed for a pod.
+type CheckReport struct {
+	PodNamespace  string `json:"podNamespace"`
+	PodName       string `json:"podName"`
+	ServiceID     string `json:"serviceID"`
+	HealthCheckID string `json:"healthCheckID"`
+	// LastKnownStatus is the status the health check was last registered or
+	// updated with, or found to have in Consul.
+	LastKnownStatus string `json:"lastKnownStatus"`
+}
+
+// Reports returns the health checks currently managed for pods, sorted by
+// pod namespace and name.
+func (h *HealthCheckResource) Reports() []CheckReport {
+	h.reportsLock.Lock()
+	defer h.reportsLock.Unlock()
+	reports := make([]CheckReport, 0, len(h.reports))
+	for _, report := range h.reports {
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].PodNamespace != reports[j].PodNamespace {
+			return reports[i].PodNamespace < reports[j].PodNamespace
+		}
+		if reports[i].PodName != reports[j].PodName {
+			return reports[i].PodName < reports[j].PodName
+		}
+		return reports[i].HealthCheckID < reports[j].HealthCheckID
+	})
+	return reports
+}
+
+// ChecksHandler returns a handler responding with the JSON encoded Reports.
+func (h *HealthCheckResource) ChecksHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(rw).Encode(h.Reports()); err != nil {
+			h.Log.Error("unable to encode health check reports", "err", err)
+		}
+	})
+}
+
+// recordReport records that the health check with ID healthCheckID of the
+// pod's service instance serviceID has status.
+func (h *HealthCheckResource) recordReport(pod *corev1.Pod, serviceID, healthCheckID, status string) {
+	h.reportsLock.Lock()
+	defer h.reportsLock.Unlock()
+	if h.reports == nil {
+		h.reports = make(map[string]CheckReport)
+	}
+	h.reports[healthCheckID] = CheckReport{
+		PodNamespace:    pod.Namespace,
+		PodName:         pod.Name,
+		ServiceID:       serviceID,
+		HealthCheckID:   healthCheckID,
+		LastKnownStatus: status,
+	}
+}
+
+// forgetReport removes the report of the health check with ID healthCheckID
+// once it has been deregistered.
+func (h *HealthCheckResource) forgetReport(healthCheckID string) {
+	h.reportsLock.Lock()
+	defer h.reportsLock.Unlock()
+	delete(h.reports, healthCheckID)
+}
+
+// staleHealthCheckIDs returns the IDs of the health checks recorded for the
+// pod other than healthCheckID. These were registered for a previous service
+// ID of the pod, e.g. before its service annotation changed.
+func (h *HealthCheckResource) staleHealthCheckIDs(pod *corev1.Pod, healthCheckID string) []string {
+	h.reportsLock.Lock()
+	defer h.reportsLock.Unlock()
+	var ids []string
+	for id, report := range h.reports {
+		if id != healthCheckID && report.PodNamespace == pod.Namespace && report.PodName == pod.Name {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,82 @@
+package connectinject
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Test that the checks endpoint reports the health checks of the processed
+// pods until they're deleted.
+func TestChecksHandler(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, false)
+	agent := newFakeConsulAgent()
+	agent.services[testServiceNameReg] = true
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		Ctx:                 context.Background(),
+		agent:               agent,
+	}
+	handler := resource.ChecksHandler()
+
+	getReports := func() []CheckReport {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/checks", nil))
+		require.Equal(http.StatusOK, rec.Code)
+		require.Equal("application/json", rec.Header().Get("Content-Type"))
+		var reports []CheckReport
+		require.NoError(json.Unmarshal(rec.Body.Bytes(), &reports))
+		return reports
+	}
+
+	require.Empty(getReports())
+
+	require.NoError(resource.Upsert("", pod))
+	require.Equal([]CheckReport{{
+		PodNamespace:    "default",
+		PodName:         testPodName,
+		ServiceID:       testServiceNameReg,
+		HealthCheckID:   testHealthCheckID,
+		LastKnownStatus: api.HealthCritical,
+	}}, getReports())
+
+	// The report is updated when the pod becomes ready.
+	readyPod := testFakeAgentPod(testPodName, true)
+	require.NoError(resource.Upsert("", readyPod))
+	reports := getReports()
+	require.Len(reports, 1)
+	require.Equal(api.HealthPassing, reports[0].LastKnownStatus)
+
+	require.NoError(resource.Delete("", readyPod))
+	require.Empty(getReports())
+}
+
+// Test that the JSON keys of the reports are stable.
+func TestCheckReport_JSON(t *testing.T) {
+	t.Parallel()
+	out, err := json.Marshal(CheckReport{
+		PodNamespace:    "ns",
+		PodName:         "pod",
+		ServiceID:       "pod-svc",
+		HealthCheckID:   "ns/pod-svc/kubernetes-health-check",
+		LastKnownStatus: api.HealthPassing,
+	})
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"podNamespace": "ns",
+		"podName": "pod",
+		"serviceID": "pod-svc",
+		"healthCheckID": "ns/pod-svc/kubernetes-health-check",
+		"lastKnownStatus": "passing"
+	}`, string(out))
+}
@@ -3,21 +3,38 @@ package connectinject
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/deckarep/golang-set"
 	"github.com/hashicorp/consul-k8s/consul"
+	"github.com/hashicorp/consul-k8s/helper/controller"
+	"github.com/hashicorp/consul-k8s/namespaces"
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/net/context"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/clock"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
@@ -29,35 +46,361 @@ const (
 	kubernetesSuccessReasonMsg = "Kubernetes health checks passing"
 
 	podPendingReasonMsg = "Pod is pending"
+
+	// healthCheckNamePrefix is the prefix of the names of the registered
+	// health checks, which are followed by the name of the Consul service.
+	// The checks are identified by their ID rather than their name.
+	healthCheckNamePrefix = "Kubernetes Readiness: "
+
+	// healthCheckIDSuffix is the last segment of the IDs of the registered
+	// health checks.
+	healthCheckIDSuffix = "kubernetes-health-check"
+
+	// DefaultHealthCheckTTL is the TTL of the registered health checks if TTL
+	// is not set. It should ensure that the check never fails due to timeout
+	// of the TTL check.
+	DefaultHealthCheckTTL = "100000h"
+
+	// DefaultHealthCheckMaxReasonLength is the maximum length of the output
+	// of the registered health checks if MaxReasonLength is not set.
+	DefaultHealthCheckMaxReasonLength = 512
+
+	// DefaultConnectionRetryDelay is the base delay between retries of a pod
+	// whose Consul agent couldn't be reached if ConnectionRetryDelay is not
+	// set.
+	DefaultConnectionRetryDelay = 500 * time.Millisecond
+
+	// DefaultAgentFailureCooldown is the time the pods of a node whose
+	// Consul agent keeps failing aren't processed for if
+	// AgentFailureCooldown is not set.
+	DefaultAgentFailureCooldown = 30 * time.Second
+
+	// DefaultRateLimitBackoff is the delay before a pod whose Consul agent
+	// rate limited the requests is retried if RateLimitBackoff is not set
+	// and the agent didn't send a Retry-After header.
+	DefaultRateLimitBackoff = 10 * time.Second
+
+	// hostIPRequeueDelay is the delay before a pod that doesn't have a host
+	// IP yet, e.g. because it was only just scheduled, is retried.
+	hostIPRequeueDelay = 2 * time.Second
+
+	// checkMissingRequeueDelay is the initial delay before a pod whose
+	// health check hasn't been registered yet is retried when
+	// ManageStatusOnly is set. It doubles on each retry up to
+	// checkMissingMaxDelay.
+	checkMissingRequeueDelay = 5 * time.Second
+	checkMissingMaxDelay     = 5 * time.Minute
+
+	// reasonEllipsis is appended to reasons that were truncated.
+	reasonEllipsis = "..."
+
+	// Reasons of the events recorded on a pod when its health check changes status.
+	eventReasonHealthCheckPassing  = "ConsulHealthCheckPassing"
+	eventReasonHealthCheckCritical = "ConsulHealthCheckCritical"
 )
 
 // ServiceNotFoundErr is returned when a Consul service instance is not registered.
 var ServiceNotFoundErr = errors.New("service is not registered in Consul")
 
+// errHealthCheckNotRegistered is returned when a pod's health check doesn't
+// exist and ManageStatusOnly prevents registering it.
+var errHealthCheckNotRegistered = errors.New("health check is not registered in Consul")
+
 type HealthCheckResource struct {
 	Log                 hclog.Logger
 	KubernetesClientset kubernetes.Interface
 
 	// ConsulUrl holds the url information for client connections.
 	ConsulUrl *url.URL
+	// TLSConfig is the TLS configuration, e.g. the CA and client certificate,
+	// used by the clients connecting to the Consul agents local to the pods.
+	TLSConfig api.TLSConfig
+	// Token is the ACL token used by the clients connecting to the Consul
+	// agents local to the pods.
+	Token string
+	// TokenFile is a file containing the ACL token. It takes precedence over
+	// Token and is read whenever a client is needed so that a rotated token
+	// is picked up without restarting.
+	TokenFile string
+	// NamespaceTokens are the ACL tokens used by the clients for the health
+	// checks of the services in a Consul namespace, keyed by namespace, e.g.
+	// when each namespace of Consul Enterprise requires a distinct token.
+	// Namespaces without a token use Token or TokenFile.
+	NamespaceTokens map[string]string
+	// NamespaceTokensDir is a directory, e.g. a mounted Secret, that contains
+	// one file per Consul namespace named after it and containing its ACL
+	// token. Its tokens take precedence over NamespaceTokens and are read
+	// whenever a client is needed so that rotated tokens are picked up.
+	NamespaceTokensDir string
 	// ReconcilePeriod is the period by which reconcile gets called.
 	// default to 1 minute.
 	ReconcilePeriod time.Duration
+	// OrphanSweepPeriod is the period by which the health checks whose pods
+	// no longer exist are deregistered. If zero, they are not swept.
+	OrphanSweepPeriod time.Duration
+	// ResyncPeriod is the period by which the informers replay all pods
+	// as updates. If zero, pods are not resynced.
+	ResyncPeriod time.Duration
+	// EnableConsulNamespaces indicates that a user is running Consul Enterprise
+	// with version 1.7+ which supports namespaces. When false, health checks are
+	// always registered without a namespace.
+	EnableConsulNamespaces bool
+	// ConsulDestinationNamespace is the Consul namespace that services are
+	// registered into if namespace mirroring is disabled.
+	ConsulDestinationNamespace string
+	// EnableNSMirroring indicates that services are registered into the
+	// Consul namespace that matches their Kubernetes namespace.
+	EnableNSMirroring bool
+	// NSMirroringPrefix is prepended to the Consul namespaces that
+	// Kubernetes namespaces are mirrored into.
+	NSMirroringPrefix string
+	// AclConfig is the ACL config, e.g. the default policies, of the Consul
+	// namespaces that are created before the first health check is
+	// registered into them.
+	AclConfig api.NamespaceACLConfig
+	// HealthCheckLabel is the label selector used to find the pods whose health
+	// checks are managed. Defaults to labelInject if empty.
+	HealthCheckLabel string
+	// HealthCheckIDPrefix, if set, is prepended to the IDs of the health
+	// checks registered in Consul, e.g. to tell apart the checks of several
+	// Kubernetes clusters registered with the same agents.
+	HealthCheckIDPrefix string
+	// TTL is the TTL of the health checks registered in Consul. It must parse
+	// as a Go duration. Defaults to DefaultHealthCheckTTL if empty.
+	TTL string
+	// DeregisterCriticalServiceAfter, if set, causes Consul to deregister the
+	// service instance once its health check has been critical for this long.
+	// This reaps instances whose pods went away without being deregistered.
+	// Note that a pod which is still running but not ready for this long will
+	// also be deregistered, and the reconcile loop will not re-register it
+	// since only the health check, not the service, is managed here. Pods
+	// can override it with the deregister-critical-after annotation.
+	DeregisterCriticalServiceAfter string
+	// SuccessBeforePassing is the number of consecutive passing updates
+	// needed for a health check to become passing. Defaults to 1 if 0.
+	SuccessBeforePassing int
+	// FailuresBeforeCritical is the number of consecutive critical updates
+	// needed for a health check to become critical. Defaults to 1 if 0.
+	FailuresBeforeCritical int
+	// ConnectionRetries is the number of times processing a pod event is
+	// retried if the pod's Consul agent can't be reached, e.g. because it is
+	// being restarted, before the error is returned. Other errors, e.g. an
+	// invalid agent address or errors returned by the agent, aren't retried.
+	ConnectionRetries int
+	// ConnectionRetryDelay is the base delay between these retries. A
+	// random jitter of up to the delay is added to it. Defaults to
+	// DefaultConnectionRetryDelay if 0.
+	ConnectionRetryDelay time.Duration
+	// AgentFailureThreshold is the number of consecutive times the Consul
+	// agent on a node can't be reached after which the pods on that node
+	// aren't processed for AgentFailureCooldown. Their events are requeued
+	// until the cooldown ends instead. If 0, pods are always processed.
+	AgentFailureThreshold int
+	// AgentFailureCooldown is the time the pods of a node whose agent
+	// reached AgentFailureThreshold aren't processed for. Defaults to
+	// DefaultAgentFailureCooldown if 0.
+	AgentFailureCooldown time.Duration
+	// RateLimitBackoff is the delay before a pod is retried when its
+	// Consul agent rejected a request with 429 Too Many Requests and didn't
+	// send a Retry-After header. These retries don't count against the
+	// retries of failed pods. Defaults to DefaultRateLimitBackoff if 0.
+	RateLimitBackoff time.Duration
+	// ErrorLogWindow, if set, collapses identical errors, e.g. the errors
+	// logged for every pod event while Consul is down: an error is logged at
+	// most once per window and the number of identical errors suppressed in
+	// between is logged with it. If 0, every error is logged.
+	ErrorLogWindow time.Duration
+	// StatusBatchWindow, if set, delays the status updates of the health
+	// checks by up to this long so that the updates sent to the same Consul
+	// agent and namespace are sent together with the client of that agent
+	// and namespace, e.g. during a rolling restart. If 0, every update is
+	// sent right away.
+	StatusBatchWindow time.Duration
+	// MaxReasonLength is the maximum length in bytes of the reason written
+	// as the output of a health check. Longer reasons, e.g. long pod
+	// condition messages, are truncated. Defaults to
+	// DefaultHealthCheckMaxReasonLength if 0.
+	MaxReasonLength int
+	// ReadyConditions are the types of the pod conditions, e.g. the
+	// conditions of readiness gates, that must all be True for the health
+	// check to pass. If one isn't, the check is critical with the message of
+	// the first condition that isn't True as reason. If empty, only the Ready
+	// condition is used.
+	ReadyConditions []corev1.PodConditionType
+	// ReadinessContainer, if set, is the name of the container whose
+	// readiness the health check reflects instead of the pod conditions,
+	// e.g. so that the check fails while the application container restarts
+	// even though the pod is Ready. The pod conditions are used for pods
+	// without a container of that name.
+	ReadinessContainer string
+	// EnvoyReadyProbe, if true, probes the /ready endpoint of the Envoy
+	// sidecar of the pods with the annotationEnvoyReadyPort annotation
+	// before marking their health check passing, so that the check only
+	// passes once the proxy is actually serving. The check stays critical
+	// while the endpoint doesn't return 200. It adds a request to the
+	// processing of every ready pod with the annotation.
+	EnvoyReadyProbe bool
+	// EnvoyReadyTimeout is the time the probe waits for the sidecar to
+	// answer. Defaults to DefaultEnvoyReadyTimeout if 0.
+	EnvoyReadyTimeout time.Duration
+	// Namespaces is the list of Kubernetes namespaces whose pods are watched.
+	// If empty, pods in all namespaces are watched.
+	Namespaces []string
+	// NamespaceSelector, if set, selects the Kubernetes namespaces whose pods
+	// are watched by their labels instead of Namespaces. Pods are watched
+	// while their namespace matches the selector and the health checks of
+	// the pods of a namespace that stops matching it are deregistered.
+	NamespaceSelector labels.Selector
+	// AllowK8sNamespacesSet, if not empty, is the set of Kubernetes
+	// namespaces whose pods are processed. Unlike for injection it takes
+	// precedence over DenyK8sNamespacesSet so that a namespace that is
+	// denied by default, e.g. kube-system, can be allowed explicitly.
+	AllowK8sNamespacesSet mapset.Set
+	// DenyK8sNamespacesSet is the set of Kubernetes namespaces whose pods
+	// are not processed unless they're in AllowK8sNamespacesSet.
+	DenyK8sNamespacesSet mapset.Set
+	// NodeName, if set, restricts the watched pods to the pods scheduled on
+	// this node, e.g. when the controller runs as a DaemonSet. The health
+	// checks of these pods are all registered with the agent at ConsulUrl
+	// instead of the agent at each pod's host IP.
+	NodeName string
+	// Agentless, if true, registers the health checks of all pods with the
+	// Consul agent at ConsulUrl, for deployments that don't run a Consul
+	// agent on each node. Neither the pods' host IPs nor their
+	// annotationConsulAPIPort annotations are used to build its address.
+	// The checks are bound to the pods' services by their ServiceID, so the
+	// services must be registered with that agent too.
+	Agentless bool
+	// ManageStatusOnly, if true, never registers health checks, e.g. because
+	// the connect-inject sidecar already registers them, and only updates
+	// the status of the checks that exist. The events of pods whose check
+	// doesn't exist yet are requeued with an exponential backoff until it
+	// does, at most CheckMissingRetries times.
+	ManageStatusOnly bool
+	// CheckMissingRetries is the number of times the event of a pod whose
+	// health check doesn't exist is requeued when ManageStatusOnly is set.
+	// The pod is then left alone until it changes or is reconciled.
+	// Defaults to controller.DefaultMaxRetries if 0.
+	CheckMissingRetries int
+	// DryRun, if true, logs the health checks that would be registered or
+	// updated in Consul instead of writing them.
+	DryRun bool
+	// EventRecorder records an event on a pod when the status of its health
+	// check changes. If nil, no events are recorded.
+	EventRecorder record.EventRecorder
+	// MetricsRegistry is the Prometheus registry the health check metrics are
+	// registered with. If nil, metrics are not exported.
+	MetricsRegistry *prometheus.Registry
+	// Clock is used for the timers of the reconcile and sweep loops, the
+	// retry delays, the agent breaker's cooldown and the error log window.
+	// Defaults to the real clock if nil. It's set to a fake clock in tests to
+	// advance time deterministically.
+	Clock clock.Clock
 
 	Ctx  context.Context
 	lock sync.Mutex
+
+	// clients caches Consul API clients keyed by the address of the agent
+	// (and the Consul namespace) they point at so that pods scheduled on the
+	// same node share a client. It is guarded by clientsLock because Upsert
+	// and Reconcile may run concurrently.
+	clients     map[string]*api.Client
+	clientsLock sync.Mutex
+	// clientTokens are the ACL tokens of the cached clients, keyed the same
+	// way. They are also guarded by clientsLock.
+	clientTokens map[string]string
+
+	// agent, if set, is used instead of the Consul agent local to each pod.
+	// It is only set in tests.
+	agent consulAgent
+
+	metrics     *healthCheckMetrics
+	metricsOnce sync.Once
+
+	// envoyClient is the client the Envoy sidecars are probed with.
+	envoyClient     *http.Client
+	envoyClientOnce sync.Once
+
+	// breaker stops the calls to the Consul agents that keep failing. It is
+	// nil if AgentFailureThreshold is 0.
+	breaker     *agentBreaker
+	breakerOnce sync.Once
+
+	// batcher batches the status updates. It is nil if StatusBatchWindow
+	// is 0.
+	batcher     *statusBatcher
+	batcherOnce sync.Once
+
+	// logLimiter collapses identical errors. It is nil if ErrorLogWindow
+	// is 0.
+	logLimiter     *errorLogLimiter
+	logLimiterOnce sync.Once
+
+	// reports are the health checks managed for pods keyed by their ID. They
+	// are guarded by reportsLock.
+	reports     map[string]CheckReport
+	reportsLock sync.Mutex
+
+	// watchErrors are the last errors listing or watching the pods of the
+	// namespaces whose informers currently fail, keyed by namespace. They
+	// are guarded by watchErrorsLock.
+	watchErrors     map[string]error
+	watchErrorsLock sync.Mutex
+
+	// nsInformers are the pod informers of the namespaces that match
+	// NamespaceSelector keyed by namespace. They are guarded by
+	// nsInformersLock.
+	nsInformers     map[string]cache.SharedIndexInformer
+	nsInformersLock sync.Mutex
+	// nsInformersSynced is set to 1 once the informers of the namespaces
+	// that initially match NamespaceSelector have been added.
+	nsInformersSynced int32
+
+	// checkMissing are the number of times the events of the pods whose
+	// health check doesn't exist yet have been requeued, keyed by pod. They
+	// are guarded by checkMissingLock.
+	checkMissing     map[string]int
+	checkMissingLock sync.Mutex
+
+	// ensuredNamespaces are the Consul namespaces that exist or have been
+	// created by ensureConsulNamespace. They are guarded by
+	// ensuredNamespacesLock.
+	ensuredNamespaces     map[string]bool
+	ensuredNamespacesLock sync.Mutex
+
+	// filterUnsupported is set to 1 once a Consul agent rejected a filtered
+	// request for its checks, after which the checks are filtered locally.
+	filterUnsupported int32
 }
 
 // Run is the long-running runloop for periodically running Reconcile.
-// It initially reconciles at startup and is then invoked after every
+// It initially imports the existing health checks and reconciles at startup and is then invoked after every
 // ReconcilePeriod expires.
 func (h *HealthCheckResource) Run(stopCh <-chan struct{}) {
+	// Register the metrics up front so that they're exported before the
+	// first health check is processed.
+	h.getMetrics()
+
+	// Adopt the health checks that already exist before the first reconcile
+	// updates them.
+	if _, err := h.ImportExistingChecks(); err != nil {
+		h.Log.Error("import of existing health checks returned an error", "err", err)
+	}
+
 	err := h.Reconcile()
 	if err != nil {
 		h.Log.Error("reconcile returned an error", "err", err)
 	}
 
-	reconcileTimer := time.NewTimer(h.ReconcilePeriod)
+	// The sweep channel is nil, and so never ready, if sweeping is disabled.
+	var sweepCh <-chan time.Time
+	if h.OrphanSweepPeriod > 0 {
+		sweepTicker := h.getClock().NewTicker(h.OrphanSweepPeriod)
+		defer sweepTicker.Stop()
+		sweepCh = sweepTicker.C()
+	}
+
+	reconcileTimer := h.getClock().NewTimer(h.ReconcilePeriod)
 	defer reconcileTimer.Stop()
 
 	for {
@@ -66,38 +409,94 @@ func (h *HealthCheckResource) Run(stopCh <-chan struct{}) {
 			h.Log.Info("received stop signal, shutting down")
 			return
 
-		case <-reconcileTimer.C:
+		case <-reconcileTimer.C():
 			if err := h.Reconcile(); err != nil {
 				h.Log.Error("reconcile returned an error", "err", err)
 			}
 			reconcileTimer.Reset(h.ReconcilePeriod)
+
+		case <-sweepCh:
+			if err := h.SweepOrphanedChecks(); err != nil {
+				h.Log.Error("sweeping orphaned health checks returned an error", "err", err)
+			}
 		}
 	}
 }
 
-// Delete is not implemented because it is handled by the preStop phase whereby all services
-// related to the pod are deregistered which also deregisters health checks.
-func (h *HealthCheckResource) Delete(string, interface{}) error {
+// Delete deregisters the pod's health check. This is usually already handled
+// by the preStop phase whereby all services related to the pod are deregistered,
+// which also deregisters health checks, so a check that no longer exists is
+// not an error.
+func (h *HealthCheckResource) Delete(key string, raw interface{}) error {
+	return h.DeleteContext(h.Ctx, key, raw)
+}
+
+// DeleteContext is Delete with a context that bounds the Consul calls.
+func (h *HealthCheckResource) DeleteContext(ctx context.Context, key string, raw interface{}) error {
+	pod, ok := raw.(*corev1.Pod)
+	if !ok {
+		return fmt.Errorf("failed to cast to a pod object")
+	}
+	if h.getConsulServiceName(pod) == "" || h.missingHostIP(pod) {
+		return nil
+	}
+	agent, err := h.getConsulAgent(pod)
+	if err != nil {
+		return fmt.Errorf("unable to get Consul client connection for %s: %s", pod.Name, err)
+	}
+	h.forgetCheckMissing(pod)
+	healthCheckID := h.getConsulHealthCheckID(pod)
+	if err := h.deregisterManagedHealthCheck(ctx, agent, healthCheckID); err != nil {
+		h.logError("unable to deregister health check", err, "id", healthCheckID)
+		return err
+	}
+	h.forgetReport(healthCheckID)
 	return nil
 }
 
 // Informer starts a sharedindex informer which watches and lists corev1.Pod objects
-// which meet the filter of labelInject.
+// which meet the filter of HealthCheckLabel in all namespaces.
 func (h *HealthCheckResource) Informer() cache.SharedIndexInformer {
+	return h.namespaceInformer(metav1.NamespaceAll)
+}
+
+// Informers returns one informer per namespace in Namespaces, or a single
+// informer watching all namespaces if Namespaces is empty. If
+// NamespaceSelector is set, the informers are added by RunInformers instead.
+func (h *HealthCheckResource) Informers() []cache.SharedIndexInformer {
+	if h.NamespaceSelector != nil {
+		return nil
+	}
+	var informers []cache.SharedIndexInformer
+	for _, ns := range h.namespaces() {
+		informers = append(informers, h.namespaceInformer(ns))
+	}
+	return informers
+}
+
+// namespaceInformer returns a sharedindex informer which watches and lists
+// corev1.Pod objects which meet the filter of HealthCheckLabel in namespace ns.
+func (h *HealthCheckResource) namespaceInformer(ns string) cache.SharedIndexInformer {
 	return cache.NewSharedIndexInformer(
 		// ListWatch takes a List and Watch function which we filter based on label which was injected.
 		&cache.ListWatch{
 			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
-				return h.KubernetesClientset.CoreV1().Pods(metav1.NamespaceAll).List(h.Ctx,
-					metav1.ListOptions{LabelSelector: labelInject})
+				options.LabelSelector = h.labelSelector()
+				options.FieldSelector = h.fieldSelector()
+				list, err := h.KubernetesClientset.CoreV1().Pods(ns).List(h.Ctx, options)
+				h.recordWatchResult(ns, "list", err)
+				return list, err
 			},
 			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
-				return h.KubernetesClientset.CoreV1().Pods(metav1.NamespaceAll).Watch(h.Ctx,
-					metav1.ListOptions{LabelSelector: labelInject})
+				options.LabelSelector = h.labelSelector()
+				options.FieldSelector = h.fieldSelector()
+				w, err := h.KubernetesClientset.CoreV1().Pods(ns).Watch(h.Ctx, options)
+				h.recordWatchResult(ns, "watch", err)
+				return w, err
 			},
 		},
-		&corev1.Pod{}, // the target type (Pod)
-		0,             // no resync (period of 0)
+		&corev1.Pod{},  // the target type (Pod)
+		h.ResyncPeriod, // no resync if the period is 0
 		cache.Indexers{},
 	)
 }
@@ -107,50 +506,296 @@ func (h *HealthCheckResource) Informer() cache.SharedIndexInformer {
 // registered against their respective agent and service, and updates to pods will have
 // this TTL health check updated to reflect the pod's readiness status.
 func (h *HealthCheckResource) Upsert(key string, raw interface{}) error {
+	return h.UpsertContext(h.Ctx, key, raw)
+}
+
+// UpsertContext is Upsert with a context that bounds the Consul calls.
+func (h *HealthCheckResource) UpsertContext(ctx context.Context, key string, raw interface{}) error {
 	pod, ok := raw.(*corev1.Pod)
 	if !ok {
 		return fmt.Errorf("failed to cast to a pod object")
 	}
-	err := h.reconcilePod(pod)
+	if !h.hasHealthCheckLabel(pod) {
+		// The label was removed from the running pod. The informer's watch
+		// usually reports this as a delete but it may also deliver the pod
+		// as an update, e.g. on a relist, and it's then handled the same way.
+		h.Log.Debug("pod no longer matches the health check label, deregistering its health check",
+			"name", pod.Name, "namespace", pod.Namespace, "label", h.labelSelector())
+		return h.DeleteContext(ctx, key, pod)
+	}
+	if h.shouldProcess(pod) && h.missingHostIP(pod) {
+		h.Log.Debug("pod has no host IP yet, requeueing", "name", pod.Name, "namespace", pod.Namespace,
+			"requeue-after", hostIPRequeueDelay)
+		return &controller.RequeueAfterError{
+			Err:   fmt.Errorf("pod %s/%s has no host IP", pod.Namespace, pod.Name),
+			Delay: hostIPRequeueDelay,
+		}
+	}
+	if allowed, cooldown := h.agentAllowed(pod); !allowed {
+		h.Log.Debug("skipping pod because its Consul agent keeps failing", "name", pod.Name, "namespace", pod.Namespace,
+			"host", h.agentHost(pod), "requeue-after", cooldown)
+		return &controller.RequeueAfterError{
+			Err:   fmt.Errorf("Consul agent on %s keeps failing", h.agentHost(pod)),
+			Delay: cooldown,
+		}
+	}
+	err := h.reconcilePodWithRetries(ctx, pod)
+	h.recordAgentResult(pod, err)
+	if errors.Is(err, errHealthCheckNotRegistered) {
+		delay, ok := h.checkMissingDelay(pod)
+		if !ok {
+			h.Log.Info("health check still not registered, giving up until the pod changes", "name", pod.Name,
+				"namespace", pod.Namespace, "retries", h.checkMissingRetries())
+			return nil
+		}
+		h.Log.Debug("health check not registered yet, requeueing", "name", pod.Name, "namespace", pod.Namespace,
+			"requeue-after", delay)
+		return &controller.RequeueAfterError{Err: err, Delay: delay}
+	}
+	h.forgetCheckMissing(pod)
+	if rateLimited, retryAfter := isRateLimitErr(err); rateLimited {
+		h.getMetrics().rateLimited.Inc()
+		delay := h.rateLimitBackoff(retryAfter)
+		h.Log.Info("Consul agent rate limited the requests, requeueing pod", "name", pod.Name, "namespace", pod.Namespace,
+			"requeue-after", delay)
+		return &controller.RequeueAfterError{Err: err, Delay: delay}
+	}
 	if err != nil {
-		h.Log.Error("unable to update pod", "err", err)
+		h.logError("unable to update pod", err, "name", pod.Name, "namespace", pod.Namespace)
 		return err
 	}
 	return nil
 }
 
+// checkMissingDelay returns the delay before the event of pod, whose health
+// check doesn't exist yet, is retried: checkMissingRequeueDelay doubled on
+// each retry, up to checkMissingMaxDelay. It returns false once the pod was
+// retried CheckMissingRetries times, after which it starts over.
+func (h *HealthCheckResource) checkMissingDelay(pod *corev1.Pod) (time.Duration, bool) {
+	key := pod.Namespace + "/" + pod.Name
+	h.checkMissingLock.Lock()
+	defer h.checkMissingLock.Unlock()
+	if h.checkMissing == nil {
+		h.checkMissing = make(map[string]int)
+	}
+	retries := h.checkMissing[key]
+	if retries >= h.checkMissingRetries() {
+		delete(h.checkMissing, key)
+		return 0, false
+	}
+	h.checkMissing[key] = retries + 1
+	delay := checkMissingRequeueDelay
+	for i := 0; i < retries && delay < checkMissingMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > checkMissingMaxDelay {
+		delay = checkMissingMaxDelay
+	}
+	return delay, true
+}
+
+// forgetCheckMissing resets the retries of pod once its health check exists
+// or it's deleted.
+func (h *HealthCheckResource) forgetCheckMissing(pod *corev1.Pod) {
+	h.checkMissingLock.Lock()
+	defer h.checkMissingLock.Unlock()
+	delete(h.checkMissing, pod.Namespace+"/"+pod.Name)
+}
+
+func (h *HealthCheckResource) checkMissingRetries() int {
+	if h.CheckMissingRetries == 0 {
+		return controller.DefaultMaxRetries
+	}
+	return h.CheckMissingRetries
+}
+
+// reconcilePodWithRetries reconciles the pod, retrying up to
+// ConnectionRetries times with jitter while its Consul agent can't be
+// reached. reconcilePod drops the cached client on connection errors so
+// each retry uses a new client.
+func (h *HealthCheckResource) reconcilePodWithRetries(ctx context.Context, pod *corev1.Pod) error {
+	for attempt := 0; ; attempt++ {
+		err := h.reconcilePod(ctx, pod)
+		if err == nil || !isConnectionErr(err) || attempt >= h.ConnectionRetries || ctx.Err() != nil {
+			return err
+		}
+		delay := h.connectionRetryDelay()
+		delay += time.Duration(rand.Int63n(int64(delay) + 1))
+		h.Log.Debug("unable to reach Consul agent, retrying", "name", pod.Name, "namespace", pod.Namespace,
+			"attempt", attempt+1, "delay", delay, "err", err)
+		select {
+		case <-h.getClock().After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
 // Reconcile iterates through all Pods with the appropriate label and compares the
 // current health check status against that which is stored in Consul and updates
 // the consul health check accordingly. If the health check doesn't yet exist it will create it.
+// A failure to reconcile a pod doesn't stop the other pods from being reconciled; the errors of
+// all the pods are returned together.
 func (h *HealthCheckResource) Reconcile() error {
 	h.lock.Lock()
 	defer h.lock.Unlock()
 	h.Log.Debug("starting reconcile")
-	// First grab the list of Pods which have the label labelInject.
-	podList, err := h.KubernetesClientset.CoreV1().Pods(corev1.NamespaceAll).List(h.Ctx,
-		metav1.ListOptions{LabelSelector: labelInject})
-	if err != nil {
-		h.Log.Error("unable to get pods", "err", err)
-		return err
-	}
-	// Reconcile the state of each pod in the podList.
-	for _, pod := range podList.Items {
-		err = h.reconcilePod(&pod)
+	var result *multierror.Error
+	for _, ns := range h.namespaces() {
+		// First grab the list of Pods which have the label HealthCheckLabel.
+		podList, err := h.KubernetesClientset.CoreV1().Pods(ns).List(h.Ctx,
+			metav1.ListOptions{LabelSelector: h.labelSelector(), FieldSelector: h.fieldSelector()})
 		if err != nil {
-			h.Log.Error("unable to update pod", "err", err)
+			h.logError("unable to get pods", err, "namespace", ns)
+			result = multierror.Append(result, fmt.Errorf("listing pods in namespace %q: %w", ns, err))
+			continue
+		}
+		// Reconcile the state of each pod in the podList.
+		for _, pod := range podList.Items {
+			// The pod's event is requeued until it has a host IP.
+			if h.missingHostIP(&pod) {
+				h.Log.Debug("skipping pod without host IP", "name", pod.Name, "namespace", pod.Namespace)
+				continue
+			}
+			if allowed, _ := h.agentAllowed(&pod); !allowed {
+				h.Log.Debug("skipping pod because its Consul agent keeps failing", "name", pod.Name, "namespace", pod.Namespace,
+					"host", h.agentHost(&pod))
+				result = multierror.Append(result, fmt.Errorf("pod %s/%s: Consul agent on %s keeps failing",
+					pod.Namespace, pod.Name, h.agentHost(&pod)))
+				continue
+			}
+			err = h.reconcilePod(h.Ctx, &pod)
+			h.recordAgentResult(&pod, err)
+			if errors.Is(err, errHealthCheckNotRegistered) {
+				// The next reconcile picks the check up once it exists.
+				h.Log.Debug("skipping pod whose health check is not registered yet", "name", pod.Name, "namespace", pod.Namespace)
+				continue
+			}
+			if err != nil {
+				h.logError("unable to update pod", err, "name", pod.Name, "namespace", pod.Namespace)
+				result = multierror.Append(result, fmt.Errorf("pod %s/%s: %w", pod.Namespace, pod.Name, err))
+			}
 		}
 	}
 	h.Log.Debug("finished reconcile")
+	return result.ErrorOrNil()
+}
+
+// SweepOrphanedChecks deregisters the health checks whose pods no longer
+// exist, e.g. because the pod's delete event was missed while the controller
+// wasn't running. Only the agents that a client has been created for are
+// swept, and only the checks of pods in the watched namespaces are
+// considered.
+func (h *HealthCheckResource) SweepOrphanedChecks() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.Log.Debug("starting orphaned health check sweep")
+
+	// List the checks before the pods so that a check registered for a pod
+	// created in between isn't mistaken for an orphan.
+	agentChecks := make(map[consulAgent][]string)
+	for _, agent := range h.knownAgents() {
+		checks, err := h.filteredChecks(h.Ctx, agent, fmt.Sprintf("CheckID matches `/%s$`", healthCheckIDSuffix),
+			func(id string, _ *api.AgentCheck) bool { return strings.HasSuffix(id, "/"+healthCheckIDSuffix) })
+		if err != nil {
+			h.Log.Error("unable to get agent health checks", "err", err)
+			continue
+		}
+		for id, check := range checks {
+			if !h.isWatchedHealthCheckID(id) {
+				continue
+			}
+			if !isManagedCheck(check) {
+				h.Log.Debug("skipping health check not managed by the controller", "id", id)
+				continue
+			}
+			agentChecks[agent] = append(agentChecks[agent], id)
+		}
+	}
+
+	existing := make(map[string]bool)
+	for _, ns := range h.namespaces() {
+		podList, err := h.KubernetesClientset.CoreV1().Pods(ns).List(h.Ctx,
+			metav1.ListOptions{LabelSelector: h.labelSelector(), FieldSelector: h.fieldSelector()})
+		if err != nil {
+			h.Log.Error("unable to get pods", "namespace", ns, "err", err)
+			return err
+		}
+		for _, pod := range podList.Items {
+			existing[h.getConsulHealthCheckID(&pod)] = true
+		}
+	}
+
+	for agent, ids := range agentChecks {
+		for _, id := range ids {
+			if existing[id] {
+				continue
+			}
+			h.Log.Info("deregistering health check of a pod that no longer exists", "id", id)
+			if err := h.deregisterConsulHealthCheck(h.Ctx, agent, id); err != nil {
+				h.Log.Error("unable to deregister health check", "id", id, "err", err)
+				continue
+			}
+			h.forgetReport(id)
+		}
+	}
+	h.Log.Debug("finished orphaned health check sweep")
 	return nil
 }
 
+// knownAgents returns the agents that a client has been created for.
+func (h *HealthCheckResource) knownAgents() []consulAgent {
+	if h.agent != nil {
+		return []consulAgent{h.agent}
+	}
+	h.clientsLock.Lock()
+	defer h.clientsLock.Unlock()
+	var agents []consulAgent
+	for _, client := range h.clients {
+		agents = append(agents, &apiAgent{client: client})
+	}
+	return agents
+}
+
+// isWatchedHealthCheckID returns true if id is the ID of a health check
+// registered by this controller for a pod in a watched namespace. Checks
+// with a different HealthCheckIDPrefix, e.g. those of another Kubernetes
+// cluster, are not.
+func (h *HealthCheckResource) isWatchedHealthCheckID(id string) bool {
+	if h.HealthCheckIDPrefix != "" {
+		if !strings.HasPrefix(id, h.HealthCheckIDPrefix+"/") {
+			return false
+		}
+		id = strings.TrimPrefix(id, h.HealthCheckIDPrefix+"/")
+	}
+	// The ID is of the form <namespace>/<service ID>/kubernetes-health-check.
+	parts := strings.Split(id, "/")
+	if len(parts) != 3 || parts[2] != healthCheckIDSuffix {
+		return false
+	}
+	if len(h.Namespaces) == 0 && h.NamespaceSelector == nil {
+		return true
+	}
+	for _, ns := range h.namespaces() {
+		if ns == parts[0] {
+			return true
+		}
+	}
+	return false
+}
+
 // reconcilePod will reconcile a pod. This is the common work for both Upsert and Reconcile.
-func (h *HealthCheckResource) reconcilePod(pod *corev1.Pod) error {
-	h.Log.Debug("processing pod", "name", pod.Name)
+func (h *HealthCheckResource) reconcilePod(ctx context.Context, pod *corev1.Pod) (err error) {
+	h.Log.Debug("processing pod", "name", pod.Name, "namespace", pod.Namespace)
 	if !h.shouldProcess(pod) {
 		// Skip pods that are not running or have not been properly injected.
 		return nil
 	}
+	if h.getConsulServiceName(pod) == "" {
+		h.Log.Debug("skipping pod without a Consul service annotation", "name", pod.Name, "namespace", pod.Namespace,
+			"annotations", []string{annotationService, annotationServiceName})
+		return nil
+	}
 	// Fetch the identifiers we will use to interact with the Consul agent for this pod.
 	serviceID := h.getConsulServiceID(pod)
 	healthCheckID := h.getConsulHealthCheckID(pod)
@@ -159,93 +804,260 @@ func (h *HealthCheckResource) reconcilePod(pod *corev1.Pod) error {
 		return fmt.Errorf("unable to get pod status: %s", err)
 	}
 	// Get a client connection to the correct agent.
-	client, err := h.getConsulClient(pod)
+	agent, err := h.getConsulAgent(pod)
 	if err != nil {
 		return fmt.Errorf("unable to get Consul client connection for %s: %s", pod.Name, err)
 	}
+	// If we couldn't reach the agent, drop the cached client so that it is
+	// rebuilt on the next event rather than reused.
+	defer func() {
+		if isConnectionErr(err) {
+			h.invalidateConsulClient(pod)
+		}
+	}()
+	if !h.healthSyncEnabled(pod) {
+		// The pod opted out so remove the health check we may have
+		// registered for it before.
+		h.Log.Debug("health check syncing disabled, deregistering health check", "name", pod.Name, "namespace", pod.Namespace,
+			"id", healthCheckID)
+		err = h.deregisterManagedHealthCheck(ctx, agent, healthCheckID)
+		if err == nil {
+			h.forgetReport(healthCheckID)
+		}
+		return err
+	}
+	// The pod's service was re-registered under a new ID so the checks bound
+	// to its old service are replaced by the one of the new service.
+	for _, staleID := range h.staleHealthCheckIDs(pod, healthCheckID) {
+		h.Log.Info("deregistering health check of the pod's previous service", "name", pod.Name, "namespace", pod.Namespace,
+			"id", staleID)
+		if err = h.deregisterManagedHealthCheck(ctx, agent, staleID); err != nil {
+			return err
+		}
+		h.forgetReport(staleID)
+	}
+	// The pod is ready as far as Kubernetes knows but its sidecar may not
+	// have received its configuration yet.
+	if status == api.HealthPassing && h.EnvoyReadyProbe {
+		if ready, notReadyReason := h.envoyReadyStatusAndReason(ctx, pod); !ready {
+			status, reason = api.HealthCritical, notReadyReason
+		}
+	}
 	// Retrieve the health check that would exist if the service had one registered for this pod.
-	serviceCheck, err := h.getServiceCheck(client, healthCheckID)
+	serviceCheck, err := h.getServiceCheck(ctx, agent, healthCheckID)
 	if err != nil {
-		return fmt.Errorf("unable to get agent health checks: serviceID=%s, checkID=%s, %s", serviceID, healthCheckID, err)
+		return fmt.Errorf("unable to get agent health checks: serviceID=%s, checkID=%s, %w", serviceID, healthCheckID, err)
+	}
+	if serviceCheck == nil && h.ManageStatusOnly {
+		// The check is registered by something else, so wait for it.
+		return errHealthCheckNotRegistered
 	}
-	if serviceCheck == nil {
+	checkName := h.getConsulHealthCheckName(pod)
+	deregisterAfter := h.deregisterCriticalServiceAfter(pod)
+	notes := h.checkNotes(pod, deregisterAfter)
+	// The check was registered with other parameters, e.g. by a previous
+	// version or before the configured TTL changed. Registering is an
+	// upsert, so it is registered again rather than only updated. Checks
+	// registered by something else are left alone.
+	reregister := serviceCheck != nil && !h.ManageStatusOnly && isManagedCheck(serviceCheck) &&
+		!checkMatchesRegistration(serviceCheck, checkName, serviceID, notes)
+	if reregister {
+		h.Log.Info("re-registering health check whose parameters changed", "name", pod.Name, "namespace", pod.Namespace, "id", healthCheckID)
+	}
+	if serviceCheck == nil || reregister {
 		// Create a new health check.
-		h.Log.Debug("registering new health check", "name", pod.Name, "id", healthCheckID)
-		err = h.registerConsulHealthCheck(client, healthCheckID, serviceID, status)
+		h.Log.Debug("registering new health check", "name", pod.Name, "namespace", pod.Namespace, "id", healthCheckID)
+		if err := h.ensureConsulNamespace(h.getConsulNamespace(pod)); err != nil {
+			return err
+		}
+		err = h.registerConsulHealthCheck(ctx, agent, healthCheckID, checkName, serviceID, h.getConsulNamespace(pod), status,
+			notes, deregisterAfter)
 		if errors.Is(err, ServiceNotFoundErr) {
 			h.Log.Warn("skipping registration because service not registered with Consul - this may be because the pod is shutting down", "serviceID", serviceID)
 			return nil
 		} else if err != nil {
-			return fmt.Errorf("unable to register health check: %s", err)
+			return fmt.Errorf("unable to register health check: %w", err)
 		}
-		h.Log.Debug("updating health check status", "name", pod.Name, "status", status, "reason", reason)
+		h.Log.Debug("updating health check status", "name", pod.Name, "namespace", pod.Namespace, "status", status, "reason", reason)
 		// Also update it, the reason this is separate is there is no way to set the Output field of the health check
-		// at creation time, and this is what is displayed on the UI as opposed to the Notes field.
-		err = h.updateConsulHealthCheckStatus(client, healthCheckID, status, reason)
+		// at creation time, and this is what is displayed on the UI as opposed to the Notes field. The notes are a
+		// stable description of the check while the output is the live reason of its status.
+		_, err = h.updateConsulHealthCheckStatus(ctx, pod, agent, nil, healthCheckID, status, reason)
 		if err != nil {
-			return fmt.Errorf("error updating health check: %s", err)
+			return fmt.Errorf("error updating health check: %w", err)
+		}
+		if reregister && status != serviceCheck.Status {
+			h.recordStatusEvent(pod, status, reason)
 		}
-	} else if serviceCheck.Status != status {
-		// Update the healthCheck.
-		h.Log.Debug("updating health check status", "name", pod.Name, "status", status, "reason", reason)
-		err = h.updateConsulHealthCheckStatus(client, healthCheckID, status, reason)
+	} else {
+		var changed bool
+		previousStatus := serviceCheck.Status
+		changed, err = h.updateConsulHealthCheckStatus(ctx, pod, agent, serviceCheck, healthCheckID, status, reason)
 		if err != nil {
-			return fmt.Errorf("error updating health check: %s", err)
+			return fmt.Errorf("error updating health check: %w", err)
+		}
+		if changed {
+			h.Log.Debug("updated health check status", "name", pod.Name, "namespace", pod.Namespace, "status", status, "reason", reason)
+			// The output may change without the status, e.g. when the pod
+			// condition's message changes, but only transitions are
+			// recorded.
+			if status != previousStatus {
+				h.recordStatusEvent(pod, status, reason)
+			}
 		}
 	}
+	h.recordReport(pod, serviceID, healthCheckID, status)
 	return nil
 }
 
-// updateConsulHealthCheckStatus updates the consul health check status.
-func (h *HealthCheckResource) updateConsulHealthCheckStatus(client *api.Client, consulHealthCheckID, status, reason string) error {
+// recordStatusEvent records an event on the pod when its health check
+// transitions to status.
+func (h *HealthCheckResource) recordStatusEvent(pod *corev1.Pod, status, reason string) {
+	if h.EventRecorder == nil {
+		return
+	}
+	if status == api.HealthPassing {
+		h.EventRecorder.Eventf(pod, corev1.EventTypeNormal, eventReasonHealthCheckPassing,
+			"Consul health check is passing: %s", reason)
+	} else {
+		h.EventRecorder.Eventf(pod, corev1.EventTypeWarning, eventReasonHealthCheckCritical,
+			"Consul health check is %s: %s", status, reason)
+	}
+}
+
+// updateConsulHealthCheckStatus updates the consul health check status and
+// sets reason as its output. current is the check as last read from the
+// agent. If it already has status and reason the update is skipped so that
+// unchanged pods don't cause a write to Consul on every relist. If
+// StatusBatchWindow is set, the update is sent with the batch of the pod's
+// agent and Consul namespace. It returns whether the check was updated.
+func (h *HealthCheckResource) updateConsulHealthCheckStatus(ctx context.Context, pod *corev1.Pod, agent consulAgent, current *api.AgentCheck, consulHealthCheckID, status, reason string) (bool, error) {
+	reason = h.truncateReason(reason)
+	if current != nil && current.Status == status && current.Output == reason {
+		return false, nil
+	}
+	if h.DryRun {
+		h.Log.Info("dry run: would update health check", "id", consulHealthCheckID, "status", status, "reason", reason)
+		return true, nil
+	}
 	h.Log.Debug("updating health check", "id", consulHealthCheckID)
-	return client.Agent().UpdateTTL(consulHealthCheckID, reason, status)
+	var err error
+	if batcher := h.getBatcher(); batcher != nil {
+		// The key is the key of the cached client that agent is.
+		addr, addrErr := h.getConsulAgentAddr(pod)
+		if addrErr != nil {
+			return false, addrErr
+		}
+		key := clientCacheKey(addr, h.getConsulNamespace(pod))
+		err = batcher.updateTTL(ctx, key, agent, consulHealthCheckID, reason, status)
+	} else {
+		err = agent.UpdateTTL(ctx, consulHealthCheckID, reason, status)
+	}
+	if err != nil {
+		return false, err
+	}
+	h.getMetrics().statusUpdates.WithLabelValues(status).Inc()
+	return true, nil
 }
 
 // registerConsulHealthCheck registers a TTL health check for the service on this Agent.
 // The Agent is local to the Pod which has a kubernetes health check.
 // This has the effect of marking the service instance healthy/unhealthy for Consul service mesh traffic.
-func (h *HealthCheckResource) registerConsulHealthCheck(client *api.Client, consulHealthCheckID, serviceID, status string) error {
+// The check is identified by consulHealthCheckID while checkName is only the
+// label shown to humans. The notes are set as the Notes field of the health check.
+func (h *HealthCheckResource) registerConsulHealthCheck(ctx context.Context, agent consulAgent, consulHealthCheckID, checkName, serviceID, consulNamespace, status, notes, deregisterAfter string) error {
+	if h.DryRun {
+		h.Log.Info("dry run: would register Consul health check", "id", consulHealthCheckID, "serviceID", serviceID, "status", status)
+		return nil
+	}
 	h.Log.Debug("registering Consul health check", "id", consulHealthCheckID, "serviceID", serviceID)
 
 	// Create a TTL health check in Consul associated with this service and pod.
-	// The TTL time is 100000h which should ensure that the check never fails due to timeout
-	// of the TTL check.
-	err := client.Agent().CheckRegister(&api.AgentCheckRegistration{
+	start := h.getClock().Now()
+	err := agent.CheckRegister(ctx, &api.AgentCheckRegistration{
 		ID:        consulHealthCheckID,
-		Name:      "Kubernetes Health Check",
+		Name:      checkName,
+		Notes:     notes,
 		ServiceID: serviceID,
+		Namespace: consulNamespace,
 		AgentServiceCheck: api.AgentServiceCheck{
-			TTL:                    "100000h",
-			Status:                 status,
-			SuccessBeforePassing:   1,
-			FailuresBeforeCritical: 1,
+			TTL:                            h.ttl(),
+			Status:                         status,
+			SuccessBeforePassing:           h.successBeforePassing(),
+			FailuresBeforeCritical:         h.failuresBeforeCritical(),
+			DeregisterCriticalServiceAfter: deregisterAfter,
 		},
 	})
+	h.getMetrics().registerDuration.Observe(h.getClock().Since(start).Seconds())
 	if err != nil {
+		h.getMetrics().registerErrors.Inc()
 		// Full error looks like:
 		// Unexpected response code: 500 (ServiceID "consulnamespace/svc-id" does not exist)
 		if strings.Contains(err.Error(), fmt.Sprintf("%s\" does not exist", serviceID)) {
 			return ServiceNotFoundErr
 		}
-		return fmt.Errorf("registering health check for service %q: %s", serviceID, err)
+		return fmt.Errorf("registering health check for service %q: %w", serviceID, err)
+	}
+	h.getMetrics().registered.Inc()
+	return nil
+}
+
+// deregisterConsulHealthCheck deregisters the health check from the agent.
+// A health check that doesn't exist, e.g. because it was already deregistered
+// along with its service, is ignored.
+func (h *HealthCheckResource) deregisterConsulHealthCheck(ctx context.Context, agent consulAgent, consulHealthCheckID string) error {
+	if h.DryRun {
+		h.Log.Info("dry run: would deregister Consul health check", "id", consulHealthCheckID)
+		return nil
+	}
+	h.Log.Debug("deregistering Consul health check", "id", consulHealthCheckID)
+	err := agent.CheckDeregister(ctx, consulHealthCheckID)
+	if err != nil {
+		// Full error looks like:
+		// Unexpected response code: 404 (Unknown check ID "default/pod-svc/kubernetes-health-check". Ensure that the check ID is passed, not the check name.)
+		if strings.Contains(err.Error(), "Unexpected response code: 404") {
+			h.Log.Debug("health check already deregistered", "id", consulHealthCheckID)
+			return nil
+		}
+		return fmt.Errorf("deregistering health check %q: %w", consulHealthCheckID, err)
 	}
 	return nil
 }
 
+// deregisterManagedHealthCheck deregisters the health check from the agent
+// if it was registered by the controller. Checks without the managed-by
+// marker in their notes, e.g. ones registered manually under the same ID,
+// are left alone.
+func (h *HealthCheckResource) deregisterManagedHealthCheck(ctx context.Context, agent consulAgent, consulHealthCheckID string) error {
+	check, err := h.getServiceCheck(ctx, agent, consulHealthCheckID)
+	if err != nil {
+		return err
+	}
+	if check == nil {
+		h.Log.Debug("health check already deregistered", "id", consulHealthCheckID)
+		return nil
+	}
+	if !isManagedCheck(check) {
+		h.Log.Warn("not deregistering health check not managed by the controller", "id", consulHealthCheckID)
+		return nil
+	}
+	return h.deregisterConsulHealthCheck(ctx, agent, consulHealthCheckID)
+}
+
 // getServiceCheck will return the health check for this pod and service if it exists.
-func (h *HealthCheckResource) getServiceCheck(client *api.Client, healthCheckID string) (*api.AgentCheck, error) {
+func (h *HealthCheckResource) getServiceCheck(ctx context.Context, agent consulAgent, healthCheckID string) (*api.AgentCheck, error) {
 	filter := fmt.Sprintf("CheckID == `%s`", healthCheckID)
-	checks, err := client.Agent().ChecksWithFilter(filter)
+	checks, err := h.filteredChecks(ctx, agent, filter,
+		func(id string, _ *api.AgentCheck) bool { return id == healthCheckID })
 	if err != nil {
-		return nil, fmt.Errorf("getting check %q: %s", healthCheckID, err)
+		return nil, fmt.Errorf("getting check %q: %w", healthCheckID, err)
 	}
 	// This will be nil (does not exist) or an actual check.
 	return checks[healthCheckID], nil
 }
 
 // getReadyStatusAndReason returns the formatted status string to pass to Consul based on the
-// ready state of the pod along with the reason message which will be passed into the Notes
+// ready state of the pod along with the reason message which will be passed into the Output
 // field of the Consul health check.
 func (h *HealthCheckResource) getReadyStatusAndReason(pod *corev1.Pod) (string, string, error) {
 	// A pod might be pending if the init containers have run but the non-init
@@ -255,43 +1067,228 @@ func (h *HealthCheckResource) getReadyStatusAndReason(pod *corev1.Pod) (string,
 		return api.HealthCritical, podPendingReasonMsg, nil
 	}
 
-	for _, cond := range pod.Status.Conditions {
-		var consulStatus, reason string
-		if cond.Type == corev1.PodReady {
-			if cond.Status != corev1.ConditionTrue {
-				consulStatus = api.HealthCritical
-				reason = cond.Message
-			} else {
-				consulStatus = api.HealthPassing
-				reason = kubernetesSuccessReasonMsg
+	if h.ReadinessContainer != "" {
+		if status, ok := containerStatus(pod, h.ReadinessContainer); ok {
+			if !status.Ready {
+				return api.HealthCritical, fmt.Sprintf("container %s is not ready", h.ReadinessContainer), nil
 			}
-			return consulStatus, reason, nil
+			return api.HealthPassing, kubernetesSuccessReasonMsg, nil
+		}
+	}
+
+	for _, condType := range h.readyConditions() {
+		cond, ok := podCondition(pod, condType)
+		if !ok {
+			return "", "", fmt.Errorf("no %s status for pod: %s", strings.ToLower(string(condType)), pod.Name)
+		}
+		if cond.Status != corev1.ConditionTrue {
+			return api.HealthCritical, cond.Message, nil
+		}
+	}
+	return api.HealthPassing, kubernetesSuccessReasonMsg, nil
+}
+
+// missingHostIP returns true if the address of the pod's Consul agent can't
+// be built yet because the pod's host IP isn't set. Its host IP is briefly
+// empty right after the pod is scheduled.
+func (h *HealthCheckResource) missingHostIP(pod *corev1.Pod) bool {
+	return !h.Agentless && h.NodeName == "" && pod.Status.HostIP == ""
+}
+
+// podCondition returns the condition of the pod with type condType and
+// whether it was found.
+func podCondition(pod *corev1.Pod, condType corev1.PodConditionType) (corev1.PodCondition, bool) {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == condType {
+			return cond, true
+		}
+	}
+	return corev1.PodCondition{}, false
+}
+
+// containerStatus returns the status of the pod's container with the given
+// name and whether it was found.
+func containerStatus(pod *corev1.Pod, name string) (corev1.ContainerStatus, bool) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == name {
+			return status, true
 		}
 	}
-	return "", "", fmt.Errorf("no ready status for pod: %s", pod.Name)
+	return corev1.ContainerStatus{}, false
 }
 
 // getConsulClient returns an *api.Client that points at the consul agent local to the pod.
 func (h *HealthCheckResource) getConsulClient(pod *corev1.Pod) (*api.Client, error) {
-	newAddr := fmt.Sprintf("%s://%s:%s", h.ConsulUrl.Scheme, pod.Status.HostIP, h.ConsulUrl.Port())
+	addr, err := h.getConsulAgentAddr(pod)
+	if err != nil {
+		return nil, err
+	}
+	return h.getOrCreateClient(addr, h.getConsulNamespace(pod))
+}
+
+// getConsulAgent returns the Consul agent local to the pod.
+func (h *HealthCheckResource) getConsulAgent(pod *corev1.Pod) (consulAgent, error) {
+	if h.agent != nil {
+		return h.agent, nil
+	}
+	client, err := h.getConsulClient(pod)
+	if err != nil {
+		return nil, err
+	}
+	return &apiAgent{client: client}, nil
+}
+
+// getConsulAgentAddr returns the address of the consul agent local to the pod.
+// Its port is taken from the pod's annotationConsulAPIPort annotation if set
+// and from ConsulUrl otherwise. Its host is the pod's host IP unless NodeName
+// is set. It returns an error if the pod doesn't have a host IP yet. In
+// Agentless mode it is the address of ConsulUrl for all pods.
+func (h *HealthCheckResource) getConsulAgentAddr(pod *corev1.Pod) (string, error) {
+	if h.Agentless {
+		return fmt.Sprintf("%s://%s", h.ConsulUrl.Scheme, h.ConsulUrl.Host), nil
+	}
+	port := h.ConsulUrl.Port()
+	if raw, ok := pod.Annotations[annotationConsulAPIPort]; ok {
+		if p, err := strconv.Atoi(raw); err != nil || p < 1 || p > 65535 {
+			return "", fmt.Errorf("invalid %s annotation %q: must be a port number", annotationConsulAPIPort, raw)
+		}
+		port = raw
+	}
+	host := pod.Status.HostIP
+	if h.NodeName != "" {
+		// All the pods are local to the agent at ConsulUrl.
+		host = h.ConsulUrl.Hostname()
+	}
+	if host == "" {
+		return "", fmt.Errorf("pod %s has no host IP", pod.Name)
+	}
+	return fmt.Sprintf("%s://%s:%s", h.ConsulUrl.Scheme, host, port), nil
+}
+
+// getOrCreateClient returns a cached *api.Client for the agent at newAddr,
+// creating one if it doesn't exist yet.
+func (h *HealthCheckResource) getOrCreateClient(newAddr, consulNamespace string) (*api.Client, error) {
+	key := clientCacheKey(newAddr, consulNamespace)
+	token, err := h.token(consulNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	h.clientsLock.Lock()
+	defer h.clientsLock.Unlock()
+	if client, ok := h.clients[key]; ok {
+		// The token is set when the client is created so if it changed,
+		// e.g. because it was rotated, the client must be rebuilt.
+		if h.clientTokens[key] == token {
+			return client, nil
+		}
+		h.Log.Info("ACL token changed, rebuilding consul client", "addr", newAddr, "namespace", consulNamespace)
+	}
+
 	localConfig := api.DefaultConfig()
 	localConfig.Address = newAddr
-	if pod.Annotations[annotationConsulNamespace] != "" {
-		localConfig.Namespace = pod.Annotations[annotationConsulNamespace]
+	localConfig.TLSConfig = h.TLSConfig
+	localConfig.Token = token
+	localConfig.TokenFile = ""
+	if consulNamespace != "" {
+		localConfig.Namespace = consulNamespace
+	}
+	httpClient, err := api.NewHttpClient(localConfig.Transport, localConfig.TLSConfig)
+	if err != nil {
+		h.logError("unable to get Consul API Client", err, "addr", newAddr)
+		return nil, err
 	}
+	httpClient.Transport = &rateLimitTransport{base: httpClient.Transport}
+	localConfig.HttpClient = httpClient
 	localClient, err := consul.NewClient(localConfig)
 	if err != nil {
-		h.Log.Error("unable to get Consul API Client", "addr", newAddr, "err", err)
+		h.logError("unable to get Consul API Client", err, "addr", newAddr)
 		return nil, err
 	}
 	h.Log.Debug("setting consul client to the following agent", "addr", newAddr)
-	return localClient, err
+	if h.clients == nil {
+		h.clients = make(map[string]*api.Client)
+		h.clientTokens = make(map[string]string)
+	}
+	h.clients[key] = localClient
+	h.clientTokens[key] = token
+	return localClient, nil
+}
+
+// token returns the ACL token the clients for the Consul namespace
+// consulNamespace should use. The token of the namespace takes precedence
+// over the default token.
+func (h *HealthCheckResource) token(consulNamespace string) (string, error) {
+	if consulNamespace != "" {
+		if h.NamespaceTokensDir != "" && filepath.Base(consulNamespace) == consulNamespace {
+			path := filepath.Join(h.NamespaceTokensDir, consulNamespace)
+			data, err := ioutil.ReadFile(path)
+			if err == nil {
+				return strings.TrimSpace(string(data)), nil
+			}
+			if !os.IsNotExist(err) {
+				return "", fmt.Errorf("reading ACL token file %q: %s", path, err)
+			}
+		}
+		if token, ok := h.NamespaceTokens[consulNamespace]; ok {
+			return token, nil
+		}
+	}
+	if h.TokenFile == "" {
+		return h.Token, nil
+	}
+	data, err := ioutil.ReadFile(h.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("reading ACL token file %q: %s", h.TokenFile, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// invalidateConsulClient removes the cached client for the agent local to the pod
+// so that the next call to getConsulClient builds a new one.
+func (h *HealthCheckResource) invalidateConsulClient(pod *corev1.Pod) {
+	newAddr, err := h.getConsulAgentAddr(pod)
+	if err != nil {
+		return
+	}
+	h.Log.Debug("invalidating cached consul client", "addr", newAddr)
+
+	h.clientsLock.Lock()
+	defer h.clientsLock.Unlock()
+	key := clientCacheKey(newAddr, h.getConsulNamespace(pod))
+	delete(h.clients, key)
+	delete(h.clientTokens, key)
+}
+
+// clientCacheKey returns the key used to cache the client for the agent at addr.
+// The Consul namespace is part of the key because it is set on the client's config.
+func clientCacheKey(addr, consulNamespace string) string {
+	return fmt.Sprintf("%s/%s", addr, consulNamespace)
+}
+
+// isConnectionErr returns true if err was caused by being unable to connect
+// to the Consul agent, as opposed to an error returned by the agent itself.
+func isConnectionErr(err error) bool {
+	// Errors returned by rateLimitTransport are wrapped in a *url.Error too.
+	if rateLimited, _ := isRateLimitErr(err); rateLimited {
+		return false
+	}
+	var urlErr *url.Error
+	var opErr *net.OpError
+	return errors.As(err, &urlErr) || errors.As(err, &opErr)
 }
 
 // shouldProcess is a simple filter which determines if Upsert or Reconcile should attempt to process the pod.
 // This is done without making any client api calls so it is fast.
 func (h *HealthCheckResource) shouldProcess(pod *corev1.Pod) bool {
-	if pod.Annotations[annotationStatus] != injected {
+	if !h.namespaceAllowed(pod.Namespace) {
+		return false
+	}
+
+	// Pods that aren't injected are only processed if they're registered
+	// as plain Consul services.
+	isInjected := pod.Annotations[annotationStatus] == injected
+	if !isInjected && pod.Annotations[annotationServiceName] == "" {
 		return false
 	}
 
@@ -319,6 +1316,12 @@ func (h *HealthCheckResource) shouldProcess(pod *corev1.Pod) bool {
 		// registered yet.
 	}
 
+	// Plain Consul services aren't registered by the injection init container
+	// so there is nothing to wait for.
+	if !isInjected {
+		return true
+	}
+
 	// We process any pod that has had its injection init container completed because
 	// this means the service instance has been registered with Consul and so we can
 	// and should set its health check status. If we don't set the health check
@@ -332,13 +1335,332 @@ func (h *HealthCheckResource) shouldProcess(pod *corev1.Pod) bool {
 	return false
 }
 
+// healthSyncEnabled returns false if the pod opted out of having its health
+// check managed with the annotationHealthSync annotation. An annotation that
+// can't be parsed is ignored.
+func (h *HealthCheckResource) healthSyncEnabled(pod *corev1.Pod) bool {
+	raw, ok := pod.Annotations[annotationHealthSync]
+	if !ok {
+		return true
+	}
+	enabled, err := strconv.ParseBool(raw)
+	if err != nil {
+		h.Log.Warn("ignoring invalid annotation", "name", pod.Name, "namespace", pod.Namespace,
+			"annotation", annotationHealthSync, "value", raw)
+		return true
+	}
+	return enabled
+}
+
+// healthCheckNote returns the note of the pod's health check set with the
+// annotationHealthCheckNote annotation, if any.
+func (h *HealthCheckResource) healthCheckNote(pod *corev1.Pod) string {
+	return pod.Annotations[annotationHealthCheckNote]
+}
+
+// checkNotes returns the notes of the pod's health check: its metadata,
+// including the fingerprint of the parameters it's registered with, followed
+// by the note of its annotationHealthCheckNote annotation.
+func (h *HealthCheckResource) checkNotes(pod *corev1.Pod, deregisterAfter string) string {
+	meta := podCheckMetadata(pod)
+	meta.Config = checkConfigFingerprint(h.ttl(), h.successBeforePassing(), h.failuresBeforeCritical(), deregisterAfter)
+	return encodeCheckNotes(meta, h.healthCheckNote(pod))
+}
+
+// deregisterCriticalServiceAfter returns the DeregisterCriticalServiceAfter of
+// the pod's health check. The pod's annotation takes precedence over the
+// global setting unless it isn't a valid duration, in which case it's logged
+// and ignored rather than failing the registration.
+func (h *HealthCheckResource) deregisterCriticalServiceAfter(pod *corev1.Pod) string {
+	raw, ok := pod.Annotations[annotationDeregisterCriticalAfter]
+	if !ok {
+		return h.DeregisterCriticalServiceAfter
+	}
+	if d, err := time.ParseDuration(raw); err != nil || d < 0 {
+		h.Log.Warn("ignoring invalid annotation, using the default", "name", pod.Name, "namespace", pod.Namespace,
+			"annotation", annotationDeregisterCriticalAfter, "value", raw, "default", h.DeregisterCriticalServiceAfter)
+		return h.DeregisterCriticalServiceAfter
+	}
+	return raw
+}
+
+// getMetrics returns the health check metrics, creating and registering them
+// on first use.
+func (h *HealthCheckResource) getMetrics() *healthCheckMetrics {
+	h.metricsOnce.Do(func() {
+		h.metrics = newHealthCheckMetrics(h.MetricsRegistry)
+	})
+	return h.metrics
+}
+
+// getBreaker returns the circuit breaker of the Consul agents, creating it
+// on first use. It returns nil if AgentFailureThreshold is 0.
+func (h *HealthCheckResource) getBreaker() *agentBreaker {
+	h.breakerOnce.Do(func() {
+		if h.AgentFailureThreshold <= 0 {
+			return
+		}
+		cooldown := h.AgentFailureCooldown
+		if cooldown <= 0 {
+			cooldown = DefaultAgentFailureCooldown
+		}
+		h.breaker = newAgentBreaker(h.AgentFailureThreshold, cooldown, h.getClock(), func(host string, open bool) {
+			state := "closed"
+			if open {
+				state = "open"
+				h.Log.Warn("Consul agent keeps failing, pausing its pods", "host", host, "cooldown", cooldown)
+			} else {
+				h.Log.Info("Consul agent recovered, resuming its pods", "host", host)
+			}
+			h.getMetrics().agentBreakerTransitions.WithLabelValues(state).Inc()
+		})
+	})
+	return h.breaker
+}
+
+// getClock returns Clock, or the real clock if it isn't set.
+func (h *HealthCheckResource) getClock() clock.Clock {
+	if h.Clock == nil {
+		return clock.RealClock{}
+	}
+	return h.Clock
+}
+
+// getBatcher returns the batcher of the status updates, creating it on first
+// use. It returns nil if StatusBatchWindow is 0.
+func (h *HealthCheckResource) getBatcher() *statusBatcher {
+	h.batcherOnce.Do(func() {
+		if h.StatusBatchWindow <= 0 {
+			return
+		}
+		h.batcher = newStatusBatcher(h.StatusBatchWindow, h.getClock())
+	})
+	return h.batcher
+}
+
+// getLogLimiter returns the limiter of the error logs, creating it on first
+// use. It returns nil if ErrorLogWindow is 0.
+func (h *HealthCheckResource) getLogLimiter() *errorLogLimiter {
+	h.logLimiterOnce.Do(func() {
+		if h.ErrorLogWindow > 0 {
+			h.logLimiter = newErrorLogLimiter(h.ErrorLogWindow, h.getClock())
+		}
+	})
+	return h.logLimiter
+}
+
+// logError logs msg with err unless an identical error was logged within
+// ErrorLogWindow.
+func (h *HealthCheckResource) logError(msg string, err error, args ...interface{}) {
+	args = append(args, "err", err)
+	if limiter := h.getLogLimiter(); limiter != nil {
+		allowed, suppressed := limiter.allow(msg + ": " + err.Error())
+		if !allowed {
+			return
+		}
+		if suppressed > 0 {
+			args = append(args, "similar-errors-suppressed", suppressed)
+		}
+	}
+	h.Log.Error(msg, args...)
+}
+
+// agentAllowed returns whether the Consul agent of the pod may be called
+// and, if it may not, the remaining cooldown of its breaker.
+func (h *HealthCheckResource) agentAllowed(pod *corev1.Pod) (bool, time.Duration) {
+	breaker := h.getBreaker()
+	if breaker == nil {
+		return true, 0
+	}
+	return breaker.allow(h.agentHost(pod))
+}
+
+// recordAgentResult records the outcome of processing the pod with the
+// breaker of its Consul agent. Only connection errors count as failures of
+// the agent.
+func (h *HealthCheckResource) recordAgentResult(pod *corev1.Pod, err error) {
+	breaker := h.getBreaker()
+	if breaker == nil {
+		return
+	}
+	if isConnectionErr(err) {
+		breaker.failure(h.agentHost(pod))
+	} else if err == nil {
+		breaker.success(h.agentHost(pod))
+	} else {
+		breaker.release(h.agentHost(pod))
+	}
+}
+
+// agentHost returns the host of the pod's Consul agent, which identifies
+// the agent's breaker.
+func (h *HealthCheckResource) agentHost(pod *corev1.Pod) string {
+	if h.Agentless {
+		return h.ConsulUrl.Host
+	}
+	return pod.Status.HostIP
+}
+
+// getConsulNamespace returns the Consul namespace that the pod's service, and
+// therefore its health check, is registered in. It is always empty if Consul
+// namespaces are not enabled. The namespace the injector annotated the pod
+// with takes precedence, otherwise it is mapped from the pod's Kubernetes
+// namespace the same way the injector does.
+func (h *HealthCheckResource) getConsulNamespace(pod *corev1.Pod) string {
+	if !h.EnableConsulNamespaces {
+		return ""
+	}
+	if ns, ok := pod.Annotations[annotationConsulNamespace]; ok {
+		return ns
+	}
+	return namespaces.ConsulNamespace(pod.Namespace, h.EnableConsulNamespaces, h.ConsulDestinationNamespace, h.EnableNSMirroring, h.NSMirroringPrefix)
+}
+
+// ttl returns the TTL of the registered health checks.
+func (h *HealthCheckResource) ttl() string {
+	if h.TTL == "" {
+		return DefaultHealthCheckTTL
+	}
+	return h.TTL
+}
+
+// rateLimitBackoff returns the delay before a pod whose Consul agent rate
+// limited the requests is retried. The agent's Retry-After takes precedence.
+func (h *HealthCheckResource) rateLimitBackoff(retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	if h.RateLimitBackoff <= 0 {
+		return DefaultRateLimitBackoff
+	}
+	return h.RateLimitBackoff
+}
+
+// connectionRetryDelay returns the base delay between retries of a pod
+// whose Consul agent couldn't be reached.
+func (h *HealthCheckResource) connectionRetryDelay() time.Duration {
+	if h.ConnectionRetryDelay <= 0 {
+		return DefaultConnectionRetryDelay
+	}
+	return h.ConnectionRetryDelay
+}
+
+// successBeforePassing returns the number of consecutive passing updates
+// needed for a health check to become passing.
+func (h *HealthCheckResource) successBeforePassing() int {
+	if h.SuccessBeforePassing <= 0 {
+		return 1
+	}
+	return h.SuccessBeforePassing
+}
+
+// failuresBeforeCritical returns the number of consecutive critical updates
+// needed for a health check to become critical.
+func (h *HealthCheckResource) failuresBeforeCritical() int {
+	if h.FailuresBeforeCritical <= 0 {
+		return 1
+	}
+	return h.FailuresBeforeCritical
+}
+
+// truncateReason truncates reason to MaxReasonLength bytes, ending it with
+// an ellipsis if it was truncated. It doesn't split multi-byte characters.
+func (h *HealthCheckResource) truncateReason(reason string) string {
+	maxLen := h.MaxReasonLength
+	if maxLen <= 0 {
+		maxLen = DefaultHealthCheckMaxReasonLength
+	}
+	if len(reason) <= maxLen {
+		return reason
+	}
+	suffix := reasonEllipsis
+	if maxLen <= len(suffix) {
+		suffix = ""
+	}
+	cut := maxLen - len(suffix)
+	for cut > 0 && !utf8.RuneStart(reason[cut]) {
+		cut--
+	}
+	return reason[:cut] + suffix
+}
+
+// namespaces returns the Kubernetes namespaces to watch pods in.
+func (h *HealthCheckResource) namespaces() []string {
+	if h.NamespaceSelector != nil {
+		return h.selectedNamespaces()
+	}
+	if len(h.Namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return h.Namespaces
+}
+
+// readyConditions returns the types of the pod conditions that must be True
+// for the health check to pass.
+func (h *HealthCheckResource) readyConditions() []corev1.PodConditionType {
+	if len(h.ReadyConditions) == 0 {
+		return []corev1.PodConditionType{corev1.PodReady}
+	}
+	return h.ReadyConditions
+}
+
+// labelSelector returns the label selector used to list and watch pods.
+func (h *HealthCheckResource) labelSelector() string {
+	if h.HealthCheckLabel == "" {
+		return labelInject
+	}
+	return h.HealthCheckLabel
+}
+
+// hasHealthCheckLabel returns true if the pod matches the label selector of
+// the watched pods.
+func (h *HealthCheckResource) hasHealthCheckLabel(pod *corev1.Pod) bool {
+	selector, err := labels.Parse(h.labelSelector())
+	if err != nil {
+		// The informers can't watch the pods with an invalid selector
+		// either, so don't deregister anything because of it.
+		return true
+	}
+	return selector.Matches(labels.Set(pod.Labels))
+}
+
+// fieldSelector returns the field selector of the watched pods. It selects
+// the pods on NodeName if it is set and all pods otherwise.
+func (h *HealthCheckResource) fieldSelector() string {
+	if h.NodeName == "" {
+		return ""
+	}
+	return fields.OneTermEqualSelector("spec.nodeName", h.NodeName).String()
+}
+
 // getConsulHealthCheckID deterministically generates a health check ID that will be unique to the Agent
-// where the health check is registered and deregistered.
+// where the health check is registered and deregistered. The ID always includes the pod's namespace
+// since pod names are only unique within a namespace.
 func (h *HealthCheckResource) getConsulHealthCheckID(pod *corev1.Pod) string {
-	return fmt.Sprintf("%s/%s/kubernetes-health-check", pod.Namespace, h.getConsulServiceID(pod))
+	id := fmt.Sprintf("%s/%s/%s", pod.Namespace, h.getConsulServiceID(pod), healthCheckIDSuffix)
+	if h.HealthCheckIDPrefix != "" {
+		return fmt.Sprintf("%s/%s", h.HealthCheckIDPrefix, id)
+	}
+	return id
 }
 
-// getConsulServiceID returns the serviceID of the connect service.
+// getConsulHealthCheckName returns the human readable name of the pod's
+// health check, e.g. "Kubernetes Readiness: web".
+func (h *HealthCheckResource) getConsulHealthCheckName(pod *corev1.Pod) string {
+	return healthCheckNamePrefix + h.getConsulServiceName(pod)
+}
+
+// getConsulServiceID returns the serviceID of the pod's service.
 func (h *HealthCheckResource) getConsulServiceID(pod *corev1.Pod) string {
-	return fmt.Sprintf("%s-%s", pod.Name, pod.Annotations[annotationService])
+	return fmt.Sprintf("%s-%s", pod.Name, h.getConsulServiceName(pod))
+}
+
+// getConsulServiceName returns the name of the pod's service. This is the
+// connect service if the pod is part of the service mesh and falls back to
+// the plain Consul service otherwise. It is empty if the pod has neither.
+func (h *HealthCheckResource) getConsulServiceName(pod *corev1.Pod) string {
+	if name := pod.Annotations[annotationService]; name != "" {
+		return name
+	}
+	return pod.Annotations[annotationServiceName]
 }
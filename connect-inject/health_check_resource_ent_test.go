@@ -3,6 +3,7 @@
 package connectinject
 
 import (
+	"context"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -70,7 +71,7 @@ func TestReconcilePodWithNamespace(t *testing.T) {
 			Expected: &api.AgentCheck{
 				CheckID:   testNamespacedHealthCheckID,
 				Status:    api.HealthPassing,
-				Notes:     "",
+				Notes:     encodeCheckNotes(checkMetadata{Namespace: testNamespace, ManagedBy: checkManagedBy}, ""),
 				Output:    kubernetesSuccessReasonMsg,
 				Type:      ttl,
 				Name:      name,
@@ -107,7 +108,7 @@ func TestReconcilePodWithNamespace(t *testing.T) {
 			Expected: &api.AgentCheck{
 				CheckID:   testNamespacedHealthCheckID,
 				Status:    api.HealthCritical,
-				Notes:     "",
+				Notes:     encodeCheckNotes(checkMetadata{Namespace: testNamespace, ManagedBy: checkManagedBy}, ""),
 				Output:    testFailureMessage,
 				Type:      ttl,
 				Name:      name,
@@ -278,7 +279,7 @@ func TestReconcilePodWithNamespace(t *testing.T) {
 				registerHealthCheck(t, client, tt.InitialState)
 			}
 			// Upsert and Reconcile both use reconcilePod to reconcile a pod.
-			err = resource.reconcilePod(tt.Pod)
+			err = resource.reconcilePod(context.Background(), tt.Pod)
 			require.NoError(err)
 			// Get the agent checks if they were registered.
 			actual := getConsulAgentChecks(t, client, tt.Expected.CheckID)
@@ -1,23 +1,42 @@
 package connectinject
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hashicorp/consul-k8s/subcommand/common"
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/consul/sdk/freeport"
 	"github.com/hashicorp/consul/sdk/testutil"
 	"github.com/hashicorp/consul/sdk/testutil/retry"
 	"github.com/hashicorp/go-hclog"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
@@ -28,7 +47,14 @@ const (
 	testFailureMessage        = "Kubernetes pod readiness probe failed"
 	testCheckNotesPassing     = "Kubernetes health checks passing"
 	ttl                       = "ttl"
-	name                      = "Kubernetes Health Check"
+	name                      = "Kubernetes Readiness: test-service"
+)
+
+var (
+	// testCheckConfig is the Config metadata of the checks registered with
+	// the default parameters.
+	testCheckConfig        = checkConfigFingerprint(DefaultHealthCheckTTL, 1, 1, "")
+	testCheckNotesMetadata = "k8s-ns=default;k8s-node=;managed-by=consul-k8s-healthcheck;check-config=" + testCheckConfig
 )
 
 // Used by gocmp.
@@ -57,7 +83,7 @@ var completedInjectInitContainer = []corev1.ContainerStatus{
 func registerHealthCheck(t *testing.T, client *api.Client, initialState string) {
 	require := require.New(t)
 	err := client.Agent().CheckRegister(&api.AgentCheckRegistration{
-		Name:      "Kubernetes Health Check",
+		Name:      name,
 		ID:        testHealthCheckID,
 		ServiceID: testServiceNameReg,
 		Notes:     "",
@@ -116,7 +142,7 @@ func TestReconcilePod(t *testing.T) {
 			&api.AgentCheck{
 				CheckID: testHealthCheckID,
 				Status:  api.HealthCritical,
-				Notes:   "",
+				Notes:   testCheckNotesMetadata,
 				Output:  "Pod is pending",
 				Type:    ttl,
 				Name:    name,
@@ -151,7 +177,7 @@ func TestReconcilePod(t *testing.T) {
 			&api.AgentCheck{
 				CheckID: testHealthCheckID,
 				Status:  api.HealthPassing,
-				Notes:   "",
+				Notes:   testCheckNotesMetadata,
 				Output:  kubernetesSuccessReasonMsg,
 				Type:    ttl,
 				Name:    name,
@@ -187,7 +213,7 @@ func TestReconcilePod(t *testing.T) {
 			&api.AgentCheck{
 				CheckID: testHealthCheckID,
 				Status:  api.HealthCritical,
-				Notes:   "",
+				Notes:   testCheckNotesMetadata,
 				Output:  testFailureMessage,
 				Type:    ttl,
 				Name:    name,
@@ -356,7 +382,7 @@ func TestReconcilePod(t *testing.T) {
 				registerHealthCheck(t, client, tt.InitialState)
 			}
 			// Upsert and Reconcile both use reconcilePod to reconcile a pod.
-			err = resource.reconcilePod(tt.Pod)
+			err = resource.reconcilePod(context.Background(), tt.Pod)
 			// If we're expecting any error from reconcilePod.
 			if tt.Err != "" {
 				// used in the cases where we're expecting an error from
@@ -409,6 +435,206 @@ func TestUpsert_PodWithNoService(t *testing.T) {
 	require.Nil(err)
 }
 
+// Test that a pod that isn't ready when it's first seen has its health check
+// registered as critical rather than passing.
+func TestUpsert_PodNotReady(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testPodName,
+			Namespace: "default",
+			Labels:    map[string]string{labelInject: "true"},
+			Annotations: map[string]string{
+				annotationStatus:  injected,
+				annotationService: testServiceNameAnnotation,
+			},
+		},
+		Spec: testPodSpec,
+		Status: corev1.PodStatus{
+			HostIP:                "127.0.0.1",
+			Phase:                 corev1.PodRunning,
+			InitContainerStatuses: completedInjectInitContainer,
+			Conditions: []corev1.PodCondition{{
+				Type:    corev1.PodReady,
+				Status:  corev1.ConditionFalse,
+				Message: testFailureMessage,
+			}},
+		},
+	}
+	server, client, resource := testServerAgentResourceAndController(t, pod)
+	defer server.Stop()
+	server.AddService(t, testServiceNameReg, api.HealthPassing, nil)
+
+	require.NoError(resource.Upsert("", pod))
+
+	actual := getConsulAgentChecks(t, client, testHealthCheckID)
+	require.NotNil(actual)
+	require.Equal(api.HealthCritical, actual.Status)
+	require.Equal(testFailureMessage, actual.Output)
+}
+
+// Test that health checks are registered for pods of connect services and of
+// plain Consul services, and that pods with neither annotation are skipped.
+func TestUpsert_ServiceAnnotations(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		Annotations   map[string]string
+		InitStatuses  []corev1.ContainerStatus
+		ExpRegistered bool
+	}{
+		"connect service": {
+			Annotations: map[string]string{
+				annotationStatus:  injected,
+				annotationService: testServiceNameAnnotation,
+			},
+			InitStatuses:  completedInjectInitContainer,
+			ExpRegistered: true,
+		},
+		"plain Consul service": {
+			Annotations: map[string]string{
+				annotationServiceName: testServiceNameAnnotation,
+			},
+			InitStatuses:  nil,
+			ExpRegistered: true,
+		},
+		"no service annotation": {
+			Annotations: map[string]string{
+				annotationStatus: injected,
+			},
+			InitStatuses:  completedInjectInitContainer,
+			ExpRegistered: false,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        testPodName,
+					Namespace:   "default",
+					Labels:      map[string]string{labelInject: "true"},
+					Annotations: c.Annotations,
+				},
+				Spec: testPodSpec,
+				Status: corev1.PodStatus{
+					HostIP:                "127.0.0.1",
+					Phase:                 corev1.PodRunning,
+					InitContainerStatuses: c.InitStatuses,
+					Conditions: []corev1.PodCondition{{
+						Type:   corev1.PodReady,
+						Status: corev1.ConditionTrue,
+					}},
+				},
+			}
+			server, client, resource := testServerAgentResourceAndController(t, pod)
+			defer server.Stop()
+			server.AddService(t, testServiceNameReg, api.HealthPassing, nil)
+
+			require.NoError(resource.Upsert("", pod))
+
+			actual := getConsulAgentChecks(t, client, testHealthCheckID)
+			if c.ExpRegistered {
+				require.NotNil(actual)
+				require.Equal(api.HealthPassing, actual.Status)
+			} else {
+				require.Nil(actual)
+			}
+		})
+	}
+}
+
+// Test that Delete deregisters the pod's health check and ignores health
+// checks that were already deregistered.
+func TestDelete(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testPodName,
+			Namespace: "default",
+			Labels:    map[string]string{labelInject: "true"},
+			Annotations: map[string]string{
+				annotationStatus:  injected,
+				annotationService: testServiceNameAnnotation,
+			},
+		},
+		Spec: testPodSpec,
+		Status: corev1.PodStatus{
+			HostIP:                "127.0.0.1",
+			Phase:                 corev1.PodRunning,
+			InitContainerStatuses: completedInjectInitContainer,
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+	server, client, resource := testServerAgentResourceAndController(t, pod)
+	defer server.Stop()
+	server.AddService(t, testServiceNameReg, api.HealthPassing, nil)
+	require.NoError(resource.Upsert("", pod))
+	require.NotNil(getConsulAgentChecks(t, client, testHealthCheckID))
+
+	require.NoError(resource.Delete("", pod))
+	require.Nil(getConsulAgentChecks(t, client, testHealthCheckID))
+
+	// Deleting again, e.g. after the preStop hook deregistered the service,
+	// isn't an error.
+	require.NoError(resource.Delete("", pod))
+}
+
+// Test that the pod's name and namespace are logged as fields when it's
+// reconciled.
+func TestReconcile_LogsPodFields(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testPodName,
+			Namespace: "default",
+			Labels:    map[string]string{labelInject: "true"},
+			Annotations: map[string]string{
+				annotationStatus:  injected,
+				annotationService: testServiceNameAnnotation,
+			},
+		},
+		Spec: testPodSpec,
+		Status: corev1.PodStatus{
+			HostIP:                "127.0.0.1",
+			Phase:                 corev1.PodRunning,
+			InitContainerStatuses: completedInjectInitContainer,
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+	server, _, resource := testServerAgentResourceAndController(t, pod)
+	defer server.Stop()
+	server.AddService(t, testServiceNameReg, api.HealthPassing, nil)
+	var buf bytes.Buffer
+	resource.Log = hclog.New(&hclog.LoggerOptions{
+		Output:     &buf,
+		Level:      hclog.Debug,
+		JSONFormat: true,
+	})
+
+	require.NoError(resource.Reconcile())
+
+	var found bool
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		require.NoError(json.Unmarshal([]byte(line), &entry))
+		if entry["@message"] == "processing pod" {
+			found = true
+			require.Equal(testPodName, entry["name"])
+			require.Equal("default", entry["namespace"])
+		}
+	}
+	require.True(found, "no log line for processing the pod: %s", buf.String())
+}
+
 func TestReconcile_IgnorePodsWithoutInjectLabel(t *testing.T) {
 	t.Parallel()
 	require := require.New(t)
@@ -613,7 +839,7 @@ func TestReconcile_IgnoreStatuses(t *testing.T) {
 			// We would expect an error if the reconciler actually tried to
 			// register a health check because the underlying service hasn't
 			// been created.
-			require.NoError(resource.reconcilePod(pod))
+			require.NoError(resource.reconcilePod(context.Background(), pod))
 		})
 	}
 }
@@ -771,10 +997,11 @@ func testServerAgentResourceAndControllerWithConsulNS(t *testing.T, pod *corev1.
 	require.NoError(err)
 
 	healthResource := HealthCheckResource{
-		Log:                 hclog.Default().Named("healthCheckResource"),
-		KubernetesClientset: fake.NewSimpleClientset(pod),
-		ConsulUrl:           consulUrl,
-		ReconcilePeriod:     0,
+		Log:                    hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset:    fake.NewSimpleClientset(pod),
+		ConsulUrl:              consulUrl,
+		ReconcilePeriod:        0,
+		EnableConsulNamespaces: consulNS != "",
 	}
 	return s, client, &healthResource
 }
@@ -810,3 +1037,1258 @@ var unreadyAppContainers = []corev1.ContainerStatus{
 		Ready: false,
 	},
 }
+
+// Test that pods on the same host share a Consul client and pods on
+// different hosts don't.
+func TestGetConsulClient_CachedPerHost(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	consulUrl, err := url.Parse("http://127.0.0.1:8500")
+	require.NoError(err)
+	resource := HealthCheckResource{
+		Log:       hclog.Default().Named("healthCheckResource"),
+		ConsulUrl: consulUrl,
+	}
+
+	podOnHost := func(name, hostIP string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Status:     corev1.PodStatus{HostIP: hostIP},
+		}
+	}
+
+	client1, err := resource.getConsulClient(podOnHost("pod1", "10.0.0.1"))
+	require.NoError(err)
+	client2, err := resource.getConsulClient(podOnHost("pod2", "10.0.0.1"))
+	require.NoError(err)
+	client3, err := resource.getConsulClient(podOnHost("pod3", "10.0.0.2"))
+	require.NoError(err)
+
+	require.True(client1 == client2, "expected pods on the same host to share a client")
+	require.False(client1 == client3, "expected pods on different hosts to use different clients")
+	require.Len(resource.clients, 2)
+}
+
+// Test that in agentless mode all pods share the client of the Consul
+// address regardless of their host.
+func TestGetConsulClient_Agentless(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	consulUrl, err := url.Parse("http://consul-server.consul:8500")
+	require.NoError(err)
+	resource := HealthCheckResource{
+		Log:       hclog.Default().Named("healthCheckResource"),
+		ConsulUrl: consulUrl,
+		Agentless: true,
+	}
+
+	pods := []*corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "default"},
+			Status:     corev1.PodStatus{HostIP: "10.0.0.1"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pod2",
+				Namespace:   "default",
+				Annotations: map[string]string{annotationConsulAPIPort: "18500"},
+			},
+			Status: corev1.PodStatus{HostIP: "10.0.0.2"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod3", Namespace: "default"},
+		},
+	}
+	for _, pod := range pods {
+		_, err := resource.getConsulClient(pod)
+		require.NoError(err)
+		require.False(resource.missingHostIP(pod))
+		require.Equal("consul-server.consul:8500", resource.agentHost(pod))
+	}
+	require.Len(resource.clients, 1)
+	require.Contains(resource.clients, clientCacheKey("http://consul-server.consul:8500", ""))
+}
+
+func TestTruncateReason(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		MaxLength int
+		Reason    string
+		Exp       string
+	}{
+		"short reason": {
+			Reason: "pod is not ready",
+			Exp:    "pod is not ready",
+		},
+		"long reason uses default max length": {
+			Reason: strings.Repeat("a", 2048),
+			Exp:    strings.Repeat("a", DefaultHealthCheckMaxReasonLength-3) + "...",
+		},
+		"reason of max length": {
+			MaxLength: 5,
+			Reason:    "abcde",
+			Exp:       "abcde",
+		},
+		"reason longer than max length": {
+			MaxLength: 5,
+			Reason:    "abcdef",
+			Exp:       "ab...",
+		},
+		"max length shorter than ellipsis": {
+			MaxLength: 2,
+			Reason:    "abcdef",
+			Exp:       "ab",
+		},
+		"multi-byte characters are not split": {
+			MaxLength: 7,
+			Reason:    "aéééé",
+			Exp:       "aé...",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			resource := HealthCheckResource{MaxReasonLength: c.MaxLength}
+			require.Equal(t, c.Exp, resource.truncateReason(c.Reason))
+		})
+	}
+}
+
+// Test that concurrent workers handling pods on different hosts always talk
+// to the agent on the pod's host, even while cached clients are invalidated.
+func TestGetConsulAgent_ConcurrentPerHost(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	const numHosts, numWorkers, numIterations = 4, 8, 25
+
+	// Each host is a different loopback address with an agent listening on
+	// the same port.
+	port := freeport.MustTake(1)[0]
+	defer freeport.Return([]int{port})
+	var requests, misrouted [numHosts]int64
+	for i := 0; i < numHosts; i++ {
+		i := i
+		hostIP := fmt.Sprintf("127.0.0.%d", i+1)
+		listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", hostIP, port))
+		require.NoError(err)
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&requests[i], 1)
+			if !strings.Contains(r.URL.Query().Get("filter"), hostIP+"-") {
+				atomic.AddInt64(&misrouted[i], 1)
+			}
+			w.Write([]byte("{}"))
+		}))
+		server.Listener.Close()
+		server.Listener = listener
+		server.Start()
+		defer server.Close()
+	}
+
+	consulUrl, err := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", port))
+	require.NoError(err)
+	resource := HealthCheckResource{
+		Log:       hclog.Default().Named("healthCheckResource"),
+		ConsulUrl: consulUrl,
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, numWorkers*numIterations*numHosts)
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for n := 0; n < numIterations; n++ {
+				for i := 0; i < numHosts; i++ {
+					hostIP := fmt.Sprintf("127.0.0.%d", i+1)
+					pod := &corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-pod-%d", hostIP, w), Namespace: "default"},
+						Status:     corev1.PodStatus{HostIP: hostIP},
+					}
+					agent, err := resource.getConsulAgent(pod)
+					if err != nil {
+						errCh <- err
+						continue
+					}
+					if _, err := agent.Checks(context.Background(), fmt.Sprintf("CheckID == `%s`", pod.Name)); err != nil {
+						errCh <- err
+					}
+					// Invalidate clients while other workers use them as
+					// happens after connection errors.
+					if n%5 == 0 {
+						resource.invalidateConsulClient(pod)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		require.NoError(err)
+	}
+
+	for i := 0; i < numHosts; i++ {
+		require.Equal(int64(numWorkers*numIterations), atomic.LoadInt64(&requests[i]), "host %d", i)
+		require.Zero(atomic.LoadInt64(&misrouted[i]), "host %d", i)
+	}
+}
+
+// Test that the sweep deregisters the health check of a deleted pod from a
+// Consul agent.
+func TestSweepOrphanedChecks(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := testFakeAgentPod(testPodName, true)
+	server, client, resource := testServerAgentResourceAndController(t, pod)
+	defer server.Stop()
+	resource.Ctx = context.Background()
+	server.AddService(t, testServiceNameReg, api.HealthPassing, nil)
+
+	// Register the pod's health check, which also creates the agent's client.
+	require.NoError(resource.Reconcile())
+	require.NotNil(getConsulAgentChecks(t, client, testHealthCheckID))
+
+	// The check isn't deregistered while the pod exists.
+	require.NoError(resource.SweepOrphanedChecks())
+	require.NotNil(getConsulAgentChecks(t, client, testHealthCheckID))
+
+	// Delete the pod without the controller seeing the event.
+	require.NoError(resource.KubernetesClientset.CoreV1().Pods(pod.Namespace).Delete(context.Background(), pod.Name, metav1.DeleteOptions{}))
+	require.NoError(resource.SweepOrphanedChecks())
+	require.Nil(getConsulAgentChecks(t, client, testHealthCheckID))
+}
+
+// Test that the clients use the token in the token file and that a rotated
+// token is picked up.
+func TestGetConsulClient_TokenFile(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	var lock sync.Mutex
+	var tokens []string
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		tokens = append(tokens, r.Header.Get("X-Consul-Token"))
+		lock.Unlock()
+		w.Write([]byte("{}"))
+	}))
+	defer agent.Close()
+	consulUrl, err := url.Parse(agent.URL)
+	require.NoError(err)
+
+	tokenFile, err := ioutil.TempFile("", "token")
+	require.NoError(err)
+	defer os.Remove(tokenFile.Name())
+	require.NoError(ioutil.WriteFile(tokenFile.Name(), []byte("token-1\n"), 0600))
+
+	resource := HealthCheckResource{
+		Log:       hclog.Default().Named("healthCheckResource"),
+		ConsulUrl: consulUrl,
+		Token:     "ignored",
+		TokenFile: tokenFile.Name(),
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: testPodName, Namespace: "default"},
+		Status:     corev1.PodStatus{HostIP: "127.0.0.1"},
+	}
+
+	client, err := resource.getConsulClient(pod)
+	require.NoError(err)
+	_, err = (&apiAgent{client: client}).Checks(context.Background(), "")
+	require.NoError(err)
+
+	// Rotate the token.
+	require.NoError(ioutil.WriteFile(tokenFile.Name(), []byte("token-2\n"), 0600))
+	client, err = resource.getConsulClient(pod)
+	require.NoError(err)
+	_, err = (&apiAgent{client: client}).Checks(context.Background(), "")
+	require.NoError(err)
+	require.Len(resource.clients, 1)
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Equal([]string{"token-1", "token-2"}, tokens)
+}
+
+// Test that the clients of the pods in a Consul namespace with its own ACL
+// token use that token and that the other clients use the default token.
+func TestGetConsulClient_NamespaceTokens(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	var lock sync.Mutex
+	tokens := make(map[string]string)
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		tokens[r.URL.Query().Get("ns")] = r.Header.Get("X-Consul-Token")
+		lock.Unlock()
+		w.Write([]byte("{}"))
+	}))
+	defer agent.Close()
+	consulUrl, err := url.Parse(agent.URL)
+	require.NoError(err)
+
+	tokensDir, err := ioutil.TempDir("", "tokens")
+	require.NoError(err)
+	defer os.RemoveAll(tokensDir)
+	require.NoError(ioutil.WriteFile(filepath.Join(tokensDir, "ns-b"), []byte("token-b\n"), 0600))
+
+	resource := HealthCheckResource{
+		Log:                    hclog.Default().Named("healthCheckResource"),
+		ConsulUrl:              consulUrl,
+		Token:                  "default-token",
+		EnableConsulNamespaces: true,
+		NamespaceTokens:        map[string]string{"ns-a": "token-a", "ns-b": "ignored"},
+		NamespaceTokensDir:     tokensDir,
+	}
+	for _, ns := range []string{"ns-a", "ns-b", "ns-c"} {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        testPodName,
+				Namespace:   "default",
+				Annotations: map[string]string{annotationConsulNamespace: ns},
+			},
+			Status: corev1.PodStatus{HostIP: "127.0.0.1"},
+		}
+		client, err := resource.getConsulClient(pod)
+		require.NoError(err)
+		_, err = (&apiAgent{client: client}).Checks(context.Background(), "")
+		require.NoError(err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Equal(map[string]string{
+		"ns-a": "token-a",
+		"ns-b": "token-b",
+		"ns-c": "default-token",
+	}, tokens)
+}
+
+// Test that the agent's port is taken from the pod's annotation if set, and
+// that the scheme is taken from the configured Consul address.
+func TestGetConsulAgentAddr(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		ConsulUrl   string
+		NodeName    string
+		Agentless   bool
+		NoHostIP    bool
+		Annotations map[string]string
+		Expected    string
+		ExpErr      string
+	}{
+		"http": {
+			ConsulUrl: "http://localhost:8500",
+			Expected:  "http://10.0.0.1:8500",
+		},
+		"https": {
+			ConsulUrl: "https://localhost:8501",
+			Expected:  "https://10.0.0.1:8501",
+		},
+		"annotation overrides port": {
+			ConsulUrl:   "https://localhost:8501",
+			Annotations: map[string]string{annotationConsulAPIPort: "18501"},
+			Expected:    "https://10.0.0.1:18501",
+		},
+		"invalid annotation": {
+			ConsulUrl:   "http://localhost:8500",
+			Annotations: map[string]string{annotationConsulAPIPort: "http"},
+			ExpErr:      `invalid consul.hashicorp.com/consul-api-port annotation "http": must be a port number`,
+		},
+		"annotation out of range": {
+			ConsulUrl:   "http://localhost:8500",
+			Annotations: map[string]string{annotationConsulAPIPort: "70000"},
+			ExpErr:      `invalid consul.hashicorp.com/consul-api-port annotation "70000": must be a port number`,
+		},
+		"node name uses the Consul URL host": {
+			ConsulUrl: "http://10.0.0.5:8500",
+			NodeName:  "node-1",
+			Expected:  "http://10.0.0.5:8500",
+		},
+		"node name with annotation": {
+			ConsulUrl:   "http://10.0.0.5:8500",
+			NodeName:    "node-1",
+			Annotations: map[string]string{annotationConsulAPIPort: "18500"},
+			Expected:    "http://10.0.0.5:18500",
+		},
+		"agentless uses the Consul URL": {
+			ConsulUrl: "https://consul-server.consul:8501",
+			Agentless: true,
+			Expected:  "https://consul-server.consul:8501",
+		},
+		"agentless ignores annotation": {
+			ConsulUrl:   "http://consul-server.consul:8500",
+			Agentless:   true,
+			Annotations: map[string]string{annotationConsulAPIPort: "18500"},
+			Expected:    "http://consul-server.consul:8500",
+		},
+		"agentless without host IP": {
+			ConsulUrl: "http://consul-server.consul:8500",
+			Agentless: true,
+			NoHostIP:  true,
+			Expected:  "http://consul-server.consul:8500",
+		},
+		"no host IP": {
+			ConsulUrl: "http://localhost:8500",
+			NoHostIP:  true,
+			ExpErr:    "pod " + testPodName + " has no host IP",
+		},
+		"node name without host IP": {
+			ConsulUrl: "http://10.0.0.5:8500",
+			NodeName:  "node-1",
+			NoHostIP:  true,
+			Expected:  "http://10.0.0.5:8500",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			consulUrl, err := url.Parse(c.ConsulUrl)
+			require.NoError(err)
+			resource := HealthCheckResource{ConsulUrl: consulUrl, NodeName: c.NodeName, Agentless: c.Agentless}
+			hostIP := "10.0.0.1"
+			if c.NoHostIP {
+				hostIP = ""
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        testPodName,
+					Namespace:   "default",
+					Annotations: c.Annotations,
+				},
+				Status: corev1.PodStatus{HostIP: hostIP},
+			}
+			addr, err := resource.getConsulAgentAddr(pod)
+			if c.ExpErr != "" {
+				require.EqualError(err, c.ExpErr)
+			} else {
+				require.NoError(err)
+				require.Equal(c.Expected, addr)
+			}
+		})
+	}
+}
+
+// Test that when the agent can't be reached the cached client is dropped
+// so that it's rebuilt on the next event.
+func TestReconcilePod_InvalidatesClientOnConnectionError(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testPodName,
+			Namespace: "default",
+			Labels:    map[string]string{labelInject: "true"},
+			Annotations: map[string]string{
+				annotationStatus:  injected,
+				annotationService: testServiceNameAnnotation,
+			},
+		},
+		Spec: testPodSpec,
+		Status: corev1.PodStatus{
+			HostIP:                "127.0.0.1",
+			Phase:                 corev1.PodRunning,
+			InitContainerStatuses: completedInjectInitContainer,
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+	// Nothing is listening on this port.
+	consulUrl, err := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", freeport.MustTake(1)[0]))
+	require.NoError(err)
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		ConsulUrl:           consulUrl,
+	}
+
+	err = resource.reconcilePod(context.Background(), pod)
+	require.Error(err)
+	require.True(isConnectionErr(err))
+	require.Empty(resource.clients)
+}
+
+// Test that Consul calls are aborted once the context passed to UpsertContext
+// is done, rather than blocking on an agent that doesn't respond.
+func TestUpsertContext_Cancelled(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testPodName,
+			Namespace: "default",
+			Labels:    map[string]string{labelInject: "true"},
+			Annotations: map[string]string{
+				annotationStatus:  injected,
+				annotationService: testServiceNameAnnotation,
+			},
+		},
+		Spec: testPodSpec,
+		Status: corev1.PodStatus{
+			HostIP:                "127.0.0.1",
+			Phase:                 corev1.PodRunning,
+			InitContainerStatuses: completedInjectInitContainer,
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+	// The agent never responds.
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer agent.Close()
+	consulUrl, err := url.Parse(agent.URL)
+	require.NoError(err)
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		ConsulUrl:           consulUrl,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = resource.UpsertContext(ctx, "default/"+testPodName, pod)
+	require.Error(err)
+	require.True(errors.Is(err, context.DeadlineExceeded), "unexpected error: %s", err)
+	require.True(time.Since(start) < 5*time.Second, "call took %s", time.Since(start))
+}
+
+// Test that the informer lists and watches pods using the configured label selector.
+func TestInformer_UsesHealthCheckLabel(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		HealthCheckLabel string
+		Expected         string
+	}{
+		"defaults to the inject label": {
+			HealthCheckLabel: "",
+			Expected:         labelInject,
+		},
+		"configured label": {
+			HealthCheckLabel: "app=web",
+			Expected:         "app=web",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			k8sclientset := fake.NewSimpleClientset()
+			resource := HealthCheckResource{
+				Log:                 hclog.Default().Named("healthCheckResource"),
+				KubernetesClientset: k8sclientset,
+				HealthCheckLabel:    c.HealthCheckLabel,
+				Ctx:                 context.Background(),
+			}
+			informer := resource.Informer()
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			go informer.Run(stopCh)
+
+			retry.Run(t, func(r *retry.R) {
+				if !informer.HasSynced() {
+					r.Error("informer has not synced")
+				}
+			})
+			var listed bool
+			for _, action := range k8sclientset.Actions() {
+				if listAction, ok := action.(k8stesting.ListAction); ok {
+					listed = true
+					require.Equal(c.Expected, listAction.GetListRestrictions().Labels.String())
+				}
+			}
+			require.True(listed)
+		})
+	}
+}
+
+// Test that failures to watch the pods are logged and counted, and that the
+// resource isn't considered watching until the informer recovers.
+func TestInformer_WatchErrors(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	k8sclientset := fake.NewSimpleClientset()
+	var failing int32 = 1
+	k8sclientset.PrependWatchReactor("pods", func(k8stesting.Action) (bool, watch.Interface, error) {
+		if atomic.LoadInt32(&failing) == 1 {
+			return true, nil, errors.New("connection refused")
+		}
+		return false, nil, nil
+	})
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: k8sclientset,
+		Ctx:                 context.Background(),
+	}
+	require.True(resource.Watching())
+	informer := resource.Informer()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go informer.Run(stopCh)
+
+	retry.Run(t, func(r *retry.R) {
+		if promtestutil.ToFloat64(resource.getMetrics().watchErrors.WithLabelValues("watch")) < 1 {
+			r.Error("watch error not counted")
+		}
+	})
+	require.False(resource.Watching())
+	require.Equal(float64(0), promtestutil.ToFloat64(resource.getMetrics().watchErrors.WithLabelValues("list")))
+
+	// The informer retries on its own and the resource is watching again
+	// once it succeeds.
+	atomic.StoreInt32(&failing, 0)
+	retry.Run(t, func(r *retry.R) {
+		if !resource.Watching() {
+			r.Error("resource isn't watching")
+		}
+	})
+}
+
+// Test that the informer and Reconcile only list the pods on the configured
+// node.
+func TestInformer_UsesNodeName(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		NodeName string
+		Expected string
+	}{
+		"all nodes": {
+			NodeName: "",
+			Expected: "",
+		},
+		"configured node": {
+			NodeName: "node-1",
+			Expected: "spec.nodeName=node-1",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			k8sclientset := fake.NewSimpleClientset()
+			resource := HealthCheckResource{
+				Log:                 hclog.Default().Named("healthCheckResource"),
+				KubernetesClientset: k8sclientset,
+				NodeName:            c.NodeName,
+				Ctx:                 context.Background(),
+			}
+			informer := resource.Informer()
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			go informer.Run(stopCh)
+
+			retry.Run(t, func(r *retry.R) {
+				if !informer.HasSynced() {
+					r.Error("informer has not synced")
+				}
+			})
+			require.NoError(resource.Reconcile())
+			var lists, watches int
+			for _, action := range k8sclientset.Actions() {
+				switch a := action.(type) {
+				case k8stesting.ListAction:
+					lists++
+					require.Equal(c.Expected, a.GetListRestrictions().Fields.String())
+				case k8stesting.WatchAction:
+					watches++
+					require.Equal(c.Expected, a.GetWatchRestrictions().Fields.String())
+				}
+			}
+			// The informer and Reconcile each list the pods.
+			require.Equal(2, lists)
+			require.Equal(1, watches)
+		})
+	}
+}
+
+// Test that the informers replay pods as updates when a resync period is set.
+func TestInformers_ResyncPeriod(t *testing.T) {
+	t.Parallel()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testPodName,
+			Namespace: "default",
+			Labels:    map[string]string{labelInject: "true"},
+		},
+		Spec: testPodSpec,
+	}
+	k8sclientset := fake.NewSimpleClientset(pod)
+	resource := HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: k8sclientset,
+		ResyncPeriod:        100 * time.Millisecond,
+		Ctx:                 context.Background(),
+	}
+	informer := resource.Informer()
+	var updates int32
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			atomic.AddInt32(&updates, 1)
+		},
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go informer.Run(stopCh)
+
+	retry.Run(t, func(r *retry.R) {
+		if atomic.LoadInt32(&updates) == 0 {
+			r.Error("pod was not resynced")
+		}
+	})
+}
+
+func TestInformers_Namespaces(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		Namespaces []string
+		Expected   []string
+	}{
+		"defaults to all namespaces": {
+			Namespaces: nil,
+			Expected:   []string{metav1.NamespaceAll},
+		},
+		"multiple namespaces": {
+			Namespaces: []string{"foo", "bar"},
+			Expected:   []string{"foo", "bar"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			k8sclientset := fake.NewSimpleClientset()
+			resource := HealthCheckResource{
+				Log:                 hclog.Default().Named("healthCheckResource"),
+				KubernetesClientset: k8sclientset,
+				Namespaces:          c.Namespaces,
+				Ctx:                 context.Background(),
+			}
+			informers := resource.Informers()
+			require.Len(informers, len(c.Expected))
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			for _, informer := range informers {
+				go informer.Run(stopCh)
+			}
+
+			retry.Run(t, func(r *retry.R) {
+				for _, informer := range informers {
+					if !informer.HasSynced() {
+						r.Error("informer has not synced")
+					}
+				}
+			})
+			var listed []string
+			for _, action := range k8sclientset.Actions() {
+				if listAction, ok := action.(k8stesting.ListAction); ok {
+					listed = append(listed, listAction.GetNamespace())
+				}
+			}
+			require.ElementsMatch(c.Expected, listed)
+		})
+	}
+}
+
+// Test that an event is recorded on the pod only when its health check
+// changes status.
+func TestReconcilePod_RecordsStatusEvents(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testPodName,
+			Namespace: "default",
+			Labels:    map[string]string{labelInject: "true"},
+			Annotations: map[string]string{
+				annotationStatus:  injected,
+				annotationService: testServiceNameAnnotation,
+			},
+		},
+		Spec: testPodSpec,
+		Status: corev1.PodStatus{
+			HostIP:                "127.0.0.1",
+			Phase:                 corev1.PodRunning,
+			InitContainerStatuses: completedInjectInitContainer,
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+	server, _, resource := testServerAgentResourceAndController(t, pod)
+	defer server.Stop()
+	server.AddService(t, testServiceNameReg, api.HealthPassing, nil)
+	recorder := record.NewFakeRecorder(10)
+	resource.EventRecorder = recorder
+
+	// Registering the health check isn't a transition.
+	require.NoError(resource.reconcilePod(context.Background(), pod))
+	require.Len(recorder.Events, 0)
+
+	// The pod becomes unready.
+	pod.Status.Conditions = []corev1.PodCondition{{
+		Type:    corev1.PodReady,
+		Status:  corev1.ConditionFalse,
+		Message: "container not ready",
+	}}
+	require.NoError(resource.reconcilePod(context.Background(), pod))
+	require.Len(recorder.Events, 1)
+	require.Equal("Warning ConsulHealthCheckCritical Consul health check is critical: container not ready", <-recorder.Events)
+
+	// No event is recorded if the status doesn't change.
+	require.NoError(resource.reconcilePod(context.Background(), pod))
+	require.Len(recorder.Events, 0)
+
+	// The pod becomes ready again.
+	pod.Status.Conditions = []corev1.PodCondition{{
+		Type:   corev1.PodReady,
+		Status: corev1.ConditionTrue,
+	}}
+	require.NoError(resource.reconcilePod(context.Background(), pod))
+	require.Len(recorder.Events, 1)
+	require.Equal("Normal ConsulHealthCheckPassing Consul health check is passing: "+kubernetesSuccessReasonMsg, <-recorder.Events)
+}
+
+// Test that in dry-run mode no health checks are written to Consul.
+func TestReconcilePod_DryRun(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testPodName,
+			Namespace: "default",
+			Labels:    map[string]string{labelInject: "true"},
+			Annotations: map[string]string{
+				annotationStatus:  injected,
+				annotationService: testServiceNameAnnotation,
+			},
+		},
+		Spec: testPodSpec,
+		Status: corev1.PodStatus{
+			HostIP:                "127.0.0.1",
+			Phase:                 corev1.PodRunning,
+			InitContainerStatuses: completedInjectInitContainer,
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+	server, client, resource := testServerAgentResourceAndController(t, pod)
+	defer server.Stop()
+	server.AddService(t, testServiceNameReg, api.HealthPassing, nil)
+	resource.DryRun = true
+
+	// The health check isn't registered.
+	require.NoError(resource.reconcilePod(context.Background(), pod))
+	require.Nil(getConsulAgentChecks(t, client, testHealthCheckID))
+
+	// Once the health check is registered, its status isn't updated.
+	resource.DryRun = false
+	require.NoError(resource.reconcilePod(context.Background(), pod))
+	resource.DryRun = true
+	pod.Status.Conditions = []corev1.PodCondition{{
+		Type:   corev1.PodReady,
+		Status: corev1.ConditionFalse,
+	}}
+	require.NoError(resource.reconcilePod(context.Background(), pod))
+	actual := getConsulAgentChecks(t, client, testHealthCheckID)
+	require.NotNil(actual)
+	require.Equal(api.HealthPassing, actual.Status)
+}
+
+// Test that the clients connecting to agents that require client
+// certificates are configured with TLSConfig.
+func TestReconcilePod_TLS(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	caFile, certFile, keyFile, cleanup := common.GenerateServerCerts(t)
+	defer cleanup()
+
+	server, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+		c.CAFile = caFile
+		c.CertFile = certFile
+		c.KeyFile = keyFile
+		c.VerifyIncomingHTTPS = true
+	})
+	require.NoError(err)
+	defer server.Stop()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testPodName,
+			Namespace: "default",
+			Labels:    map[string]string{labelInject: "true"},
+			Annotations: map[string]string{
+				annotationStatus:  injected,
+				annotationService: testServiceNameAnnotation,
+			},
+		},
+		Spec: testPodSpec,
+		Status: corev1.PodStatus{
+			HostIP:                "127.0.0.1",
+			Phase:                 corev1.PodRunning,
+			InitContainerStatuses: completedInjectInitContainer,
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+	server.AddService(t, testServiceNameReg, api.HealthPassing, nil)
+
+	consulUrl, err := url.Parse("https://" + server.HTTPSAddr)
+	require.NoError(err)
+	tlsConfig := api.TLSConfig{
+		CAFile:   caFile,
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}
+	resource := &HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		ConsulUrl:           consulUrl,
+		TLSConfig:           tlsConfig,
+	}
+
+	// Reconcile twice so that the second time uses the cached client.
+	require.NoError(resource.reconcilePod(context.Background(), pod))
+	require.NoError(resource.reconcilePod(context.Background(), pod))
+
+	client, err := api.NewClient(&api.Config{
+		Address:   server.HTTPSAddr,
+		Scheme:    "https",
+		TLSConfig: tlsConfig,
+	})
+	require.NoError(err)
+	actual := getConsulAgentChecks(t, client, testHealthCheckID)
+	require.NotNil(actual)
+	require.Equal(api.HealthPassing, actual.Status)
+
+	// Without a client certificate the agent rejects the connection.
+	resource = &HealthCheckResource{
+		Log:                 hclog.Default().Named("healthCheckResource"),
+		KubernetesClientset: fake.NewSimpleClientset(pod),
+		ConsulUrl:           consulUrl,
+		TLSConfig:           api.TLSConfig{CAFile: caFile},
+	}
+	require.Error(resource.reconcilePod(context.Background(), pod))
+}
+
+// Test that registering a health check for a service that was never
+// registered with Consul returns an error rather than reporting success.
+func TestRegisterConsulHealthCheck_ServiceNotFound(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testPodName,
+			Namespace: "default",
+		},
+	}
+	server, _, resource := testServerAgentResourceAndController(t, pod)
+	defer server.Stop()
+
+	client, err := resource.getConsulClient(pod)
+	require.NoError(err)
+	err = resource.registerConsulHealthCheck(context.Background(), &apiAgent{client: client}, testHealthCheckID, name, testServiceNameReg, "", api.HealthPassing, "", "")
+	require.True(errors.Is(err, ServiceNotFoundErr), "unexpected error: %v", err)
+}
+
+// Test that the health check is registered with the configured TTL so that
+// it expires if it isn't updated.
+func TestReconcilePod_TTL(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testPodName,
+			Namespace: "default",
+			Labels:    map[string]string{labelInject: "true"},
+			Annotations: map[string]string{
+				annotationStatus:  injected,
+				annotationService: testServiceNameAnnotation,
+			},
+		},
+		Spec: testPodSpec,
+		Status: corev1.PodStatus{
+			HostIP:                "127.0.0.1",
+			Phase:                 corev1.PodRunning,
+			InitContainerStatuses: completedInjectInitContainer,
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+	server, client, resource := testServerAgentResourceAndController(t, pod)
+	defer server.Stop()
+	server.AddService(t, testServiceNameReg, api.HealthPassing, nil)
+	resource.TTL = "1s"
+
+	require.NoError(resource.reconcilePod(context.Background(), pod))
+	actual := getConsulAgentChecks(t, client, testHealthCheckID)
+	require.NotNil(actual)
+	require.Equal(api.HealthPassing, actual.Status)
+
+	retry.Run(t, func(r *retry.R) {
+		actual := getConsulAgentChecks(t, client, testHealthCheckID)
+		if actual == nil || actual.Status != api.HealthCritical {
+			r.Error("health check has not expired")
+		}
+	})
+}
+
+// Test that Reconcile only registers health checks for pods in the
+// configured namespaces.
+func TestReconcile_Namespaces(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testPodName,
+			Namespace: "default",
+			Labels:    map[string]string{labelInject: "true"},
+			Annotations: map[string]string{
+				annotationStatus:  injected,
+				annotationService: testServiceNameAnnotation,
+			},
+		},
+		Spec: testPodSpec,
+		Status: corev1.PodStatus{
+			HostIP:                "127.0.0.1",
+			Phase:                 corev1.PodRunning,
+			InitContainerStatuses: completedInjectInitContainer,
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+	server, client, resource := testServerAgentResourceAndController(t, pod)
+	defer server.Stop()
+	server.AddService(t, testServiceNameReg, api.HealthPassing, nil)
+
+	// The pod's namespace isn't watched so no health check is registered.
+	resource.Namespaces = []string{"foo", "bar"}
+	require.NoError(resource.Reconcile())
+	require.Nil(getConsulAgentChecks(t, client, testHealthCheckID))
+
+	// Once its namespace is watched, the health check is registered.
+	resource.Namespaces = []string{"foo", "default"}
+	require.NoError(resource.Reconcile())
+	actual := getConsulAgentChecks(t, client, testHealthCheckID)
+	require.NotNil(actual)
+	require.Equal(api.HealthPassing, actual.Status)
+}
+
+func TestGetConsulNamespace(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		EnableConsulNamespaces     bool
+		ConsulDestinationNamespace string
+		EnableNSMirroring          bool
+		NSMirroringPrefix          string
+		Annotations                map[string]string
+		Expected                   string
+	}{
+		"namespaces disabled": {
+			EnableConsulNamespaces: false,
+			Annotations:            map[string]string{annotationConsulNamespace: "ns"},
+			Expected:               "",
+		},
+		"namespaces enabled": {
+			EnableConsulNamespaces: true,
+			Annotations:            map[string]string{annotationConsulNamespace: "ns"},
+			Expected:               "ns",
+		},
+		"namespaces enabled without annotation": {
+			EnableConsulNamespaces: true,
+			Annotations:            nil,
+			Expected:               "",
+		},
+		"destination namespace": {
+			EnableConsulNamespaces:     true,
+			ConsulDestinationNamespace: "dest",
+			Expected:                   "dest",
+		},
+		"mirroring": {
+			EnableConsulNamespaces:     true,
+			ConsulDestinationNamespace: "dest",
+			EnableNSMirroring:          true,
+			Expected:                   "default",
+		},
+		"mirroring with prefix": {
+			EnableConsulNamespaces:     true,
+			ConsulDestinationNamespace: "dest",
+			EnableNSMirroring:          true,
+			NSMirroringPrefix:          "k8s-",
+			Expected:                   "k8s-default",
+		},
+		"annotation takes precedence over mirroring": {
+			EnableConsulNamespaces: true,
+			EnableNSMirroring:      true,
+			NSMirroringPrefix:      "k8s-",
+			Annotations:            map[string]string{annotationConsulNamespace: "ns"},
+			Expected:               "ns",
+		},
+		"namespaces disabled with mirroring": {
+			EnableConsulNamespaces: false,
+			EnableNSMirroring:      true,
+			NSMirroringPrefix:      "k8s-",
+			Expected:               "",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			resource := HealthCheckResource{
+				EnableConsulNamespaces:     c.EnableConsulNamespaces,
+				ConsulDestinationNamespace: c.ConsulDestinationNamespace,
+				EnableNSMirroring:          c.EnableNSMirroring,
+				NSMirroringPrefix:          c.NSMirroringPrefix,
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        testPodName,
+					Namespace:   "default",
+					Annotations: c.Annotations,
+				},
+			}
+			require.Equal(t, c.Expected, resource.getConsulNamespace(pod))
+		})
+	}
+}
+
+// Test that pods with the same name in different namespaces get distinct
+// health check IDs, with and without a prefix.
+func TestGetConsulHealthCheckID(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		Prefix   string
+		Expected []string
+	}{
+		"no prefix": {
+			Prefix: "",
+			Expected: []string{
+				"foo/test-pod-test-service/kubernetes-health-check",
+				"bar/test-pod-test-service/kubernetes-health-check",
+			},
+		},
+		"prefix": {
+			Prefix: "k8s-east",
+			Expected: []string{
+				"k8s-east/foo/test-pod-test-service/kubernetes-health-check",
+				"k8s-east/bar/test-pod-test-service/kubernetes-health-check",
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			resource := HealthCheckResource{HealthCheckIDPrefix: c.Prefix}
+			var ids []string
+			for _, ns := range []string{"foo", "bar"} {
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        testPodName,
+						Namespace:   ns,
+						Annotations: map[string]string{annotationService: testServiceNameAnnotation},
+					},
+				}
+				ids = append(ids, resource.getConsulHealthCheckID(pod))
+			}
+			require.Equal(t, c.Expected, ids)
+		})
+	}
+}
+
+// Test that registering a health check and updating its status is reflected
+// in the metrics.
+func TestReconcilePod_Metrics(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testPodName,
+			Namespace: "default",
+			Labels:    map[string]string{labelInject: "true"},
+			Annotations: map[string]string{
+				annotationStatus:  injected,
+				annotationService: testServiceNameAnnotation,
+			},
+		},
+		Spec: testPodSpec,
+		Status: corev1.PodStatus{
+			HostIP:                "127.0.0.1",
+			Phase:                 corev1.PodRunning,
+			InitContainerStatuses: completedInjectInitContainer,
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+	server, _, resource := testServerAgentResourceAndController(t, pod)
+	defer server.Stop()
+	resource.MetricsRegistry = prometheus.NewRegistry()
+	server.AddService(t, testServiceNameReg, api.HealthPassing, nil)
+
+	require.NoError(resource.reconcilePod(context.Background(), pod))
+	metrics := resource.getMetrics()
+	require.Equal(float64(1), promtestutil.ToFloat64(metrics.registered))
+	require.Equal(float64(0), promtestutil.ToFloat64(metrics.registerErrors))
+	require.Equal(float64(1), promtestutil.ToFloat64(metrics.statusUpdates.WithLabelValues(api.HealthPassing)))
+
+	// The metrics are exported through the registry.
+	families, err := resource.MetricsRegistry.Gather()
+	require.NoError(err)
+	var names []string
+	for _, f := range families {
+		names = append(names, f.GetName())
+	}
+	require.Contains(names, "consul_k8s_healthcheck_registered_total")
+	require.Contains(names, "consul_k8s_healthcheck_register_duration_seconds")
+}
+
+// Test that Reconcile registers a health check for a running pod whose
+// check doesn't exist in Consul yet, e.g. because its event was missed.
+func TestReconcile_RegistersMissingHealthCheck(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testPodName,
+			Namespace: "default",
+			Labels:    map[string]string{labelInject: "true"},
+			Annotations: map[string]string{
+				annotationStatus:  injected,
+				annotationService: testServiceNameAnnotation,
+			},
+		},
+		Spec: testPodSpec,
+		Status: corev1.PodStatus{
+			HostIP:                "127.0.0.1",
+			Phase:                 corev1.PodRunning,
+			InitContainerStatuses: completedInjectInitContainer,
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+	server, client, resource := testServerAgentResourceAndController(t, pod)
+	defer server.Stop()
+	server.AddService(t, testServiceNameReg, api.HealthPassing, nil)
+	require.Nil(getConsulAgentChecks(t, client, testHealthCheckID))
+
+	require.NoError(resource.Reconcile())
+
+	actual := getConsulAgentChecks(t, client, testHealthCheckID)
+	require.NotNil(actual)
+	require.Equal(api.HealthPassing, actual.Status)
+	require.Equal(kubernetesSuccessReasonMsg, actual.Output)
+}
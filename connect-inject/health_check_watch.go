@@ -0,0 +1,40 @@
+package connectinject
+
+// recordWatchResult records the result of listing or watching, as given by
+// op, the pods of namespace ns. Failures are logged and counted, and the
+// namespace is considered not watched until the informer's next list or
+// watch succeeds. The informer retries on its own in the meantime.
+func (h *HealthCheckResource) recordWatchResult(ns, op string, err error) {
+	h.watchErrorsLock.Lock()
+	if err == nil {
+		delete(h.watchErrors, ns)
+		h.watchErrorsLock.Unlock()
+		return
+	}
+	if h.watchErrors == nil {
+		h.watchErrors = make(map[string]error)
+	}
+	h.watchErrors[ns] = err
+	h.watchErrorsLock.Unlock()
+
+	h.getMetrics().watchErrors.WithLabelValues(op).Inc()
+	h.logError("unable to "+op+" pods, retrying", err, "namespace", ns)
+}
+
+// forgetWatchError forgets the last failure to list or watch the pods of
+// namespace ns, e.g. once the namespace is no longer watched.
+func (h *HealthCheckResource) forgetWatchError(ns string) {
+	h.watchErrorsLock.Lock()
+	defer h.watchErrorsLock.Unlock()
+	delete(h.watchErrors, ns)
+}
+
+// Watching implements controller.WatchStatus. It returns false while the
+// pods of a watched namespace can't be listed or watched, e.g. because the
+// connection to the API server dropped, since the informers' caches may be
+// stale even though they have synced before.
+func (h *HealthCheckResource) Watching() bool {
+	h.watchErrorsLock.Lock()
+	defer h.watchErrorsLock.Unlock()
+	return len(h.watchErrors) == 0
+}
@@ -120,12 +120,16 @@ func (r *ConfigEntryController) ReconcileEntry(
 			})
 
 			// Ignore the error where the config entry isn't found in Consul.
-			// It is indicative of desired state.
+			// It is indicative of desired state. Any other error, e.g. because
+			// Consul is unreachable, is returned so the deletion is requeued
+			// with backoff and the finalizer keeps the resource around until
+			// the config entry has been deleted from Consul.
 			if err != nil && !isNotFoundErr(err) {
-				return ctrl.Result{}, fmt.Errorf("getting config entry from consul: %w", err)
+				return r.syncFailed(ctx, logger, crdCtrl, configEntry, ConsulAgentError,
+					fmt.Errorf("getting config entry from consul: %w", err))
 			} else if err == nil {
 				// Only delete the resource from Consul if it is owned by our datacenter.
-				if entry.GetMeta()[common.DatacenterKey] == r.DatacenterName {
+				if isManagedEntry(entry, r.DatacenterName) {
 					_, err := r.ConsulClient.ConfigEntries().Delete(configEntry.ConsulKind(), configEntry.ConsulName(), &capi.WriteOptions{
 						Namespace: r.consulNamespace(consulEntry, configEntry.ConsulMirroringNS(), configEntry.ConsulGlobalResource()),
 					})
@@ -135,7 +139,8 @@ func (r *ConfigEntryController) ReconcileEntry(
 					}
 					logger.Info("deletion from Consul successful")
 				} else {
-					logger.Info("config entry in Consul was created in another datacenter - skipping delete from Consul", "external-datacenter", entry.GetMeta()[common.DatacenterKey])
+					logger.Info("config entry in Consul is not managed by this datacenter - skipping delete from Consul",
+						"external-datacenter", entry.GetMeta()[common.DatacenterKey], "external-source", entry.GetMeta()[common.SourceKey])
 				}
 			}
 			// remove our finalizer from the list and update it.
@@ -340,6 +345,15 @@ func containsString(slice []string, s string) bool {
 	return false
 }
 
+// isManagedEntry returns true if the config entry in Consul was written by
+// the controller of datacenter, i.e. its meta carries both the external
+// source marker of Kubernetes and the datacenter. Entries without the marker,
+// e.g. ones created with the CLI, are never deleted by the controller.
+func isManagedEntry(entry capi.ConfigEntry, datacenter string) bool {
+	meta := entry.GetMeta()
+	return meta[common.SourceKey] == common.SourceValue && meta[common.DatacenterKey] == datacenter
+}
+
 // sourceDatacenterMismatchErr returns an error for when the source datacenter
 // meta key does not match our datacenter. This could be because the config
 // entry was created directly in Consul or because it was created by another
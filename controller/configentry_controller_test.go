@@ -1249,6 +1249,207 @@ func TestConfigEntryControllers_deletesConfigEntry(t *testing.T) {
 	}
 }
 
+// Test that a resource marked for deletion whose config entry is already gone
+// from Consul has its finalizer removed so that it can be deleted.
+func TestConfigEntryControllers_deletesWhenNotInConsul(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+	ctx := context.Background()
+	kubeNS := "default"
+
+	svcDefaults := &v1alpha1.ServiceDefaults{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "foo",
+			Namespace:         kubeNS,
+			DeletionTimestamp: &metav1.Time{Time: time.Now()},
+			Finalizers:        []string{FinalizerName},
+		},
+		Spec: v1alpha1.ServiceDefaultsSpec{
+			Protocol: "http",
+		},
+	}
+	s := runtime.NewScheme()
+	s.AddKnownTypes(v1alpha1.GroupVersion, svcDefaults)
+	client := fake.NewFakeClientWithScheme(s, svcDefaults)
+
+	consul, err := testutil.NewTestServerConfigT(t, nil)
+	req.NoError(err)
+	defer consul.Stop()
+	consul.WaitForServiceIntentions(t)
+	consulClient, err := capi.NewClient(&capi.Config{
+		Address: consul.HTTPAddr,
+	})
+	req.NoError(err)
+
+	reconciler := &ServiceDefaultsController{
+		Client: client,
+		Log:    logrtest.TestLogger{T: t},
+		ConfigEntryController: &ConfigEntryController{
+			ConsulClient:   consulClient,
+			DatacenterName: datacenterName,
+		},
+	}
+	namespacedName := types.NamespacedName{
+		Namespace: kubeNS,
+		Name:      svcDefaults.KubernetesName(),
+	}
+	resp, err := reconciler.Reconcile(ctrl.Request{
+		NamespacedName: namespacedName,
+	})
+	req.NoError(err)
+	req.False(resp.Requeue)
+
+	var updated v1alpha1.ServiceDefaults
+	err = client.Get(ctx, namespacedName, &updated)
+	req.NoError(err)
+	req.NotContains(updated.Finalizers(), FinalizerName)
+}
+
+// Test that if Consul is unreachable when a resource is deleted, the
+// reconcile fails so that it's requeued and the finalizer is kept until the
+// config entry has been deleted from Consul.
+func TestConfigEntryControllers_deletesWhenConsulReachableAgain(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+	ctx := context.Background()
+	kubeNS := "default"
+
+	svcDefaults := &v1alpha1.ServiceDefaults{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "foo",
+			Namespace:         kubeNS,
+			DeletionTimestamp: &metav1.Time{Time: time.Now()},
+			Finalizers:        []string{FinalizerName},
+		},
+		Spec: v1alpha1.ServiceDefaultsSpec{
+			Protocol: "http",
+		},
+	}
+	s := runtime.NewScheme()
+	s.AddKnownTypes(v1alpha1.GroupVersion, svcDefaults)
+	client := fake.NewFakeClientWithScheme(s, svcDefaults)
+
+	consul, err := testutil.NewTestServerConfigT(t, nil)
+	req.NoError(err)
+	defer consul.Stop()
+	consul.WaitForServiceIntentions(t)
+	consulClient, err := capi.NewClient(&capi.Config{
+		Address: consul.HTTPAddr,
+	})
+	req.NoError(err)
+	written, _, err := consulClient.ConfigEntries().Set(svcDefaults.ToConsul(datacenterName), nil)
+	req.NoError(err)
+	req.True(written)
+
+	// Nothing listens on port 1 so requests to this client fail.
+	unreachableClient, err := capi.NewClient(&capi.Config{
+		Address: "127.0.0.1:1",
+	})
+	req.NoError(err)
+
+	reconciler := &ServiceDefaultsController{
+		Client: client,
+		Log:    logrtest.TestLogger{T: t},
+		ConfigEntryController: &ConfigEntryController{
+			ConsulClient:   unreachableClient,
+			DatacenterName: datacenterName,
+		},
+	}
+	namespacedName := types.NamespacedName{
+		Namespace: kubeNS,
+		Name:      svcDefaults.KubernetesName(),
+	}
+	_, err = reconciler.Reconcile(ctrl.Request{
+		NamespacedName: namespacedName,
+	})
+	req.Error(err)
+	req.Contains(err.Error(), "getting config entry from consul")
+
+	var updated v1alpha1.ServiceDefaults
+	err = client.Get(ctx, namespacedName, &updated)
+	req.NoError(err)
+	req.Contains(updated.Finalizers(), FinalizerName)
+	syncCondition := updated.GetCondition(v1alpha1.ConditionSynced)
+	req.Equal(corev1.ConditionFalse, syncCondition.Status)
+	req.Equal(ConsulAgentError, syncCondition.Reason)
+
+	// Once Consul is reachable again the config entry is deleted and the
+	// finalizer removed.
+	reconciler.ConfigEntryController.ConsulClient = consulClient
+	resp, err := reconciler.Reconcile(ctrl.Request{
+		NamespacedName: namespacedName,
+	})
+	req.NoError(err)
+	req.False(resp.Requeue)
+
+	_, _, err = consulClient.ConfigEntries().Get(capi.ServiceDefaults, svcDefaults.ConsulName(), nil)
+	req.EqualError(err, "Unexpected response code: 404 (Config entry not found for \"service-defaults\" / \"foo\")")
+
+	var deleted v1alpha1.ServiceDefaults
+	err = client.Get(ctx, namespacedName, &deleted)
+	req.NoError(err)
+	req.NotContains(deleted.Finalizers(), FinalizerName)
+}
+
+// Test that a config entry in Consul that already matches the resource is
+// not written again.
+func TestConfigEntryControllers_doesNotWriteMatchingEntry(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+	kubeNS := "default"
+
+	svcDefaults := &v1alpha1.ServiceDefaults{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "foo",
+			Namespace:  kubeNS,
+			Finalizers: []string{FinalizerName},
+		},
+		Spec: v1alpha1.ServiceDefaultsSpec{
+			Protocol: "http",
+		},
+	}
+	s := runtime.NewScheme()
+	s.AddKnownTypes(v1alpha1.GroupVersion, svcDefaults)
+	client := fake.NewFakeClientWithScheme(s, svcDefaults)
+
+	consul, err := testutil.NewTestServerConfigT(t, nil)
+	req.NoError(err)
+	defer consul.Stop()
+	consul.WaitForServiceIntentions(t)
+	consulClient, err := capi.NewClient(&capi.Config{
+		Address: consul.HTTPAddr,
+	})
+	req.NoError(err)
+
+	written, _, err := consulClient.ConfigEntries().Set(svcDefaults.ToConsul(datacenterName), nil)
+	req.NoError(err)
+	req.True(written)
+	entry, _, err := consulClient.ConfigEntries().Get(capi.ServiceDefaults, "foo", nil)
+	req.NoError(err)
+	modifyIndex := entry.GetModifyIndex()
+
+	reconciler := &ServiceDefaultsController{
+		Client: client,
+		Log:    logrtest.TestLogger{T: t},
+		ConfigEntryController: &ConfigEntryController{
+			ConsulClient:   consulClient,
+			DatacenterName: datacenterName,
+		},
+	}
+	resp, err := reconciler.Reconcile(ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: kubeNS,
+			Name:      svcDefaults.KubernetesName(),
+		},
+	})
+	req.NoError(err)
+	req.False(resp.Requeue)
+
+	entry, _, err = consulClient.ConfigEntries().Get(capi.ServiceDefaults, "foo", nil)
+	req.NoError(err)
+	req.Equal(modifyIndex, entry.GetModifyIndex())
+}
+
 func TestConfigEntryControllers_errorUpdatesSyncStatus(t *testing.T) {
 	t.Parallel()
 	kubeNS := "default"
@@ -2446,6 +2647,76 @@ func TestConfigEntryControllers_updatesStatusWhenDeleteFails(t *testing.T) {
 	require.True(t, cmp.Equal(syncCondition, expectedCondition, cmpopts.IgnoreFields(v1alpha1.Condition{}, "LastTransitionTime")))
 }
 
+// Test that if Consul rejects writing the config entry, the resource's
+// synced condition is set to false with Consul's error.
+func TestConfigEntryControllers_updatesStatusWhenWriteFails(t *testing.T) {
+	ctx := context.Background()
+	kubeNS := "default"
+
+	s := runtime.NewScheme()
+	s.AddKnownTypes(v1alpha1.GroupVersion, &v1alpha1.ServiceSplitter{})
+
+	// The service's protocol defaults to tcp which doesn't support splitting
+	// so Consul rejects the write.
+	splitter := &v1alpha1.ServiceSplitter{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service",
+			Namespace: kubeNS,
+		},
+		Spec: v1alpha1.ServiceSplitterSpec{
+			Splits: v1alpha1.ServiceSplits{
+				{
+					Weight:  100,
+					Service: "service",
+				},
+			},
+		},
+	}
+
+	client := fake.NewFakeClientWithScheme(s, splitter)
+
+	consul, err := testutil.NewTestServerConfigT(t, nil)
+	require.NoError(t, err)
+	defer consul.Stop()
+
+	consul.WaitForServiceIntentions(t)
+	consulClient, err := capi.NewClient(&capi.Config{
+		Address: consul.HTTPAddr,
+	})
+	require.NoError(t, err)
+
+	reconciler := ServiceSplitterController{
+		Client: client,
+		Log:    logrtest.TestLogger{T: t},
+		ConfigEntryController: &ConfigEntryController{
+			ConsulClient:   consulClient,
+			DatacenterName: datacenterName,
+		},
+	}
+
+	namespacedName := types.NamespacedName{
+		Namespace: kubeNS,
+		Name:      splitter.Name,
+	}
+	resp, err := reconciler.Reconcile(ctrl.Request{NamespacedName: namespacedName})
+	expErr := "writing config entry to consul: Unexpected response code: 500 (discovery chain \"service\" uses a protocol \"tcp\" that does not permit advanced routing or splitting behavior)"
+	require.EqualError(t, err, expErr)
+	require.False(t, resp.Requeue)
+
+	err = client.Get(ctx, namespacedName, splitter)
+	require.NoError(t, err)
+
+	// Ensure the status of the resource is updated to display failure reason.
+	syncCondition := splitter.GetCondition(v1alpha1.ConditionSynced)
+	expectedCondition := &v1alpha1.Condition{
+		Type:    v1alpha1.ConditionSynced,
+		Status:  corev1.ConditionFalse,
+		Reason:  ConsulAgentError,
+		Message: expErr,
+	}
+	require.True(t, cmp.Equal(syncCondition, expectedCondition, cmpopts.IgnoreFields(v1alpha1.Condition{}, "LastTransitionTime")))
+}
+
 // Test that if the resource already exists in Consul but the Kube resource
 // has the "migrate-entry" annotation then we let the Kube resource sync to Consul.
 func TestConfigEntryController_Migration(t *testing.T) {
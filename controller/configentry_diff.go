@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/consul-k8s/api/common"
+	capi "github.com/hashicorp/consul/api"
+)
+
+// DriftType is the way a config entry in Consul has drifted from its custom
+// resource.
+type DriftType string
+
+const (
+	// DriftMissing is a custom resource whose config entry doesn't exist in
+	// Consul.
+	DriftMissing DriftType = "missing in Consul"
+	// DriftDiffers is a custom resource whose config entry in Consul doesn't
+	// match it.
+	DriftDiffers DriftType = "differs"
+	// DriftExtra is a config entry in Consul that's managed by this
+	// datacenter but that no custom resource exists for.
+	DriftExtra DriftType = "extra in Consul"
+)
+
+// Drift is a difference between the custom resources and the config entries
+// in Consul.
+type Drift struct {
+	Type DriftType
+	// Kind, Name and Namespace identify the config entry in Consul.
+	Kind      string
+	Name      string
+	Namespace string
+	// Kube and Consul are the JSON of the config entry of the custom
+	// resource and of the one in Consul, if they exist.
+	Kube   string
+	Consul string
+}
+
+func (d Drift) String() string {
+	id := fmt.Sprintf("%s/%s", d.Kind, d.Name)
+	if d.Namespace != "" {
+		id = fmt.Sprintf("%s/%s/%s", d.Kind, d.Namespace, d.Name)
+	}
+	if d.Type == DriftDiffers {
+		return fmt.Sprintf("%s: %s: consul=%s, kube=%s", d.Type, id, d.Consul, d.Kube)
+	}
+	return fmt.Sprintf("%s: %s", d.Type, id)
+}
+
+// Diff compares the custom resources of kinds with the config entries in
+// Consul and returns their drift. Resources that are being deleted are
+// ignored.
+func (r *ConfigEntryController) Diff(kinds []string, resources []common.ConfigEntryResource) ([]Drift, error) {
+	var drifts []Drift
+	// seen holds the config entries that custom resources exist for, keyed
+	// by entryKey.
+	seen := make(map[string]bool)
+	for _, resource := range resources {
+		if !resource.GetObjectMeta().DeletionTimestamp.IsZero() {
+			continue
+		}
+		consulEntry := resource.ToConsul(r.DatacenterName)
+		consulNS := r.consulNamespace(consulEntry, resource.ConsulMirroringNS(), resource.ConsulGlobalResource())
+		seen[entryKey(resource.ConsulKind(), consulNS, resource.ConsulName())] = true
+
+		drift := Drift{
+			Kind:      resource.ConsulKind(),
+			Name:      resource.ConsulName(),
+			Namespace: consulNS,
+			Kube:      marshalEntry(consulEntry),
+		}
+		entry, _, err := r.ConsulClient.ConfigEntries().Get(resource.ConsulKind(), resource.ConsulName(), &capi.QueryOptions{
+			Namespace: consulNS,
+		})
+		if isNotFoundErr(err) {
+			drift.Type = DriftMissing
+			drifts = append(drifts, drift)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("getting config entry %s/%s from consul: %w", resource.ConsulKind(), resource.ConsulName(), err)
+		}
+		if !resource.MatchesConsul(entry) {
+			drift.Type = DriftDiffers
+			drift.Consul = marshalEntry(entry)
+			drifts = append(drifts, drift)
+		}
+	}
+
+	// Config entries that weren't created by this datacenter's controller
+	// aren't expected to have custom resources.
+	listNS := ""
+	if r.EnableConsulNamespaces {
+		listNS = common.WildcardNamespace
+	}
+	for _, kind := range kinds {
+		entries, _, err := r.ConsulClient.ConfigEntries().List(kind, &capi.QueryOptions{
+			Namespace: listNS,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("listing %s config entries from consul: %w", kind, err)
+		}
+		for _, entry := range entries {
+			if !isManagedEntry(entry, r.DatacenterName) {
+				continue
+			}
+			if seen[entryKey(kind, entry.GetNamespace(), entry.GetName())] {
+				continue
+			}
+			drifts = append(drifts, Drift{
+				Type:      DriftExtra,
+				Kind:      kind,
+				Name:      entry.GetName(),
+				Namespace: entry.GetNamespace(),
+				Consul:    marshalEntry(entry),
+			})
+		}
+	}
+
+	// Group the drift by type.
+	sort.SliceStable(drifts, func(i, j int) bool {
+		if drifts[i].Type != drifts[j].Type {
+			return drifts[i].Type < drifts[j].Type
+		}
+		return entryKey(drifts[i].Kind, drifts[i].Namespace, drifts[i].Name) <
+			entryKey(drifts[j].Kind, drifts[j].Namespace, drifts[j].Name)
+	})
+	return drifts, nil
+}
+
+// entryKey identifies a config entry in Consul.
+func entryKey(kind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+// marshalEntry returns the JSON of entry, or of the error marshalling it, to
+// show the fields that have drifted.
+func marshalEntry(entry capi.ConfigEntry) string {
+	asJSON, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Sprintf("unable to marshal config entry: %s", err)
+	}
+	return string(asJSON)
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/api/common"
+	"github.com/hashicorp/consul-k8s/api/v1alpha1"
+	capi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConfigEntryController_Diff(t *testing.T) {
+	t.Parallel()
+
+	serviceDefaults := &v1alpha1.ServiceDefaults{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ServiceDefaultsSpec{
+			Protocol: "http",
+		},
+	}
+	cases := map[string]struct {
+		resources     []common.ConfigEntryResource
+		consulEntries []capi.ConfigEntry
+		expDrifts     []Drift
+	}{
+		"no drift": {
+			resources: []common.ConfigEntryResource{serviceDefaults},
+			consulEntries: []capi.ConfigEntry{
+				serviceDefaults.ToConsul(datacenterName),
+			},
+			expDrifts: nil,
+		},
+		"missing in Consul": {
+			resources: []common.ConfigEntryResource{serviceDefaults},
+			expDrifts: []Drift{
+				{
+					Type: DriftMissing,
+					Kind: capi.ServiceDefaults,
+					Name: "foo",
+					Kube: `{"Kind":"service-defaults","Name":"foo","Protocol":"http","MeshGateway":{},"Expose":{},"Meta":{"consul.hashicorp.com/source-datacenter":"datacenter","external-source":"kubernetes"},"CreateIndex":0,"ModifyIndex":0}`,
+				},
+			},
+		},
+		"differs": {
+			resources: []common.ConfigEntryResource{serviceDefaults},
+			consulEntries: []capi.ConfigEntry{
+				&capi.ServiceConfigEntry{
+					Kind:     capi.ServiceDefaults,
+					Name:     "foo",
+					Protocol: "tcp",
+					Meta: map[string]string{
+						common.SourceKey:     common.SourceValue,
+						common.DatacenterKey: datacenterName,
+					},
+				},
+			},
+			expDrifts: []Drift{
+				{
+					Type:   DriftDiffers,
+					Kind:   capi.ServiceDefaults,
+					Name:   "foo",
+					Kube:   `{"Kind":"service-defaults","Name":"foo","Protocol":"http","MeshGateway":{},"Expose":{},"Meta":{"consul.hashicorp.com/source-datacenter":"datacenter","external-source":"kubernetes"},"CreateIndex":0,"ModifyIndex":0}`,
+					Consul: `{"Kind":"service-defaults","Name":"foo","Protocol":"tcp","MeshGateway":{},"Expose":{},"Meta":{"consul.hashicorp.com/source-datacenter":"datacenter","external-source":"kubernetes"},"CreateIndex":0,"ModifyIndex":0}`,
+				},
+			},
+		},
+		"extra in Consul": {
+			consulEntries: []capi.ConfigEntry{
+				&capi.ServiceResolverConfigEntry{
+					Kind:           capi.ServiceResolver,
+					Name:           "bar",
+					ConnectTimeout: 5 * time.Second,
+					Meta: map[string]string{
+						common.SourceKey:     common.SourceValue,
+						common.DatacenterKey: datacenterName,
+					},
+				},
+			},
+			expDrifts: []Drift{
+				{
+					Type:   DriftExtra,
+					Kind:   capi.ServiceResolver,
+					Name:   "bar",
+					Consul: `{"ConnectTimeout":"5s","Kind":"service-resolver","Name":"bar","Meta":{"consul.hashicorp.com/source-datacenter":"datacenter","external-source":"kubernetes"},"CreateIndex":0,"ModifyIndex":0}`,
+				},
+			},
+		},
+		"entries not managed by the datacenter are ignored": {
+			consulEntries: []capi.ConfigEntry{
+				&capi.ServiceResolverConfigEntry{
+					Kind: capi.ServiceResolver,
+					Name: "created-with-the-cli",
+				},
+				&capi.ServiceResolverConfigEntry{
+					Kind: capi.ServiceResolver,
+					Name: "created-without-the-marker",
+					Meta: map[string]string{
+						common.DatacenterKey: datacenterName,
+					},
+				},
+				&capi.ServiceResolverConfigEntry{
+					Kind: capi.ServiceResolver,
+					Name: "created-in-another-dc",
+					Meta: map[string]string{
+						common.DatacenterKey: "other-datacenter",
+					},
+				},
+			},
+			expDrifts: nil,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			req := require.New(t)
+			consul, err := testutil.NewTestServerConfigT(t, nil)
+			req.NoError(err)
+			defer consul.Stop()
+
+			consul.WaitForServiceIntentions(t)
+			consulClient, err := capi.NewClient(&capi.Config{
+				Address: consul.HTTPAddr,
+			})
+			req.NoError(err)
+			for _, configEntry := range c.consulEntries {
+				written, _, err := consulClient.ConfigEntries().Set(configEntry, nil)
+				req.NoError(err)
+				req.True(written)
+			}
+
+			r := &ConfigEntryController{
+				ConsulClient:   consulClient,
+				DatacenterName: datacenterName,
+			}
+			drifts, err := r.Diff([]string{capi.ServiceDefaults, capi.ServiceResolver}, c.resources)
+			req.NoError(err)
+			// The indexes of the entries in Consul vary so they're not
+			// compared.
+			for i := range drifts {
+				drifts[i].Consul = testIndexesRegexp.ReplaceAllString(drifts[i].Consul, `"CreateIndex":0,"ModifyIndex":0`)
+			}
+			req.Equal(c.expDrifts, drifts)
+		})
+	}
+}
+
+var testIndexesRegexp = regexp.MustCompile(`"CreateIndex":\d+,"ModifyIndex":\d+`)
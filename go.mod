@@ -29,6 +29,7 @@ require (
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/mitchellh/go-testing-interface v1.14.0 // indirect
 	github.com/mitchellh/mapstructure v1.4.1 // indirect
+	github.com/prometheus/client_golang v1.4.0
 	github.com/radovskyb/watcher v1.0.2
 	github.com/stretchr/testify v1.5.1
 	go.opencensus.io v0.22.0 // indirect
@@ -4,17 +4,31 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
 
+const (
+	// DefaultMaxRetries is the default number of times an item is retried.
+	DefaultMaxRetries = 5
+
+	// defaultBaseDelay and defaultMaxDelay match the exponential backoff of
+	// workqueue.DefaultControllerRateLimiter.
+	defaultBaseDelay = 5 * time.Millisecond
+	defaultMaxDelay  = 1000 * time.Second
+)
+
 // Controller is a generic cache.Controller implementation that watches
 // Kubernetes for changes to specific set of resources and calls the configured
 // callbacks as data changes.
@@ -22,7 +36,68 @@ type Controller struct {
 	Log      hclog.Logger
 	Resource Resource
 
-	informer cache.SharedIndexInformer
+	// BaseDelay and MaxDelay configure the exponential backoff between
+	// retries of an item that failed processing. If both are zero, the
+	// client-go default controller rate limiter is used.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// ProcessUnchangedUpdates causes updates to objects whose resource
+	// version didn't change to be processed. These are delivered by relists
+	// and periodic resyncs and are skipped by default. Set this if the
+	// Resource's informers are configured to resync so that resyncs reach
+	// Upsert.
+	ProcessUnchangedUpdates bool
+
+	// MaxRetries is the number of times an item that failed processing is
+	// retried before it's dropped. Defaults to DefaultMaxRetries if zero.
+	MaxRetries int
+
+	// Workers is the number of goroutines processing items concurrently.
+	// The workqueue never hands out the same key to two workers at once, but
+	// the Resource's callbacks must be safe for concurrent use if this is
+	// greater than one. Defaults to 1 if zero.
+	Workers int
+
+	// ItemTimeout bounds how long the Resource may spend processing a
+	// single item if it implements ContextResource. If zero, items are
+	// processed without a timeout.
+	ItemTimeout time.Duration
+
+	// ShutdownTimeout bounds how long Run keeps processing the items that
+	// are still queued once stopCh is closed. Items still queued when it
+	// elapses are dropped. If zero, Run processes all queued items before
+	// returning.
+	ShutdownTimeout time.Duration
+
+	// Name names the queue of items to process. The standard workqueue
+	// metrics are only published for named queues, see
+	// SetWorkqueueMetricsProvider.
+	Name string
+
+	// RetryThreshold is the number of retries after which an item is
+	// counted by the workqueue_items_over_retry_threshold gauge, e.g. to
+	// alert on items that keep failing. The gauge is only registered if
+	// MetricsRegistry is set.
+	RetryThreshold  int
+	MetricsRegistry prometheus.Registerer
+
+	// overThreshold holds the keys of the items that have been retried more
+	// than RetryThreshold times. It is guarded by retryLock.
+	overThreshold      map[string]struct{}
+	overThresholdGauge prometheus.Gauge
+	retryLock          sync.Mutex
+
+	// informers is guarded by lock since HasSynced may be called
+	// concurrently with Run.
+	informers []cache.SharedIndexInformer
+	lock      sync.RWMutex
+
+	// alive is set to 1 while Run is running, including while it waits for
+	// the initial cache sync.
+	alive int32
+	// running is set to 1 while the worker loop is running.
+	running int32
 }
 
 // Event is something that occurred to the resources we're watching.
@@ -46,38 +121,31 @@ func (c *Controller) Run(stopCh <-chan struct{}) {
 	// Properly handle any panics
 	defer utilruntime.HandleCrash()
 
-	// Create an informer so we can keep track of all service changes.
-	informer := c.Resource.Informer()
-	c.informer = informer
+	atomic.StoreInt32(&c.alive, 1)
+	defer atomic.StoreInt32(&c.alive, 0)
+
+	// Create the informers so we can keep track of all resource changes.
+	informers := c.resourceInformers()
+	c.lock.Lock()
+	c.informers = informers
+	c.lock.Unlock()
+
+	if err := c.registerMetrics(); err != nil {
+		utilruntime.HandleError(fmt.Errorf("error registering metrics: %s", err))
+	}
 
-	// Create a queue for storing items to process from the informer.
+	// Create a queue for storing items to process from the informers.
 	var queueOnce sync.Once
-	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	queue := workqueue.NewNamedRateLimitingQueue(c.rateLimiter(), c.Name)
 	shutdown := func() { queue.ShutDown() }
 	defer queueOnce.Do(shutdown)
 
-	// Add an event handler when data is received from the informer. The
+	// Add an event handler when data is received from the informers. The
 	// event handlers here will block the informer so we just offload them
 	// immediately into a workqueue.
-	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			// convert the resource object into a key (in this case
-			// we are just doing it in the format of 'namespace/name')
-			key, err := cache.MetaNamespaceKeyFunc(obj)
-			c.Log.Debug("queue", "op", "add", "key", key)
-			if err == nil {
-				queue.Add(Event{Key: key, Obj: obj})
-			}
-		},
-		UpdateFunc: func(oldObj, newObj interface{}) {
-			key, err := cache.MetaNamespaceKeyFunc(newObj)
-			c.Log.Debug("queue", "op", "update", "key", key)
-			if err == nil {
-				queue.Add(Event{Key: key, Obj: newObj})
-			}
-		},
-		DeleteFunc: c.informerDeleteHandler(queue),
-	})
+	for _, informer := range informers {
+		informer.AddEventHandler(c.informerEventHandler(queue))
+	}
 
 	// If the type is a background syncer, then we startup the background
 	// process.
@@ -109,58 +177,241 @@ func (c *Controller) Run(stopCh <-chan struct{}) {
 		}()
 	}
 
-	// Run the informer to start requesting resources
-	go func() {
-		informer.Run(stopCh)
+	// Run the informers to start requesting resources
+	for _, informer := range informers {
+		go func(informer cache.SharedIndexInformer) {
+			informer.Run(stopCh)
 
-		// We have to shut down the queue here if we stop so that
-		// wait.Until stops below too. We can't wait until the defer at
-		// the top since wait.Until will block.
+			// We have to shut down the queue here if we stop so that
+			// wait.Until stops below too. We can't wait until the defer at
+			// the top since wait.Until will block.
+			queueOnce.Do(shutdown)
+		}(informer)
+	}
+
+	// Shut down the queue once we stop even if there are no informers
+	// whose exit would shut it down.
+	go func() {
+		<-stopCh
 		queueOnce.Do(shutdown)
 	}()
 
+	// If the informers change while we run, let the Resource add and remove
+	// them. Removed informers must not shut down the queue so they're run
+	// by the informerSet.
+	if di, ok := c.Resource.(DynamicInformer); ok {
+		set := &informerSet{
+			ctrl:   c,
+			queue:  queue,
+			stopCh: stopCh,
+			stops:  make(map[cache.SharedIndexInformer]chan struct{}),
+		}
+		doneCh := make(chan struct{})
+		go func() {
+			defer close(doneCh)
+			di.RunInformers(stopCh, set)
+		}()
+		defer func() { <-doneCh }()
+	}
+
 	// Initial sync
-	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+	if !cache.WaitForCacheSync(stopCh, c.HasSynced) {
 		utilruntime.HandleError(fmt.Errorf("error syncing cache"))
 		return
 	}
 	c.Log.Debug("initial cache sync complete")
 
-	// run the runWorker method every second with a stop channel
-	wait.Until(func() {
-		for c.processSingle(queue, informer) {
-			// Process
-		}
-	}, time.Second, stopCh)
+	atomic.StoreInt32(&c.running, 1)
+	defer atomic.StoreInt32(&c.running, 0)
+
+	// Once stopCh is closed the queue is shut down, but the items that are
+	// already queued are still returned by it. drainTimeoutCh is closed,
+	// and the items' contexts are cancelled, once we've spent
+	// ShutdownTimeout processing them.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	drainTimeoutCh := make(chan struct{})
+	if c.ShutdownTimeout > 0 {
+		go func() {
+			<-stopCh
+			time.Sleep(c.ShutdownTimeout)
+			close(drainTimeoutCh)
+			cancel()
+		}()
+	}
+
+	// Run the workers every second with a stop channel and wait until they
+	// have all stopped.
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.Until(func() {
+				for c.processSingle(ctx, queue) {
+					select {
+					case <-drainTimeoutCh:
+						c.Log.Warn("shutdown timeout exceeded, dropping queued items", "remaining", queue.Len())
+						return
+					default:
+					}
+				}
+			}, time.Second, stopCh)
+		}()
+	}
+	wg.Wait()
 }
 
-// HasSynced implements cache.Controller
+// HasSynced implements cache.Controller. It returns true only once all of
+// the informers have synced. If the Resource is a DynamicInformer, its
+// informers must have been added first. If the Resource is a WatchStatus,
+// it returns false while the Resource isn't watching.
 func (c *Controller) HasSynced() bool {
-	if c.informer == nil {
+	if ws, ok := c.Resource.(WatchStatus); ok && !ws.Watching() {
+		return false
+	}
+	di, dynamic := c.Resource.(DynamicInformer)
+	if dynamic && !di.InformersSynced() {
+		return false
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	// A DynamicInformer may legitimately have no informers, e.g. if no
+	// namespace matches its selector.
+	if len(c.informers) == 0 && !dynamic {
 		return false
 	}
 
-	return c.informer.HasSynced()
+	for _, informer := range c.informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
 }
 
-// LastSyncResourceVersion implements cache.Controller
+// LastSyncResourceVersion implements cache.Controller. If there are multiple
+// informers, it returns the resource version of the first one.
 func (c *Controller) LastSyncResourceVersion() string {
-	if c.informer == nil {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if len(c.informers) == 0 {
 		return ""
 	}
 
-	return c.informer.LastSyncResourceVersion()
+	return c.informers[0].LastSyncResourceVersion()
+}
+
+// Running returns true while the worker loop processing events is running,
+// i.e. after the initial cache sync and until Run returns.
+func (c *Controller) Running() bool {
+	return atomic.LoadInt32(&c.running) == 1
+}
+
+// Alive returns true from the moment Run is called until it returns,
+// whether or not the informers have synced. Unlike Running, it is meant for
+// liveness probes: a controller whose informers can't sync, e.g. because the
+// API server is unreachable, is still alive.
+func (c *Controller) Alive() bool {
+	return atomic.LoadInt32(&c.alive) == 1
+}
+
+// rateLimiter returns the rate limiter of the queue of items to process.
+func (c *Controller) rateLimiter() workqueue.RateLimiter {
+	if c.BaseDelay == 0 && c.MaxDelay == 0 {
+		return workqueue.DefaultControllerRateLimiter()
+	}
+	baseDelay, maxDelay := c.BaseDelay, c.MaxDelay
+	if baseDelay == 0 {
+		baseDelay = defaultBaseDelay
+	}
+	if maxDelay == 0 {
+		maxDelay = defaultMaxDelay
+	}
+	return workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay)
+}
+
+// registerMetrics registers the gauge of the items over the retry threshold
+// with MetricsRegistry if it's set. A gauge registered by a previous Run is
+// reused.
+func (c *Controller) registerMetrics() error {
+	c.retryLock.Lock()
+	defer c.retryLock.Unlock()
+	c.overThreshold = make(map[string]struct{})
+	if c.MetricsRegistry == nil {
+		return nil
+	}
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "workqueue_items_over_retry_threshold",
+		Help:        "Number of items of the workqueue that have been retried more than the retry threshold.",
+		ConstLabels: prometheus.Labels{"name": c.Name},
+	})
+	if err := c.MetricsRegistry.Register(gauge); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return err
+		}
+		gauge = are.ExistingCollector.(prometheus.Gauge)
+	}
+	gauge.Set(0)
+	c.overThresholdGauge = gauge
+	return nil
+}
+
+// trackRetries records whether the item with key has been retried more than
+// RetryThreshold times and updates the gauge accordingly.
+func (c *Controller) trackRetries(key string, retries int) {
+	c.retryLock.Lock()
+	defer c.retryLock.Unlock()
+	if c.overThreshold == nil {
+		c.overThreshold = make(map[string]struct{})
+	}
+	if retries > c.RetryThreshold {
+		c.overThreshold[key] = struct{}{}
+	} else {
+		delete(c.overThreshold, key)
+	}
+	if c.overThresholdGauge != nil {
+		c.overThresholdGauge.Set(float64(len(c.overThreshold)))
+	}
+}
+
+// maxRetries returns the number of times a failed item is retried.
+func (c *Controller) maxRetries() int {
+	if c.MaxRetries == 0 {
+		return DefaultMaxRetries
+	}
+	return c.MaxRetries
+}
+
+// workers returns the number of goroutines processing items.
+func (c *Controller) workers() int {
+	if c.Workers <= 0 {
+		return 1
+	}
+	return c.Workers
+}
+
+// resourceInformers returns the informers to watch the Resource with.
+func (c *Controller) resourceInformers() []cache.SharedIndexInformer {
+	if mi, ok := c.Resource.(MultiInformer); ok {
+		return mi.Informers()
+	}
+	return []cache.SharedIndexInformer{c.Resource.Informer()}
 }
 
 func (c *Controller) processSingle(
+	ctx context.Context,
 	queue workqueue.RateLimitingInterface,
-	informer cache.SharedIndexInformer,
 ) bool {
 	// Fetch the next item
 	rawEvent, quit := queue.Get()
 	if quit {
 		return false
 	}
+	// Done must be called whatever the outcome, including when the item is
+	// requeued below: it marks the item as no longer being processed, and
+	// the queue won't hand it out again until then.
 	defer queue.Done(rawEvent)
 
 	event, ok := rawEvent.(Event)
@@ -169,10 +420,10 @@ func (c *Controller) processSingle(
 		return true
 	}
 
-	// Get the item from the informer to ensure we have the most up-to-date
+	// Get the item from the informers to ensure we have the most up-to-date
 	// copy.
 	key := event.Key
-	item, exists, err := informer.GetIndexer().GetByKey(key)
+	item, exists, err := c.getByKey(key)
 
 	// If we got the item successfully, call the proper method
 	if err == nil {
@@ -181,23 +432,30 @@ func (c *Controller) processSingle(
 		if !exists {
 			// In the case of deletes, the item is no longer in the cache so
 			// we use the copy we got at the time of the event (event.Obj).
-			err = c.Resource.Delete(key, event.Obj)
+			err = c.delete(ctx, key, event.Obj)
 		} else {
-			err = c.Resource.Upsert(key, item)
+			err = c.upsert(ctx, key, item)
 		}
 
 		if err == nil {
 			queue.Forget(rawEvent)
+			c.trackRetries(key, 0)
 		}
 	}
 
-	if err != nil {
-		if queue.NumRequeues(event) < 5 {
+	var requeueErr *RequeueAfterError
+	if errors.As(err, &requeueErr) {
+		c.Log.Debug("failed processing item, requeueing", "key", key, "delay", requeueErr.Delay, "error", err)
+		queue.AddAfter(rawEvent, requeueErr.Delay)
+	} else if err != nil {
+		if queue.NumRequeues(event) < c.maxRetries() {
 			c.Log.Error("failed processing item, retrying", "key", key, "error", err)
 			queue.AddRateLimited(rawEvent)
+			c.trackRetries(key, queue.NumRequeues(rawEvent))
 		} else {
 			c.Log.Error("failed processing item, no more retries", "key", key, "error", err)
 			queue.Forget(rawEvent)
+			c.trackRetries(key, 0)
 			utilruntime.HandleError(err)
 		}
 	}
@@ -205,6 +463,103 @@ func (c *Controller) processSingle(
 	return true
 }
 
+// getByKey returns the object with key from the cache of the first
+// informer that has it.
+func (c *Controller) getByKey(key string) (item interface{}, exists bool, err error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for _, informer := range c.informers {
+		item, exists, err = informer.GetIndexer().GetByKey(key)
+		if err != nil || exists {
+			break
+		}
+	}
+	return item, exists, err
+}
+
+// upsert calls the Resource's UpsertContext if it implements
+// ContextResource, and Upsert otherwise.
+func (c *Controller) upsert(ctx context.Context, key string, obj interface{}) error {
+	cr, ok := c.Resource.(ContextResource)
+	if !ok {
+		return c.Resource.Upsert(key, obj)
+	}
+	ctx, cancel := c.itemContext(ctx)
+	defer cancel()
+	return cr.UpsertContext(ctx, key, obj)
+}
+
+// delete calls the Resource's DeleteContext if it implements
+// ContextResource, and Delete otherwise.
+func (c *Controller) delete(ctx context.Context, key string, obj interface{}) error {
+	cr, ok := c.Resource.(ContextResource)
+	if !ok {
+		return c.Resource.Delete(key, obj)
+	}
+	ctx, cancel := c.itemContext(ctx)
+	defer cancel()
+	return cr.DeleteContext(ctx, key, obj)
+}
+
+// itemContext returns the context to process a single item with.
+func (c *Controller) itemContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.ItemTimeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.ItemTimeout)
+}
+
+// informerEventHandler returns the handler queueing the events of an
+// informer.
+func (c *Controller) informerEventHandler(queue workqueue.RateLimitingInterface) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			// convert the resource object into a key (in this case
+			// we are just doing it in the format of 'namespace/name')
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			c.Log.Debug("queue", "op", "add", "key", key)
+			if err == nil {
+				queue.Add(Event{Key: key, Obj: obj})
+			}
+		},
+		UpdateFunc: c.informerUpdateHandler(queue),
+		DeleteFunc: c.informerDeleteHandler(queue),
+	}
+}
+
+// informerUpdateHandler returns a function that implements
+// `UpdateFunc` from the `ResourceEventHandlerFuncs` interface.
+// It is split out as its own method to aid in testing.
+func (c *Controller) informerUpdateHandler(queue workqueue.RateLimitingInterface) func(oldObj, newObj interface{}) {
+	return func(oldObj, newObj interface{}) {
+		// Relists deliver updates for objects that haven't changed. These
+		// have the same resource version so we skip them rather than
+		// queueing a no-op update.
+		if !c.ProcessUnchangedUpdates && sameResourceVersion(oldObj, newObj) {
+			return
+		}
+		key, err := cache.MetaNamespaceKeyFunc(newObj)
+		c.Log.Debug("queue", "op", "update", "key", key)
+		if err == nil {
+			queue.Add(Event{Key: key, Obj: newObj})
+		}
+	}
+}
+
+// sameResourceVersion returns true if both objects have the same, non-empty
+// resource version.
+func sameResourceVersion(oldObj, newObj interface{}) bool {
+	oldMeta, err := meta.Accessor(oldObj)
+	if err != nil {
+		return false
+	}
+	newMeta, err := meta.Accessor(newObj)
+	if err != nil {
+		return false
+	}
+	return oldMeta.GetResourceVersion() != "" && oldMeta.GetResourceVersion() == newMeta.GetResourceVersion()
+}
+
 // informerDeleteHandler returns a function that implements
 // `DeleteFunc` from the `ResourceEventHandlerFuncs` interface.
 // It is split out as its own method to aid in testing.
@@ -224,3 +579,71 @@ func (c *Controller) informerDeleteHandler(queue workqueue.RateLimitingInterface
 		}
 	}
 }
+
+// informerSet implements InformerSet for a running Controller.
+type informerSet struct {
+	ctrl   *Controller
+	queue  workqueue.RateLimitingInterface
+	stopCh <-chan struct{}
+
+	// stops are closed to stop the added informers. They are guarded by
+	// lock.
+	stops map[cache.SharedIndexInformer]chan struct{}
+	lock  sync.Mutex
+}
+
+func (s *informerSet) Add(informer cache.SharedIndexInformer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.stops[informer]; ok {
+		return
+	}
+	stop := make(chan struct{})
+	s.stops[informer] = stop
+
+	s.ctrl.lock.Lock()
+	s.ctrl.informers = append(s.ctrl.informers, informer)
+	s.ctrl.lock.Unlock()
+
+	informer.AddEventHandler(s.ctrl.informerEventHandler(s.queue))
+	// The informer stops when it's removed or when the Controller stops.
+	informerStopCh := make(chan struct{})
+	go func() {
+		defer close(informerStopCh)
+		select {
+		case <-stop:
+		case <-s.stopCh:
+		}
+	}()
+	go informer.Run(informerStopCh)
+}
+
+func (s *informerSet) Remove(informer cache.SharedIndexInformer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stop, ok := s.stops[informer]
+	if !ok {
+		return
+	}
+	delete(s.stops, informer)
+
+	// Remove the informer before queueing its objects so that they're
+	// looked up in the remaining informers only.
+	s.ctrl.lock.Lock()
+	for i, inf := range s.ctrl.informers {
+		if inf == informer {
+			s.ctrl.informers = append(s.ctrl.informers[:i], s.ctrl.informers[i+1:]...)
+			break
+		}
+	}
+	s.ctrl.lock.Unlock()
+	close(stop)
+
+	for _, obj := range informer.GetStore().List() {
+		key, err := cache.MetaNamespaceKeyFunc(obj)
+		s.ctrl.Log.Debug("queue", "op", "remove", "key", key)
+		if err == nil {
+			s.queue.Add(Event{Key: key, Obj: obj})
+		}
+	}
+}
@@ -2,11 +2,16 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -156,6 +161,597 @@ func TestController_update(t *testing.T) {
 	closer()
 }
 
+// Test that each transition of a pod, e.g. from Pending to Running and from
+// unready to Ready, reaches the resource in order.
+func TestController_podTransitions(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	client := fake.NewSimpleClientset()
+	resource := &recordingResource{informer: testPodInformer(client)}
+	closer := TestControllerRun(resource)
+	defer closer()
+
+	// waitForCall waits for the resource to have been called n times and
+	// returns the last call.
+	waitForCall := func(n int) recordedCall {
+		var calls []recordedCall
+		require.Eventually(func() bool {
+			calls = resource.Calls()
+			return len(calls) >= n
+		}, time.Second, 10*time.Millisecond)
+		require.Len(calls, n)
+		return calls[n-1]
+	}
+
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Status: apiv1.PodStatus{Phase: apiv1.PodPending},
+	}
+	pod, err := client.CoreV1().Pods(pod.Namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+	require.NoError(err)
+	call := waitForCall(1)
+	require.Equal("upsert", call.Op)
+	require.Equal("default/foo", call.Key)
+	require.Equal(apiv1.PodPending, call.Obj.(*apiv1.Pod).Status.Phase)
+
+	// Pending to Running.
+	pod.Status.Phase = apiv1.PodRunning
+	pod.Status.Conditions = []apiv1.PodCondition{{Type: apiv1.PodReady, Status: apiv1.ConditionFalse}}
+	pod, err = client.CoreV1().Pods(pod.Namespace).Update(context.Background(), pod, metav1.UpdateOptions{})
+	require.NoError(err)
+	call = waitForCall(2)
+	require.Equal("upsert", call.Op)
+	require.Equal("default/foo", call.Key)
+	require.Equal(apiv1.PodRunning, call.Obj.(*apiv1.Pod).Status.Phase)
+	require.Equal(apiv1.ConditionFalse, call.Obj.(*apiv1.Pod).Status.Conditions[0].Status)
+
+	// Unready to Ready.
+	pod.Status.Conditions[0].Status = apiv1.ConditionTrue
+	_, err = client.CoreV1().Pods(pod.Namespace).Update(context.Background(), pod, metav1.UpdateOptions{})
+	require.NoError(err)
+	call = waitForCall(3)
+	require.Equal("upsert", call.Op)
+	require.Equal("default/foo", call.Key)
+	require.Equal(apiv1.ConditionTrue, call.Obj.(*apiv1.Pod).Status.Conditions[0].Status)
+
+	require.NoError(client.CoreV1().Pods(pod.Namespace).Delete(context.Background(), pod.Name, metav1.DeleteOptions{}))
+	call = waitForCall(4)
+	require.Equal("delete", call.Op)
+	require.Equal("default/foo", call.Key)
+}
+
+// Test that resources implementing MultiInformer receive events from
+// all of their informers.
+func TestController_multiInformer(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	client := fake.NewSimpleClientset()
+	resource, data, deleted, dataLock := testResource(client)
+	mresource := &testMultiInformer{
+		Resource: resource,
+		informers: []cache.SharedIndexInformer{
+			testNamespaceInformer(client, "foo"),
+			testNamespaceInformer(client, "bar"),
+		},
+	}
+
+	// Start the controller
+	closer := TestControllerRun(mresource)
+
+	// Wait some period of time
+	time.Sleep(100 * time.Millisecond)
+
+	for _, ns := range []string{"foo", "bar", "baz"} {
+		svc := testService("svc")
+		svc.Namespace = ns
+		_, err := client.CoreV1().Services(ns).Create(context.Background(), svc, metav1.CreateOptions{})
+		require.NoError(err)
+	}
+
+	// Wait a bit so that the creates hopefully propagate
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(client.CoreV1().Services("bar").Delete(context.Background(), "svc", metav1.DeleteOptions{}))
+
+	// Wait some period of time
+	time.Sleep(100 * time.Millisecond)
+	closer()
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	require.Len(data, 1)
+	require.Contains(data, "foo/svc")
+	require.Len(deleted, 1)
+	require.Contains(deleted, "bar/svc")
+}
+
+// Test that resources implementing DynamicInformer receive events from the
+// informers they add until they remove them, and that the objects of a
+// removed informer are processed as deleted.
+func TestController_dynamicInformer(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	client := fake.NewSimpleClientset()
+	resource, data, deleted, dataLock := testResource(client)
+	fooInformer := testNamespaceInformer(client, "foo")
+	dresource := &testDynamicInformer{
+		Resource: resource,
+		initial:  []cache.SharedIndexInformer{fooInformer},
+		removeCh: make(chan cache.SharedIndexInformer),
+	}
+	// The resource's own informer watches the default namespace.
+	ctrl := &Controller{Log: hclog.Default(), Resource: dresource}
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ctrl.Run(stopCh)
+	}()
+	defer func() {
+		close(stopCh)
+		<-doneCh
+	}()
+
+	for _, ns := range []string{"default", "foo", "bar"} {
+		svc := testService("svc")
+		svc.Namespace = ns
+		_, err := client.CoreV1().Services(ns).Create(context.Background(), svc, metav1.CreateOptions{})
+		require.NoError(err)
+	}
+	require.Eventually(func() bool {
+		dataLock.Lock()
+		defer dataLock.Unlock()
+		_, okDefault := data["default/svc"]
+		_, okFoo := data["foo/svc"]
+		return okDefault && okFoo
+	}, 5*time.Second, 10*time.Millisecond)
+	require.True(ctrl.HasSynced())
+
+	// Removing the informer processes its objects as deleted.
+	dresource.removeCh <- fooInformer
+	require.Eventually(func() bool {
+		dataLock.Lock()
+		defer dataLock.Unlock()
+		_, ok := deleted["foo/svc"]
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	require.Len(data, 1)
+	require.Contains(data, "default/svc")
+	require.NotContains(data, "bar/svc")
+}
+
+// Test that the controller isn't synced while a resource implementing
+// WatchStatus isn't watching, even though its informer synced.
+func TestController_watchStatus(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	client := fake.NewSimpleClientset()
+	resource, _, _, _ := testResource(client)
+	wresource := &testWatchStatus{Resource: resource, watching: 1}
+	ctrl := &Controller{Log: hclog.Default(), Resource: wresource}
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ctrl.Run(stopCh)
+	}()
+	defer func() {
+		close(stopCh)
+		<-doneCh
+	}()
+
+	require.Eventually(ctrl.HasSynced, 5*time.Second, 10*time.Millisecond)
+	atomic.StoreInt32(&wresource.watching, 0)
+	require.False(ctrl.HasSynced())
+	atomic.StoreInt32(&wresource.watching, 1)
+	require.True(ctrl.HasSynced())
+}
+
+// Test that failed items are retried after the configured base delay and
+// dropped after the configured number of retries.
+func TestController_retries(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	client := fake.NewSimpleClientset()
+	var lock sync.Mutex
+	var attempts []time.Time
+	resource := NewResource(testInformer(client),
+		func(key string, v interface{}) error {
+			lock.Lock()
+			defer lock.Unlock()
+			attempts = append(attempts, time.Now())
+			return fmt.Errorf("failed")
+		},
+		func(key string, v interface{}) error {
+			return nil
+		},
+	)
+	baseDelay := 200 * time.Millisecond
+	ctrl := &Controller{
+		Log:        hclog.Default(),
+		Resource:   resource,
+		BaseDelay:  baseDelay,
+		MaxRetries: 1,
+	}
+
+	// Start the controller
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ctrl.Run(stopCh)
+	}()
+
+	_, err := client.CoreV1().Services(metav1.NamespaceDefault).Create(context.Background(), testService("foo"), metav1.CreateOptions{})
+	require.NoError(err)
+
+	// Wait long enough for more than the configured retries to happen.
+	time.Sleep(4 * baseDelay)
+	close(stopCh)
+	<-doneCh
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(attempts, 2)
+	require.True(attempts[1].Sub(attempts[0]) >= baseDelay, "retried after %s", attempts[1].Sub(attempts[0]))
+}
+
+// Test that an item that keeps failing is retried MaxRetries times and then
+// dropped, and that it doesn't block the processing of later items.
+func TestController_retriesExhausted(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	client := fake.NewSimpleClientset()
+	var lock sync.Mutex
+	attempts := make(map[string]int)
+	resource := NewResource(testInformer(client),
+		func(key string, v interface{}) error {
+			lock.Lock()
+			defer lock.Unlock()
+			attempts[key]++
+			if key == "default/fail" {
+				return fmt.Errorf("failed")
+			}
+			return nil
+		},
+		func(key string, v interface{}) error {
+			return nil
+		},
+	)
+	const maxRetries = 3
+	ctrl := &Controller{
+		Log:        hclog.Default(),
+		Resource:   resource,
+		BaseDelay:  10 * time.Millisecond,
+		MaxRetries: maxRetries,
+	}
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ctrl.Run(stopCh)
+	}()
+
+	_, err := client.CoreV1().Services(metav1.NamespaceDefault).Create(context.Background(), testService("fail"), metav1.CreateOptions{})
+	require.NoError(err)
+	// Wait long enough for all the retries to happen.
+	time.Sleep(500 * time.Millisecond)
+	_, err = client.CoreV1().Services(metav1.NamespaceDefault).Create(context.Background(), testService("ok"), metav1.CreateOptions{})
+	require.NoError(err)
+	time.Sleep(200 * time.Millisecond)
+	close(stopCh)
+	<-doneCh
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Equal(1+maxRetries, attempts["default/fail"])
+	require.Equal(1, attempts["default/ok"])
+}
+
+// Test that an item that fails with a RequeueAfterError is retried after
+// its delay and that these retries don't count against MaxRetries.
+func TestController_requeueAfter(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	client := fake.NewSimpleClientset()
+	var lock sync.Mutex
+	var attempts []time.Time
+	delay := 100 * time.Millisecond
+	resource := NewResource(testInformer(client),
+		func(key string, v interface{}) error {
+			lock.Lock()
+			defer lock.Unlock()
+			attempts = append(attempts, time.Now())
+			if len(attempts) < 4 {
+				return &RequeueAfterError{Err: fmt.Errorf("failed"), Delay: delay}
+			}
+			return nil
+		},
+		func(key string, v interface{}) error {
+			return nil
+		},
+	)
+	ctrl := &Controller{
+		Log:        hclog.Default(),
+		Resource:   resource,
+		BaseDelay:  time.Millisecond,
+		MaxRetries: 1,
+	}
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ctrl.Run(stopCh)
+	}()
+
+	_, err := client.CoreV1().Services(metav1.NamespaceDefault).Create(context.Background(), testService("foo"), metav1.CreateOptions{})
+	require.NoError(err)
+
+	// Wait long enough for all the retries to happen.
+	time.Sleep(6 * delay)
+	close(stopCh)
+	<-doneCh
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(attempts, 4)
+	for i := 1; i < len(attempts); i++ {
+		require.True(attempts[i].Sub(attempts[i-1]) >= delay, "retried after %s", attempts[i].Sub(attempts[i-1]))
+	}
+}
+
+// Test that items retried more than the retry threshold are counted by the
+// gauge.
+func TestController_retryThreshold(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	client := fake.NewSimpleClientset()
+	resource := NewResource(testInformer(client),
+		func(key string, v interface{}) error {
+			if key == "default/bar" {
+				return nil
+			}
+			return fmt.Errorf("failed")
+		},
+		func(key string, v interface{}) error {
+			return nil
+		},
+	)
+	ctrl := &Controller{
+		Log:             hclog.Default(),
+		Resource:        resource,
+		Name:            "retry-threshold",
+		BaseDelay:       time.Millisecond,
+		MaxDelay:        10 * time.Millisecond,
+		MaxRetries:      1000,
+		RetryThreshold:  2,
+		MetricsRegistry: prometheus.NewRegistry(),
+	}
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ctrl.Run(stopCh)
+	}()
+	defer func() {
+		close(stopCh)
+		<-doneCh
+	}()
+
+	for _, name := range []string{"foo", "bar"} {
+		_, err := client.CoreV1().Services(metav1.NamespaceDefault).Create(context.Background(), testService(name), metav1.CreateOptions{})
+		require.NoError(err)
+	}
+
+	// Only foo keeps failing.
+	time.Sleep(200 * time.Millisecond)
+	ctrl.retryLock.Lock()
+	defer ctrl.retryLock.Unlock()
+	require.Equal(float64(1), promtestutil.ToFloat64(ctrl.overThresholdGauge))
+	require.Contains(ctrl.overThreshold, "default/foo")
+}
+
+// Test that items that are queued when the controller is stopped are
+// processed before Run returns, unless the shutdown timeout elapses first.
+func TestController_shutdown(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		ShutdownTimeout time.Duration
+		ExpAll          bool
+	}{
+		"no timeout": {
+			ShutdownTimeout: 0,
+			ExpAll:          true,
+		},
+		"timeout longer than the drain": {
+			ShutdownTimeout: 5 * time.Second,
+			ExpAll:          true,
+		},
+		"timeout shorter than the drain": {
+			ShutdownTimeout: 100 * time.Millisecond,
+			ExpAll:          false,
+		},
+	}
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require := require.New(t)
+
+			const numItems = 10
+			client := fake.NewSimpleClientset()
+			for i := 0; i < numItems; i++ {
+				_, err := client.CoreV1().Services(metav1.NamespaceDefault).Create(context.Background(), testService(fmt.Sprintf("svc-%d", i)), metav1.CreateOptions{})
+				require.NoError(err)
+			}
+
+			var processed int32
+			startedCh := make(chan struct{})
+			var startedOnce sync.Once
+			resource := NewResource(testInformer(client),
+				func(key string, v interface{}) error {
+					startedOnce.Do(func() { close(startedCh) })
+					time.Sleep(50 * time.Millisecond)
+					atomic.AddInt32(&processed, 1)
+					return nil
+				},
+				func(key string, v interface{}) error {
+					return nil
+				},
+			)
+			ctrl := &Controller{
+				Log:             hclog.Default(),
+				Resource:        resource,
+				ShutdownTimeout: c.ShutdownTimeout,
+			}
+
+			stopCh := make(chan struct{})
+			doneCh := make(chan struct{})
+			go func() {
+				defer close(doneCh)
+				ctrl.Run(stopCh)
+			}()
+
+			// Stop the controller while the first item is being processed.
+			<-startedCh
+			close(stopCh)
+			<-doneCh
+
+			if c.ExpAll {
+				require.Equal(int32(numItems), atomic.LoadInt32(&processed))
+			} else {
+				require.Less(atomic.LoadInt32(&processed), int32(numItems))
+			}
+		})
+	}
+}
+
+// Test that items are processed concurrently by the configured number of
+// workers and that they are all handled.
+func TestController_workers(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	const numItems = 20
+	const numWorkers = 4
+	client := fake.NewSimpleClientset()
+	for i := 0; i < numItems; i++ {
+		_, err := client.CoreV1().Services(metav1.NamespaceDefault).Create(context.Background(), testService(fmt.Sprintf("svc-%d", i)), metav1.CreateOptions{})
+		require.NoError(err)
+	}
+
+	var lock sync.Mutex
+	processed := make(map[string]bool)
+	var inFlight, maxInFlight int32
+	resource := NewResource(testInformer(client),
+		func(key string, v interface{}) error {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			lock.Lock()
+			if n > maxInFlight {
+				maxInFlight = n
+			}
+			lock.Unlock()
+
+			time.Sleep(50 * time.Millisecond)
+
+			lock.Lock()
+			processed[key] = true
+			lock.Unlock()
+			return nil
+		},
+		func(key string, v interface{}) error {
+			return nil
+		},
+	)
+	ctrl := &Controller{
+		Log:      hclog.Default(),
+		Resource: resource,
+		Workers:  numWorkers,
+	}
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ctrl.Run(stopCh)
+	}()
+
+	// Serially, the items would take numItems * 50ms = 1s to process.
+	time.Sleep(500 * time.Millisecond)
+	close(stopCh)
+	<-doneCh
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(processed, numItems)
+	require.True(maxInFlight > 1, "items were processed serially")
+	require.True(maxInFlight <= numWorkers, "%d items were processed concurrently", maxInFlight)
+}
+
+// Test that ContextResources are called with a context that expires after
+// the item timeout.
+func TestController_itemTimeout(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	client := fake.NewSimpleClientset()
+	errCh := make(chan error, 1)
+	resource := &testContextResource{
+		Resource: NewResource(testInformer(client), nil, nil),
+		upsert: func(ctx context.Context, key string, v interface{}) error {
+			<-ctx.Done()
+			select {
+			case errCh <- ctx.Err():
+			default:
+			}
+			return nil
+		},
+	}
+	ctrl := &Controller{
+		Log:         hclog.Default(),
+		Resource:    resource,
+		ItemTimeout: 100 * time.Millisecond,
+	}
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ctrl.Run(stopCh)
+	}()
+	defer func() {
+		close(stopCh)
+		<-doneCh
+	}()
+
+	_, err := client.CoreV1().Services(metav1.NamespaceDefault).Create(context.Background(), testService("foo"), metav1.CreateOptions{})
+	require.NoError(err)
+
+	select {
+	case err := <-errCh:
+		require.Equal(context.DeadlineExceeded, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("item's context was not cancelled")
+	}
+}
+
 // Test that backgrounders are started and stopped.
 func TestController_backgrounder(t *testing.T) {
 	t.Parallel()
@@ -225,6 +821,91 @@ func TestController_informerDeleteHandler(t *testing.T) {
 	}
 }
 
+func TestController_informerUpdateHandler(t *testing.T) {
+	t.Parallel()
+	withVersion := func(version string) *apiv1.Service {
+		svc := testService("foo")
+		svc.ResourceVersion = version
+		return svc
+	}
+	cases := map[string]struct {
+		Unchanged bool
+		Old       interface{}
+		New       interface{}
+		Exp       *Event
+	}{
+		"same resource version": {
+			Old: withVersion("1"),
+			New: withVersion("1"),
+			Exp: nil,
+		},
+		"same resource version with unchanged updates processed": {
+			Unchanged: true,
+			Old:       withVersion("1"),
+			New:       withVersion("1"),
+			Exp: &Event{
+				Key: "default/foo",
+				Obj: withVersion("1"),
+			},
+		},
+		"different resource version": {
+			Old: withVersion("1"),
+			New: withVersion("2"),
+			Exp: &Event{
+				Key: "default/foo",
+				Obj: withVersion("2"),
+			},
+		},
+		"no resource version": {
+			Old: testService("foo"),
+			New: testService("foo"),
+			Exp: &Event{
+				Key: "default/foo",
+				Obj: testService("foo"),
+			},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctrl := &Controller{Log: hclog.Default(), ProcessUnchangedUpdates: c.Unchanged}
+			queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+			defer queue.ShutDown()
+			ctrl.informerUpdateHandler(queue)(c.Old, c.New)
+
+			if c.Exp == nil {
+				require.Equal(t, queue.Len(), 0)
+			} else {
+				rawEvent, quit := queue.Get()
+				require.False(t, quit)
+				require.Equal(t, *c.Exp, rawEvent)
+			}
+		})
+	}
+}
+
+// Compare detecting unchanged objects by deep equality against comparing
+// their resource versions.
+func BenchmarkUnchangedUpdate(b *testing.B) {
+	oldSvc := testService("foo")
+	oldSvc.ResourceVersion = "1"
+	for i := 0; i < 50; i++ {
+		oldSvc.Spec.Ports = append(oldSvc.Spec.Ports, apiv1.ServicePort{Name: fmt.Sprintf("port-%d", i), Port: int32(i)})
+	}
+	newSvc := oldSvc.DeepCopy()
+
+	b.Run("DeepEqual", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			reflect.DeepEqual(oldSvc, newSvc)
+		}
+	})
+	b.Run("ResourceVersion", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			sameResourceVersion(oldSvc, newSvc)
+		}
+	})
+}
+
 // testBackgrounder implements Backgrounder and has a simple func to check
 // if its running.
 type testBackgrounder struct {
@@ -252,6 +933,74 @@ func (r *testBackgrounder) Run(ch <-chan struct{}) {
 	r.Unlock()
 }
 
+// testMultiInformer implements MultiInformer and returns the given
+// informers instead of the Resource's informer.
+type testMultiInformer struct {
+	Resource
+
+	informers []cache.SharedIndexInformer
+}
+
+func (r *testMultiInformer) Informers() []cache.SharedIndexInformer {
+	return r.informers
+}
+
+// testDynamicInformer implements DynamicInformer. It adds the initial
+// informers and removes the informers sent on removeCh.
+type testDynamicInformer struct {
+	Resource
+
+	initial  []cache.SharedIndexInformer
+	removeCh chan cache.SharedIndexInformer
+	synced   int32
+}
+
+func (r *testDynamicInformer) RunInformers(stopCh <-chan struct{}, set InformerSet) {
+	for _, informer := range r.initial {
+		set.Add(informer)
+	}
+	atomic.StoreInt32(&r.synced, 1)
+	for {
+		select {
+		case informer := <-r.removeCh:
+			set.Remove(informer)
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (r *testDynamicInformer) InformersSynced() bool {
+	return atomic.LoadInt32(&r.synced) == 1
+}
+
+// testWatchStatus implements WatchStatus. It's watching while watching is 1.
+type testWatchStatus struct {
+	Resource
+
+	watching int32
+}
+
+func (r *testWatchStatus) Watching() bool {
+	return atomic.LoadInt32(&r.watching) == 1
+}
+
+// testContextResource implements ContextResource by calling upsert on
+// upserts. Deletes are ignored.
+type testContextResource struct {
+	Resource
+
+	upsert func(context.Context, string, interface{}) error
+}
+
+func (r *testContextResource) UpsertContext(ctx context.Context, key string, v interface{}) error {
+	return r.upsert(ctx, key, v)
+}
+
+func (r *testContextResource) DeleteContext(ctx context.Context, key string, v interface{}) error {
+	return nil
+}
+
 // testService returns a bare bones apiv1.Service structure with the
 // given name set. This is useful with the fake client.
 func testService(name string) *apiv1.Service {
@@ -270,14 +1019,20 @@ func testService(name string) *apiv1.Service {
 // testInformer creates an Informer that operates on the given K8S client
 // and watches for Service entries.
 func testInformer(client kubernetes.Interface) cache.SharedIndexInformer {
+	return testNamespaceInformer(client, metav1.NamespaceDefault)
+}
+
+// testNamespaceInformer creates an Informer that operates on the given K8S
+// client and watches for Service entries in the given namespace.
+func testNamespaceInformer(client kubernetes.Interface, namespace string) cache.SharedIndexInformer {
 	return cache.NewSharedIndexInformer(
 		&cache.ListWatch{
 			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
-				return client.CoreV1().Services(metav1.NamespaceDefault).List(context.Background(), options)
+				return client.CoreV1().Services(namespace).List(context.Background(), options)
 			},
 
 			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
-				return client.CoreV1().Services(metav1.NamespaceDefault).Watch(context.Background(), options)
+				return client.CoreV1().Services(namespace).Watch(context.Background(), options)
 			},
 		},
 		&apiv1.Service{},
@@ -286,6 +1041,66 @@ func testInformer(client kubernetes.Interface) cache.SharedIndexInformer {
 	)
 }
 
+// testPodInformer creates an Informer that operates on the given K8S client
+// and watches for Pod entries in the default namespace.
+func testPodInformer(client kubernetes.Interface) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.CoreV1().Pods(metav1.NamespaceDefault).List(context.Background(), options)
+			},
+
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.CoreV1().Pods(metav1.NamespaceDefault).Watch(context.Background(), options)
+			},
+		},
+		&apiv1.Pod{},
+		0,
+		cache.Indexers{},
+	)
+}
+
+// recordedCall is a call to the callbacks of a recordingResource.
+type recordedCall struct {
+	// Op is "upsert" or "delete".
+	Op  string
+	Key string
+	Obj interface{}
+}
+
+// recordingResource is a Resource that records the calls to its callbacks in
+// order, unlike testResource which only keeps the latest object of each key.
+type recordingResource struct {
+	informer cache.SharedIndexInformer
+
+	lock  sync.Mutex
+	calls []recordedCall
+}
+
+func (r *recordingResource) Informer() cache.SharedIndexInformer { return r.informer }
+
+func (r *recordingResource) Upsert(key string, v interface{}) error {
+	return r.record("upsert", key, v)
+}
+
+func (r *recordingResource) Delete(key string, v interface{}) error {
+	return r.record("delete", key, v)
+}
+
+func (r *recordingResource) record(op, key string, v interface{}) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.calls = append(r.calls, recordedCall{Op: op, Key: key, Obj: v})
+	return nil
+}
+
+// Calls returns the calls recorded so far.
+func (r *recordingResource) Calls() []recordedCall {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]recordedCall(nil), r.calls...)
+}
+
 // testResource creates a Resource implementation that keeps track of the
 // callback data. It returns two maps. The first is a map from resource keys to resources
 // based on the callbacks that have occurred. The second is a map of the resources
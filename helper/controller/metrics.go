@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// SetWorkqueueMetricsProvider publishes the standard metrics of the named
+// workqueues, e.g. their depth, latency and retries, by registering them with
+// reg. The queue of a Controller is only named, and so only has metrics, if
+// its Name is set. client-go only uses the first provider set in a process so
+// this should be called once, before any Controller runs.
+func SetWorkqueueMetricsProvider(reg prometheus.Registerer) {
+	workqueue.SetProvider(newWorkqueueMetricsProvider(reg))
+}
+
+// workqueueMetricsProvider implements workqueue.MetricsProvider with
+// Prometheus metrics labeled by the name of the queue.
+type workqueueMetricsProvider struct {
+	depth          *prometheus.GaugeVec
+	adds           *prometheus.CounterVec
+	latency        *prometheus.HistogramVec
+	workDuration   *prometheus.HistogramVec
+	unfinished     *prometheus.GaugeVec
+	longestRunning *prometheus.GaugeVec
+	retries        *prometheus.CounterVec
+}
+
+func newWorkqueueMetricsProvider(reg prometheus.Registerer) *workqueueMetricsProvider {
+	labels := []string{"name"}
+	p := &workqueueMetricsProvider{
+		depth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "workqueue_depth",
+			Help: "Current depth of the workqueue.",
+		}, labels),
+		adds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workqueue_adds_total",
+			Help: "Total number of adds handled by the workqueue.",
+		}, labels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "workqueue_queue_duration_seconds",
+			Help:    "How long in seconds an item stays in the workqueue before being requested.",
+			Buckets: prometheus.ExponentialBuckets(10e-9, 10, 10),
+		}, labels),
+		workDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "workqueue_work_duration_seconds",
+			Help:    "How long in seconds processing an item from the workqueue takes.",
+			Buckets: prometheus.ExponentialBuckets(10e-9, 10, 10),
+		}, labels),
+		unfinished: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "workqueue_unfinished_work_seconds",
+			Help: "How many seconds of work has been done that is in progress and hasn't been observed " +
+				"by work_duration. Large values indicate stuck workers.",
+		}, labels),
+		longestRunning: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "workqueue_longest_running_processor_seconds",
+			Help: "How many seconds the longest running processor of the workqueue has been running.",
+		}, labels),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workqueue_retries_total",
+			Help: "Total number of retries handled by the workqueue.",
+		}, labels),
+	}
+	reg.MustRegister(p.depth, p.adds, p.latency, p.workDuration, p.unfinished, p.longestRunning, p.retries)
+	return p
+}
+
+func (p *workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return p.depth.WithLabelValues(name)
+}
+
+func (p *workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return p.adds.WithLabelValues(name)
+}
+
+func (p *workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return p.latency.WithLabelValues(name)
+}
+
+func (p *workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return p.workDuration.WithLabelValues(name)
+}
+
+func (p *workqueueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return p.unfinished.WithLabelValues(name)
+}
+
+func (p *workqueueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return p.longestRunning.WithLabelValues(name)
+}
+
+func (p *workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return p.retries.WithLabelValues(name)
+}
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Test that the depth gauge of a named queue reflects its queued items.
+// client-go only uses the first metrics provider that's set so this must be
+// the only test setting one.
+func TestSetWorkqueueMetricsProvider_depth(t *testing.T) {
+	require := require.New(t)
+	reg := prometheus.NewRegistry()
+	SetWorkqueueMetricsProvider(reg)
+
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "test")
+	defer queue.ShutDown()
+	queue.Add(Event{Key: "default/foo"})
+	queue.Add(Event{Key: "default/bar"})
+	// Adding an item that's already queued doesn't change the depth.
+	queue.Add(Event{Key: "default/bar"})
+	require.NoError(promtestutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP workqueue_depth Current depth of the workqueue.
+# TYPE workqueue_depth gauge
+workqueue_depth{name="test"} 2
+`), "workqueue_depth"))
+
+	item, _ := queue.Get()
+	queue.Done(item)
+	require.NoError(promtestutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP workqueue_depth Current depth of the workqueue.
+# TYPE workqueue_depth gauge
+workqueue_depth{name="test"} 1
+`), "workqueue_depth"))
+}
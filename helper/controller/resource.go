@@ -1,6 +1,10 @@
 package controller
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"k8s.io/client-go/tools/cache"
 )
 
@@ -30,6 +34,23 @@ type Resource interface {
 	Delete(key string, obj interface{}) error
 }
 
+// RequeueAfterError can be returned by a Resource's Upsert and Delete
+// callbacks to retry the item after Delay instead of after the Controller's
+// backoff, e.g. when the Resource knows that retrying sooner would fail
+// again. Retries with a RequeueAfterError don't count against MaxRetries.
+type RequeueAfterError struct {
+	Err   error
+	Delay time.Duration
+}
+
+func (e *RequeueAfterError) Error() string {
+	return fmt.Sprintf("%s, requeueing after %s", e.Err, e.Delay)
+}
+
+func (e *RequeueAfterError) Unwrap() error {
+	return e.Err
+}
+
 // Backgrounder should be implemented by a Resource that requires additional
 // background processing. If a Resource implements this, then the Controller
 // will automatically Run the Backgrounder for the duration of the controller.
@@ -40,6 +61,59 @@ type Backgrounder interface {
 	Run(<-chan struct{})
 }
 
+// MultiInformer should be implemented by a Resource that needs more than
+// one informer to watch its resources, for example one informer per namespace.
+// If a Resource implements this, then the Controller will use the informers
+// returned by Informers instead of Informer and merge their events into a
+// single queue.
+type MultiInformer interface {
+	Informers() []cache.SharedIndexInformer
+}
+
+// DynamicInformer should be implemented by a Resource whose informers change
+// while the Controller runs, for example one informer per namespace that
+// matches a label selector. If a Resource implements this, then the
+// Controller calls RunInformers in the background once it has started the
+// informers returned by Informer or Informers. The informers added to the
+// InformerSet are watched in addition to those until they're removed.
+type DynamicInformer interface {
+	// RunInformers adds informers to and removes them from set until stopCh
+	// is closed.
+	RunInformers(stopCh <-chan struct{}, set InformerSet)
+	// InformersSynced returns true once the informers that should initially
+	// be watched have been added to the InformerSet.
+	InformersSynced() bool
+}
+
+// WatchStatus should be implemented by a Resource that knows when its
+// informers lost their watch of the API server, e.g. because the connection
+// dropped. Informers retry on their own and stay synced meanwhile, so if a
+// Resource implements this, then the Controller's HasSynced also returns
+// false while Watching returns false, e.g. so that readiness reflects it.
+type WatchStatus interface {
+	Watching() bool
+}
+
+// InformerSet is the set of informers watched by a running Controller.
+type InformerSet interface {
+	// Add starts informer and queues the events of its objects.
+	Add(informer cache.SharedIndexInformer)
+	// Remove stops informer. The objects in its cache are processed as
+	// deleted unless another informer of the Controller still has them.
+	Remove(informer cache.SharedIndexInformer)
+}
+
+// ContextResource should be implemented by a Resource whose callbacks make
+// calls that should be bounded in time, e.g. calls to Consul. If a Resource
+// implements this, then the Controller will call UpsertContext and
+// DeleteContext instead of Upsert and Delete. The context is cancelled once
+// the Controller's ItemTimeout elapses, or once its ShutdownTimeout elapses
+// while shutting down.
+type ContextResource interface {
+	UpsertContext(ctx context.Context, key string, obj interface{}) error
+	DeleteContext(ctx context.Context, key string, obj interface{}) error
+}
+
 // NewResource returns a Resource implementation for the given informer,
 // upsert handler, and delete handler.
 func NewResource(
@@ -17,6 +17,24 @@ const (
 // it will create it and set crossNSACLPolicy as a policy default.
 // Boolean return value indicates if the namespace was created by this call.
 func EnsureExists(client *capi.Client, ns string, crossNSAClPolicy string) (bool, error) {
+	var aclConfig capi.NamespaceACLConfig
+	if crossNSAClPolicy != "" {
+		// Create the ACLs config for the cross-Consul-namespace
+		// default policy that needs to be attached
+		aclConfig = capi.NamespaceACLConfig{
+			PolicyDefaults: []capi.ACLLink{
+				{Name: crossNSAClPolicy},
+			},
+		}
+	}
+	return EnsureExistsWithACLConfig(client, ns, aclConfig)
+}
+
+// EnsureExistsWithACLConfig ensures a Consul namespace with name ns exists.
+// If it doesn't, it will create it with aclConfig as its ACL config. An
+// existing namespace is left as is.
+// Boolean return value indicates if the namespace was created by this call.
+func EnsureExistsWithACLConfig(client *capi.Client, ns string, aclConfig capi.NamespaceACLConfig) (bool, error) {
 	if ns == WildcardNamespace || ns == DefaultNamespace {
 		return false, nil
 	}
@@ -30,17 +48,6 @@ func EnsureExists(client *capi.Client, ns string, crossNSAClPolicy string) (bool
 	}
 
 	// If not, create it.
-	var aclConfig capi.NamespaceACLConfig
-	if crossNSAClPolicy != "" {
-		// Create the ACLs config for the cross-Consul-namespace
-		// default policy that needs to be attached
-		aclConfig = capi.NamespaceACLConfig{
-			PolicyDefaults: []capi.ACLLink{
-				{Name: crossNSAClPolicy},
-			},
-		}
-	}
-
 	consulNamespace := capi.Namespace{
 		Name:        ns,
 		Description: "Auto-generated by consul-k8s",
@@ -155,6 +155,47 @@ func TestEnsureExists_CreatesNS(tt *testing.T) {
 	}
 }
 
+// Test that the namespace is created with the given ACL config.
+func TestEnsureExistsWithACLConfig_CreatesNS(t *testing.T) {
+	req := require.New(t)
+	masterToken := "master"
+	consul, err := testutil.NewTestServerConfigT(t, func(cfg *testutil.TestServerConfig) {
+		cfg.ACL.Enabled = true
+		cfg.ACL.DefaultPolicy = "deny"
+		cfg.ACL.Tokens.Master = masterToken
+	})
+	req.NoError(err)
+	defer consul.Stop()
+	consul.WaitForLeader(t)
+
+	consulClient, err := capi.NewClient(&capi.Config{
+		Address: consul.HTTPAddr,
+		Token:   masterToken,
+	})
+	req.NoError(err)
+	_, _, err = consulClient.ACL().PolicyCreate(&capi.ACLPolicy{Name: "default-policy"}, nil)
+	req.NoError(err)
+	aclConfig := capi.NamespaceACLConfig{
+		PolicyDefaults: []capi.ACLLink{{Name: "default-policy"}},
+	}
+
+	created, err := EnsureExistsWithACLConfig(consulClient, "ns", aclConfig)
+	req.NoError(err)
+	req.True(created)
+	cNS, _, err := consulClient.Namespaces().Read("ns", nil)
+	req.NoError(err)
+	req.Len(cNS.ACLs.PolicyDefaults, 1)
+	req.Equal("default-policy", cNS.ACLs.PolicyDefaults[0].Name)
+
+	// Calling it again leaves the namespace alone.
+	created, err = EnsureExistsWithACLConfig(consulClient, "ns", capi.NamespaceACLConfig{})
+	req.NoError(err)
+	req.False(created)
+	cNS, _, err = consulClient.Namespaces().Read("ns", nil)
+	req.NoError(err)
+	req.Len(cNS.ACLs.PolicyDefaults, 1)
+}
+
 func TestConsulNamespace(t *testing.T) {
 	cases := map[string]struct {
 		kubeNS                 string
@@ -1,19 +1,31 @@
 package common
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 )
 
 func TestLogger_InvalidLogLevel(t *testing.T) {
-	_, err := Logger("invalid")
+	_, err := Logger("invalid", false)
 	require.EqualError(t, err, "unknown log level: invalid")
 }
 
 func TestLogger(t *testing.T) {
-	lgr, err := Logger("debug")
+	lgr, err := Logger("debug", false)
 	require.NoError(t, err)
 	require.NotNil(t, lgr)
 	require.True(t, lgr.IsDebug())
 }
+
+func TestLogger_Level(t *testing.T) {
+	for _, jsonLogging := range []bool{false, true} {
+		t.Run(fmt.Sprintf("json=%t", jsonLogging), func(t *testing.T) {
+			lgr, err := Logger("info", jsonLogging)
+			require.NoError(t, err)
+			require.True(t, lgr.IsInfo())
+			require.False(t, lgr.IsDebug())
+		})
+	}
+}
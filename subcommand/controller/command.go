@@ -1,23 +1,29 @@
 package controller
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"sync"
 
 	"github.com/hashicorp/consul-k8s/api/common"
 	"github.com/hashicorp/consul-k8s/api/v1alpha1"
+	"github.com/hashicorp/consul-k8s/api/v1beta1"
 	"github.com/hashicorp/consul-k8s/controller"
 	"github.com/hashicorp/consul-k8s/subcommand/flags"
+	capi "github.com/hashicorp/consul/api"
 	"github.com/mitchellh/cli"
 	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
 )
 
 type Command struct {
@@ -27,11 +33,13 @@ type Command struct {
 	k8s       *flags.K8SFlags
 	httpFlags *flags.HTTPFlags
 
-	flagWebhookTLSCertDir    string
-	flagEnableLeaderElection bool
-	flagEnableWebhooks       bool
-	flagDatacenter           string
-	flagLogLevel             string
+	flagWebhookTLSCertDir     string
+	flagEnableLeaderElection  bool
+	flagEnableWebhooks        bool
+	flagValidateAgainstConsul bool
+	flagDatacenter            string
+	flagLogLevel              string
+	flagDiff                  bool
 
 	// Flags to support Consul Enterprise namespaces.
 	flagEnableNamespaces           bool
@@ -40,6 +48,8 @@ type Command struct {
 	flagNSMirroringPrefix          string
 	flagCrossNSACLPolicy           string
 
+	kubeClient client.Client
+
 	once sync.Once
 	help string
 }
@@ -52,6 +62,7 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(v1alpha1.AddToScheme(scheme))
+	utilruntime.Must(v1beta1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -78,6 +89,14 @@ func (c *Command) init() {
 		"Directory that contains the TLS cert and key required for the webhook. The cert and key files must be named 'tls.crt' and 'tls.key' respectively.")
 	c.flagSet.BoolVar(&c.flagEnableWebhooks, "enable-webhooks", true,
 		"Enable webhooks. Disable when running locally since Kube API server won't be able to route to local server.")
+	c.flagSet.BoolVar(&c.flagValidateAgainstConsul, "enable-webhook-consul-validation", false,
+		"Deny the creation of resources whose config entries already exist in Consul but aren't managed by "+
+			"this controller, e.g. because they were created with the Consul CLI or in another datacenter. "+
+			"Resources with the \"consul.hashicorp.com/migrate-entry\" annotation are still allowed.")
+	c.flagSet.BoolVar(&c.flagDiff, "diff", false,
+		"Print the drift between the custom resources and the config entries in Consul, i.e. the config entries "+
+			"that are missing in Consul, that differ from their custom resources, and that are managed by this "+
+			"datacenter but have no custom resource, and exit. Exits 2 if any drift is found and 1 on errors.")
 	c.flagSet.StringVar(&c.flagLogLevel, "log-level", zapcore.InfoLevel.String(),
 		fmt.Sprintf("Log verbosity level. Supported values (in order of detail) are "+
 			"%q, %q, %q, and %q.", zapcore.DebugLevel.String(), zapcore.InfoLevel.String(), zapcore.WarnLevel.String(), zapcore.ErrorLevel.String()))
@@ -97,7 +116,8 @@ func (c *Command) Run(args []string) int {
 		c.UI.Error("Invalid arguments: should have no non-flag arguments")
 		return 1
 	}
-	if c.flagEnableWebhooks && c.flagWebhookTLSCertDir == "" {
+	// The webhooks aren't served when printing the drift.
+	if c.flagEnableWebhooks && c.flagWebhookTLSCertDir == "" && !c.flagDiff {
 		c.UI.Error("Invalid arguments: -webhook-tls-cert-dir must be set")
 		return 1
 	}
@@ -117,6 +137,10 @@ func (c *Command) Run(args []string) int {
 	ctrl.SetLogger(logger)
 	klog.SetLogger(logger)
 
+	if c.flagDiff {
+		return c.diff()
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:           scheme,
 		Port:             9443,
@@ -135,15 +159,7 @@ func (c *Command) Run(args []string) int {
 		return 1
 	}
 
-	configEntryReconciler := &controller.ConfigEntryController{
-		ConsulClient:               consulClient,
-		DatacenterName:             c.flagDatacenter,
-		EnableConsulNamespaces:     c.flagEnableNamespaces,
-		ConsulDestinationNamespace: c.flagConsulDestinationNamespace,
-		EnableNSMirroring:          c.flagEnableNSMirroring,
-		NSMirroringPrefix:          c.flagNSMirroringPrefix,
-		CrossNSACLPolicy:           c.flagCrossNSACLPolicy,
-	}
+	configEntryReconciler := c.configEntryController(consulClient)
 	if err = (&controller.ServiceDefaultsController{
 		ConfigEntryController: configEntryReconciler,
 		Client:                mgr.GetClient(),
@@ -222,12 +238,22 @@ func (c *Command) Run(args []string) int {
 		// automatically when new certificates are available.
 		mgr.GetWebhookServer().CertDir = c.flagWebhookTLSCertDir
 
+		// The webhooks only check for conflicts with Consul if enabled.
+		var consulValidation common.ConsulValidation
+		if c.flagValidateAgainstConsul {
+			consulValidation = common.ConsulValidation{
+				Client:         consulClient,
+				DatacenterName: c.flagDatacenter,
+			}
+		}
+
 		// Note: The path here should be identical to the one on the kubebuilder
 		// annotation in each webhook file.
 		mgr.GetWebhookServer().Register("/mutate-v1alpha1-servicedefaults",
 			&webhook.Admission{Handler: &v1alpha1.ServiceDefaultsWebhook{
 				Client:                     mgr.GetClient(),
 				ConsulClient:               consulClient,
+				ConsulValidation:           consulValidation,
 				Logger:                     ctrl.Log.WithName("webhooks").WithName(common.ServiceDefaults),
 				EnableConsulNamespaces:     c.flagEnableNamespaces,
 				EnableNSMirroring:          c.flagEnableNSMirroring,
@@ -238,6 +264,7 @@ func (c *Command) Run(args []string) int {
 			&webhook.Admission{Handler: &v1alpha1.ServiceResolverWebhook{
 				Client:                     mgr.GetClient(),
 				ConsulClient:               consulClient,
+				ConsulValidation:           consulValidation,
 				Logger:                     ctrl.Log.WithName("webhooks").WithName(common.ServiceResolver),
 				EnableConsulNamespaces:     c.flagEnableNamespaces,
 				EnableNSMirroring:          c.flagEnableNSMirroring,
@@ -248,6 +275,7 @@ func (c *Command) Run(args []string) int {
 			&webhook.Admission{Handler: &v1alpha1.ProxyDefaultsWebhook{
 				Client:                 mgr.GetClient(),
 				ConsulClient:           consulClient,
+				ConsulValidation:       consulValidation,
 				Logger:                 ctrl.Log.WithName("webhooks").WithName(common.ProxyDefaults),
 				EnableConsulNamespaces: c.flagEnableNamespaces,
 				EnableNSMirroring:      c.flagEnableNSMirroring,
@@ -256,6 +284,7 @@ func (c *Command) Run(args []string) int {
 			&webhook.Admission{Handler: &v1alpha1.ServiceRouterWebhook{
 				Client:                     mgr.GetClient(),
 				ConsulClient:               consulClient,
+				ConsulValidation:           consulValidation,
 				Logger:                     ctrl.Log.WithName("webhooks").WithName(common.ServiceRouter),
 				EnableConsulNamespaces:     c.flagEnableNamespaces,
 				EnableNSMirroring:          c.flagEnableNSMirroring,
@@ -266,6 +295,7 @@ func (c *Command) Run(args []string) int {
 			&webhook.Admission{Handler: &v1alpha1.ServiceSplitterWebhook{
 				Client:                     mgr.GetClient(),
 				ConsulClient:               consulClient,
+				ConsulValidation:           consulValidation,
 				Logger:                     ctrl.Log.WithName("webhooks").WithName(common.ServiceSplitter),
 				EnableConsulNamespaces:     c.flagEnableNamespaces,
 				EnableNSMirroring:          c.flagEnableNSMirroring,
@@ -276,6 +306,7 @@ func (c *Command) Run(args []string) int {
 			&webhook.Admission{Handler: &v1alpha1.ServiceIntentionsWebhook{
 				Client:                     mgr.GetClient(),
 				ConsulClient:               consulClient,
+				ConsulValidation:           consulValidation,
 				Logger:                     ctrl.Log.WithName("webhooks").WithName(common.ServiceIntentions),
 				EnableConsulNamespaces:     c.flagEnableNamespaces,
 				EnableNSMirroring:          c.flagEnableNSMirroring,
@@ -286,6 +317,7 @@ func (c *Command) Run(args []string) int {
 			&webhook.Admission{Handler: &v1alpha1.IngressGatewayWebhook{
 				Client:                     mgr.GetClient(),
 				ConsulClient:               consulClient,
+				ConsulValidation:           consulValidation,
 				Logger:                     ctrl.Log.WithName("webhooks").WithName(common.IngressGateway),
 				EnableConsulNamespaces:     c.flagEnableNamespaces,
 				EnableNSMirroring:          c.flagEnableNSMirroring,
@@ -296,12 +328,17 @@ func (c *Command) Run(args []string) int {
 			&webhook.Admission{Handler: &v1alpha1.TerminatingGatewayWebhook{
 				Client:                     mgr.GetClient(),
 				ConsulClient:               consulClient,
+				ConsulValidation:           consulValidation,
 				Logger:                     ctrl.Log.WithName("webhooks").WithName(common.TerminatingGateway),
 				EnableConsulNamespaces:     c.flagEnableNamespaces,
 				EnableNSMirroring:          c.flagEnableNSMirroring,
 				ConsulDestinationNamespace: c.flagConsulDestinationNamespace,
 				NSMirroringPrefix:          c.flagNSMirroringPrefix,
 			}})
+
+		// Convert the config entries between their versions, e.g. so that
+		// objects stored as v1alpha1 can be read as a later version.
+		mgr.GetWebhookServer().Register("/convert", &conversion.Webhook{})
 	}
 	// +kubebuilder:scaffold:builder
 
@@ -313,6 +350,94 @@ func (c *Command) Run(args []string) int {
 	return 0
 }
 
+// configEntryController returns the ConfigEntryController shared by the
+// CRD-specific controllers.
+func (c *Command) configEntryController(consulClient *capi.Client) *controller.ConfigEntryController {
+	return &controller.ConfigEntryController{
+		ConsulClient:               consulClient,
+		DatacenterName:             c.flagDatacenter,
+		EnableConsulNamespaces:     c.flagEnableNamespaces,
+		ConsulDestinationNamespace: c.flagConsulDestinationNamespace,
+		EnableNSMirroring:          c.flagEnableNSMirroring,
+		NSMirroringPrefix:          c.flagNSMirroringPrefix,
+		CrossNSACLPolicy:           c.flagCrossNSACLPolicy,
+	}
+}
+
+// diff prints the drift between the custom resources and the config entries
+// in Consul. It returns exitCodeDrift if there's any drift so that it can be
+// told apart from the errors, which return 1.
+func (c *Command) diff() int {
+	// The client might already be set if we're in a test.
+	if c.kubeClient == nil {
+		cfg, err := ctrl.GetConfig()
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error retrieving Kubernetes config: %s", err))
+			return 1
+		}
+		c.kubeClient, err = client.New(cfg, client.Options{Scheme: scheme})
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error creating Kubernetes client: %s", err))
+			return 1
+		}
+	}
+	consulClient, err := c.httpFlags.APIClient()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error connecting to Consul agent: %s", err))
+		return 1
+	}
+
+	var resources []common.ConfigEntryResource
+	for _, list := range []runtime.Object{
+		&v1alpha1.ServiceDefaultsList{},
+		&v1alpha1.ServiceResolverList{},
+		&v1alpha1.ProxyDefaultsList{},
+		&v1alpha1.ServiceRouterList{},
+		&v1alpha1.ServiceSplitterList{},
+		&v1alpha1.ServiceIntentionsList{},
+		&v1alpha1.IngressGatewayList{},
+		&v1alpha1.TerminatingGatewayList{},
+	} {
+		if err := c.kubeClient.List(context.Background(), list); err != nil {
+			c.UI.Error(fmt.Sprintf("Error listing custom resources: %s", err))
+			return 1
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error listing custom resources: %s", err))
+			return 1
+		}
+		for _, item := range items {
+			resources = append(resources, item.(common.ConfigEntryResource))
+		}
+	}
+
+	kinds := []string{
+		capi.ServiceDefaults,
+		capi.ServiceResolver,
+		capi.ProxyDefaults,
+		capi.ServiceRouter,
+		capi.ServiceSplitter,
+		capi.ServiceIntentions,
+		capi.IngressGateway,
+		capi.TerminatingGateway,
+	}
+	drifts, err := c.configEntryController(consulClient).Diff(kinds, resources)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error comparing config entries: %s", err))
+		return 1
+	}
+	for _, drift := range drifts {
+		c.UI.Output(drift.String())
+	}
+	if len(drifts) > 0 {
+		c.UI.Error(fmt.Sprintf("Found %d config entries that have drifted", len(drifts)))
+		return exitCodeDrift
+	}
+	c.UI.Info("No drift found")
+	return 0
+}
+
 func (c *Command) Help() string {
 	c.once.Do(c.init)
 	return c.help
@@ -322,10 +447,16 @@ func (c *Command) Synopsis() string {
 	return synopsis
 }
 
+// exitCodeDrift is the exit code of -diff if any drift is found.
+const exitCodeDrift = 2
+
 const synopsis = "Starts the Consul Kubernetes controller"
 const help = `
 Usage: consul-k8s controller [options]
 
-  Starts the Consul Kubernetes controller that manages Consul Custom Resource Definitions
+  Starts the Consul Kubernetes controller that manages Consul Custom Resource Definitions.
+  With -diff, prints the drift between the custom resources and the config
+  entries in Consul instead. It exits 0 if there's no drift, 2 if there's
+  any drift, and 1 on errors.
 
 `
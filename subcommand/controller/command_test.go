@@ -1,10 +1,18 @@
 package controller
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/hashicorp/consul-k8s/api/v1alpha1"
 	"github.com/mitchellh/cli"
 	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestRun_FlagValidation(t *testing.T) {
@@ -26,6 +34,11 @@ func TestRun_FlagValidation(t *testing.T) {
 			flags:  []string{"-webhook-tls-cert-dir", "/foo"},
 			expErr: "-datacenter must be set",
 		},
+		{
+			// The webhooks aren't served when printing the drift.
+			flags:  []string{"-diff"},
+			expErr: "-datacenter must be set",
+		},
 		{
 			flags:  []string{"-webhook-tls-cert-dir", "/foo", "-datacenter", "foo", "-log-level", "invalid"},
 			expErr: `Error parsing -log-level "invalid": unrecognized level: "invalid"`,
@@ -42,3 +55,83 @@ func TestRun_FlagValidation(t *testing.T) {
 		})
 	}
 }
+
+// Test the exit codes of -diff, which tell the drift apart from the errors.
+func TestRun_Diff(t *testing.T) {
+	t.Parallel()
+
+	serviceDefaults := &v1alpha1.ServiceDefaults{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ServiceDefaultsSpec{
+			Protocol: "http",
+		},
+	}
+	cases := map[string]struct {
+		// kubeClient lists the custom resources.
+		kubeClient client.Client
+		// consulStatus is the status code of every request to Consul if
+		// it's not 200.
+		consulStatus int
+		expExitCode  int
+		expOutput    string
+		expErr       string
+	}{
+		"no drift": {
+			kubeClient:  fake.NewFakeClientWithScheme(scheme),
+			expExitCode: 0,
+			expOutput:   "No drift found",
+		},
+		"drift": {
+			kubeClient:  fake.NewFakeClientWithScheme(scheme, serviceDefaults),
+			expExitCode: 2,
+			expOutput:   "missing in Consul: service-defaults/foo",
+			expErr:      "Found 1 config entries that have drifted",
+		},
+		"error listing the custom resources": {
+			// The custom resources aren't registered with the scheme.
+			kubeClient:  fake.NewFakeClientWithScheme(runtime.NewScheme()),
+			expExitCode: 1,
+			expErr:      "Error listing custom resources",
+		},
+		"error getting the config entries": {
+			kubeClient:   fake.NewFakeClientWithScheme(scheme),
+			consulStatus: http.StatusInternalServerError,
+			expExitCode:  1,
+			expErr:       "Error comparing config entries",
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(tt *testing.T) {
+			// The config entries of a kind are listed at /v1/config/<kind>
+			// and got at /v1/config/<kind>/<name>. There are none in Consul.
+			consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if c.consulStatus != 0 {
+					w.WriteHeader(c.consulStatus)
+					return
+				}
+				if strings.Count(strings.TrimPrefix(r.URL.Path, "/v1/config/"), "/") > 0 {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Write([]byte("[]"))
+			}))
+			defer consul.Close()
+
+			ui := cli.NewMockUi()
+			cmd := Command{UI: ui, kubeClient: c.kubeClient}
+			exitCode := cmd.Run([]string{
+				"-diff",
+				"-datacenter", "dc1",
+				"-http-addr", consul.URL,
+			})
+			require.Equal(tt, c.expExitCode, exitCode, ui.ErrorWriter.String())
+			require.Contains(tt, ui.OutputWriter.String(), c.expOutput)
+			require.Contains(tt, ui.ErrorWriter.String(), c.expErr)
+		})
+	}
+}
@@ -96,7 +96,7 @@ func (c *Command) Run(args []string) int {
 		}
 	}
 
-	logger, err := common.Logger(logLevel)
+	logger, err := common.Logger(logLevel, false)
 	if err != nil {
 		c.UI.Error(err.Error())
 		return 1
@@ -82,7 +82,7 @@ func (c *Command) Run(args []string) int {
 		return 1
 	}
 
-	logger, err := common.Logger(c.flagLogLevel)
+	logger, err := common.Logger(c.flagLogLevel, false)
 	if err != nil {
 		c.UI.Error(err.Error())
 		return 1
@@ -21,16 +21,26 @@ import (
 	"github.com/hashicorp/consul-k8s/consul"
 	"github.com/hashicorp/consul-k8s/helper/cert"
 	"github.com/hashicorp/consul-k8s/helper/controller"
+	"github.com/hashicorp/consul-k8s/subcommand"
 	"github.com/hashicorp/consul-k8s/subcommand/common"
 	"github.com/hashicorp/consul-k8s/subcommand/flags"
 	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
 	"github.com/mitchellh/cli"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
 )
 
 type Command struct {
@@ -49,8 +59,10 @@ type Command struct {
 	flagWriteServiceDefaults bool   // True to enable central config injection
 	flagDefaultProtocol      string // Default protocol for use with central config
 	flagConsulCACert         string // [Deprecated] Path to CA Certificate to use when communicating with Consul clients
+	flagTLSSkipVerify        bool   // Skip verifying the Consul agents' certificates
 	flagEnvoyExtraArgs       string // Extra envoy args when starting envoy
 	flagLogLevel             string
+	flagLogJSON              bool
 
 	// Flags to support namespaces
 	flagEnableNamespaces           bool     // Use namespacing on all components
@@ -64,6 +76,50 @@ type Command struct {
 	// Flags to enable connect-inject health checks.
 	flagEnableHealthChecks          bool          // Start the health check controller.
 	flagHealthChecksReconcilePeriod time.Duration // Period for health check reconcile.
+	flagHealthChecksResyncPeriod    time.Duration // Period for replaying all pods through the health checks controller.
+	flagHealthChecksSweepPeriod     time.Duration // Period for deregistering the health checks of deleted pods.
+	flagHealthChecksLabel           string        // Label selector for pods whose health checks are managed.
+	flagHealthChecksIDPrefix        string        // Prefix of the IDs of the health checks registered in Consul.
+	flagHealthChecksMetricsListen   string        // Address to serve health check metrics on.
+	flagHealthChecksProbeListen     string        // Address to serve the health checks controller's probes on.
+	flagHealthChecksNamespaces      []string      // K8s namespaces whose pods' health checks are managed.
+	flagHealthChecksAllowNamespaces []string      // K8s namespaces whose pods are processed (has precedence).
+	flagHealthChecksDenyNamespaces  []string      // K8s namespaces whose pods are not processed.
+	flagHealthChecksReadyConditions []string      // Pod conditions that must be True for health checks to pass.
+	flagHealthChecksReadinessSource string        // Readiness the health checks reflect, "pod" or "container:<name>".
+	flagHealthChecksNSSelector      string        // Label selector for K8s namespaces whose pods' health checks are managed.
+	flagHealthChecksNodeName        string        // K8s node whose pods' health checks are managed.
+	flagHealthChecksAgentless       bool          // Register all health checks with the agent at the Consul address.
+	flagHealthChecksTTL             string        // TTL of the health checks registered in Consul.
+	flagHealthChecksDeregisterAfter string        // Deregister services whose health check is critical for this long.
+	flagHealthChecksMaxReasonLength int           // Maximum length of the output of the health checks.
+	flagHealthChecksSuccessBefore   int           // Passing updates needed for a health check to pass.
+	flagHealthChecksFailuresBefore  int           // Critical updates needed for a health check to fail.
+	flagHealthChecksDryRun          bool          // Log health check writes instead of performing them.
+	flagHealthChecksStatusOnly      bool          // Only update the status of health checks registered by something else.
+	flagHealthChecksNSTokensDir     string        // Directory of the ACL tokens of the Consul namespaces.
+	flagHealthChecksRetryBaseDelay  time.Duration // Initial delay before retrying a failed pod.
+	flagHealthChecksRetryMaxDelay   time.Duration // Maximum delay before retrying a failed pod.
+	flagHealthChecksMaxRetries      int           // Number of times a failed pod is retried.
+	flagHealthChecksShutdownTimeout time.Duration // Time to spend processing queued pods on shutdown.
+	flagHealthChecksWorkers         int           // Number of goroutines processing pods.
+	flagHealthChecksItemTimeout     time.Duration // Time allowed for the Consul calls made for a single pod.
+	flagHealthChecksConnRetries     int           // Times a pod is retried while its Consul agent can't be reached.
+	flagHealthChecksConnRetryDelay  time.Duration // Base delay between those retries.
+	flagHealthChecksAgentFailures   int           // Consecutive failures of a Consul agent after which its pods are paused.
+	flagHealthChecksAgentCooldown   time.Duration // Time the pods of a failing Consul agent are paused for.
+	flagHealthChecksRateBackoff     time.Duration // Delay before retrying the pods of a rate limited Consul agent.
+	flagHealthChecksReconcileOnce   bool          // Reconcile the health checks once and exit.
+	flagHealthChecksRetryThreshold  int           // Retries after which a pod counts towards the retry alert gauge.
+	flagHealthChecksErrorLogWindow  time.Duration // Window within which identical errors are logged once.
+	flagHealthChecksBatchWindow     time.Duration // Window within which the status updates of a client are sent together.
+	flagHealthChecksEnvoyReady      bool          // Probe the pods' Envoy sidecars before marking their checks passing.
+	flagHealthChecksEnvoyTimeout    time.Duration // Time the Envoy ready probe waits for the sidecar.
+
+	// Flags to run the health checks controller on a single replica.
+	flagEnableLeaderElection    bool   // Only run the health checks controller on the elected leader.
+	flagLeaderElectionNamespace string // Namespace of the Lease used for leader election.
+	flagLeaderElectionLeaseName string // Name of the Lease used for leader election.
 
 	// Proxy resource settings.
 	flagDefaultSidecarProxyCPULimit      string
@@ -85,6 +141,10 @@ type Command struct {
 
 	flagSet *flag.FlagSet
 	http    *flags.HTTPFlags
+	k8s     *flags.K8SFlags
+
+	// Flags to select the Kubernetes API server.
+	flagInCluster bool // Always use the in-cluster config, even if -kubeconfig is set.
 
 	consulClient *api.Client
 	clientset    kubernetes.Interface
@@ -93,6 +153,10 @@ type Command struct {
 	once  sync.Once
 	help  string
 	cert  atomic.Value
+
+	// leading is set to 1 while this replica holds the health checks
+	// controller's leader election Lease.
+	leading int32
 }
 
 func (c *Command) init() {
@@ -121,6 +185,8 @@ func (c *Command) init() {
 		"Write a service-defaults config for every Connect service using protocol from -default-protocol or Pod annotation.")
 	c.flagSet.StringVar(&c.flagDefaultProtocol, "default-protocol", "",
 		"The default protocol to use in central config registrations.")
+	c.flagSet.BoolVar(&c.flagTLSSkipVerify, "tls-skip-verify", false,
+		"If true, the Consul agents' TLS certificates are not verified. This is insecure and should only be used for testing.")
 	c.flagSet.StringVar(&c.flagConsulCACert, "consul-ca-cert", "",
 		"[Deprecated] Please use '-ca-file' flag instead. Path to CA certificate to use if communicating with Consul clients over HTTPS.")
 	c.flagSet.Var((*flags.AppendSliceValue)(&c.flagAllowK8sNamespacesList), "allow-k8s-namespace",
@@ -130,6 +196,141 @@ func (c *Command) init() {
 	c.flagSet.BoolVar(&c.flagEnableHealthChecks, "enable-health-checks-controller", false,
 		"Enables health checks controller.")
 	c.flagSet.DurationVar(&c.flagHealthChecksReconcilePeriod, "health-checks-reconcile-period", 1*time.Minute, "Reconcile period for health checks controller.")
+	c.flagSet.BoolVar(&c.flagHealthChecksReconcileOnce, "health-checks-reconcile-once", false,
+		"If true, the health checks of all pods are reconciled once and the command exits instead of serving the "+
+			"webhook. The exit code is non-zero if reconciling any pod failed. Requires -enable-health-checks-controller.")
+	c.flagSet.DurationVar(&c.flagHealthChecksResyncPeriod, "health-check-resync-period", 0,
+		"Period by which the health checks controller replays all pods as updates so that health checks that "+
+			"drifted, e.g. due to missed events, are corrected. If 0, pods are not resynced.")
+	c.flagSet.DurationVar(&c.flagHealthChecksSweepPeriod, "health-check-orphan-sweep-period", 0,
+		"Period by which the health checks of pods that no longer exist are deregistered from the Consul "+
+			"agents. If 0, the default, they are not swept.")
+	c.flagSet.StringVar(&c.flagHealthChecksLabel, "health-check-label", "",
+		"Label selector for the pods whose health checks are managed by the health checks controller. "+
+			"Defaults to the \"consul.hashicorp.com/connect-inject-status\" label applied by the injector.")
+	c.flagSet.StringVar(&c.flagHealthChecksIDPrefix, "health-check-id-prefix", "",
+		"Prefix of the IDs of the health checks registered in Consul by the health checks controller. "+
+			"IDs are of the form \"<prefix>/<namespace>/<pod>-<service>/kubernetes-health-check\".")
+	c.flagSet.Var((*flags.AppendSliceValue)(&c.flagHealthChecksNamespaces), "health-check-namespace",
+		"K8s namespace whose pods' health checks are managed by the health checks controller. "+
+			"May be specified multiple times. If not set, pods in all namespaces are watched.")
+	c.flagSet.Var((*flags.AppendSliceValue)(&c.flagHealthChecksAllowNamespaces), "health-check-allow-namespace",
+		"K8s namespace whose pods are processed by the health checks controller. If set, the pods of the other "+
+			"namespaces are skipped. Takes precedence over -health-check-deny-namespace. May be specified multiple times.")
+	c.flagSet.Var((*flags.AppendSliceValue)(&c.flagHealthChecksDenyNamespaces), "health-check-deny-namespace",
+		"K8s namespace whose pods are skipped by the health checks controller. The \"kube-system\" and "+
+			"\"kube-public\" namespaces are always denied unless allowed with -health-check-allow-namespace. "+
+			"May be specified multiple times.")
+	c.flagSet.BoolVar(&c.flagHealthChecksAgentless, "agentless", false,
+		"If true, the health checks controller registers the health checks of all pods with the Consul agent or "+
+			"server at the configured Consul address instead of the agent on each pod's host IP, for deployments "+
+			"that don't run a Consul agent on each node.")
+	c.flagSet.StringVar(&c.flagHealthChecksNodeName, "node-name", "",
+		"Name of the K8s node whose pods' health checks are managed by the health checks controller, e.g. when it runs "+
+			"as a DaemonSet with the node name set from the downward API. The health checks are registered with the "+
+			"Consul agent at the configured Consul address instead of the agent on each pod's host IP. If not set, "+
+			"pods on all nodes are watched.")
+	c.flagSet.StringVar(&c.flagHealthChecksNSSelector, "health-check-namespace-selector", "",
+		"Label selector for the K8s namespaces whose pods' health checks are managed by the health checks controller, "+
+			"e.g. \"consul.hashicorp.com/health-checks=enabled\". Pods are watched while their namespace matches it and "+
+			"the health checks of the pods of a namespace that stops matching it are deregistered. "+
+			"Can't be used with -health-check-namespace.")
+	c.flagSet.Var((*flags.AppendSliceValue)(&c.flagHealthChecksReadyConditions), "health-check-ready-condition",
+		"Type of a pod condition, e.g. of a readiness gate, that must be True for the pod's health check to pass. "+
+			"May be specified multiple times. If not set, only the Ready condition is used.")
+	c.flagSet.StringVar(&c.flagHealthChecksReadinessSource, "readiness-source", "pod",
+		"Readiness the health checks managed by the health checks controller reflect. Either \"pod\" to use the pod's "+
+			"conditions or \"container:<name>\" to use the readiness of the pod's container with that name, falling back "+
+			"to the pod's conditions if the pod has no such container.")
+	c.flagSet.StringVar(&c.flagHealthChecksTTL, "health-check-ttl", connectinject.DefaultHealthCheckTTL,
+		"TTL of the health checks registered in Consul by the health checks controller. Must be a valid Go duration, e.g. \"10m\".")
+	c.flagSet.StringVar(&c.flagHealthChecksDeregisterAfter, "health-check-deregister-critical-service-after", "",
+		"If set, Consul deregisters services whose health check registered by the health checks controller has been "+
+			"critical for this long. Must be a valid Go duration, e.g. \"30m\". If empty, services are never deregistered. Pods can override it with the "+
+			"\"consul.hashicorp.com/deregister-critical-after\" annotation.")
+	c.flagSet.IntVar(&c.flagHealthChecksMaxReasonLength, "health-check-max-reason-length", connectinject.DefaultHealthCheckMaxReasonLength,
+		"Maximum length in bytes of the output of the health checks registered in Consul. Longer pod "+
+			"condition messages are truncated.")
+	c.flagSet.IntVar(&c.flagHealthChecksSuccessBefore, "health-check-success-before-passing", 1,
+		"Number of consecutive passing updates needed for a health check registered by the health checks "+
+			"controller to become passing.")
+	c.flagSet.IntVar(&c.flagHealthChecksFailuresBefore, "health-check-failures-before-critical", 1,
+		"Number of consecutive critical updates needed for a health check registered by the health checks "+
+			"controller to become critical.")
+	c.flagSet.BoolVar(&c.flagHealthChecksDryRun, "health-check-dry-run", false,
+		"If true, the health checks controller logs the health checks it would register or update in Consul "+
+			"instead of writing them.")
+	c.flagSet.BoolVar(&c.flagHealthChecksStatusOnly, "manage-status-only", false,
+		"Never register health checks, e.g. because the connect-inject sidecar registers them, and only update "+
+			"the status of the ones that exist. Pods whose health check doesn't exist yet are retried with an exponential "+
+			"backoff, at most -health-check-max-retries times.")
+	c.flagSet.StringVar(&c.flagHealthChecksNSTokensDir, "health-check-namespace-tokens-dir", "",
+		"Directory, e.g. a mounted Secret, containing one file per Consul namespace named after it that contains "+
+			"the ACL token the health checks controller uses for the health checks in that namespace. "+
+			"Namespaces without a file use the default token.")
+	c.flagSet.DurationVar(&c.flagHealthChecksRetryBaseDelay, "health-check-retry-base-delay", 0,
+		"Initial delay before the health checks controller retries a pod that failed processing. The delay doubles "+
+			"on each retry. If neither this nor -health-check-retry-max-delay are set, the client-go defaults are used.")
+	c.flagSet.DurationVar(&c.flagHealthChecksRetryMaxDelay, "health-check-retry-max-delay", 0,
+		"Maximum delay before the health checks controller retries a pod that failed processing.")
+	c.flagSet.IntVar(&c.flagHealthChecksMaxRetries, "health-check-max-retries", controller.DefaultMaxRetries,
+		"Number of times the health checks controller retries a pod that failed processing.")
+	c.flagSet.IntVar(&c.flagHealthChecksWorkers, "health-check-workers", 1,
+		"Number of pods the health checks controller processes concurrently.")
+	c.flagSet.IntVar(&c.flagHealthChecksConnRetries, "health-check-connection-retries", 2,
+		"Number of times the health checks controller retries a pod right away if the pod's Consul agent can't be "+
+			"reached, e.g. because it's restarting, before the pod is requeued.")
+	c.flagSet.DurationVar(&c.flagHealthChecksConnRetryDelay, "health-check-connection-retry-delay", connectinject.DefaultConnectionRetryDelay,
+		"Base delay between the retries of a pod whose Consul agent can't be reached. A random jitter of up to the "+
+			"delay is added.")
+	c.flagSet.IntVar(&c.flagHealthChecksAgentFailures, "health-check-agent-failure-threshold", 0,
+		"Number of consecutive times the Consul agent on a node can't be reached after which the health checks "+
+			"controller stops processing the pods on that node for -health-check-agent-failure-cooldown. If 0, "+
+			"the default, the pods are always processed.")
+	c.flagSet.DurationVar(&c.flagHealthChecksAgentCooldown, "health-check-agent-failure-cooldown", connectinject.DefaultAgentFailureCooldown,
+		"Time the health checks controller stops processing the pods of a node whose Consul agent keeps failing for. "+
+			"Their events are requeued until it has elapsed.")
+	c.flagSet.DurationVar(&c.flagHealthChecksRateBackoff, "health-check-rate-limit-backoff", connectinject.DefaultRateLimitBackoff,
+		"Delay before the health checks controller retries a pod whose Consul agent rate limited the requests "+
+			"and didn't send a Retry-After header.")
+	c.flagSet.IntVar(&c.flagHealthChecksRetryThreshold, "health-check-retry-alert-threshold", 3,
+		"Number of retries after which a pod counts towards the workqueue_items_over_retry_threshold metric "+
+			"of the health checks controller, e.g. to alert on pods that keep failing.")
+	c.flagSet.DurationVar(&c.flagHealthChecksErrorLogWindow, "health-check-error-log-window", 0,
+		"Window within which the health checks controller logs identical errors, e.g. the errors of every pod "+
+			"while Consul is down, only once. The number of errors suppressed in between is logged with the next one. "+
+			"If 0, the default, every error is logged.")
+	c.flagSet.DurationVar(&c.flagHealthChecksBatchWindow, "health-check-status-batch-window", 0,
+		"Window within which the health checks controller collects the status updates sent to the same Consul "+
+			"agent and namespace to send them together with a single client, e.g. during a rolling restart. Updates "+
+			"are delayed by up to this long. If 0, every update is sent right away.")
+	c.flagSet.BoolVar(&c.flagHealthChecksEnvoyReady, "health-check-envoy-ready-probe", false,
+		"If true, the health checks controller only marks the health check of a ready pod with the "+
+			"consul.hashicorp.com/envoy-ready-port annotation passing once its Envoy sidecar's /ready endpoint "+
+			"returns 200 at that port of the pod's IP. The sidecar's admin API only listens on localhost so the pod "+
+			"must expose the endpoint at that port itself. Pods without the annotation aren't probed. This adds a "+
+			"request to the processing of every ready pod with the annotation.")
+	c.flagSet.DurationVar(&c.flagHealthChecksEnvoyTimeout, "health-check-envoy-ready-timeout", connectinject.DefaultEnvoyReadyTimeout,
+		"Time the Envoy ready probe of the health checks controller waits for the sidecar to answer.")
+	c.flagSet.DurationVar(&c.flagHealthChecksItemTimeout, "health-check-item-timeout", 30*time.Second,
+		"Maximum time the health checks controller waits on the Consul agent when processing a single pod. "+
+			"Pods that time out are retried. If 0, there is no timeout.")
+	c.flagSet.DurationVar(&c.flagHealthChecksShutdownTimeout, "health-check-shutdown-timeout", 10*time.Second,
+		"Maximum time the health checks controller spends processing the pods that are still queued when "+
+			"shutting down. If 0, all queued pods are processed.")
+	c.flagSet.StringVar(&c.flagHealthChecksMetricsListen, "health-check-metrics-listen", "",
+		"Address to bind the health checks controller's Prometheus metrics listener to, e.g. \":9102\". "+
+			"Metrics are served on the /metrics path and the managed health checks as JSON on the /checks path. "+
+			"If empty, metrics are not served.")
+	c.flagSet.StringVar(&c.flagHealthChecksProbeListen, "health-check-probe-listen", "",
+		"Address to bind the health checks controller's readiness and liveness probe listener to, e.g. \":9103\". "+
+			"Probes are served on the /health/ready and /health/live paths. If empty, probes are not served.")
+	c.flagSet.BoolVar(&c.flagEnableLeaderElection, "enable-leader-election", false,
+		"Enables leader election for the health checks controller so that only one replica processes health checks.")
+	c.flagSet.StringVar(&c.flagLeaderElectionNamespace, "leader-election-namespace", "",
+		"Kubernetes namespace of the Lease used for leader election. Required if -enable-leader-election is true.")
+	c.flagSet.StringVar(&c.flagLeaderElectionLeaseName, "leader-election-lease-name", "consul-connect-injector-health-checks",
+		"Name of the Lease used for leader election.")
 	c.flagSet.BoolVar(&c.flagEnableNamespaces, "enable-namespaces", false,
 		"[Enterprise Only] Enables namespaces, in either a single Consul namespace or mirrored.")
 	c.flagSet.StringVar(&c.flagConsulDestinationNamespace, "consul-destination-namespace", "default",
@@ -145,6 +346,8 @@ func (c *Command) init() {
 	c.flagSet.StringVar(&c.flagLogLevel, "log-level", "info",
 		"Log verbosity level. Supported values (in order of detail) are \"trace\", "+
 			"\"debug\", \"info\", \"warn\", and \"error\".")
+	c.flagSet.BoolVar(&c.flagLogJSON, "log-json", false,
+		"Enable or disable JSON output format for logging.")
 
 	// Proxy sidecar resource setting flags.
 	c.flagSet.StringVar(&c.flagDefaultSidecarProxyCPURequest, "default-sidecar-proxy-cpu-request", "", "Default sidecar proxy CPU request.")
@@ -164,9 +367,15 @@ func (c *Command) init() {
 	c.flagSet.StringVar(&c.flagConsulSidecarMemoryRequest, "consul-sidecar-memory-request", "25Mi", "Consul sidecar memory request.")
 	c.flagSet.StringVar(&c.flagConsulSidecarMemoryLimit, "consul-sidecar-memory-limit", "50Mi", "Consul sidecar memory limit.")
 
+	c.flagSet.BoolVar(&c.flagInCluster, "in-cluster", false,
+		"If true, the Kubernetes API server is always reached with the in-cluster config of the pod's service "+
+			"account. It can't be set together with -kubeconfig.")
+
 	c.http = &flags.HTTPFlags{}
+	c.k8s = &flags.K8SFlags{}
 
 	flags.Merge(c.flagSet, c.http.Flags())
+	flags.Merge(c.flagSet, c.k8s.Flags())
 	c.help = flags.Usage(help, c.flagSet)
 
 	// Wait on an interrupt or terminate for exit, be sure to init it before running
@@ -196,6 +405,10 @@ func (c *Command) Run(args []string) int {
 		c.UI.Error("-envoy-image must be set")
 		return 1
 	}
+	if c.flagInCluster && c.k8s.KubeConfig() != "" {
+		c.UI.Error("-in-cluster and -kubeconfig can't both be set")
+		return 1
+	}
 	if c.flagWriteServiceDefaults {
 		c.UI.Error("-enable-central-config is no longer supported")
 		return 1
@@ -204,8 +417,135 @@ func (c *Command) Run(args []string) int {
 		c.UI.Error("-default-protocol is no longer supported")
 		return 1
 	}
+	if c.flagEnableLeaderElection && c.flagLeaderElectionNamespace == "" {
+		c.UI.Error("-leader-election-namespace must be set when -enable-leader-election is true")
+		return 1
+	}
+	if c.flagHealthChecksReconcileOnce && !c.flagEnableHealthChecks {
+		c.UI.Error("-health-checks-reconcile-once requires -enable-health-checks-controller")
+		return 1
+	}
+	if c.flagEnableLeaderElection && !c.flagEnableHealthChecks {
+		c.UI.Error("-enable-leader-election requires -enable-health-checks-controller")
+		return 1
+	}
+	if c.flagHealthChecksNodeName != "" && c.flagEnableLeaderElection {
+		c.UI.Error("-node-name can't be used with -enable-leader-election")
+		return 1
+	}
+	if _, err := parseReadinessSource(c.flagHealthChecksReadinessSource); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	var healthChecksNSSelector labels.Selector
+	if c.flagHealthChecksNSSelector != "" {
+		if len(c.flagHealthChecksNamespaces) > 0 {
+			c.UI.Error("-health-check-namespace-selector can't be used with -health-check-namespace")
+			return 1
+		}
+		var err error
+		healthChecksNSSelector, err = labels.Parse(c.flagHealthChecksNSSelector)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("-health-check-namespace-selector is invalid: %s", err))
+			return 1
+		}
+	}
+	if _, err := time.ParseDuration(c.flagHealthChecksTTL); err != nil {
+		c.UI.Error(fmt.Sprintf("-health-check-ttl is invalid: %s", err))
+		return 1
+	}
+	if c.flagHealthChecksResyncPeriod < 0 {
+		c.UI.Error("-health-check-resync-period must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksSweepPeriod < 0 {
+		c.UI.Error("-health-check-orphan-sweep-period must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksRetryBaseDelay < 0 {
+		c.UI.Error("-health-check-retry-base-delay must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksRetryMaxDelay < 0 {
+		c.UI.Error("-health-check-retry-max-delay must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksRetryMaxDelay != 0 && c.flagHealthChecksRetryMaxDelay < c.flagHealthChecksRetryBaseDelay {
+		c.UI.Error("-health-check-retry-max-delay must not be less than -health-check-retry-base-delay")
+		return 1
+	}
+	if c.flagHealthChecksMaxRetries < 0 {
+		c.UI.Error("-health-check-max-retries must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksSuccessBefore < 1 {
+		c.UI.Error("-health-check-success-before-passing must be at least 1")
+		return 1
+	}
+	if c.flagHealthChecksFailuresBefore < 1 {
+		c.UI.Error("-health-check-failures-before-critical must be at least 1")
+		return 1
+	}
+	if c.flagHealthChecksMaxReasonLength < 1 {
+		c.UI.Error("-health-check-max-reason-length must be at least 1")
+		return 1
+	}
+	if c.flagHealthChecksWorkers < 1 {
+		c.UI.Error("-health-check-workers must be at least 1")
+		return 1
+	}
+	if c.flagHealthChecksConnRetries < 0 {
+		c.UI.Error("-health-check-connection-retries must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksConnRetryDelay < 0 {
+		c.UI.Error("-health-check-connection-retry-delay must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksAgentFailures < 0 {
+		c.UI.Error("-health-check-agent-failure-threshold must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksAgentCooldown < 0 {
+		c.UI.Error("-health-check-agent-failure-cooldown must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksRateBackoff < 0 {
+		c.UI.Error("-health-check-rate-limit-backoff must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksRetryThreshold < 0 {
+		c.UI.Error("-health-check-retry-alert-threshold must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksErrorLogWindow < 0 {
+		c.UI.Error("-health-check-error-log-window must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksBatchWindow < 0 {
+		c.UI.Error("-health-check-status-batch-window must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksEnvoyTimeout < 0 {
+		c.UI.Error("-health-check-envoy-ready-timeout must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksItemTimeout < 0 {
+		c.UI.Error("-health-check-item-timeout must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksShutdownTimeout < 0 {
+		c.UI.Error("-health-check-shutdown-timeout must not be negative")
+		return 1
+	}
+	if c.flagHealthChecksDeregisterAfter != "" {
+		if _, err := time.ParseDuration(c.flagHealthChecksDeregisterAfter); err != nil {
+			c.UI.Error(fmt.Sprintf("-health-check-deregister-critical-service-after is invalid: %s", err))
+			return 1
+		}
+	}
 
-	logger, err := common.Logger(c.flagLogLevel)
+	logger, err := common.Logger(c.flagLogLevel, c.flagLogJSON)
 	if err != nil {
 		c.UI.Error(err.Error())
 		return 1
@@ -262,11 +602,11 @@ func (c *Command) Run(args []string) int {
 		return 1
 	}
 
-	// We must have an in-cluster K8S client
+	// Create the K8S client, in-cluster unless a kubeconfig is given.
 	if c.clientset == nil {
-		config, err := rest.InClusterConfig()
+		config, err := c.k8sConfig()
 		if err != nil {
-			c.UI.Error(fmt.Sprintf("Error loading in-cluster K8S config: %s", err))
+			c.UI.Error(err.Error())
 			return 1
 		}
 		c.clientset, err = kubernetes.NewForConfig(config)
@@ -282,6 +622,9 @@ func (c *Command) Run(args []string) int {
 	if cfg.TLSConfig.CAFile == "" && c.flagConsulCACert != "" {
 		cfg.TLSConfig.CAFile = c.flagConsulCACert
 	}
+	if c.flagTLSSkipVerify {
+		cfg.TLSConfig.InsecureSkipVerify = true
+	}
 	consulURLRaw := cfg.Address
 	// cfg.Address may or may not be prefixed with scheme.
 	if !strings.Contains(cfg.Address, "://") {
@@ -314,6 +657,35 @@ func (c *Command) Run(args []string) int {
 		}
 	}
 
+	// Reconcile the health checks once, e.g. from a Job, without serving
+	// the webhook.
+	if c.flagHealthChecksReconcileOnce {
+		healthResource := c.healthCheckResource(context.Background(), logger, consulURL, cfg, nil)
+		// There are no informers to follow the namespaces that match the
+		// selector so reconcile the ones that match it now.
+		if healthChecksNSSelector != nil {
+			nsList, err := c.clientset.CoreV1().Namespaces().List(context.Background(),
+				metav1.ListOptions{LabelSelector: healthChecksNSSelector.String()})
+			if err != nil {
+				c.UI.Error(fmt.Sprintf("Error listing namespaces: %s", err))
+				return 1
+			}
+			for _, ns := range nsList.Items {
+				healthResource.Namespaces = append(healthResource.Namespaces, ns.Name)
+			}
+			if len(healthResource.Namespaces) == 0 {
+				c.UI.Info("No namespaces match -health-check-namespace-selector")
+				return 0
+			}
+		}
+		if err := healthResource.Reconcile(); err != nil {
+			c.UI.Error(fmt.Sprintf("Error reconciling health checks: %s", err))
+			return 1
+		}
+		c.UI.Info("Reconciled health checks")
+		return 0
+	}
+
 	// Determine where to source the certificates from
 	var certSource cert.Source = &cert.GenSource{
 		Name:  "Connect Inject",
@@ -387,24 +759,94 @@ func (c *Command) Run(args []string) int {
 
 	// Start the health checks controller.
 	ctrlExitCh := make(chan error)
+	// ctrlDoneCh is closed once the health checks controller, if enabled,
+	// has exited.
+	ctrlDoneCh := make(chan struct{})
 	if c.flagEnableHealthChecks {
-		healthResource := connectinject.HealthCheckResource{
-			Log:                 logger.Named("healthCheckResource"),
-			KubernetesClientset: c.clientset,
-			ConsulUrl:           consulURL,
-			Ctx:                 ctx,
-			ReconcilePeriod:     c.flagHealthChecksReconcilePeriod,
+		// Record events on pods when their health checks change status.
+		eventBroadcaster := record.NewBroadcaster()
+		defer eventBroadcaster.Shutdown()
+		eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: c.clientset.CoreV1().Events("")})
+
+		healthResource := c.healthCheckResource(ctx, logger, consulURL, cfg, healthChecksNSSelector)
+		healthResource.MetricsRegistry = prometheus.NewRegistry()
+		// Publish the depth, latency and retries of the controller's queue
+		// alongside the health check metrics.
+		controller.SetWorkqueueMetricsProvider(healthResource.MetricsRegistry)
+		healthResource.EventRecorder = eventBroadcaster.NewRecorder(scheme.Scheme,
+			corev1.EventSource{Component: "consul-connect-injector"})
+
+		// Serve the health check metrics and reports if configured.
+		if c.flagHealthChecksMetricsListen != "" {
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle("/metrics", promhttp.HandlerFor(healthResource.MetricsRegistry, promhttp.HandlerOpts{}))
+			metricsMux.Handle("/checks", healthResource.ChecksHandler())
+			metricsServer := &http.Server{
+				Addr:    c.flagHealthChecksMetricsListen,
+				Handler: metricsMux,
+			}
+			defer metricsServer.Close()
+			go func() {
+				c.UI.Info(fmt.Sprintf("Serving health check metrics on %q...", c.flagHealthChecksMetricsListen))
+				if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					c.UI.Error(fmt.Sprintf("Error listening for metrics: %s", err))
+					serverErrors <- err
+				}
+			}()
 		}
 
 		healthChecksCtrl := &controller.Controller{
-			Log:      logger.Named("healthCheckController"),
-			Resource: &healthResource,
+			Log:        logger.Named("healthCheckController"),
+			Resource:   healthResource,
+			Name:       "healthchecks",
+			BaseDelay:  c.flagHealthChecksRetryBaseDelay,
+			MaxDelay:   c.flagHealthChecksRetryMaxDelay,
+			MaxRetries: c.flagHealthChecksMaxRetries,
+			Workers:    c.flagHealthChecksWorkers,
+			// Count the pods that keep failing so that they can be alerted on.
+			RetryThreshold:  c.flagHealthChecksRetryThreshold,
+			MetricsRegistry: healthResource.MetricsRegistry,
+			// Bound how long a stuck agent can block a worker.
+			ItemTimeout: c.flagHealthChecksItemTimeout,
+			// Pods that are still queued on shutdown are processed so that
+			// their health checks are up to date when we exit.
+			ShutdownTimeout: c.flagHealthChecksShutdownTimeout,
+			// Resyncs don't change the pods' resource versions so they must
+			// not be skipped.
+			ProcessUnchangedUpdates: c.flagHealthChecksResyncPeriod > 0,
+		}
+
+		// Serve the health checks controller's probes if configured.
+		if c.flagHealthChecksProbeListen != "" {
+			probes := &healthChecksProbes{
+				ctrl: healthChecksCtrl,
+				standby: func() bool {
+					return c.flagEnableLeaderElection && atomic.LoadInt32(&c.leading) == 0
+				},
+			}
+			probeServer := &http.Server{
+				Addr:    c.flagHealthChecksProbeListen,
+				Handler: probes.handler(),
+			}
+			defer probeServer.Close()
+			go func() {
+				c.UI.Info(fmt.Sprintf("Serving health checks controller probes on %q...", c.flagHealthChecksProbeListen))
+				if err := probeServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					c.UI.Error(fmt.Sprintf("Error listening for probes: %s", err))
+					serverErrors <- err
+				}
+			}()
 		}
 
 		// Start the health check controller, reconcile is started at the same time
 		// and new events will queue in the informer.
 		go func() {
-			healthChecksCtrl.Run(ctx.Done())
+			defer close(ctrlDoneCh)
+			if c.flagEnableLeaderElection {
+				c.runWithLeaderElection(ctx, logger.Named("leaderElection"), healthChecksCtrl)
+			} else {
+				healthChecksCtrl.Run(ctx.Done())
+			}
 			// If ctl.Run() exits before ctx is cancelled, then our health checks
 			// controller isn't running. In that case we need to shutdown since
 			// this is unrecoverable.
@@ -412,12 +854,18 @@ func (c *Command) Run(args []string) int {
 				ctrlExitCh <- fmt.Errorf("health checks controller exited unexpectedly")
 			}
 		}()
+	} else {
+		close(ctrlDoneCh)
 	}
 
 	// Block until we get a signal or something errors.
 	select {
 	case sig := <-c.sigCh:
 		c.UI.Info(fmt.Sprintf("%s received, shutting down", sig))
+		// Stop the health checks controller and wait for it to finish
+		// processing the pods that are still queued.
+		cancelFunc()
+		<-ctrlDoneCh
 		if err := server.Close(); err != nil {
 			c.UI.Error(fmt.Sprintf("shutting down server: %v", err))
 			return 1
@@ -433,6 +881,146 @@ func (c *Command) Run(args []string) int {
 	}
 }
 
+// healthCheckResource returns the resource of the health checks controller
+// configured from the flags. nsSelector is the parsed
+// -health-check-namespace-selector.
+func (c *Command) healthCheckResource(ctx context.Context, logger hclog.Logger, consulURL *url.URL, cfg *api.Config, nsSelector labels.Selector) *connectinject.HealthCheckResource {
+	var readyConditions []corev1.PodConditionType
+	for _, condType := range c.flagHealthChecksReadyConditions {
+		readyConditions = append(readyConditions, corev1.PodConditionType(condType))
+	}
+	denyNamespaces := flags.ToSet(append([]string{metav1.NamespaceSystem, metav1.NamespacePublic},
+		c.flagHealthChecksDenyNamespaces...))
+	// The readiness source was validated by Run.
+	readinessContainer, _ := parseReadinessSource(c.flagHealthChecksReadinessSource)
+	return &connectinject.HealthCheckResource{
+		Log:                            logger.Named("healthCheckResource"),
+		KubernetesClientset:            c.clientset,
+		ConsulUrl:                      consulURL,
+		TLSConfig:                      cfg.TLSConfig,
+		Token:                          cfg.Token,
+		TokenFile:                      cfg.TokenFile,
+		NamespaceTokensDir:             c.flagHealthChecksNSTokensDir,
+		Ctx:                            ctx,
+		ReconcilePeriod:                c.flagHealthChecksReconcilePeriod,
+		ResyncPeriod:                   c.flagHealthChecksResyncPeriod,
+		OrphanSweepPeriod:              c.flagHealthChecksSweepPeriod,
+		HealthCheckLabel:               c.flagHealthChecksLabel,
+		HealthCheckIDPrefix:            c.flagHealthChecksIDPrefix,
+		Namespaces:                     c.flagHealthChecksNamespaces,
+		NamespaceSelector:              nsSelector,
+		NodeName:                       c.flagHealthChecksNodeName,
+		Agentless:                      c.flagHealthChecksAgentless,
+		AllowK8sNamespacesSet:          flags.ToSet(c.flagHealthChecksAllowNamespaces),
+		DenyK8sNamespacesSet:           denyNamespaces,
+		ReadyConditions:                readyConditions,
+		ReadinessContainer:             readinessContainer,
+		EnvoyReadyProbe:                c.flagHealthChecksEnvoyReady,
+		EnvoyReadyTimeout:              c.flagHealthChecksEnvoyTimeout,
+		TTL:                            c.flagHealthChecksTTL,
+		DeregisterCriticalServiceAfter: c.flagHealthChecksDeregisterAfter,
+		SuccessBeforePassing:           c.flagHealthChecksSuccessBefore,
+		FailuresBeforeCritical:         c.flagHealthChecksFailuresBefore,
+		MaxReasonLength:                c.flagHealthChecksMaxReasonLength,
+		ConnectionRetries:              c.flagHealthChecksConnRetries,
+		ConnectionRetryDelay:           c.flagHealthChecksConnRetryDelay,
+		AgentFailureThreshold:          c.flagHealthChecksAgentFailures,
+		AgentFailureCooldown:           c.flagHealthChecksAgentCooldown,
+		RateLimitBackoff:               c.flagHealthChecksRateBackoff,
+		ErrorLogWindow:                 c.flagHealthChecksErrorLogWindow,
+		StatusBatchWindow:              c.flagHealthChecksBatchWindow,
+		EnableConsulNamespaces:         c.flagEnableNamespaces,
+		ConsulDestinationNamespace:     c.flagConsulDestinationNamespace,
+		EnableNSMirroring:              c.flagEnableK8SNSMirroring,
+		NSMirroringPrefix:              c.flagK8SNSMirroringPrefix,
+		AclConfig:                      crossNamespaceACLConfig(c.flagCrossNamespaceACLPolicy),
+		ManageStatusOnly:               c.flagHealthChecksStatusOnly,
+		CheckMissingRetries:            c.flagHealthChecksMaxRetries,
+		DryRun:                         c.flagHealthChecksDryRun,
+	}
+}
+
+// crossNamespaceACLConfig returns the ACL config of the Consul namespaces
+// created with policy as their default policy, if any.
+func crossNamespaceACLConfig(policy string) api.NamespaceACLConfig {
+	if policy == "" {
+		return api.NamespaceACLConfig{}
+	}
+	return api.NamespaceACLConfig{PolicyDefaults: []api.ACLLink{{Name: policy}}}
+}
+
+// k8sConfig returns the config of the Kubernetes client. Unless -in-cluster
+// is set, it's loaded from the -kubeconfig file or the default kubeconfig
+// path if they exist, e.g. to run the command out-of-cluster for debugging,
+// and falls back to the in-cluster config.
+func (c *Command) k8sConfig() (*rest.Config, error) {
+	if c.flagInCluster {
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("Error loading in-cluster K8S config: %s", err)
+		}
+		return config, nil
+	}
+	config, err := subcommand.K8SConfig(c.k8s.KubeConfig())
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving Kubernetes auth: %s", err)
+	}
+	return config, nil
+}
+
+// parseReadinessSource parses the -readiness-source flag and returns the
+// name of the container whose readiness the health checks reflect, or "" if
+// they reflect the pod's conditions.
+func parseReadinessSource(source string) (string, error) {
+	const containerPrefix = "container:"
+	switch {
+	case source == "pod":
+		return "", nil
+	case strings.HasPrefix(source, containerPrefix) && len(source) > len(containerPrefix):
+		return strings.TrimPrefix(source, containerPrefix), nil
+	default:
+		return "", fmt.Errorf("-readiness-source must be \"pod\" or \"container:<name>\", got %q", source)
+	}
+}
+
+// runWithLeaderElection runs ctrl only while this instance holds the leader
+// election Lease. It blocks until ctx is cancelled or leadership is lost.
+func (c *Command) runWithLeaderElection(ctx context.Context, logger hclog.Logger, ctrl *controller.Controller) {
+	identity, err := os.Hostname()
+	if err != nil {
+		logger.Error("unable to get hostname for leader election identity", "err", err)
+		return
+	}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      c.flagLeaderElectionLeaseName,
+			Namespace: c.flagLeaderElectionNamespace,
+		},
+		Client: c.clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				logger.Info("acquired leadership, starting health checks controller", "identity", identity)
+				atomic.StoreInt32(&c.leading, 1)
+				defer atomic.StoreInt32(&c.leading, 0)
+				ctrl.Run(leaderCtx.Done())
+			},
+			OnStoppedLeading: func() {
+				logger.Info("stopped leading", "identity", identity)
+			},
+		},
+	})
+}
+
 func (c *Command) interrupt() {
 	c.sendSignal(syscall.SIGINT)
 }
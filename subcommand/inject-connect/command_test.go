@@ -1,16 +1,28 @@
 package connectinject
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
 
+	connectinject "github.com/hashicorp/consul-k8s/connect-inject"
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/consul/sdk/freeport"
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
 	"github.com/mitchellh/cli"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
@@ -46,6 +58,147 @@ func TestRun_FlagValidation(t *testing.T) {
 				"-default-protocol", "http"},
 			expErr: "-default-protocol is no longer supported",
 		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-enable-leader-election"},
+			expErr: "-leader-election-namespace must be set when -enable-leader-election is true",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-enable-leader-election", "-leader-election-namespace", "default"},
+			expErr: "-enable-leader-election requires -enable-health-checks-controller",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-enable-health-checks-controller", "-enable-leader-election", "-leader-election-namespace", "default",
+				"-node-name", "node-1"},
+			expErr: "-node-name can't be used with -enable-leader-election",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-ttl", "forever"},
+			expErr: "-health-check-ttl is invalid: time: invalid duration",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-orphan-sweep-period", "-1s"},
+			expErr: "-health-check-orphan-sweep-period must not be negative",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-retry-base-delay", "-1s"},
+			expErr: "-health-check-retry-base-delay must not be negative",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-retry-base-delay", "10s", "-health-check-retry-max-delay", "1s"},
+			expErr: "-health-check-retry-max-delay must not be less than -health-check-retry-base-delay",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-max-retries", "-1"},
+			expErr: "-health-check-max-retries must not be negative",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-workers", "0"},
+			expErr: "-health-check-workers must be at least 1",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-namespace-selector", "team=a", "-health-check-namespace", "default"},
+			expErr: "-health-check-namespace-selector can't be used with -health-check-namespace",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-namespace-selector", "team in ("},
+			expErr: "-health-check-namespace-selector is invalid",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-checks-reconcile-once"},
+			expErr: "-health-checks-reconcile-once requires -enable-health-checks-controller",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-connection-retries", "-1"},
+			expErr: "-health-check-connection-retries must not be negative",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-connection-retry-delay", "-1s"},
+			expErr: "-health-check-connection-retry-delay must not be negative",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-agent-failure-threshold", "-1"},
+			expErr: "-health-check-agent-failure-threshold must not be negative",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-agent-failure-cooldown", "-1s"},
+			expErr: "-health-check-agent-failure-cooldown must not be negative",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-rate-limit-backoff", "-1s"},
+			expErr: "-health-check-rate-limit-backoff must not be negative",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-retry-alert-threshold", "-1"},
+			expErr: "-health-check-retry-alert-threshold must not be negative",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-error-log-window", "-1s"},
+			expErr: "-health-check-error-log-window must not be negative",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-status-batch-window", "-1s"},
+			expErr: "-health-check-status-batch-window must not be negative",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-envoy-ready-timeout", "-1s"},
+			expErr: "-health-check-envoy-ready-timeout must not be negative",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-in-cluster", "-kubeconfig", "/tmp/kubeconfig"},
+			expErr: "-in-cluster and -kubeconfig can't both be set",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-readiness-source", "container"},
+			expErr: "-readiness-source must be \"pod\" or \"container:<name>\", got \"container\"",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-readiness-source", "container:"},
+			expErr: "-readiness-source must be \"pod\" or \"container:<name>\", got \"container:\"",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-success-before-passing", "0"},
+			expErr: "-health-check-success-before-passing must be at least 1",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-failures-before-critical", "0"},
+			expErr: "-health-check-failures-before-critical must be at least 1",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-max-reason-length", "0"},
+			expErr: "-health-check-max-reason-length must be at least 1",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-health-check-deregister-critical-service-after", "soon"},
+			expErr: "-health-check-deregister-critical-service-after is invalid: time: invalid duration",
+		},
 		{
 			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
 				"-ca-file", "bar"},
@@ -170,6 +323,61 @@ func TestRun_FlagValidation(t *testing.T) {
 	}
 }
 
+// Test that the Kubernetes client is pointed at the server of the
+// -kubeconfig file and that -in-cluster ignores it.
+func TestRun_Kubeconfig(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"major": "1", "minor": "18", "gitVersion": "v1.18.6"}`)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	kubeconfig := filepath.Join(dir, "config")
+	require.NoError(t, ioutil.WriteFile(kubeconfig, []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: %s
+contexts:
+- name: test
+  context:
+    cluster: test
+current-context: test
+`, server.URL)), 0600))
+
+	cmd := Command{}
+	cmd.init()
+	require.NoError(t, cmd.flagSet.Parse([]string{"-kubeconfig", kubeconfig}))
+	config, err := cmd.k8sConfig()
+	require.NoError(t, err)
+	require.Equal(t, server.URL, config.Host)
+
+	clientset, err := kubernetes.NewForConfig(config)
+	require.NoError(t, err)
+	version, err := clientset.Discovery().ServerVersion()
+	require.NoError(t, err)
+	require.Equal(t, "v1.18.6", version.GitVersion)
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// Outside of a cluster, -in-cluster fails rather than using the
+	// kubeconfig.
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return
+	}
+	cmd = Command{}
+	cmd.init()
+	require.NoError(t, cmd.flagSet.Parse([]string{"-in-cluster"}))
+	_, err = cmd.k8sConfig()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Error loading in-cluster K8S config")
+}
+
 func TestRun_ResourceLimitDefaults(t *testing.T) {
 	cmd := Command{}
 	cmd.init()
@@ -280,6 +488,167 @@ func testSignalHandling(sig os.Signal) func(*testing.T) {
 	}
 }
 
+// Test that the health check metrics are served when a metrics listener is configured.
+func TestRun_ServesHealthCheckMetrics(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+	ui := cli.NewMockUi()
+	cmd := Command{
+		UI:        ui,
+		clientset: k8sClient,
+	}
+	ports := freeport.MustTake(2)
+
+	// NOTE: This url doesn't matter because Consul is never called.
+	os.Setenv(api.HTTPAddrEnvName, "http://0.0.0.0:9999")
+	defer os.Unsetenv(api.HTTPAddrEnvName)
+
+	exitChan := runCommandAsynchronously(&cmd, []string{
+		"-consul-k8s-image", "hashicorp/consul-k8s", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+		"-enable-health-checks-controller=true",
+		"-listen", fmt.Sprintf(":%d", ports[0]),
+		"-health-check-metrics-listen", fmt.Sprintf("127.0.0.1:%d", ports[1]),
+	})
+	defer func() {
+		cmd.sendSignal(syscall.SIGINT)
+		<-exitChan
+	}()
+
+	retry.Run(t, func(r *retry.R) {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", ports[1]))
+		if err != nil {
+			r.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			r.Fatalf("unexpected status code %d", resp.StatusCode)
+		}
+	})
+}
+
+// Test that with leader election enabled the health checks controller
+// acquires the configured Lease.
+func TestRun_HealthChecksLeaderElection(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+	ui := cli.NewMockUi()
+	cmd := Command{
+		UI:        ui,
+		clientset: k8sClient,
+	}
+	ports := freeport.MustTake(1)
+
+	// NOTE: This url doesn't matter because Consul is never called.
+	os.Setenv(api.HTTPAddrEnvName, "http://0.0.0.0:9999")
+	defer os.Unsetenv(api.HTTPAddrEnvName)
+
+	exitChan := runCommandAsynchronously(&cmd, []string{
+		"-consul-k8s-image", "hashicorp/consul-k8s", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+		"-enable-health-checks-controller=true",
+		"-listen", fmt.Sprintf(":%d", ports[0]),
+		"-enable-leader-election",
+		"-leader-election-namespace", "default",
+		"-leader-election-lease-name", "test-lease",
+	})
+	defer func() {
+		cmd.sendSignal(syscall.SIGINT)
+		<-exitChan
+	}()
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	retry.Run(t, func(r *retry.R) {
+		lease, err := k8sClient.CoordinationV1().Leases("default").Get(context.Background(), "test-lease", metav1.GetOptions{})
+		if err != nil {
+			r.Fatal(err)
+		}
+		if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != hostname {
+			r.Fatalf("lease not held by %q", hostname)
+		}
+	})
+}
+
+// Test that with -health-checks-reconcile-once the health checks of the pods
+// are registered and the command exits.
+func TestRun_HealthChecksReconcileOnce(t *testing.T) {
+	consul, err := testutil.NewTestServerConfigT(t, nil)
+	require.NoError(t, err)
+	defer consul.Stop()
+	consul.WaitForLeader(t)
+	consulClient, err := api.NewClient(&api.Config{Address: consul.HTTPAddr})
+	require.NoError(t, err)
+	require.NoError(t, consulClient.Agent().ServiceRegister(&api.AgentServiceRegistration{
+		ID:   "pod1-web",
+		Name: "web",
+	}))
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod1",
+			Namespace: "default",
+			Labels:    map[string]string{"consul.hashicorp.com/connect-inject-status": "injected"},
+			Annotations: map[string]string{
+				"consul.hashicorp.com/connect-inject-status": "injected",
+				"consul.hashicorp.com/connect-service":       "web",
+			},
+		},
+		Status: corev1.PodStatus{
+			HostIP: "127.0.0.1",
+			Phase:  corev1.PodRunning,
+			InitContainerStatuses: []corev1.ContainerStatus{{
+				Name: connectinject.InjectInitContainerName,
+				State: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"},
+				},
+			}},
+			Conditions: []corev1.PodCondition{{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+
+	cases := map[string]struct {
+		consulAddr string
+		expCode    int
+	}{
+		"registers health checks": {
+			consulAddr: consul.HTTPAddr,
+			expCode:    0,
+		},
+		// Nothing listens on port 1 so reconciling the pod fails.
+		"consul unreachable": {
+			consulAddr: "127.0.0.1:1",
+			expCode:    1,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := Command{
+				UI:        ui,
+				clientset: fake.NewSimpleClientset(pod),
+			}
+			cmd.init()
+			code := cmd.Run([]string{
+				"-consul-k8s-image", "hashicorp/consul-k8s", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-http-addr", c.consulAddr,
+				"-enable-health-checks-controller",
+				"-health-checks-reconcile-once",
+			})
+			require.Equal(t, c.expCode, code, ui.ErrorWriter.String())
+			if c.expCode != 0 {
+				require.Contains(t, ui.ErrorWriter.String(), "Error reconciling health checks")
+				return
+			}
+
+			checks, err := consulClient.Agent().Checks()
+			require.NoError(t, err)
+			check, ok := checks["default/pod1-web/kubernetes-health-check"]
+			require.True(t, ok, "health check not registered")
+			require.Equal(t, api.HealthPassing, check.Status)
+		})
+	}
+}
+
 // This function starts the command asynchronously and returns a non-blocking chan.
 // When finished, the command will send its exit code to the channel.
 // Note that it's the responsibility of the caller to terminate the command by calling stopCommand,
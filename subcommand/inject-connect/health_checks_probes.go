@@ -0,0 +1,50 @@
+package connectinject
+
+import (
+	"net/http"
+
+	"github.com/hashicorp/consul-k8s/helper/controller"
+)
+
+// healthChecksProbes serves the readiness and liveness probes of the health
+// checks controller.
+type healthChecksProbes struct {
+	ctrl *controller.Controller
+
+	// standby returns true if the controller isn't expected to be running,
+	// e.g. because this replica isn't the leader. Standby replicas are always
+	// ready and live so that they can take over. It may be nil.
+	standby func() bool
+}
+
+// handler returns the handler serving /health/ready and /health/live.
+func (p *healthChecksProbes) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health/ready", p.handleReady)
+	mux.HandleFunc("/health/live", p.handleLive)
+	return mux
+}
+
+// handleReady responds with 200 once the controller's informers have synced.
+func (p *healthChecksProbes) handleReady(rw http.ResponseWriter, _ *http.Request) {
+	if p.isStandby() || p.ctrl.HasSynced() {
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+	rw.WriteHeader(http.StatusServiceUnavailable)
+}
+
+// handleLive responds with 200 while the controller is running, whether or
+// not its informers have synced: a controller waiting for the API server
+// isn't helped by being restarted.
+func (p *healthChecksProbes) handleLive(rw http.ResponseWriter, _ *http.Request) {
+	if p.isStandby() || p.ctrl.Alive() {
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+	rw.WriteHeader(http.StatusServiceUnavailable)
+}
+
+func (p *healthChecksProbes) isStandby() bool {
+	return p.standby != nil && p.standby()
+}
@@ -0,0 +1,96 @@
+package connectinject
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/helper/controller"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Test that the ready probe fails until the controller has synced and that
+// the live probe succeeds as soon as it runs, including before it has synced.
+func TestHealthChecksProbes(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	// The informer can't sync until listCh is closed.
+	listCh := make(chan struct{})
+	client := fake.NewSimpleClientset()
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				<-listCh
+				return client.CoreV1().Pods(metav1.NamespaceAll).List(context.Background(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.CoreV1().Pods(metav1.NamespaceAll).Watch(context.Background(), options)
+			},
+		},
+		&corev1.Pod{},
+		0,
+		cache.Indexers{},
+	)
+	noop := func(string, interface{}) error { return nil }
+	ctrl := &controller.Controller{
+		Log:      hclog.Default(),
+		Resource: controller.NewResource(informer, noop, noop),
+	}
+	probes := &healthChecksProbes{ctrl: ctrl}
+	handler := probes.handler()
+
+	// Before the controller has started, the probes fail.
+	require.Equal(http.StatusServiceUnavailable, probeStatus(handler, "/health/ready"))
+	require.Equal(http.StatusServiceUnavailable, probeStatus(handler, "/health/live"))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go ctrl.Run(stopCh)
+
+	// The controller is live while it waits for the informer to sync.
+	retry.Run(t, func(r *retry.R) {
+		if status := probeStatus(handler, "/health/live"); status != http.StatusOK {
+			r.Errorf("live probe returned %d", status)
+		}
+	})
+	require.False(ctrl.HasSynced())
+	require.Equal(http.StatusServiceUnavailable, probeStatus(handler, "/health/ready"))
+
+	close(listCh)
+	retry.Run(t, func(r *retry.R) {
+		if status := probeStatus(handler, "/health/ready"); status != http.StatusOK {
+			r.Errorf("ready probe returned %d", status)
+		}
+		if status := probeStatus(handler, "/health/live"); status != http.StatusOK {
+			r.Errorf("live probe returned %d", status)
+		}
+	})
+}
+
+// Test that standby replicas are always ready and live.
+func TestHealthChecksProbes_Standby(t *testing.T) {
+	t.Parallel()
+	probes := &healthChecksProbes{
+		ctrl:    &controller.Controller{},
+		standby: func() bool { return true },
+	}
+	handler := probes.handler()
+	require.Equal(t, http.StatusOK, probeStatus(handler, "/health/ready"))
+	require.Equal(t, http.StatusOK, probeStatus(handler, "/health/live"))
+}
+
+func probeStatus(handler http.Handler, path string) int {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	return rec.Code
+}
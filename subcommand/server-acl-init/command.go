@@ -277,7 +277,7 @@ func (c *Command) Run(args []string) int {
 	defer cancel()
 
 	var err error
-	c.log, err = common.Logger(c.flagLogLevel)
+	c.log, err = common.Logger(c.flagLogLevel, false)
 	if err != nil {
 		c.UI.Error(err.Error())
 		return 1
@@ -200,7 +200,7 @@ func (c *Command) Run(args []string) int {
 	// Set up logging
 	if c.logger == nil {
 		var err error
-		c.logger, err = common.Logger(c.flagLogLevel)
+		c.logger, err = common.Logger(c.flagLogLevel, false)
 		if err != nil {
 			c.UI.Error(err.Error())
 			return 1